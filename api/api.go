@@ -0,0 +1,123 @@
+// Package api describes the JSON API served under /api/v1. It has the types
+// the server and its clients exchange, the OpenAPI document for them, and a
+// client.
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Spec is the OpenAPI 3 document for the API.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// PREFIX is the path the API is served under.
+const PREFIX = "/api/v1"
+
+// Prices are decimal strings in the currency's major unit, e.g. "3.49".
+
+type Item struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Price       string `json:"price"`
+	Currency    string `json:"currency"`
+	Category    string `json:"category"`
+	TimesBought int    `json:"timesBought"`
+}
+
+type Metadata struct {
+	CurrentPage  int `json:"currentPage"`
+	PageSize     int `json:"pageSize"`
+	FirstPage    int `json:"firstPage"`
+	LastPage     int `json:"lastPage"`
+	TotalRecords int `json:"totalRecords"`
+}
+
+type ItemPage struct {
+	Items    []Item   `json:"items"`
+	Metadata Metadata `json:"metadata"`
+}
+
+type BasketItem struct {
+	BasketID  int64  `json:"basketId"`
+	Purchased bool   `json:"purchased"`
+	Quantity  int    `json:"quantity"`
+	Unit      string `json:"unit"`
+	Store     string `json:"store"`
+	Note      string `json:"note"`
+	Item      Item   `json:"item"`
+}
+
+type Basket struct {
+	Items    []BasketItem `json:"items"`
+	Total    string       `json:"total"`
+	Currency string       `json:"currency"`
+}
+
+type List struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type CreateItem struct {
+	Name     string  `json:"name"`
+	Price    *string `json:"price,omitempty"`
+	Category string  `json:"category,omitempty"`
+}
+
+// UpdateItem changes the item's name and price. Fields that are left empty are
+// not changed.
+type UpdateItem struct {
+	Name  string  `json:"name,omitempty"`
+	Price *string `json:"price,omitempty"`
+}
+
+// AddToBasket adds an existing item by ItemID, or an item by Name, which is
+// created first if there is not one with that name. Quantity defaults to 1.
+type AddToBasket struct {
+	ItemID   int64   `json:"itemId,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Price    *string `json:"price,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Quantity *int    `json:"quantity,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+	Store    string  `json:"store,omitempty"`
+	Note     string  `json:"note,omitempty"`
+}
+
+// UpdateBasketItem checks or unchecks the item and changes its quantity.
+// Fields that are left out are not changed.
+type UpdateBasketItem struct {
+	Purchased *bool   `json:"purchased,omitempty"`
+	Quantity  *int    `json:"quantity,omitempty"`
+	Unit      *string `json:"unit,omitempty"`
+}
+
+// Error is the body of every error response. Fields has the validation error
+// for each field that failed.
+type Error struct {
+	Status  int               `json:"-"`
+	Message string            `json:"error"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	fields := make([]string, 0, len(e.Fields))
+	for field, err := range e.Fields {
+		fields = append(fields, field+": "+err)
+	}
+	if len(fields) == 0 {
+		return fmt.Sprintf("%d %s", e.Status, msg)
+	}
+	slices.Sort(fields)
+	return fmt.Sprintf("%d %s: %s", e.Status, msg, strings.Join(fields, ", "))
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client calls the API of the Trolly server at BaseURL, e.g.
+// https://trolly.example.com, with a personal access token.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Search is the query for SearchItems. Zero values use the server's defaults.
+type Search struct {
+	Search   string
+	OrderBy  string
+	Page     int
+	PageSize int
+}
+
+func (c *Client) SearchItems(ctx context.Context, search Search) (ItemPage, error) {
+	query := url.Values{}
+	if search.Search != "" {
+		query.Set("search", search.Search)
+	}
+	if search.OrderBy != "" {
+		query.Set("orderBy", search.OrderBy)
+	}
+	if search.Page != 0 {
+		query.Set("page", strconv.Itoa(search.Page))
+	}
+	if search.PageSize != 0 {
+		query.Set("pageSize", strconv.Itoa(search.PageSize))
+	}
+	path := "/items"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var page ItemPage
+	err := c.do(ctx, http.MethodGet, path, nil, &page)
+	return page, err
+}
+
+func (c *Client) GetItem(ctx context.Context, id int64) (Item, error) {
+	var item Item
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/items/%d", id), nil, &item)
+	return item, err
+}
+
+func (c *Client) CreateItem(ctx context.Context, input CreateItem) (Item, error) {
+	var item Item
+	err := c.do(ctx, http.MethodPost, "/items", input, &item)
+	return item, err
+}
+
+func (c *Client) UpdateItem(ctx context.Context, id int64, input UpdateItem) (Item, error) {
+	var item Item
+	err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/items/%d", id), input, &item)
+	return item, err
+}
+
+func (c *Client) DeleteItem(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/items/%d", id), nil, nil)
+}
+
+func (c *Client) GetLists(ctx context.Context) ([]List, error) {
+	var lists []List
+	err := c.do(ctx, http.MethodGet, "/lists", nil, &lists)
+	return lists, err
+}
+
+func (c *Client) GetBasket(ctx context.Context, listId int64) (Basket, error) {
+	var basket Basket
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/lists/%d/basket", listId), nil, &basket)
+	return basket, err
+}
+
+func (c *Client) AddToBasket(ctx context.Context, listId int64, input AddToBasket) (BasketItem, error) {
+	var item BasketItem
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/lists/%d/basket", listId), input, &item)
+	return item, err
+}
+
+func (c *Client) UpdateBasketItem(ctx context.Context, listId int64, basketId int64, input UpdateBasketItem) (BasketItem, error) {
+	var item BasketItem
+	err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/lists/%d/basket/%d", listId, basketId), input, &item)
+	return item, err
+}
+
+func (c *Client) RemoveFromBasket(ctx context.Context, listId int64, basketId int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/lists/%d/basket/%d", listId, basketId), nil, nil)
+}
+
+func (c *Client) ClearBasket(ctx context.Context, listId int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/lists/%d/basket", listId), nil, nil)
+}
+
+// do sends body as JSON to the API path and decodes the response into dst,
+// unless dst is nil. Error responses are returned as an *Error.
+func (c *Client) do(ctx context.Context, method string, path string, body any, dst any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+PREFIX+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		apiErr := &Error{Status: res.StatusCode}
+		// The body is not JSON when the request never reached the API, so
+		// the status is all there is to go on.
+		json.NewDecoder(res.Body).Decode(apiErr)
+		return apiErr
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(dst)
+}
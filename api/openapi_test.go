@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type schema struct {
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+}
+
+func loadSpec(t *testing.T) (map[string]any, map[string]schema) {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		t.Fatalf("Spec is not JSON: %v", err)
+	}
+	var components struct {
+		Components struct {
+			Schemas map[string]schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(Spec, &components); err != nil {
+		t.Fatal(err)
+	}
+	return doc, components.Components.Schemas
+}
+
+func TestSpecRefs(t *testing.T) {
+	doc, _ := loadSpec(t)
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("openapi = %q, want 3.x", version)
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				var target any = doc
+				for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					m, _ := target.(map[string]any)
+					target = m[part]
+				}
+				if target == nil {
+					t.Errorf("%s does not exist", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+// TestSpecSchemas checks the schemas have the same fields as the types the
+// server and client use.
+func TestSpecSchemas(t *testing.T) {
+	_, schemas := loadSpec(t)
+	types := map[string]any{
+		"Item":             Item{},
+		"Metadata":         Metadata{},
+		"ItemPage":         ItemPage{},
+		"BasketItem":       BasketItem{},
+		"Basket":           Basket{},
+		"List":             List{},
+		"CreateItem":       CreateItem{},
+		"UpdateItem":       UpdateItem{},
+		"AddToBasket":      AddToBasket{},
+		"UpdateBasketItem": UpdateBasketItem{},
+		"Error":            Error{},
+	}
+	for name := range schemas {
+		if _, ok := types[name]; !ok {
+			t.Errorf("schema %s has no type", name)
+		}
+	}
+
+	for name, v := range types {
+		s, ok := schemas[name]
+		if !ok {
+			t.Errorf("type %s has no schema", name)
+			continue
+		}
+		typ := reflect.TypeOf(v)
+		var fields []string
+		for i := range typ.NumField() {
+			tag, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if tag == "-" {
+				continue
+			}
+			fields = append(fields, tag)
+			if _, ok := s.Properties[tag]; !ok {
+				t.Errorf("%s.%s is not in the schema", name, tag)
+			}
+			// Responses always have every field, and requests need the
+			// fields that are not omitted when empty.
+			required := slices.Contains(s.Required, tag)
+			if !strings.Contains(opts, "omitempty") && !required {
+				t.Errorf("%s.%s is always sent but the schema does not require it", name, tag)
+			}
+		}
+		for property := range s.Properties {
+			if !slices.Contains(fields, property) {
+				t.Errorf("%s schema has %s, which the type does not", name, property)
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hunterwilkins2/trolly/api"
+	"github.com/hunterwilkins2/trolly/internal/parser"
+)
+
+func (c *cli) lists(ctx context.Context) error {
+	lists, err := c.client.GetLists(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(lists)
+	}
+	w := c.table("ID", "NAME")
+	for _, list := range lists {
+		fmt.Fprintf(w, "%d\t%s\n", list.ID, list.Name)
+	}
+	return w.Flush()
+}
+
+func (c *cli) ls(ctx context.Context) error {
+	listId, err := c.listId(ctx)
+	if err != nil {
+		return err
+	}
+	basket, err := c.client.GetBasket(ctx, listId)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(basket)
+	}
+	if len(basket.Items) == 0 {
+		fmt.Fprintln(c.out, "The basket is empty")
+		return nil
+	}
+	w := c.table("ID", "", "QTY", "NAME", "PRICE", "STORE", "NOTE")
+	for _, item := range basket.Items {
+		check := "[ ]"
+		if item.Purchased {
+			check = "[x]"
+		}
+		quantity := strconv.Itoa(item.Quantity)
+		if item.Unit != "" {
+			quantity += " " + item.Unit
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", item.BasketID, check, quantity, item.Item.Name, item.Item.Price, item.Store, item.Note)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Total %s %s\n", basket.Total, basket.Currency)
+	return nil
+}
+
+// add parses each argument as one or more entries, the same as the add box on
+// the web, and adds them to the basket. Entries that cannot be added are
+// reported without stopping the rest.
+func (c *cli) add(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: trolly-cli add <entry>...")
+	}
+	listId, err := c.listId(ctx)
+	if err != nil {
+		return err
+	}
+
+	added := []api.BasketItem{}
+	var failed []string
+	lines := parser.ParseAll(strings.Join(args, "\n"), c.currency)
+	for _, line := range lines {
+		err := line.Err
+		if err == nil {
+			var item api.BasketItem
+			item, err = c.client.AddToBasket(ctx, listId, toAddToBasket(line.Entry))
+			if err == nil {
+				added = append(added, item)
+			}
+		}
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.Status >= 500 {
+			return err
+		} else if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", line.Text, err))
+		}
+	}
+
+	if c.json {
+		if err := c.printJSON(added); err != nil {
+			return err
+		}
+	} else {
+		for _, item := range added {
+			fmt.Fprintf(c.out, "Added %s (%d)\n", item.Item.Name, item.BasketID)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d items could not be added\n%s", len(failed), len(lines), strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+func toAddToBasket(entry parser.Entry) api.AddToBasket {
+	input := api.AddToBasket{
+		Name:     entry.Name,
+		Category: entry.Category,
+		Quantity: &entry.Quantity,
+		Unit:     entry.Measure(),
+		Store:    entry.Store,
+		Note:     entry.Note,
+	}
+	if !entry.Price.IsZero() {
+		price := entry.Price.Decimal()
+		input.Price = &price
+	}
+	return input
+}
+
+func (c *cli) setPurchased(ctx context.Context, args []string, purchased bool) error {
+	return c.eachItem(ctx, args, func(listId int64, basketId int64) (any, error) {
+		return c.client.UpdateBasketItem(ctx, listId, basketId, api.UpdateBasketItem{Purchased: &purchased})
+	})
+}
+
+func (c *cli) rm(ctx context.Context, args []string) error {
+	return c.eachItem(ctx, args, func(listId int64, basketId int64) (any, error) {
+		return nil, c.client.RemoveFromBasket(ctx, listId, basketId)
+	})
+}
+
+// eachItem calls fn for each basket item id in args, printing what it returns
+// as JSON, or the basket once they are all done.
+func (c *cli) eachItem(ctx context.Context, args []string, fn func(listId int64, basketId int64) (any, error)) error {
+	if len(args) == 0 {
+		return errors.New("no basket item ids given, they are shown by ls")
+	}
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a basket item id", arg)
+		}
+		ids = append(ids, id)
+	}
+	listId, err := c.listId(ctx)
+	if err != nil {
+		return err
+	}
+
+	var results []any
+	for _, id := range ids {
+		result, err := fn(listId, id)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", id, err)
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	if c.json {
+		if results == nil {
+			return nil
+		}
+		return c.printJSON(results)
+	}
+	return c.ls(ctx)
+}
+
+func (c *cli) clear(ctx context.Context) error {
+	listId, err := c.listId(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.client.ClearBasket(ctx, listId)
+	if err != nil || c.json {
+		return err
+	}
+	fmt.Fprintln(c.out, "Cleared the basket")
+	return nil
+}
+
+func (c *cli) pantry(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "search" {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("pantry", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var search api.Search
+	fs.StringVar(&search.OrderBy, "order", "", "timesBought, recentlyPurchased or recentlyAdded")
+	fs.IntVar(&search.Page, "page", 1, "Page of results")
+	fs.IntVar(&search.PageSize, "page-size", 20, "Results per page")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("usage: trolly-cli pantry [search] [-order by] [-page n] [-page-size n] [query]: %w", err)
+	}
+	search.Search = strings.Join(fs.Args(), " ")
+
+	page, err := c.client.SearchItems(ctx, search)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(page)
+	}
+	w := c.table("ID", "NAME", "PRICE", "CATEGORY", "BOUGHT")
+	for _, item := range page.Items {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", item.ID, item.Name, item.Price, item.Category, item.TimesBought)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Page %d of %d, %d items\n", page.Metadata.CurrentPage, max(page.Metadata.LastPage, 1), page.Metadata.TotalRecords)
+	return nil
+}
+
+// listId resolves the -list flag, which is either a list's id or its name.
+func (c *cli) listId(ctx context.Context) (int64, error) {
+	lists, err := c.client.GetLists(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if c.list == "" && len(lists) > 0 {
+		return lists[0].ID, nil
+	}
+	for _, list := range lists {
+		if strconv.FormatInt(list.ID, 10) == c.list || strings.EqualFold(list.Name, c.list) {
+			return list.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no list %q", c.list)
+}
+
+func (c *cli) table(columns ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	return w
+}
+
+func (c *cli) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,125 @@
+// Command trolly-cli manages grocery lists from the terminal through the
+// Trolly API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/hunterwilkins2/trolly/api"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+const usage = `usage: trolly-cli [flags] <command> [args]
+
+Commands:
+  lists                    show the lists
+  ls                       show the basket
+  add <entry>...           add items to the basket, e.g. "2x milk 1gal $3.49 @costco"
+  check <id>...            check items off
+  uncheck <id>...          uncheck items
+  rm <id>...               remove items from the basket
+  clear                    remove every item from the basket
+  pantry [search] [query]  search the pantry
+
+The server and token default to $TROLLY_SERVER and $TROLLY_TOKEN. Tokens are
+created on the server's Account page. Prices are read in the currency set by
+-currency or $TROLLY_CURRENCY, which should match the server's.
+
+Flags:
+`
+
+const DEFAULT_SERVER = "http://localhost:4000"
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "trolly-cli:", err)
+		os.Exit(1)
+	}
+}
+
+// cli is the client and output settings a command runs with.
+type cli struct {
+	client *api.Client
+	out    io.Writer
+	json   bool
+	// list is the id or name of the list to use. The first list is used
+	// when it is empty.
+	list string
+	// currency is what prices given to add are in.
+	currency money.Currency
+}
+
+// run parses the flags in args and runs the command that follows them.
+func run(ctx context.Context, args []string, getenv func(string) string, out io.Writer, errOut io.Writer) error {
+	server := getenv("TROLLY_SERVER")
+	if server == "" {
+		server = DEFAULT_SERVER
+	}
+
+	c := &cli{out: out}
+	fs := flag.NewFlagSet("trolly-cli", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.Usage = func() {
+		fmt.Fprint(errOut, usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&server, "server", server, "URL of the Trolly server")
+	token := fs.String("token", getenv("TROLLY_TOKEN"), "API token")
+	fs.StringVar(&c.list, "list", getenv("TROLLY_LIST"), "ID or name of the list, defaults to the first list")
+	fs.BoolVar(&c.json, "json", false, "Print JSON instead of text")
+	currency := fs.String("currency", getenv("TROLLY_CURRENCY"), "ISO 4217 code of the currency prices are in, defaults to "+string(money.DEFAULT_CURRENCY))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	if *token == "" {
+		return errors.New("no API token, set -token or $TROLLY_TOKEN")
+	}
+	c.currency = money.Currency(strings.ToUpper(*currency))
+	if c.currency == "" {
+		c.currency = money.DEFAULT_CURRENCY
+	}
+	if !c.currency.Valid() {
+		return fmt.Errorf("unknown currency %q", *currency)
+	}
+	c.client = api.NewClient(server, *token)
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "lists":
+		return c.lists(ctx)
+	case "ls":
+		return c.ls(ctx)
+	case "add":
+		return c.add(ctx, args)
+	case "check":
+		return c.setPurchased(ctx, args, true)
+	case "uncheck":
+		return c.setPurchased(ctx, args, false)
+	case "rm":
+		return c.rm(ctx, args)
+	case "clear":
+		return c.clear(ctx)
+	case "pantry":
+		return c.pantry(ctx, args)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
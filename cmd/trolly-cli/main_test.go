@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/api"
+)
+
+type request struct {
+	method string
+	path   string
+	body   map[string]any
+}
+
+// fakeServer answers the API with canned responses and records the requests
+// that change anything.
+func fakeServer(t *testing.T) (*httptest.Server, *[]request) {
+	t.Helper()
+	var requests []request
+	basket := api.Basket{
+		Items: []api.BasketItem{
+			{BasketID: 7, Item: api.Item{ID: 1, Name: "Milk", Price: "3.49"}, Quantity: 2, Unit: "gal"},
+			{BasketID: 8, Item: api.Item{ID: 2, Name: "Eggs", Price: "4.00"}, Quantity: 1, Purchased: true},
+		},
+		Total:    "10.98",
+		Currency: "USD",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer trolly_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(api.Error{Message: "invalid token"})
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, api.PREFIX)
+		if r.Method != http.MethodGet {
+			req := request{method: r.Method, path: path}
+			if b, _ := io.ReadAll(r.Body); len(b) > 0 {
+				if err := json.Unmarshal(b, &req.body); err != nil {
+					t.Errorf("%s %s body is not JSON: %v", r.Method, path, err)
+				}
+			}
+			requests = append(requests, req)
+		}
+
+		var v any
+		switch {
+		case path == "/lists":
+			v = []api.List{{ID: 3, Name: "Groceries"}, {ID: 4, Name: "Hardware"}}
+		case r.Method == http.MethodGet && path == "/lists/3/basket":
+			v = basket
+		case r.Method == http.MethodPost && path == "/lists/3/basket":
+			v = api.BasketItem{BasketID: 9, Item: api.Item{Name: req(requests).body["name"].(string)}}
+		case r.Method == http.MethodPatch:
+			v = basket.Items[0]
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case path == "/items":
+			v = api.ItemPage{Items: []api.Item{{ID: 1, Name: "Milk", Price: "3.49", TimesBought: 5}}, Metadata: api.Metadata{CurrentPage: 1, LastPage: 1, TotalRecords: 1}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(api.Error{Message: "not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func req(requests []request) request {
+	return requests[len(requests)-1]
+}
+
+func runCLI(t *testing.T, server string, args ...string) (string, error) {
+	t.Helper()
+	env := map[string]string{"TROLLY_SERVER": server, "TROLLY_TOKEN": "trolly_test"}
+	var out bytes.Buffer
+	err := run(context.Background(), args, func(key string) string { return env[key] }, &out, io.Discard)
+	return out.String(), err
+}
+
+func TestAdd(t *testing.T) {
+	ts, requests := fakeServer(t)
+
+	out, err := runCLI(t, ts.URL, "add", "2x milk 1gal $3.49 @costco", "eggs, bread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(*requests))
+	}
+	milk := (*requests)[0]
+	if milk.method != http.MethodPost || milk.path != "/lists/3/basket" {
+		t.Errorf("sent %s %s, want POST /lists/3/basket", milk.method, milk.path)
+	}
+	want := map[string]any{"name": "milk", "price": "3.49", "quantity": 2.0, "unit": "1gal", "store": "costco"}
+	for key, value := range want {
+		if milk.body[key] != value {
+			t.Errorf("body[%q] = %v, want %v", key, milk.body[key], value)
+		}
+	}
+	if (*requests)[2].body["name"] != "bread" {
+		t.Errorf("third item = %v, want bread", (*requests)[2].body)
+	}
+	if !strings.Contains(out, "Added milk") {
+		t.Errorf("output = %q, want it to say milk was added", out)
+	}
+
+	// The fake server only has a basket for the first list
+	out, err = runCLI(t, ts.URL, "-list", "hardware", "add", "nails")
+	if err == nil || !strings.Contains(err.Error(), "nails") {
+		t.Errorf("adding to a list the fake server does not have = %v, want nails to fail", err)
+	}
+	if out != "" {
+		t.Errorf("output = %q, want nothing added", out)
+	}
+	out, err = runCLI(t, ts.URL, "-json", "-list", "hardware", "add", "nails")
+	var added []api.BasketItem
+	if err == nil || json.Unmarshal([]byte(out), &added) != nil || added == nil || len(added) != 0 {
+		t.Errorf("add -json = %q, %v, want an empty array", out, err)
+	}
+}
+
+func TestBasket(t *testing.T) {
+	ts, requests := fakeServer(t)
+
+	out, err := runCLI(t, ts.URL, "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[ ]", "2 gal", "Milk", "[x]", "Eggs", "Total 10.98 USD"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ls output is missing %q:\n%s", want, out)
+		}
+	}
+
+	out, err = runCLI(t, ts.URL, "-json", "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var basket api.Basket
+	if err := json.Unmarshal([]byte(out), &basket); err != nil || len(basket.Items) != 2 {
+		t.Errorf("ls -json = %q, %v", out, err)
+	}
+
+	if _, err := runCLI(t, ts.URL, "-list", "Groceries", "check", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if r := req(*requests); r.method != http.MethodPatch || r.path != "/lists/3/basket/7" || r.body["purchased"] != true {
+		t.Errorf("check sent %+v, want purchased true for item 7", r)
+	}
+	if _, err := runCLI(t, ts.URL, "uncheck", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if r := req(*requests); r.body["purchased"] != false {
+		t.Errorf("uncheck sent %+v, want purchased false", r)
+	}
+	if _, err := runCLI(t, ts.URL, "rm", "7", "8"); err != nil {
+		t.Fatal(err)
+	}
+	if r := req(*requests); r.method != http.MethodDelete || r.path != "/lists/3/basket/8" {
+		t.Errorf("rm sent %s %s", r.method, r.path)
+	}
+	if _, err := runCLI(t, ts.URL, "clear"); err != nil {
+		t.Fatal(err)
+	}
+	if r := req(*requests); r.method != http.MethodDelete || r.path != "/lists/3/basket" {
+		t.Errorf("clear sent %s %s", r.method, r.path)
+	}
+}
+
+func TestPantry(t *testing.T) {
+	ts, _ := fakeServer(t)
+	out, err := runCLI(t, ts.URL, "pantry", "search", "-order", "recentlyAdded", "milk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Milk") || !strings.Contains(out, "Page 1 of 1, 1 items") {
+		t.Errorf("pantry output = %q", out)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	ts, _ := fakeServer(t)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"frobnicate"}, "unknown command"},
+		{[]string{"add"}, "usage"},
+		{[]string{"check", "milk"}, "not a basket item id"},
+		{[]string{"rm"}, "no basket item ids"},
+	}
+	for _, tt := range tests {
+		_, err := runCLI(t, ts.URL, tt.args...)
+		if tt.want == "" && !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("%v = %v, want help", tt.args, err)
+		} else if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%v = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+
+	var out bytes.Buffer
+	err := run(context.Background(), []string{"-server", ts.URL, "-token", "wrong", "ls"}, func(string) string { return "" }, &out, io.Discard)
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("ls with a bad token = %v, want unauthorized", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+func (app *application) AccountPage(w http.ResponseWriter, r *http.Request) {
+	app.renderAccount(w, r, pages.AccountView{})
+}
+
+// renderAccount renders the account page with what the view does not already
+// have.
+func (app *application) renderAccount(w http.ResponseWriter, r *http.Request, view pages.AccountView) {
+	view.Now = time.Now()
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	view.User = user
+	view.TwoFactorUnavailable = app.config.randomKey
+
+	view.TwoFactor, err = app.twoFactor.Enabled(r.Context(), user.ID)
+	if err == nil && view.TwoFactor {
+		view.RecoveryCodesLeft, err = app.twoFactor.RecoveryCodesLeft(r.Context(), user.ID)
+	}
+	if err != nil {
+		app.logger.Error("could not get two-factor authentication", "user", user.ID, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	view.Passkeys, err = app.passkeys.GetAll(r.Context(), user.ID)
+	if err != nil {
+		app.logger.Error("could not get passkeys", "user", user.ID, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	view.Tokens, err = app.tokens.GetAll(r.Context())
+	if err != nil {
+		app.logger.Error("could not get tokens", "user", user.ID, "error", err.Error())
+		if _, ok := r.Context().Value(components.FlashKey).(string); !ok {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get tokens"))
+		}
+	}
+	pages.Account(view).Render(r.Context(), w)
+}
+
+func (app *application) CreateToken(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	days, err := strconv.Atoi(r.FormValue("expires"))
+	if err != nil || days < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var expiresAt time.Time
+	if days > 0 {
+		expiresAt = time.Now().AddDate(0, 0, days)
+	}
+
+	token, plaintext, err := app.tokens.Create(r.Context(), name, models.TokenScope(r.FormValue("scope")), expiresAt)
+	if err != nil {
+		app.logger.Error("could not create token", "name", name, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			for _, fieldErr := range v.FieldErrors {
+				r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, fieldErr.Error()))
+				break
+			}
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not create token. Please try again."))
+		}
+		app.renderAccount(w, r, pages.AccountView{})
+		return
+	}
+	app.logger.Info("created token", "id", token.ID, "user", token.UserID, "scope", token.Scope)
+	app.renderAccount(w, r, pages.AccountView{NewToken: plaintext})
+}
+
+func (app *application) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = app.tokens.Revoke(r.Context(), id)
+	if err != nil {
+		app.logger.Error("could not revoke token", "id", id, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not revoke token. Please try again."))
+	} else {
+		app.logger.Info("revoked token", "id", id)
+	}
+	app.renderAccount(w, r, pages.AccountView{})
+}
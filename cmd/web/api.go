@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/hunterwilkins2/trolly/api"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+const MAX_PAGE_SIZE = 100
+const MAX_BODY_SIZE = 1 << 20
+
+// toAPIItem converts an item for the API, giving its price in currency if it
+// has none.
+func toAPIItem(item models.Item, currency money.Currency) api.Item {
+	if item.Price.Currency != "" {
+		currency = item.Price.Currency
+	}
+	return api.Item{
+		ID:          item.ID,
+		Name:        item.Name,
+		Price:       item.Price.Decimal(),
+		Currency:    string(currency),
+		Category:    item.Category,
+		TimesBought: item.TimesBought,
+	}
+}
+
+func toAPIBasketItem(item models.BasketItem, currency money.Currency) api.BasketItem {
+	return api.BasketItem{
+		BasketID:  item.BasketID,
+		Purchased: item.Purchased,
+		Quantity:  item.Quantity,
+		Unit:      item.Unit,
+		Store:     item.Store,
+		Note:      item.Note,
+		Item:      toAPIItem(item.Item, currency),
+	}
+}
+
+func toAPIBasket(basket models.Basket, currency money.Currency) api.Basket {
+	items := make([]api.BasketItem, 0, len(basket.Items))
+	for _, item := range basket.Items {
+		items = append(items, toAPIBasketItem(item, currency))
+	}
+	if basket.Total.Currency != "" {
+		currency = basket.Total.Currency
+	}
+	return api.Basket{
+		Items:    items,
+		Total:    basket.Total.Decimal(),
+		Currency: string(currency),
+	}
+}
+
+// APIAuthenticated is Authenticated for the JSON API, which also accepts API
+// tokens and responds with an error instead of redirecting to the login page.
+func (app *application) APIAuthenticated(role models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var status int
+			if r.Header.Get("Authorization") != "" {
+				r, status = app.authenticateToken(r, role)
+			} else {
+				r, status = app.authenticate(r, role)
+			}
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			if status != http.StatusOK {
+				app.writeError(w, status, http.StatusText(status))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIList resolves the :listId the request operates on.
+func (app *application) APIList(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listId, err := strconv.ParseInt(flow.Param(r.Context(), "listId"), 10, 64)
+		if err != nil {
+			app.writeError(w, http.StatusNotFound, models.ErrListNotFound.Error())
+			return
+		}
+		list, err := app.lists.Get(r.Context(), listId)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), components.ListKey, list.ID))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		app.logger.Error("could not encode response", "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func (app *application) writeError(w http.ResponseWriter, status int, msg string) {
+	app.writeJSON(w, status, api.Error{Message: msg})
+}
+
+// errorResponse responds to err from a service: validation failures with the
+// field that failed, missing records with not found, and anything else with an
+// internal server error.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var v *validator.Validator
+	switch {
+	case errors.As(err, &v):
+		fields := make(map[string]string, len(v.FieldErrors))
+		for field, fieldErr := range v.FieldErrors {
+			fields[field] = fieldErr.Error()
+		}
+		app.writeJSON(w, http.StatusUnprocessableEntity, api.Error{Message: "validation failed", Fields: fields})
+	case errors.Is(err, models.ErrItemNotFound), errors.Is(err, models.ErrBasketItemNotFound), errors.Is(err, models.ErrListNotFound):
+		app.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrBasketItemChanged):
+		app.writeError(w, http.StatusConflict, err.Error())
+	default:
+		app.logger.Error("api request failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+		app.writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+// readJSON decodes the request body into dst, responding with a bad request
+// and returning false if it cannot.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must only contain a single JSON value")
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("body must not be empty")
+		}
+		app.writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// parsePrice parses an optional price in currency, adding an error for field
+// to v if it is not a valid amount.
+func parsePrice(v *validator.Validator, field string, price *string, currency money.Currency) money.Amount {
+	if price == nil || strings.TrimSpace(*price) == "" {
+		return money.Amount{}
+	}
+	amount, err := money.Parse(strings.TrimSpace(*price), currency)
+	if err != nil {
+		v.AddError(field, err)
+	}
+	return amount
+}
+
+func pathID(r *http.Request, param string) (int64, bool) {
+	id, err := strconv.ParseInt(flow.Param(r.Context(), param), 10, 64)
+	return id, err == nil
+}
+
+func (app *application) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.Spec)
+}
+
+func (app *application) APISearchItems(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v := validator.New()
+	page, pageSize := 1, PAGE_SIZE
+	var err error
+	if s := query.Get("page"); s != "" {
+		page, err = strconv.Atoi(s)
+		v.Check(err != nil || page < 1, "page", "Page must be a positive number")
+	}
+	if s := query.Get("pageSize"); s != "" {
+		pageSize, err = strconv.Atoi(s)
+		v.Check(err != nil || pageSize < 1 || pageSize > MAX_PAGE_SIZE, "pageSize", fmt.Sprintf("Page size must be between 1 and %d", MAX_PAGE_SIZE))
+	}
+	if v.HasErrors() {
+		app.errorResponse(w, r, v)
+		return
+	}
+
+	metadata, items, err := app.items.Search(r.Context(), query.Get("search"), page, pageSize, query.Get("orderBy"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	res := api.ItemPage{
+		Items:    make([]api.Item, 0, len(items)),
+		Metadata: api.Metadata(metadata),
+	}
+	for _, item := range items {
+		res.Items = append(res.Items, toAPIItem(item, app.config.currency))
+	}
+	app.writeJSON(w, http.StatusOK, res)
+}
+
+func (app *application) APIGetItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.writeError(w, http.StatusNotFound, models.ErrItemNotFound.Error())
+		return
+	}
+	item, err := app.items.Get(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, toAPIItem(item, app.config.currency))
+}
+
+func (app *application) APICreateItem(w http.ResponseWriter, r *http.Request) {
+	var input api.CreateItem
+	if !app.readJSON(w, r, &input) {
+		return
+	}
+	v := validator.New()
+	price := parsePrice(v, "price", input.Price, app.config.currency)
+	if v.HasErrors() {
+		app.errorResponse(w, r, v)
+		return
+	}
+
+	item, err := app.items.Add(r.Context(), strings.TrimSpace(input.Name), price, strings.TrimSpace(input.Category))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.logger.Info("created item", "id", item.ID)
+	app.writeJSON(w, http.StatusCreated, toAPIItem(item, app.config.currency))
+}
+
+func (app *application) APIUpdateItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.writeError(w, http.StatusNotFound, models.ErrItemNotFound.Error())
+		return
+	}
+	var input api.UpdateItem
+	if !app.readJSON(w, r, &input) {
+		return
+	}
+	v := validator.New()
+	price := parsePrice(v, "price", input.Price, app.config.currency)
+	if v.HasErrors() {
+		app.errorResponse(w, r, v)
+		return
+	}
+
+	item, err := app.items.Update(r.Context(), id, strings.TrimSpace(input.Name), price)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, toAPIItem(item, app.config.currency))
+}
+
+func (app *application) APIDeleteItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.writeError(w, http.StatusNotFound, models.ErrItemNotFound.Error())
+		return
+	}
+	err := app.items.Remove(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.logger.Info("deleted item", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIGetLists returns the household's lists, creating the default list for
+// new users like the web pages do.
+func (app *application) APIGetLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := app.lists.GetAll(r.Context())
+	if err == nil && len(lists) == 0 {
+		var list models.List
+		list, err = app.lists.Default(r.Context())
+		lists = append(lists, list)
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	res := make([]api.List, 0, len(lists))
+	for _, list := range lists {
+		res = append(res, api.List(list))
+	}
+	app.writeJSON(w, http.StatusOK, res)
+}
+
+func (app *application) APIGetBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	basket, err := app.basket.GetItems(r.Context(), listId)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, toAPIBasket(basket, app.config.currency))
+}
+
+// APIAddToBasket adds an existing item to the basket by its id, or by name,
+// creating the item first if there is not one with that name.
+func (app *application) APIAddToBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	var input api.AddToBasket
+	if !app.readJSON(w, r, &input) {
+		return
+	}
+	v := validator.New()
+	price := parsePrice(v, "price", input.Price, app.config.currency)
+	v.Check(input.ItemID == 0 && strings.TrimSpace(input.Name) == "", "name", "Either an item id or a name must be provided")
+	v.Check(input.ItemID != 0 && input.Name != "", "name", "Only one of an item id or a name can be provided")
+	if v.HasErrors() {
+		app.errorResponse(w, r, v)
+		return
+	}
+	quantity := 1
+	if input.Quantity != nil {
+		quantity = *input.Quantity
+	}
+
+	var basketItem models.BasketItem
+	err := app.transactor.WithinTx(r.Context(), func(ctx context.Context) error {
+		var item models.Item
+		var err error
+		if input.ItemID != 0 {
+			item, err = app.items.Get(ctx, input.ItemID)
+		} else {
+			item, err = app.items.Add(ctx, strings.TrimSpace(input.Name), price, strings.TrimSpace(input.Category))
+		}
+		if err != nil {
+			return err
+		}
+		basketItem, err = app.basket.AddItem(ctx, listId, models.BasketItem{
+			Quantity: quantity,
+			Unit:     strings.TrimSpace(input.Unit),
+			Store:    strings.TrimSpace(input.Store),
+			Note:     strings.TrimSpace(input.Note),
+			Item:     item,
+		})
+		return err
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusCreated, toAPIBasketItem(basketItem, app.config.currency))
+}
+
+// APIUpdateBasketItem checks or unchecks the item and changes its quantity.
+// Fields that are left out are not changed.
+func (app *application) APIUpdateBasketItem(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.writeError(w, http.StatusNotFound, models.ErrBasketItemNotFound.Error())
+		return
+	}
+	var input api.UpdateBasketItem
+	if !app.readJSON(w, r, &input) {
+		return
+	}
+
+	var item models.BasketItem
+	err := app.transactor.WithinTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		item, err = app.basket.GetItem(ctx, listId, id)
+		if err != nil {
+			return err
+		}
+		if input.Quantity != nil || input.Unit != nil {
+			quantity, unit := item.Quantity, item.Unit
+			if input.Quantity != nil {
+				quantity = *input.Quantity
+			}
+			if input.Unit != nil {
+				unit = *input.Unit
+			}
+			item, err = app.basket.UpdateQuantity(ctx, listId, id, quantity, unit)
+			if err != nil {
+				return err
+			}
+		}
+		if input.Purchased != nil && *input.Purchased != item.Purchased {
+			item, err = app.basket.TogglePurchased(ctx, listId, id)
+		}
+		return err
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, toAPIBasketItem(item, app.config.currency))
+}
+
+func (app *application) APIRemoveFromBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.writeError(w, http.StatusNotFound, models.ErrBasketItemNotFound.Error())
+		return
+	}
+	err := app.basket.RemoveItem(r.Context(), listId, id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) APIClearBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	err := app.basket.RemoveAllItems(r.Context(), listId)
+	if err != nil && !errors.Is(err, models.ErrBasketItemNotFound) {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/api"
+)
+
+// api sends body as JSON and decodes the JSON response into dst, unless dst is
+// nil.
+func (ts *testServer) api(t *testing.T, method string, path string, body any, dst any) int {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ts.token)
+	}
+	res, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if dst != nil {
+		if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+			t.Fatalf("%s %s: could not decode response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func checkStatus(t *testing.T, what string, got int, want int) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("%s = %d, want %d", what, got, want)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	ts := newTestServer(t)
+	var apiErr api.Error
+	checkStatus(t, "unauthenticated GET /api/v1/items", ts.api(t, http.MethodGet, "/api/v1/items", nil, &apiErr), http.StatusUnauthorized)
+	if apiErr.Message == "" {
+		t.Errorf("unauthenticated error has no message")
+	}
+
+	ts.register(t, "Test", "test@example.com")
+	var lists []api.List
+	checkStatus(t, "GET /api/v1/lists", ts.api(t, http.MethodGet, "/api/v1/lists", nil, &lists), http.StatusOK)
+	if len(lists) != 1 {
+		t.Fatalf("got lists %+v, want the default list", lists)
+	}
+	basketPath := fmt.Sprintf("/api/v1/lists/%d/basket", lists[0].ID)
+
+	var milk api.Item
+	checkStatus(t, "create item", ts.api(t, http.MethodPost, "/api/v1/items", map[string]any{"name": "Milk", "price": "3.49", "category": "dairy"}, &milk), http.StatusCreated)
+	if milk.Name != "Milk" || milk.Price != "3.49" || milk.Currency != "USD" || milk.Category != "dairy" {
+		t.Errorf("created %+v", milk)
+	}
+	ts.api(t, http.MethodPost, "/api/v1/items", map[string]any{"name": "Eggs"}, nil)
+
+	apiErr = api.Error{}
+	checkStatus(t, "create invalid item", ts.api(t, http.MethodPost, "/api/v1/items", map[string]any{"name": "", "price": "1.234"}, &apiErr), http.StatusUnprocessableEntity)
+	if apiErr.Fields["price"] == "" {
+		t.Errorf("got %+v, want a price field error", apiErr)
+	}
+	checkStatus(t, "create item with unknown field", ts.api(t, http.MethodPost, "/api/v1/items", map[string]any{"nme": "Milk"}, nil), http.StatusBadRequest)
+
+	var page api.ItemPage
+	checkStatus(t, "search items", ts.api(t, http.MethodGet, "/api/v1/items?search=mil&orderBy=recentlyAdded", nil, &page), http.StatusOK)
+	if len(page.Items) != 1 || page.Items[0].ID != milk.ID || page.Metadata.TotalRecords != 1 {
+		t.Errorf("search for mil = %+v", page)
+	}
+	checkStatus(t, "page through items", ts.api(t, http.MethodGet, "/api/v1/items?pageSize=1&page=2", nil, &page), http.StatusOK)
+	if len(page.Items) != 1 || page.Metadata.CurrentPage != 2 || page.Metadata.LastPage != 2 || page.Metadata.TotalRecords != 2 {
+		t.Errorf("second page = %+v", page)
+	}
+	checkStatus(t, "page size too large", ts.api(t, http.MethodGet, "/api/v1/items?pageSize=1000", nil, nil), http.StatusUnprocessableEntity)
+
+	itemPath := fmt.Sprintf("/api/v1/items/%d", milk.ID)
+	checkStatus(t, "update item", ts.api(t, http.MethodPatch, itemPath, map[string]any{"price": "3.99"}, &milk), http.StatusOK)
+	if milk.Name != "Milk" || milk.Price != "3.99" {
+		t.Errorf("updated %+v", milk)
+	}
+
+	var added api.BasketItem
+	checkStatus(t, "add item by id", ts.api(t, http.MethodPost, basketPath, map[string]any{"itemId": milk.ID, "quantity": 2}, &added), http.StatusCreated)
+	if added.Item.ID != milk.ID || added.Quantity != 2 {
+		t.Errorf("added %+v", added)
+	}
+	var bread api.BasketItem
+	checkStatus(t, "add item by name", ts.api(t, http.MethodPost, basketPath, map[string]any{"name": "Bread", "price": "2.00", "store": "bakery"}, &bread), http.StatusCreated)
+	if bread.Item.Name != "Bread" || bread.Quantity != 1 || bread.Store != "bakery" {
+		t.Errorf("added %+v", bread)
+	}
+	checkStatus(t, "add item without a name", ts.api(t, http.MethodPost, basketPath, map[string]any{}, nil), http.StatusUnprocessableEntity)
+	checkStatus(t, "add missing item", ts.api(t, http.MethodPost, basketPath, map[string]any{"itemId": 9999}, nil), http.StatusNotFound)
+
+	var basket api.Basket
+	checkStatus(t, "get basket", ts.api(t, http.MethodGet, basketPath, nil, &basket), http.StatusOK)
+	if len(basket.Items) != 2 || basket.Total != "9.98" {
+		t.Errorf("basket = %+v", basket)
+	}
+
+	breadPath := fmt.Sprintf("%s/%d", basketPath, bread.BasketID)
+	var updated api.BasketItem
+	checkStatus(t, "purchase item", ts.api(t, http.MethodPatch, breadPath, map[string]any{"purchased": true, "quantity": 3}, &updated), http.StatusOK)
+	if !updated.Purchased || updated.Quantity != 3 {
+		t.Errorf("updated %+v", updated)
+	}
+	checkStatus(t, "purchase item again", ts.api(t, http.MethodPatch, breadPath, map[string]any{"purchased": true}, &updated), http.StatusOK)
+	if !updated.Purchased {
+		t.Errorf("purchasing twice unchecked the item")
+	}
+	apiErr = api.Error{}
+	checkStatus(t, "invalid quantity", ts.api(t, http.MethodPatch, breadPath, map[string]any{"quantity": 0}, &apiErr), http.StatusUnprocessableEntity)
+	if len(apiErr.Fields) == 0 {
+		t.Errorf("got %+v, want a field error", apiErr)
+	}
+
+	checkStatus(t, "remove item", ts.api(t, http.MethodDelete, breadPath, nil, nil), http.StatusNoContent)
+	checkStatus(t, "remove item again", ts.api(t, http.MethodDelete, breadPath, nil, nil), http.StatusNotFound)
+	checkStatus(t, "clear basket", ts.api(t, http.MethodDelete, basketPath, nil, nil), http.StatusNoContent)
+	checkStatus(t, "clear empty basket", ts.api(t, http.MethodDelete, basketPath, nil, nil), http.StatusNoContent)
+	checkStatus(t, "get basket of missing list", ts.api(t, http.MethodGet, "/api/v1/lists/9999/basket", nil, nil), http.StatusNotFound)
+
+	checkStatus(t, "delete item", ts.api(t, http.MethodDelete, itemPath, nil, nil), http.StatusNoContent)
+	checkStatus(t, "get deleted item", ts.api(t, http.MethodGet, itemPath, nil, nil), http.StatusNotFound)
+}
+
+func TestAPITokens(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	createToken := func(name string, scope string) (string, string) {
+		t.Helper()
+		account := ts.do(t, http.MethodPost, "/account/tokens", url.Values{"name": {name}, "scope": {scope}, "expires": {"30"}}).fragment(t, "account")
+		plaintext := find(t, account, `id="new-token"[^>]*>([^<]+)<`)
+		id := find(t, account, `id="token-([0-9]+)"[^>]*><td[^>]*>`+name+`<`)
+		return plaintext, id
+	}
+	readToken, _ := createToken("Reader", "read")
+	writeToken, writeId := createToken("Writer", "write")
+	contains(t, ts.get(t, "/account").fragment(t, "account"), "Reader", "Writer", "read", "write")
+
+	// Token clients have no session cookie
+	reader := &testServer{Server: ts.Server, client: &http.Client{}, token: readToken}
+	writer := &testServer{Server: ts.Server, client: &http.Client{}, token: writeToken}
+
+	checkStatus(t, "read with read token", reader.api(t, http.MethodGet, "/api/v1/items", nil, nil), http.StatusOK)
+	checkStatus(t, "write with read token", reader.api(t, http.MethodPost, "/api/v1/items", map[string]any{"name": "Milk"}, nil), http.StatusForbidden)
+	checkStatus(t, "write with write token", writer.api(t, http.MethodPost, "/api/v1/items", map[string]any{"name": "Milk"}, nil), http.StatusCreated)
+	bad := &testServer{Server: ts.Server, client: &http.Client{}, token: "trolly_not-a-token"}
+	checkStatus(t, "read with unknown token", bad.api(t, http.MethodGet, "/api/v1/items", nil, nil), http.StatusUnauthorized)
+
+	account := ts.get(t, "/account").fragment(t, "account")
+	if strings.Contains(account, `id="new-token"`) || strings.Contains(account, writeToken) {
+		t.Errorf("token is shown after it was created")
+	}
+	if row := (response{http.StatusOK, nil, account}).fragment(t, "token-"+writeId); strings.Contains(row, "Never") {
+		t.Errorf("used token with an expiry shows Never:\n%s", row)
+	}
+
+	ts.do(t, http.MethodDelete, "/account/tokens/"+writeId, nil)
+	checkStatus(t, "write with revoked token", writer.api(t, http.MethodPost, "/api/v1/items", map[string]any{"name": "Eggs"}, nil), http.StatusUnauthorized)
+}
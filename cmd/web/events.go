@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hunterwilkins2/trolly/components"
+)
+
+const (
+	eventWriteWait  = 10 * time.Second
+	eventPongWait   = 60 * time.Second
+	eventPingPeriod = (eventPongWait * 9) / 10
+)
+
+var eventUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// BasketEvents streams the list's basket events over a websocket so every open
+// grocery list can re-render when another device changes the basket.
+func (app *application) BasketEvents(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	conn, err := eventUpgrader.Upgrade(hijacker(w), r, nil)
+	if err != nil {
+		app.logger.Error("could not upgrade basket events connection", "list", listId, "error", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := app.broker.Subscribe(listId)
+	defer unsubscribe()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(eventPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(eventPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(eventPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-events:
+			conn.SetWriteDeadline(time.Now().Add(eventWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(eventWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// hijacker unwraps middleware response writers, such as the session manager's,
+// until it finds one that can be hijacked for a websocket upgrade.
+func hijacker(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		if _, ok := w.(http.Hijacker); ok {
+			return w
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = u.Unwrap()
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +12,8 @@ import (
 	"github.com/hunterwilkins2/trolly/components"
 	"github.com/hunterwilkins2/trolly/components/pages"
 	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/parser"
 	"github.com/hunterwilkins2/trolly/internal/service"
 	"github.com/hunterwilkins2/trolly/internal/validator"
 )
@@ -18,15 +21,41 @@ import (
 const PAGE_SIZE = 10
 const SUGGEST_SIZE = 5
 
+func (app *application) Home(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	http.Redirect(w, r, fmt.Sprintf("/lists/%d", listId), http.StatusSeeOther)
+}
+
 func (app *application) GroceryListPage(w http.ResponseWriter, r *http.Request) {
-	basket, err := app.basket.GetItems(r.Context())
+	listId := r.Context().Value(components.ListKey).(int64)
+	app.sessionManager.Put(r.Context(), "listId", listId)
+	app.renderGroceryList(w, r)
+}
+
+func (app *application) renderGroceryList(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	list := models.List{ID: listId}
+	lists, err := app.lists.GetAll(r.Context())
 	if err != nil {
-		app.logger.Error("could not get basket", "error", err.Error())
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get items"))
+		app.logger.Error("could not get lists", "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get lists"))
+	}
+	for _, l := range lists {
+		if l.ID == listId {
+			list = l
+		}
+	}
+
+	basket, err := app.basket.GetItems(r.Context(), listId)
+	if err != nil {
+		app.logger.Error("could not get basket", "list", listId, "error", err.Error())
+		if _, ok := r.Context().Value(components.FlashKey).(string); !ok {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get items"))
+		}
 	} else {
-		app.logger.Info("got basket", "basket", basket)
+		app.logger.Debug("got basket", "list", listId, "basket", basket)
 	}
-	pages.GroceryList(basket).Render(r.Context(), w)
+	pages.GroceryList(lists, list, basket).Render(r.Context(), w)
 }
 
 func (app *application) PantryPage(w http.ResponseWriter, r *http.Request) {
@@ -45,9 +74,28 @@ func (app *application) LoginPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) RegisterPage(w http.ResponseWriter, r *http.Request) {
+	if app.signupDisabled(w, r) {
+		return
+	}
 	pages.Register(nil, nil).Render(r.Context(), w)
 }
 
+// signupDisabled responds with the login page if new accounts cannot be made
+// with a password, and reports whether it did.
+func (app *application) signupDisabled(w http.ResponseWriter, r *http.Request) bool {
+	if !app.config.disableSignup {
+		return false
+	}
+	flash := "Signing up is turned off"
+	if app.oidc != nil {
+		flash = "New accounts are made by logging in with " + app.config.oidcName
+	}
+	r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+	w.WriteHeader(http.StatusForbidden)
+	pages.Login(nil, nil).Render(r.Context(), w)
+	return true
+}
+
 func (app *application) ValidateName(w http.ResponseWriter, r *http.Request) {
 	name := r.FormValue("name")
 	v := validator.New()
@@ -85,10 +133,22 @@ func (app *application) ValidatePassword(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) Register(w http.ResponseWriter, r *http.Request) {
+	if app.signupDisabled(w, r) {
+		return
+	}
 	name := r.FormValue("name")
 	email := r.FormValue("email")
 	password := r.FormValue("password")
-	user, err := app.users.Register(r.Context(), name, email, password)
+	var user *models.User
+	err := app.transactor.WithinTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		user, err = app.users.Register(ctx, name, email, password)
+		if err != nil {
+			return err
+		}
+		_, err = app.households.CreateFirst(ctx, user)
+		return err
+	})
 	if err != nil {
 		app.logger.Error("Failed to create user", "error", err.Error(), "name", name, "email", email)
 		var ee map[string]error
@@ -106,11 +166,17 @@ func (app *application) Register(w http.ResponseWriter, r *http.Request) {
 	}
 	app.logger.Info("created new user", "name", user.Name, "email", email)
 
-	app.sessionManager.RenewToken(r.Context())
-	app.sessionManager.Put(r.Context(), "userId", user.ID)
+	next, err := app.logIn(r, user)
+	if err != nil {
+		app.logger.Error("could not log new user in", "user", user.ID, "error", err.Error())
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 	app.sessionManager.Put(r.Context(), "userName", user.Name)
+	// A failed email is logged, and the user can ask for another
+	app.sendVerification(r, user)
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, next, http.StatusSeeOther)
 }
 
 func (app *application) Login(w http.ResponseWriter, r *http.Request) {
@@ -132,12 +198,16 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	next, err := app.logIn(r, user)
+	if err != nil {
+		app.logger.Error("could not log user in", "user", user.ID, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not log in. Please try again."))
+		pages.Login(map[string]string{"email": email}, nil).Render(r.Context(), w)
+		return
+	}
 	app.logger.Info("login from", "name", user.Name, "email", email)
 
-	app.sessionManager.RenewToken(r.Context())
-	app.sessionManager.Put(r.Context(), "userId", user.ID)
-
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, next, http.StatusSeeOther)
 }
 
 func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
@@ -166,14 +236,10 @@ func (app *application) Search(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) AddItem(w http.ResponseWriter, r *http.Request) {
-	itemReq := r.FormValue("item")
-	item, price := parseItem(itemReq)
-	app.logger.Debug("parsed item", "item", item, "price", price)
-	_, err := app.items.Add(r.Context(), item, price)
-	if err != nil {
-		app.logger.Error("unable to add item", "error", err.Error())
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not add item. Please try again."))
-	}
+	r = app.addEntries(r, r.FormValue("item"), func(ctx context.Context, entry parser.Entry) error {
+		_, err := app.items.Add(ctx, entry.Name, entry.Price, entry.Category)
+		return err
+	})
 	metadata, items, err := app.items.Search(r.Context(), "", 1, PAGE_SIZE, "recentlyAdded")
 	if err != nil {
 		app.logger.Error("unable to get items", "error", err.Error())
@@ -197,31 +263,6 @@ func (app *application) DeleteItem(w http.ResponseWriter, r *http.Request) {
 	app.logger.Info("deleted item", "id", itemId)
 }
 
-func parseItem(item string) (string, float32) {
-	var itemName []byte
-	var priceStart, priceEnd int
-	var price float32
-	for i := 0; i < len(item); i++ {
-		if item[i] == '$' {
-			i++
-			priceStart = i
-			for ; i < len(item) && item[i] != ' '; i++ {
-			}
-			priceEnd = i
-			continue
-		}
-		itemName = append(itemName, item[i])
-	}
-
-	if priceStart != priceEnd {
-		p, _ := strconv.ParseFloat(item[priceStart:priceEnd], 32)
-		if p > 0 {
-			price = float32(p)
-		}
-	}
-	return strings.TrimSpace(string(itemName)), price
-}
-
 func (app *application) EditItemPage(w http.ResponseWriter, r *http.Request) {
 	itemIdStr := r.URL.Query().Get("id")
 	itemId, err := strconv.ParseInt(itemIdStr, 10, 64)
@@ -247,8 +288,15 @@ func (app *application) EditItem(w http.ResponseWriter, r *http.Request) {
 	}
 	name := r.FormValue("name")
 	priceStr := r.FormValue("price")
-	price, _ := strconv.ParseFloat(priceStr, 32)
-	item, err := app.items.Update(r.Context(), itemId, name, float32(price))
+	var price money.Amount
+	if priceStr != "" {
+		price, err = money.Parse(priceStr, app.config.currency)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	item, err := app.items.Update(r.Context(), itemId, name, price)
 	if err != nil {
 		app.logger.Error("could not update item", "id", itemId, "error", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -258,6 +306,7 @@ func (app *application) EditItem(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) AddItemToBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
 	itemIdStr := flow.Param(r.Context(), "itemId")
 	itemId, err := strconv.ParseInt(itemIdStr, 10, 64)
 	if err != nil {
@@ -270,106 +319,164 @@ func (app *application) AddItemToBasket(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	_, err = app.basket.AddItem(r.Context(), item)
+	_, err = app.basket.AddItem(r.Context(), listId, models.BasketItem{Quantity: 1, Item: item})
 	if err != nil {
-		app.logger.Error("could not add item to basket", "it", itemId, "error", err.Error())
+		app.logger.Error("could not add item to basket", "it", itemId, "list", listId, "error", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	items, err := app.basket.GetItems(r.Context())
-	if err != nil {
-		app.logger.Error("could not get items", "error", err.Error)
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get items"))
-	}
-	pages.GroceryList(items).Render(r.Context(), w)
+	app.renderGroceryList(w, r)
 }
 
 func (app *application) CreateNewItemAndAddToBasket(w http.ResponseWriter, r *http.Request) {
-	itemReq := r.FormValue("item")
-	itemName, price := parseItem(itemReq)
-	app.logger.Debug("parsed item", "item", itemName, "price", price)
-
-	var items models.Basket
-	item, err := app.items.Add(r.Context(), itemName, price)
-	app.logger.Debug("created new item", "item", item)
-	if err != nil {
-		app.logger.Error("unable to add item", "error", err.Error())
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not add item. Please try again."))
-	} else {
-		_, err := app.basket.AddItem(r.Context(), item)
+	listId := r.Context().Value(components.ListKey).(int64)
+	r = app.addEntries(r, r.FormValue("item"), func(ctx context.Context, entry parser.Entry) error {
+		item, err := app.items.Add(ctx, entry.Name, entry.Price, entry.Category)
 		if err != nil {
-			app.logger.Error("unable to add item to basket", "error", err.Error())
-			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not add item to basket. Please try again."))
-		} else {
-			basket, err := app.basket.GetItems(r.Context())
+			return err
+		}
+		app.logger.Debug("created new item", "item", item)
+		_, err = app.basket.AddItem(ctx, listId, models.BasketItem{
+			Quantity: entry.Quantity,
+			Unit:     entry.Measure(),
+			Store:    entry.Store,
+			Note:     entry.Note,
+			Item:     item,
+		})
+		return err
+	})
+
+	app.renderGroceryList(w, r)
+}
+
+// addEntries parses each entry in input and calls add for it, all in a single
+// transaction. Entries that cannot be parsed or are invalid are reported on the
+// returned request without stopping the rest from being added.
+func (app *application) addEntries(r *http.Request, input string, add func(ctx context.Context, entry parser.Entry) error) *http.Request {
+	lines := parser.ParseAll(input, app.config.currency)
+	if len(lines) == 0 {
+		return r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Item name cannot be empty"))
+	}
+
+	var lineErrors []string
+	err := app.transactor.WithinTx(r.Context(), func(ctx context.Context) error {
+		lineErrors = nil
+		for _, line := range lines {
+			err := line.Err
+			if err == nil {
+				app.logger.Debug("parsed item", "entry", line.Entry)
+				err = add(ctx, line.Entry)
+			}
+
+			var parseErr *parser.Error
+			var v *validator.Validator
+			if errors.As(err, &v) {
+				for _, fieldErr := range v.FieldErrors {
+					err = fieldErr
+					break
+				}
+			} else if err != nil && !errors.As(err, &parseErr) {
+				return err
+			}
 			if err != nil {
-				app.logger.Error("could not get basket items", "error", err.Error())
-				r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not ge basket"))
+				app.logger.Info("could not add item", "item", line.Text, "error", err.Error())
+				lineErrors = append(lineErrors, fmt.Sprintf("%s: %v", line.Text, err))
 			}
-			items = basket
 		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("unable to add items", "error", err.Error())
+		return r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not add items. Please try again."))
 	}
 
-	pages.GroceryList(items).Render(r.Context(), w)
+	if len(lines) == 1 && len(lineErrors) == 1 {
+		return r.WithContext(context.WithValue(r.Context(), components.FlashKey, lineErrors[0]))
+	} else if len(lineErrors) > 0 {
+		ctx := context.WithValue(r.Context(), components.FlashKey, fmt.Sprintf("%d of %d items could not be added", len(lineErrors), len(lines)))
+		return r.WithContext(context.WithValue(ctx, components.LineErrorsKey, lineErrors))
+	}
+	return r
 }
 
 func (app *application) MarkPurchased(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
 	idStr := flow.Param(r.Context(), "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	item, err := app.basket.TogglePurchased(r.Context(), id)
-	if err != nil {
+	item, err := app.basket.TogglePurchased(r.Context(), listId, id)
+	if err == models.ErrBasketItemChanged {
+		// Another device toggled it first, so show the list as it is now
+		app.logger.Info("basket item changed while toggling", "id", id)
+		app.renderGroceryList(w, r)
+		return
+	} else if err != nil {
 		app.logger.Error("could not update basket item status", "error", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	app.logger.Info("updated item status", "item", item)
 
-	items, err := app.basket.GetItems(r.Context())
+	app.renderGroceryList(w, r)
+}
+
+func (app *application) UpdateBasketQuantity(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	idStr := flow.Param(r.Context(), "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		app.logger.Error("could not get items", "error", err.Error)
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get items"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
-	pages.GroceryList(items).Render(r.Context(), w)
+	quantity, _ := strconv.Atoi(r.FormValue("quantity"))
+	item, err := app.basket.UpdateQuantity(r.Context(), listId, id, quantity, r.FormValue("unit"))
+	if err != nil {
+		app.logger.Error("could not update basket item quantity", "id", id, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			for _, fieldErr := range v.FieldErrors {
+				r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, fieldErr.Error()))
+				break
+			}
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not update quantity. Please try again."))
+		}
+	} else {
+		app.logger.Info("updated item quantity", "item", item)
+	}
+
+	app.renderGroceryList(w, r)
 }
 
 func (app *application) RemoveItemFromBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
 	idStr := flow.Param(r.Context(), "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	err = app.basket.RemoveItem(r.Context(), id)
+	err = app.basket.RemoveItem(r.Context(), listId, id)
 	if err != nil {
 		app.logger.Error("could not remove item", "error", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	basket, err := app.basket.GetItems(r.Context())
-	if err != nil {
-		app.logger.Error("could not get basket", "error", err.Error())
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get basket"))
-	}
-	pages.GroceryList(basket).Render(r.Context(), w)
+	app.renderGroceryList(w, r)
 }
 
 func (app *application) RemoveAllItems(w http.ResponseWriter, r *http.Request) {
-	err := app.basket.RemoveAllItems(r.Context())
-	if err != nil {
+	listId := r.Context().Value(components.ListKey).(int64)
+	err := app.basket.RemoveAllItems(r.Context(), listId)
+	if err != nil && !errors.Is(err, models.ErrBasketItemNotFound) {
 		app.logger.Error("could not remove all items", "error", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	basket, err := app.basket.GetItems(r.Context())
-	if err != nil {
-		app.logger.Error("could not get basket", "error", err.Error())
-		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get basket"))
-	}
-	pages.GroceryList(basket).Render(r.Context(), w)
+	app.renderGroceryList(w, r)
 }
 
 func (app *application) Suggest(w http.ResponseWriter, r *http.Request) {
@@ -383,5 +490,75 @@ func (app *application) Suggest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	app.logger.Info("found suggestions", "query", query, "suggestions", items)
-	pages.BasketSearch(items).Render(r.Context(), w)
+	pages.BasketSearch(r.Context().Value(components.ListKey).(int64), items).Render(r.Context(), w)
+}
+
+func (app *application) ListsPage(w http.ResponseWriter, r *http.Request) {
+	lists, err := app.lists.GetAll(r.Context())
+	if err != nil {
+		app.logger.Error("could not get lists", "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get lists"))
+	}
+	pages.Lists(lists).Render(r.Context(), w)
+}
+
+func (app *application) CreateList(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	list, err := app.lists.Create(r.Context(), name)
+	if err != nil {
+		app.logger.Error("could not create list", "name", name, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, v.GetError("name").Error()))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not create list. Please try again."))
+		}
+	} else {
+		app.logger.Info("created list", "list", list)
+	}
+	app.ListsPage(w, r)
+}
+
+func (app *application) EditListPage(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	list, err := app.lists.Get(r.Context(), listId)
+	if err != nil {
+		app.logger.Error("could not get list", "id", listId, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	pages.EditList(list).Render(r.Context(), w)
+}
+
+func (app *application) RenameList(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	name := strings.TrimSpace(r.FormValue("name"))
+	list, err := app.lists.Rename(r.Context(), listId, name)
+	if err != nil {
+		app.logger.Error("could not rename list", "id", listId, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	pages.ListRow(list).Render(r.Context(), w)
+}
+
+func (app *application) DeleteList(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	err := app.lists.Remove(r.Context(), listId)
+	if err != nil {
+		app.logger.Error("could not delete list", "id", listId, "error", err.Error())
+		if err == service.ErrLastList {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "You need at least one list"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not delete list. Please try again."))
+		}
+	} else {
+		app.logger.Info("deleted list", "id", listId)
+	}
+	app.ListsPage(w, r)
 }
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/internal/mail"
+	"github.com/hunterwilkins2/trolly/internal/migrate"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/migrations"
+)
+
+// testServer serves the whole application from a temporary SQLite database to
+// a client that keeps its cookies, like a browser would.
+type testServer struct {
+	*httptest.Server
+	client *http.Client
+	// token is sent as a bearer token with API requests when it is set.
+	token string
+	// mail is every email the server has sent.
+	mail   *bytes.Buffer
+	config config
+}
+
+// newTestServer starts a test server, with the options applied to its config.
+func newTestServer(t *testing.T, options ...func(cfg *config)) *testServer {
+	t.Helper()
+	db, err := models.Open(models.SQLite, filepath.Join(t.TempDir(), "trolly.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent bytes.Buffer
+	cfg := config{
+		baseURL:   "http://trolly.test",
+		mailer:    mail.NewLogMailer(&sent, "Trolly <trolly@example.com>"),
+		secretKey: []byte("test key"),
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	app, err := newApplication(db, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(app.routes(false))
+	t.Cleanup(ts.Close)
+
+	return &testServer{Server: ts, client: newTestClient(t), mail: &sent, config: cfg}
+}
+
+// session returns the test server with a new client, so a separate session.
+func (ts *testServer) session(t *testing.T) *testServer {
+	t.Helper()
+	other := *ts
+	other.client = newTestClient(t)
+	return &other
+}
+
+// register signs up a user with the password pa55word and verifies their
+// email, leaving them logged in.
+func (ts *testServer) register(t *testing.T, name string, email string) {
+	t.Helper()
+	ts.do(t, http.MethodPost, "/register", url.Values{"name": {name}, "email": {email}, "password": {"pa55word"}}).redirectsTo(t, "/")
+	ts.get(t, ts.link(t, email, "/verify-email")).redirectsTo(t, "/")
+}
+
+// link returns the path of the last link to the page emailed to the address.
+func (ts *testServer) link(t *testing.T, to string, page string) string {
+	t.Helper()
+	messages := strings.Split(ts.mail.String(), "From: ")
+	for i := len(messages) - 1; i >= 0; i-- {
+		if !strings.Contains(messages[i], "\nTo: "+to+"\n") {
+			continue
+		}
+		pattern := regexp.QuoteMeta(ts.config.baseURL+page) + `(\?\S+)`
+		if match := regexp.MustCompile(pattern).FindStringSubmatch(messages[i]); match != nil {
+			return page + match[1]
+		}
+	}
+	t.Fatalf("no link to %s emailed to %s in:\n%s", page, to, ts.mail)
+	return ""
+}
+
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   string
+}
+
+func (ts *testServer) do(t *testing.T, method string, path string, form url.Values) response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	res, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response{res.StatusCode, res.Header, string(body)}
+}
+
+func (ts *testServer) get(t *testing.T, path string) response {
+	t.Helper()
+	return ts.do(t, http.MethodGet, path, nil)
+}
+
+// redirectsTo checks the response is a redirect to path.
+func (res response) redirectsTo(t *testing.T, path string) {
+	t.Helper()
+	if res.status != http.StatusSeeOther || res.header.Get("Location") != path {
+		t.Fatalf("got %d to %q, want a redirect to %s", res.status, res.header.Get("Location"), path)
+	}
+}
+
+// fragment returns the element with the id, which is what htmx swaps in with
+// hx-select.
+func (res response) fragment(t *testing.T, id string) string {
+	t.Helper()
+	if res.status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.status, http.StatusOK)
+	}
+	at := strings.Index(res.body, `id="`+id+`"`)
+	if at < 0 {
+		t.Fatalf("no #%s in page:\n%s", id, res.body)
+	}
+	start := strings.LastIndex(res.body[:at], "<")
+	tag := res.body[start+1 : start+1+strings.IndexAny(res.body[start+1:], " \t\n>")]
+
+	depth := 0
+	for i := start; i < len(res.body); i++ {
+		rest := res.body[i:]
+		if strings.HasPrefix(rest, "</"+tag+">") {
+			depth--
+			if depth == 0 {
+				return res.body[start : i+len(tag)+3]
+			}
+		} else if strings.HasPrefix(rest, "<"+tag) && strings.ContainsAny(rest[len(tag)+1:len(tag)+2], " \t\n>") {
+			depth++
+		}
+	}
+	t.Fatalf("#%s is not closed", id)
+	return ""
+}
+
+func contains(t *testing.T, html string, want ...string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(html, s) {
+			t.Errorf("missing %q in:\n%s", s, html)
+		}
+	}
+}
+
+// find returns the first capture of the pattern in html.
+func find(t *testing.T, html string, pattern string) string {
+	t.Helper()
+	match := regexp.MustCompile(pattern).FindStringSubmatch(html)
+	if match == nil {
+		t.Fatalf("no match for %s in:\n%s", pattern, html)
+	}
+	return match[1]
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t)
+	ts.get(t, "/").redirectsTo(t, "/login")
+	ts.get(t, "/pantry").redirectsTo(t, "/login")
+	contains(t, ts.get(t, "/login").body, `action="/login"`)
+
+	res := ts.do(t, http.MethodPost, "/register", url.Values{"name": {"Test"}, "email": {"not an email"}, "password": {"pa55word"}})
+	contains(t, res.body, "Must be a valid email")
+
+	form := url.Values{"name": {"Test"}, "email": {"test@example.com"}, "password": {"pa55word"}}
+	ts.do(t, http.MethodPost, "/register", form).redirectsTo(t, "/")
+	ts.get(t, "/").redirectsTo(t, "/verify-email")
+	ts.get(t, ts.link(t, "test@example.com", "/verify-email")).redirectsTo(t, "/")
+	home := ts.get(t, "/")
+	listPath := home.header.Get("Location")
+	if !regexp.MustCompile(`^/lists/[0-9]+$`).MatchString(listPath) {
+		t.Fatalf("/ redirects to %q, want a list", listPath)
+	}
+	contains(t, ts.get(t, listPath).fragment(t, "groceries"), "Add items to get started")
+
+	res = ts.do(t, http.MethodPost, "/logout", nil)
+	if res.header.Get("HX-Redirect") != "/login" {
+		t.Errorf("logout HX-Redirect = %q, want /login", res.header.Get("HX-Redirect"))
+	}
+	ts.get(t, listPath).redirectsTo(t, "/login")
+
+	res = ts.do(t, http.MethodPost, "/register", form)
+	contains(t, res.body, "User with that email already exists")
+	res = ts.do(t, http.MethodPost, "/login", url.Values{"email": {"test@example.com"}, "password": {"wrong password"}})
+	contains(t, res.body, "Email or password is incorrect")
+	ts.get(t, listPath).redirectsTo(t, "/login")
+
+	ts.do(t, http.MethodPost, "/login", url.Values{"email": {"TEST@example.com"}, "password": {"pa55word"}}).redirectsTo(t, "/")
+	ts.get(t, "/").redirectsTo(t, listPath)
+}
+
+func TestCurrency(t *testing.T) {
+	ts := newTestServer(t, func(cfg *config) { cfg.currency = money.EUR })
+	ts.register(t, "Test", "test@example.com")
+	listPath := ts.get(t, "/").header.Get("Location")
+
+	pantry := ts.do(t, http.MethodPost, "/items", url.Values{"item": {"Cheese €3.49\nBread $2"}}).fragment(t, "pantry")
+	contains(t, pantry, "Cheese", "€3.49", "Bread", "€2.00")
+	cheeseId := find(t, pantry, `href="/items/([0-9]+)"[^>]*>Cheese<`)
+	contains(t, ts.get(t, "/items/edit?id="+cheeseId).body, "€", `value="3.49"`)
+
+	groceries := ts.do(t, http.MethodPost, listPath+"/basket", url.Values{"item": {"2x Cheese"}}).fragment(t, "groceries")
+	contains(t, groceries, "€6.98", "Total €6.98")
+}
+
+func TestGroceries(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	listPath := ts.get(t, "/").header.Get("Location")
+
+	pantry := ts.do(t, http.MethodPost, "/items", url.Values{"item": {"Milk $3.49 #dairy\nEggs $2.50"}}).fragment(t, "pantry")
+	contains(t, pantry, "Milk", "$3.49", "Eggs", "$2.50")
+	milkId := find(t, pantry, `href="/items/([0-9]+)"[^>]*>Milk<`)
+	contains(t, ts.get(t, "/pantry").fragment(t, "pantry"), "Milk", "Eggs")
+
+	// A line that cannot be parsed is reported without losing the rest
+	groceries := ts.do(t, http.MethodPost, listPath+"/basket", url.Values{"item": {"2x Bread $2.00 @bakery\n3x"}}).fragment(t, "groceries")
+	contains(t, groceries, "1 of 2 items could not be added", "3x: item name cannot be empty", "Bread", "bakery", "$4.00")
+
+	groceries = ts.do(t, http.MethodPost, listPath+"/basket/"+milkId, nil).fragment(t, "groceries")
+	contains(t, groceries, "Milk", "Total $7.49")
+	basketId := find(t, groceries, `id="item-([0-9]+)"[^>]*><td[^>]*>Milk`)
+
+	row := func(groceries string) string {
+		return response{http.StatusOK, nil, groceries}.fragment(t, "item-"+basketId)
+	}
+	if strings.Contains(row(groceries), "line-through") {
+		t.Errorf("Milk is crossed off before being purchased")
+	}
+	groceries = ts.do(t, http.MethodPatch, listPath+"/basket/"+basketId, nil).fragment(t, "groceries")
+	if !strings.Contains(row(groceries), "line-through") {
+		t.Errorf("Milk is not crossed off once purchased:\n%s", row(groceries))
+	}
+	contains(t, groceries, "Finish trip")
+	groceries = ts.do(t, http.MethodPatch, listPath+"/basket/"+basketId, nil).fragment(t, "groceries")
+	if strings.Contains(row(groceries), "line-through") {
+		t.Errorf("Milk is still crossed off after being unchecked")
+	}
+
+	groceries = ts.do(t, http.MethodDelete, listPath+"/basket", nil).fragment(t, "groceries")
+	contains(t, groceries, "Add items to get started")
+	// Clearing a basket that is already empty still shows it
+	groceries = ts.do(t, http.MethodDelete, listPath+"/basket", nil).fragment(t, "groceries")
+	contains(t, groceries, "Add items to get started")
+
+	ts.do(t, http.MethodPost, "/logout", nil)
+	ts.do(t, http.MethodPatch, listPath+"/basket/"+basketId, nil).redirectsTo(t, "/login")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+func (app *application) HouseholdPage(w http.ResponseWriter, r *http.Request) {
+	app.renderHousehold(w, r)
+}
+
+func (app *application) renderHousehold(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	userId := r.Context().Value(components.UserKey).(uuid.UUID)
+	view := pages.HouseholdView{
+		UserID: userId,
+		Role:   models.Role(r.Context().Value(components.RoleKey).(string)),
+	}
+
+	user, err := app.users.GetUser(r.Context(), userId)
+	if err == nil {
+		view.Pending, err = app.households.PendingInvitations(r.Context(), user)
+	}
+	var householdErr, membersErr, membershipsErr, invitationsErr error
+	view.Household, householdErr = app.households.Get(r.Context(), householdId)
+	view.Members, membersErr = app.households.Members(r.Context(), householdId)
+	view.Memberships, membershipsErr = app.households.Memberships(r.Context())
+	if view.Role.Includes(models.RoleOwner) {
+		view.Invitations, invitationsErr = app.households.Invitations(r.Context(), householdId)
+	}
+	if err = errors.Join(err, householdErr, membersErr, membershipsErr, invitationsErr); err != nil {
+		app.logger.Error("could not get household", "id", householdId, "error", err.Error())
+		if _, ok := r.Context().Value(components.FlashKey).(string); !ok {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get household"))
+		}
+	}
+	pages.Household(view).Render(r.Context(), w)
+}
+
+func (app *application) SwitchHousehold(w http.ResponseWriter, r *http.Request) {
+	householdId, err := strconv.ParseInt(r.FormValue("household"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	member, err := app.households.Switch(r.Context(), householdId)
+	if err != nil {
+		app.logger.Error("could not switch household", "id", householdId, "error", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "householdId", member.HouseholdID)
+	app.sessionManager.Remove(r.Context(), "listId")
+	w.Header().Add("HX-Redirect", "/")
+}
+
+func (app *application) JoinHousehold(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(components.UserKey).(uuid.UUID)
+	code := r.FormValue("code")
+	household, err := app.households.Join(r.Context(), userId, code)
+	if err != nil {
+		app.logger.Error("could not join household", "code", code, "error", err.Error())
+		if err == service.ErrInvalidJoinCode {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "No household has that join code"))
+		} else if err == models.ErrAlreadyMember {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "You are already a member of that household"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not join household. Please try again."))
+		}
+		app.renderHousehold(w, r)
+		return
+	}
+	app.logger.Info("joined household", "user", userId, "household", household.ID)
+
+	app.sessionManager.Put(r.Context(), "householdId", household.ID)
+	app.sessionManager.Remove(r.Context(), "listId")
+	w.Header().Add("HX-Redirect", "/household")
+}
+
+func (app *application) LeaveHousehold(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	userId := r.Context().Value(components.UserKey).(uuid.UUID)
+	err := app.households.RemoveMember(r.Context(), householdId, userId)
+	if err != nil {
+		app.logger.Error("could not leave household", "household", householdId, "error", err.Error())
+		if err == service.ErrLastOwner {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Make another member an owner before leaving"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not leave household. Please try again."))
+		}
+		app.renderHousehold(w, r)
+		return
+	}
+	app.logger.Info("left household", "user", userId, "household", householdId)
+
+	app.sessionManager.Remove(r.Context(), "householdId")
+	app.sessionManager.Remove(r.Context(), "listId")
+	w.Header().Add("HX-Redirect", "/household")
+}
+
+func (app *application) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationId, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	invitation, err := app.households.AcceptInvitation(r.Context(), user, invitationId)
+	if err != nil {
+		app.logger.Error("could not accept invitation", "id", invitationId, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not accept invitation. Please try again."))
+		app.renderHousehold(w, r)
+		return
+	}
+	app.logger.Info("accepted invitation", "user", user.ID, "household", invitation.HouseholdID)
+
+	app.sessionManager.Put(r.Context(), "householdId", invitation.HouseholdID)
+	app.sessionManager.Remove(r.Context(), "listId")
+	w.Header().Add("HX-Redirect", "/household")
+}
+
+func (app *application) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationId, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = app.households.DeclineInvitation(r.Context(), user, invitationId)
+	if err != nil {
+		app.logger.Error("could not decline invitation", "id", invitationId, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not decline invitation. Please try again."))
+	}
+	app.renderHousehold(w, r)
+}
+
+func (app *application) RenameHousehold(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	name := r.FormValue("name")
+	_, err := app.households.Rename(r.Context(), householdId, name)
+	if err != nil {
+		app.logger.Error("could not rename household", "id", householdId, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, v.GetError("name").Error()))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not rename household. Please try again."))
+		}
+	}
+	app.renderHousehold(w, r)
+}
+
+func (app *application) RegenerateJoinCode(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	_, err := app.households.RegenerateJoinCode(r.Context(), householdId)
+	if err != nil {
+		app.logger.Error("could not regenerate join code", "id", householdId, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not create a new join code. Please try again."))
+	}
+	app.renderHousehold(w, r)
+}
+
+func (app *application) InviteMember(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	email := r.FormValue("email")
+	role := models.Role(r.FormValue("role"))
+	invitation, err := app.households.Invite(r.Context(), householdId, email, role)
+	if err != nil {
+		app.logger.Error("could not invite member", "household", householdId, "email", email, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			for _, fieldErr := range v.FieldErrors {
+				r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, fieldErr.Error()))
+				break
+			}
+		} else if err == models.ErrDuplicateInvitation {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "That email address has already been invited"))
+		} else if err == models.ErrAlreadyMember {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "That user is already a member of the household"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not send invitation. Please try again."))
+		}
+	} else {
+		app.logger.Info("invited member", "household", householdId, "email", invitation.Email, "role", invitation.Role)
+	}
+	app.renderHousehold(w, r)
+}
+
+func (app *application) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	invitationId, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = app.households.CancelInvitation(r.Context(), householdId, invitationId)
+	if err != nil {
+		app.logger.Error("could not cancel invitation", "id", invitationId, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not cancel invitation. Please try again."))
+	}
+	app.renderHousehold(w, r)
+}
+
+func (app *application) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	userId, err := uuid.Parse(flow.Param(r.Context(), "userId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	role := models.Role(r.FormValue("role"))
+	err = app.households.ChangeRole(r.Context(), householdId, userId, role)
+	if err != nil {
+		app.logger.Error("could not change member role", "household", householdId, "user", userId, "error", err.Error())
+		if err == service.ErrLastOwner {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "A household needs at least one owner"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not change role. Please try again."))
+		}
+	}
+	app.renderHousehold(w, r)
+}
+
+func (app *application) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	householdId := r.Context().Value(components.HouseholdKey).(int64)
+	userId, err := uuid.Parse(flow.Param(r.Context(), "userId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = app.households.RemoveMember(r.Context(), householdId, userId)
+	if err != nil {
+		app.logger.Error("could not remove member", "household", householdId, "user", userId, "error", err.Error())
+		if err == service.ErrLastOwner {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "A household needs at least one owner"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not remove member. Please try again."))
+		}
+	}
+	app.renderHousehold(w, r)
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rand"
 	"encoding/gob"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -11,105 +12,236 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/alexedwards/flow"
 	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/postgresstore"
+	"github.com/alexedwards/scs/sqlite3store"
 	"github.com/alexedwards/scs/v2"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/events"
+	"github.com/hunterwilkins2/trolly/internal/mail"
+	"github.com/hunterwilkins2/trolly/internal/migrate"
 	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
 	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/migrations"
 )
 
 type application struct {
 	items  *service.ItemService
 	users  *service.UserService
 	basket *service.BasketService
+	lists  *service.ListService
+	trips  *service.TripService
+
+	households *service.HouseholdService
+	tokens     *service.TokenService
+	twoFactor  *service.TwoFactorService
+	passkeys   *service.PasskeyService
+	oidc       *service.OIDCService
+
+	broker     *events.Broker
+	transactor *models.Transactor
 
 	sessionManager *scs.SessionManager
 	logger         *slog.Logger
+	config         config
+}
+
+// config is the settings the application is run with, beyond the database.
+type config struct {
+	// baseURL is where the server is reached, for links in emails. Passkeys
+	// only work on it.
+	baseURL string
+	mailer  mail.Mailer
+	// secretKey signs email verification links.
+	secretKey []byte
+	// randomKey is set when secretKey was made up at startup. Two-factor
+	// secrets encrypted with it could not be read after a restart, so
+	// two-factor authentication cannot be set up.
+	randomKey bool
+	// oidc is the identity provider users can log in with, if it has an
+	// issuer. oidcName is what it is called on the login page.
+	oidc     service.OIDCConfig
+	oidcName string
+	// disableSignup stops new accounts being made with a password, leaving
+	// single sign-on as the only way in for new users.
+	disableSignup bool
+	// currency is what prices are entered and shown in, unless an amount
+	// already has one.
+	currency money.Currency
 }
 
 func main() {
-	gob.Register(uuid.New())
 	port := flag.Int("port", 4000, "Port to serve server on")
 	hotReload := flag.Bool("hot-reload", false, "Hot-reload web browser on save")
 	dbHost := flag.String("db-host", "0.0.0.0:3306", "MySQL hostname")
 	dbUser := flag.String("db-user", "trolly", "MySQL username")
 	dbPass := flag.String("db-pass", "pa55word", "MySQL password")
 	dbName := flag.String("db-name", "trolly", "MySQL database name")
+	dbDriver := flag.String("db-driver", string(models.MySQL), "Database driver, mysql, sqlite or postgres")
+	dbDSN := flag.String("db-dsn", "", "Database DSN, replaces the MySQL flags. A file path for sqlite, defaults to trolly.db. Required for postgres")
+	autoMigrate := flag.Bool("auto-migrate", false, "Apply pending migrations before starting the server")
+	baseURL := flag.String("base-url", "", "URL the server is reached at, for links in emails. Defaults to http://localhost with the port")
+	smtpHost := flag.String("smtp-host", "", "SMTP server to send email through. Emails are logged when it is not set")
+	smtpPort := flag.Int("smtp-port", 587, "SMTP server port")
+	smtpUser := flag.String("smtp-user", "", "SMTP username")
+	smtpPass := flag.String("smtp-pass", "", "SMTP password")
+	mailFrom := flag.String("mail-from", "Trolly <trolly@localhost>", "Address emails are sent from")
+	mailFile := flag.String("mail-file", "", "File to write emails to instead of logging them, when there is no SMTP server")
+	secretKey := flag.String("secret-key", "", "Hex encoded key of at least 32 bytes to sign links and encrypt two-factor secrets with. A random key is used when it is not set, which two-factor authentication cannot be set up with")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL to offer single sign-on with")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcScopes := flag.String("oidc-scopes", "openid email profile", "OpenID Connect scopes to ask for, separated by spaces or commas")
+	oidcName := flag.String("oidc-name", "single sign-on", "Name of the identity provider shown on the login page")
+	disableSignup := flag.Bool("disable-signup", false, "Stop new accounts being made with a password")
+	currency := flag.String("currency", string(money.DEFAULT_CURRENCY), "ISO 4217 code of the currency prices are entered and shown in")
 	flag.Parse()
 
 	logHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
 	logger := slog.New(logHandler)
 
-	db, err := openDb(*dbHost, *dbUser, *dbPass, *dbName)
+	dialect := models.Dialect(*dbDriver)
+	if !dialect.Valid() {
+		logger.Error("unknown database driver", "driver", *dbDriver)
+		os.Exit(1)
+	}
+	dsn := *dbDSN
+	if dsn == "" {
+		switch dialect {
+		case models.SQLite:
+			dsn = "trolly.db"
+		case models.Postgres:
+			logger.Error("postgres requires -db-dsn")
+			os.Exit(1)
+		default:
+			dsn = fmt.Sprintf("%s:%s@%s/%s", *dbUser, *dbPass, *dbHost, *dbName)
+		}
+	}
+
+	db, err := openDb(models.Open, dialect, dsn)
 	if err != nil {
 		logger.Error("could not create connection to database", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-
-	userRepo := models.NewUserRepository(db)
-	userService := service.NewUserService(userRepo)
-
-	itemRepo := models.NewItemRepository(db)
-	itemService := service.NewItemService(itemRepo)
-
-	basketRepo := models.NewBasketRepository(db)
-	basketService := service.NewBasketService(basketRepo)
-
-	app := &application{
-		users:          userService,
-		items:          itemService,
-		basket:         basketService,
-		sessionManager: sessionManager,
-		logger:         logger,
+	// Migrations get their own connection, as they run several statements at
+	// once which the application's queries should never be able to.
+	migrationDb, err := openDb(models.OpenForMigrations, dialect, dsn)
+	if err != nil {
+		logger.Error("could not create connection to database", "error", err)
+		os.Exit(1)
 	}
+	defer migrationDb.Close()
 
-	mux := flow.New()
-	if *hotReload {
-		mux.HandleFunc("/hot-reload", HotReload)
-		mux.HandleFunc("/hot-reload/ready", Ready, http.MethodGet)
+	migrator, err := migrate.New(migrationDb, migrations.FS)
+	if err != nil {
+		logger.Error("could not read migrations", "error", err)
+		os.Exit(1)
+	}
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := migrateCommand(context.Background(), migrator, flag.Args()[1:], os.Stdout); err != nil {
+			logger.Error("could not migrate database", "error", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		logger.Error("unknown command", "command", flag.Arg(0))
+		os.Exit(1)
 	}
 
-	fs := http.FileServer(http.Dir("./static"))
-	mux.Handle("/static/...", http.StripPrefix("/static/", fs))
-
-	mux.Use(app.RecoverPanic, UseHotReload(*hotReload), app.LogRequest, sessionManager.LoadAndSave)
-	mux.HandleFunc("/signup", app.RegisterPage, http.MethodGet)
-	mux.HandleFunc("/register", app.Register, http.MethodPost)
-	mux.HandleFunc("/user/validate/name", app.ValidateName, http.MethodPost)
-	mux.HandleFunc("/user/validate/email", app.ValidateEmail, http.MethodPost)
-	mux.HandleFunc("/user/validate/password", app.ValidatePassword, http.MethodPost)
-
-	mux.HandleFunc("/login", app.LoginPage, http.MethodGet)
-	mux.HandleFunc("/login", app.Login, http.MethodPost)
-	mux.HandleFunc("/logout", app.Logout, http.MethodPost)
-
-	mux.Group(func(m *flow.Mux) {
-		mux.Use(app.Authenticated)
-		mux.HandleFunc("/", app.GroceryListPage, http.MethodGet)
-		mux.HandleFunc("/pantry", app.PantryPage, http.MethodGet)
+	if *autoMigrate {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			logger.Error("could not migrate database", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("applied migrations", "count", n)
+	}
+	version, dirty, err := migrator.Version(context.Background())
+	if err != nil {
+		logger.Error("could not get schema version", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("database schema", "version", version, "latest", migrator.Latest(), "dirty", dirty)
+	if dirty || version != migrator.Latest() {
+		logger.Warn("database schema is not up to date, run trolly migrate up")
+	}
 
-		mux.HandleFunc("/search", app.Search, http.MethodPost)
-		mux.HandleFunc("/items", app.AddItem, http.MethodPost)
-		mux.HandleFunc("/items/:id", app.DeleteItem, http.MethodDelete)
-		mux.HandleFunc("/items/edit", app.EditItemPage, http.MethodGet)
-		mux.HandleFunc("/items/:id", app.EditItem, http.MethodPatch)
+	cfg := config{baseURL: strings.TrimSuffix(*baseURL, "/")}
+	cfg.currency = money.Currency(strings.ToUpper(*currency))
+	if !cfg.currency.Valid() {
+		logger.Error("-currency must be a three letter ISO 4217 code", "currency", *currency)
+		os.Exit(1)
+	}
+	if cfg.baseURL == "" {
+		cfg.baseURL = fmt.Sprintf("http://localhost:%d", *port)
+	}
+	if *secretKey == "" {
+		cfg.secretKey = make([]byte, 32)
+		if _, err := rand.Read(cfg.secretKey); err != nil {
+			logger.Error("could not generate secret key", "error", err)
+			os.Exit(1)
+		}
+		cfg.randomKey = true
+		enabled, err := models.NewTOTPRepository(db).CountEnabled(context.Background())
+		if err != nil {
+			logger.Warn("could not check for two-factor authentication", "error", err)
+		} else if enabled > 0 {
+			logger.Error("-secret-key must be set, as users have two-factor authentication secrets encrypted with it", "users", enabled)
+			os.Exit(1)
+		}
+		logger.Warn("no -secret-key set, links in emails will stop working when the server restarts and two-factor authentication cannot be set up")
+	} else {
+		cfg.secretKey, err = hex.DecodeString(*secretKey)
+		if err != nil || len(cfg.secretKey) < 32 {
+			logger.Error("-secret-key must be at least 32 bytes of hex")
+			os.Exit(1)
+		}
+	}
+	if *oidcIssuer != "" {
+		cfg.oidc = service.OIDCConfig{
+			Issuer:       *oidcIssuer,
+			ClientID:     *oidcClientID,
+			ClientSecret: *oidcClientSecret,
+			Scopes: strings.FieldsFunc(*oidcScopes, func(r rune) bool {
+				return r == ',' || r == ' '
+			}),
+		}
+		cfg.oidcName = *oidcName
+		if cfg.oidc.ClientID == "" {
+			logger.Error("-oidc-issuer requires -oidc-client-id")
+			os.Exit(1)
+		}
+	}
+	cfg.disableSignup = *disableSignup
+	switch {
+	case *smtpHost != "":
+		cfg.mailer = mail.NewSMTPMailer(*smtpHost, *smtpPort, *smtpUser, *smtpPass, *mailFrom)
+	case *mailFile != "":
+		f, err := os.OpenFile(*mailFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			logger.Error("could not open mail file", "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		cfg.mailer = mail.NewLogMailer(f, *mailFrom)
+	default:
+		cfg.mailer = mail.NewLogMailer(os.Stdout, *mailFrom)
+	}
 
-		mux.HandleFunc("/suggestions", app.Suggest, http.MethodGet)
-		mux.HandleFunc("/basket", app.CreateNewItemAndAddToBasket, http.MethodPost)
-		mux.HandleFunc("/basket/:itemId", app.AddItemToBasket, http.MethodPost)
-		mux.HandleFunc("/basket/:id", app.MarkPurchased, http.MethodPatch)
-		mux.HandleFunc("/basket/:id", app.RemoveItemFromBasket, http.MethodDelete)
-		mux.HandleFunc("/basket", app.RemoveAllItems, http.MethodDelete)
-	})
+	app, err := newApplication(db, logger, cfg)
+	if err != nil {
+		logger.Error("could not create application", "error", err)
+		os.Exit(1)
+	}
 
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%d", *port),
@@ -117,7 +249,7 @@ func main() {
 		WriteTimeout:      1 * time.Second,
 		IdleTimeout:       30 * time.Second,
 		ReadHeaderTimeout: 2 * time.Second,
-		Handler:           mux,
+		Handler:           app.routes(*hotReload),
 		ErrorLog:          slog.NewLogLogger(logHandler, slog.LevelError),
 	}
 
@@ -148,10 +280,86 @@ func main() {
 	logger.Info("stopped server")
 }
 
-func openDb(dbHost, dbUser, dbPass, dbName string) (*sql.DB, error) {
-	var db *sql.DB
+// newApplication wires the services up to the database.
+func newApplication(db *models.DB, logger *slog.Logger, cfg config) (*application, error) {
+	gob.Register(uuid.UUID{})
+	gob.Register(time.Time{})
+	sessionManager := scs.New()
+	switch db.Dialect {
+	case models.SQLite:
+		sessionManager.Store = sqlite3store.New(db.DB)
+	case models.Postgres:
+		sessionManager.Store = postgresstore.New(db.DB)
+	default:
+		sessionManager.Store = mysqlstore.New(db.DB)
+	}
+
+	if cfg.currency == "" {
+		cfg.currency = money.DEFAULT_CURRENCY
+	}
+	db.Currency = cfg.currency
+
+	transactor := models.NewTransactor(db)
+
+	userRepo := models.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, models.NewPasswordResetRepository(db), transactor, cfg.secretKey)
+
+	itemRepo := models.NewItemRepository(db)
+	priceRepo := models.NewPriceRepository(db)
+	itemService := service.NewItemService(itemRepo, priceRepo, transactor)
+
+	broker := events.NewBroker()
+
+	basketRepo := models.NewBasketRepository(db)
+	purchaseRepo := models.NewPurchaseRepository(db)
+	basketService := service.NewBasketService(basketRepo, purchaseRepo, priceRepo, transactor, broker)
+
+	listRepo := models.NewListRepository(db)
+	listService := service.NewListService(listRepo)
+
+	householdRepo := models.NewHouseholdRepository(db)
+	householdService := service.NewHouseholdService(householdRepo, transactor)
+
+	tokenRepo := models.NewTokenRepository(db)
+	tokenService := service.NewTokenService(tokenRepo)
+
+	tripRepo := models.NewTripRepository(db)
+	tripService := service.NewTripService(tripRepo, basketRepo, listRepo, transactor, broker)
+
+	passkeyService, err := service.NewPasskeyService(models.NewCredentialRepository(db), userRepo, cfg.baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var oidcService *service.OIDCService
+	if cfg.oidc.Issuer != "" {
+		cfg.oidc.RedirectURL = cfg.baseURL + "/login/oidc/callback"
+		oidcService = service.NewOIDCService(userRepo, models.NewIdentityRepository(db), householdService, transactor, cfg.oidc)
+	}
+
+	return &application{
+		users:          userService,
+		items:          itemService,
+		basket:         basketService,
+		lists:          listService,
+		trips:          tripService,
+		households:     householdService,
+		tokens:         tokenService,
+		twoFactor:      service.NewTwoFactorService(models.NewTOTPRepository(db), transactor, cfg.secretKey),
+		passkeys:       passkeyService,
+		oidc:           oidcService,
+		broker:         broker,
+		transactor:     transactor,
+		sessionManager: sessionManager,
+		logger:         logger,
+		config:         cfg,
+	}, nil
+}
+
+func openDb(open func(models.Dialect, string) (*models.DB, error), dialect models.Dialect, dsn string) (*models.DB, error) {
+	var db *models.DB
 	if err := retryWithBackoff(func() error {
-		_db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@%s/%s?parseTime=true", dbUser, dbPass, dbHost, dbName))
+		_db, err := open(dialect, dsn)
 		db = _db
 		return err
 	})(); err != nil {
@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alexedwards/flow"
 	"github.com/google/uuid"
 	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
 )
 
 func (app *application) LogRequest(next http.Handler) http.Handler {
@@ -19,21 +24,121 @@ func (app *application) LogRequest(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) Authenticated(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, ok := app.sessionManager.Get(r.Context(), "userId").(uuid.UUID)
-		if !ok {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		user, err := app.users.GetUser(r.Context(), id)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
+// Authenticated requires a logged in user whose role in their current
+// household includes role. Users who have not verified their email are sent
+// to verify it.
+func (app *application) Authenticated(role models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, status := app.authenticate(r, role)
+			switch status {
+			case http.StatusOK:
+				next.ServeHTTP(w, r)
+			case http.StatusUnauthorized:
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+			case http.StatusForbidden:
+				if user, status := app.sessionUser(r); status == http.StatusOK && !user.Verified() {
+					http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+					return
+				}
+				w.WriteHeader(status)
+			default:
+				w.WriteHeader(status)
+			}
+		})
+	}
+}
+
+// authenticate adds the session's user, their household and role in it, and
+// their price mode to the request. The status is http.StatusOK if they are
+// allowed to continue, and the status to respond with otherwise. Users who
+// have not verified their email are forbidden.
+func (app *application) authenticate(r *http.Request, role models.Role) (*http.Request, int) {
+	user, status := app.sessionUser(r)
+	if status != http.StatusOK {
+		return r, status
+	}
+	if !user.Verified() {
+		return r, http.StatusForbidden
+	}
+	householdId := app.sessionManager.GetInt64(r.Context(), "householdId")
+	priceMode := app.sessionManager.GetString(r.Context(), "priceMode")
+	return app.authorize(r, user, householdId, priceMode, role)
+}
+
+// sessionUser returns the user logged in to the session, verified or not.
+// Users who still have to enter their two-factor code are not logged in yet.
+func (app *application) sessionUser(r *http.Request) (*models.User, int) {
+	id, ok := app.sessionManager.Get(r.Context(), "userId").(uuid.UUID)
+	if !ok || app.sessionManager.GetBool(r.Context(), "twoFactorPending") {
+		return nil, http.StatusUnauthorized
+	}
+	user, err := app.users.GetUser(r.Context(), id)
+	if err != nil {
+		return nil, http.StatusUnauthorized
+	}
+	// Changing the password bumps the user's session version, which logs out
+	// the sessions from before it
+	if app.sessionManager.GetInt(r.Context(), "sessionVersion") != user.SessionVersion {
+		return nil, http.StatusUnauthorized
+	}
+	return user, http.StatusOK
+}
+
+// authenticateToken is authenticate for requests with an API token in their
+// Authorization header. Tokens only act on the household they were created in.
+func (app *application) authenticateToken(r *http.Request, role models.Role) (*http.Request, int) {
+	plaintext, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return r, http.StatusUnauthorized
+	}
+	token, err := app.tokens.Authenticate(r.Context(), strings.TrimSpace(plaintext))
+	if err != nil {
+		if err != service.ErrInvalidToken {
+			app.logger.Error("could not check token", "error", err.Error())
+			return r, http.StatusInternalServerError
 		}
-		r = r.WithContext(context.WithValue(r.Context(), components.UserKey, user.ID))
-		next.ServeHTTP(w, r)
-	})
+		return r, http.StatusUnauthorized
+	}
+	if !token.Scope.Allows(role) {
+		app.logger.Info("forbidden", "token", token.ID, "scope", token.Scope, "required", role)
+		return r, http.StatusForbidden
+	}
+	user, err := app.users.GetUser(r.Context(), token.UserID)
+	if err != nil {
+		return r, http.StatusUnauthorized
+	}
+
+	r, status := app.authorize(r, user, token.HouseholdID, models.PriceLatest, role)
+	if status == http.StatusOK && r.Context().Value(components.HouseholdKey).(int64) != token.HouseholdID {
+		app.logger.Info("forbidden", "token", token.ID, "household", token.HouseholdID)
+		return r, http.StatusForbidden
+	}
+	return r, status
+}
+
+// authorize checks the user's role in their household, which is the preferred
+// household if they are still a member of it.
+func (app *application) authorize(r *http.Request, user *models.User, householdId int64, priceMode string, role models.Role) (*http.Request, int) {
+	r = r.WithContext(context.WithValue(r.Context(), components.UserKey, user.ID))
+
+	member, err := app.households.Current(r.Context(), user, householdId)
+	if err != nil {
+		app.logger.Error("could not get household", "user", user.ID, "error", err.Error())
+		return r, http.StatusInternalServerError
+	}
+	if !member.Role.Includes(role) {
+		app.logger.Info("forbidden", "user", user.ID, "household", member.HouseholdID, "role", member.Role, "required", role)
+		return r, http.StatusForbidden
+	}
+	r = r.WithContext(context.WithValue(r.Context(), components.HouseholdKey, member.HouseholdID))
+	r = r.WithContext(context.WithValue(r.Context(), components.RoleKey, string(member.Role)))
+
+	if priceMode != models.PriceAverage {
+		priceMode = models.PriceLatest
+	}
+	r = r.WithContext(context.WithValue(r.Context(), components.PriceModeKey, priceMode))
+	return r, http.StatusOK
 }
 
 func (app *application) RecoverPanic(next http.Handler) http.Handler {
@@ -48,3 +153,58 @@ func (app *application) RecoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// LoginOptions tells the pages whether users can sign up, and which identity
+// provider they can log in with.
+func (app *application) LoginOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), components.SignupDisabledKey, app.config.disableSignup)
+		if app.oidc != nil {
+			ctx = context.WithValue(ctx, components.SingleSignOnKey, app.config.oidcName)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Currency tells the pages which currency amounts without one are in.
+func (app *application) Currency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), components.CurrencyKey, app.config.currency)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CurrentList resolves the list a request operates on. Routes with a :listId
+// parameter use that list, every other route falls back to the last list the
+// user viewed or to their default list.
+func (app *application) CurrentList(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var list models.List
+		var err error
+		if listIdStr := flow.Param(r.Context(), "listId"); listIdStr != "" {
+			listId, err := strconv.ParseInt(listIdStr, 10, 64)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			list, err = app.lists.Get(r.Context(), listId)
+			if err != nil {
+				app.logger.Error("could not get list", "id", listId, "error", err.Error())
+				http.NotFound(w, r)
+				return
+			}
+		} else {
+			list, err = app.lists.Get(r.Context(), app.sessionManager.GetInt64(r.Context(), "listId"))
+			if err != nil {
+				list, err = app.lists.Default(r.Context())
+				if err != nil {
+					app.logger.Error("could not get default list", "error", err.Error())
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+		r = r.WithContext(context.WithValue(r.Context(), components.ListKey, list.ID))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/hunterwilkins2/trolly/internal/migrate"
+)
+
+const migrateUsage = "usage: trolly [flags] migrate up|down [steps|all]|status|version"
+
+// migrateCommand runs the migrate subcommand with the arguments that follow
+// it, writing what it did to out.
+func migrateCommand(ctx context.Context, migrator *migrate.Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migrations\n", n)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = -1
+			} else {
+				var err error
+				steps, err = strconv.Atoi(args[1])
+				if err != nil || steps < 1 {
+					return errors.New(migrateUsage)
+				}
+			}
+		}
+		n, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rolled back %d migrations\n", n)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "%06d %-40s %s\n", status.Version, status.Name, state)
+		}
+
+	case "version":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			fmt.Fprintf(out, "%d (dirty)\n", version)
+		} else {
+			fmt.Fprintf(out, "%d\n", version)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
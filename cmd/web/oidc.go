@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/service"
+)
+
+// OIDCLogin sends the browser to the identity provider to log in, keeping
+// what is needed to check its response in the session.
+func (app *application) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	login, err := app.oidc.Begin(r.Context())
+	if err != nil {
+		app.logger.Error("could not begin single sign-on", "error", err.Error())
+		app.oidcFailed(w, r, "Could not reach "+app.config.oidcName+". Please try again.")
+		return
+	}
+	app.sessionManager.Put(r.Context(), "oidcState", login.State)
+	app.sessionManager.Put(r.Context(), "oidcNonce", login.Nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", login.Verifier)
+	http.Redirect(w, r, login.URL, http.StatusSeeOther)
+}
+
+// OIDCCallback is where the identity provider sends the browser back to. The
+// user it vouches for is logged in, and still asked for their second factor
+// if they have one.
+func (app *application) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	login := service.OIDCLogin{
+		State:    app.sessionManager.PopString(r.Context(), "oidcState"),
+		Nonce:    app.sessionManager.PopString(r.Context(), "oidcNonce"),
+		Verifier: app.sessionManager.PopString(r.Context(), "oidcVerifier"),
+	}
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		app.logger.Info("single sign-on refused", "error", reason, "description", query.Get("error_description"))
+		app.oidcFailed(w, r, "You were not logged in with "+app.config.oidcName)
+		return
+	}
+
+	user, err := app.oidc.Finish(r.Context(), login, query.Get("state"), query.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOIDCLogin):
+			app.logger.Info("invalid single sign-on", "error", err.Error())
+			app.oidcFailed(w, r, "Could not log in with "+app.config.oidcName+". Please try again.")
+		case err == service.ErrEmailNotVerified:
+			app.oidcFailed(w, r, "Verify your email with "+app.config.oidcName+" before logging in with it")
+		default:
+			app.logger.Error("could not finish single sign-on", "error", err.Error())
+			app.oidcFailed(w, r, "Could not log in with "+app.config.oidcName+". Please try again.")
+		}
+		return
+	}
+
+	next, err := app.logIn(r, user)
+	if err != nil {
+		app.logger.Error("could not log user in", "user", user.ID, "error", err.Error())
+		app.oidcFailed(w, r, "Could not log in. Please try again.")
+		return
+	}
+	app.logger.Info("login from", "name", user.Name, "email", user.Email, "singleSignOn", true)
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func (app *application) oidcFailed(w http.ResponseWriter, r *http.Request, flash string) {
+	r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+	pages.Login(nil, nil).Render(r.Context(), w)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/internal/oidctest"
+	"github.com/hunterwilkins2/trolly/internal/service"
+)
+
+// logInWithOIDC goes through logging in with the issuer, returning the
+// server's response to the callback.
+func (ts *testServer) logInWithOIDC(t *testing.T, issuer *oidctest.Issuer) response {
+	t.Helper()
+	res := ts.get(t, "/login/oidc")
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("GET /login/oidc = %d: %s", res.status, res.body)
+	}
+	callback, err := issuer.Authorize(res.header.Get("Location"))
+	if err != nil {
+		t.Fatalf("could not authorize: %v", err)
+	}
+	return ts.get(t, callback.RequestURI())
+}
+
+func TestOIDC(t *testing.T) {
+	issuer, err := oidctest.New("trolly", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+	ts := newTestServer(t, func(cfg *config) {
+		cfg.oidc = service.OIDCConfig{Issuer: issuer.URL, ClientID: "trolly", ClientSecret: "secret", Scopes: []string{"openid", "email"}}
+		cfg.oidcName = "Example"
+		cfg.disableSignup = true
+	})
+
+	page := ts.get(t, "/login").body
+	contains(t, page, `href="/login/oidc"`, "Log in with Example")
+	if strings.Contains(page, `href="/signup"`) {
+		t.Error("the sign up link is shown when signing up is turned off")
+	}
+	for _, res := range []response{
+		ts.get(t, "/signup"),
+		ts.do(t, http.MethodPost, "/register", url.Values{"name": {"Test"}, "email": {"test@example.com"}, "password": {"pa55word"}}),
+	} {
+		if res.status != http.StatusForbidden {
+			t.Errorf("signing up = %d, want %d", res.status, http.StatusForbidden)
+		}
+		contains(t, res.body, "New accounts are made by logging in with Example")
+	}
+
+	authorize, err := url.Parse(ts.get(t, "/login/oidc").header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorize.Query()
+	if query.Get("redirect_uri") != "http://trolly.test/login/oidc/callback" || query.Get("scope") != "openid email" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("the authorization request asks for %v", query)
+	}
+
+	// Logging in makes an account that does not need its email verified
+	issuer.User = oidctest.User{Subject: "1", Email: "sso@example.com", EmailVerified: true, Name: "SSO"}
+	ts.logInWithOIDC(t, issuer).redirectsTo(t, "/")
+	if res := ts.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after single sign-on = %d, want %d", res.status, http.StatusOK)
+	}
+
+	// The callback only works once, in the session that started the login
+	res := ts.get(t, "/login/oidc")
+	callback, err := issuer.Authorize(res.header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := ts.session(t)
+	contains(t, other.get(t, callback.RequestURI()).body, "Could not log in with Example")
+	other.get(t, "/pantry").redirectsTo(t, "/login")
+	ts.get(t, callback.RequestURI()).redirectsTo(t, "/")
+	contains(t, ts.get(t, callback.RequestURI()).body, "Could not log in with Example")
+
+	contains(t, other.get(t, "/login/oidc/callback?error=access_denied").body, "You were not logged in with Example")
+	issuer.User = oidctest.User{Subject: "2", Email: "unverified@example.com"}
+	contains(t, other.logInWithOIDC(t, issuer).body, "Verify your email with Example before logging in with it")
+	other.get(t, "/pantry").redirectsTo(t, "/login")
+
+	// Without an identity provider there is nothing to log in with
+	plain := newTestServer(t)
+	if res := plain.get(t, "/login/oidc"); res.status != http.StatusNotFound {
+		t.Errorf("GET /login/oidc without an identity provider = %d, want %d", res.status, http.StatusNotFound)
+	}
+	page = plain.get(t, "/login").body
+	contains(t, page, `href="/signup"`)
+	if strings.Contains(page, "/login/oidc") {
+		t.Error("single sign-on is offered without an identity provider")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/api"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+var pathParam = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// TestOpenAPIRoutes checks the OpenAPI document describes exactly the routes
+// the API registers.
+func TestOpenAPIRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	res := ts.get(t, "/api/openapi.json")
+	if res.status != http.StatusOK || res.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /api/openapi.json = %d %s", res.status, res.header.Get("Content-Type"))
+	}
+	var spec struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(res.body), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0].URL != api.PREFIX {
+		t.Errorf("servers = %+v, want %s", spec.Servers, api.PREFIX)
+	}
+
+	var documented []string
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	var registered []string
+	for _, route := range (&application{}).apiRoutes() {
+		path := pathParam.ReplaceAllString(route.pattern, "{$1}")
+		registered = append(registered, route.method+" "+path)
+		if (route.method == http.MethodGet) != (route.role == models.RoleViewer) {
+			t.Errorf("%s %s needs %s, but read tokens are documented as only able to GET", route.method, path, route.role)
+		}
+
+		// Every route is behind the API's authentication
+		res := ts.do(t, route.method, api.PREFIX+pathParam.ReplaceAllString(route.pattern, "1"), nil)
+		var apiErr api.Error
+		if res.status != http.StatusUnauthorized || json.Unmarshal([]byte(res.body), &apiErr) != nil {
+			t.Errorf("unauthenticated %s %s = %d %q, want a JSON 401", route.method, path, res.status, res.body)
+		}
+	}
+
+	slices.Sort(documented)
+	slices.Sort(registered)
+	for _, operation := range documented {
+		if !slices.Contains(registered, operation) {
+			t.Errorf("%s is documented but not registered", operation)
+		}
+	}
+	for _, operation := range registered {
+		if !slices.Contains(documented, operation) {
+			t.Errorf("%s is registered but not documented", operation)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	account := ts.do(t, http.MethodPost, "/account/tokens", url.Values{"name": {"Client"}, "scope": {"write"}, "expires": {"0"}}).fragment(t, "account")
+	client := api.NewClient(ts.URL, find(t, account, `id="new-token"[^>]*>([^<]+)<`))
+	ctx := context.Background()
+
+	price := "3.49"
+	milk, err := client.CreateItem(ctx, api.CreateItem{Name: "Milk", Price: &price})
+	if err != nil || milk.Price != price {
+		t.Fatalf("CreateItem() = %+v, %v", milk, err)
+	}
+	_, err = client.CreateItem(ctx, api.CreateItem{})
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity || apiErr.Fields["name"] == "" {
+		t.Errorf("CreateItem() with no name = %v, want a name validation error", err)
+	}
+	milk, err = client.UpdateItem(ctx, milk.ID, api.UpdateItem{Name: "Whole milk"})
+	if err != nil || milk.Name != "Whole milk" {
+		t.Errorf("UpdateItem() = %+v, %v", milk, err)
+	}
+	if page, err := client.SearchItems(ctx, api.Search{Search: "milk"}); err != nil || len(page.Items) != 1 {
+		t.Errorf("SearchItems() = %+v, %v", page, err)
+	}
+
+	lists, err := client.GetLists(ctx)
+	if err != nil || len(lists) != 1 {
+		t.Fatalf("GetLists() = %+v, %v", lists, err)
+	}
+	listId := lists[0].ID
+	quantity := 2
+	added, err := client.AddToBasket(ctx, listId, api.AddToBasket{ItemID: milk.ID, Quantity: &quantity})
+	if err != nil || added.Quantity != 2 {
+		t.Fatalf("AddToBasket() = %+v, %v", added, err)
+	}
+	purchased := true
+	if item, err := client.UpdateBasketItem(ctx, listId, added.BasketID, api.UpdateBasketItem{Purchased: &purchased}); err != nil || !item.Purchased {
+		t.Errorf("UpdateBasketItem() = %+v, %v", item, err)
+	}
+	if basket, err := client.GetBasket(ctx, listId); err != nil || len(basket.Items) != 1 || basket.Total != "6.98" {
+		t.Errorf("GetBasket() = %+v, %v", basket, err)
+	}
+	if err := client.RemoveFromBasket(ctx, listId, added.BasketID); err != nil {
+		t.Errorf("RemoveFromBasket() = %v", err)
+	}
+	if err := client.ClearBasket(ctx, listId); err != nil {
+		t.Errorf("ClearBasket() = %v", err)
+	}
+	if err := client.DeleteItem(ctx, milk.ID); err != nil {
+		t.Errorf("DeleteItem() = %v", err)
+	}
+	_, err = client.GetItem(ctx, milk.ID)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Errorf("GetItem() of a deleted item = %v, want not found", err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+// passkeyLogin is where the browser is sent once it has logged in with a
+// passkey.
+type passkeyLogin struct {
+	Redirect string `json:"redirect"`
+}
+
+// BeginPasskeyLogin responds with the options for navigator.credentials.get.
+// A user who has entered their password can use one of their passkeys as
+// their second factor. Anyone else can use any passkey for the site in place
+// of their email and password.
+func (app *application) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.pendingUser(r)
+	assertion, session, err := app.passkeys.BeginLogin(r.Context(), user)
+	if err != nil {
+		if err == models.ErrCredentialNotFound {
+			app.writeError(w, http.StatusNotFound, "You do not have any passkeys")
+			return
+		}
+		app.logger.Error("could not begin passkey login", "error", err.Error())
+		app.writeError(w, http.StatusInternalServerError, "Could not log in with a passkey. Please try again.")
+		return
+	}
+	app.sessionManager.Put(r.Context(), "passkeyLogin", session)
+	app.writeJSON(w, http.StatusOK, assertion)
+}
+
+// FinishPasskeyLogin checks the passkey the browser used and logs its owner
+// in. A passkey that verified who was using it counts as both factors, so
+// users with two-factor authentication are not asked for a code after it.
+func (app *application) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	pending, _ := app.pendingUser(r)
+	session := app.sessionManager.PopString(r.Context(), "passkeyLogin")
+	user, err := app.passkeys.FinishLogin(r.Context(), pending, session, http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPasskey) || err == models.ErrCredentialNotFound || err == models.ErrUserNotFound {
+			app.logger.Info("invalid passkey", "error", err.Error())
+			app.writeError(w, http.StatusUnauthorized, "That passkey could not be used to log in")
+			return
+		}
+		app.logger.Error("could not finish passkey login", "error", err.Error())
+		app.writeError(w, http.StatusInternalServerError, "Could not log in with a passkey. Please try again.")
+		return
+	}
+	app.logger.Info("login from", "name", user.Name, "email", user.Email, "passkey", true)
+
+	if pending != nil {
+		app.finishLogIn(r)
+	} else {
+		app.sessionManager.RenewToken(r.Context())
+		app.sessionManager.Put(r.Context(), "userId", user.ID)
+		app.sessionManager.Put(r.Context(), "sessionVersion", user.SessionVersion)
+		app.sessionManager.Remove(r.Context(), "twoFactorPending")
+		app.sessionManager.Remove(r.Context(), "twoFactorRequires")
+	}
+	app.writeJSON(w, http.StatusOK, passkeyLogin{Redirect: "/"})
+}
+
+// BeginPasskeyRegistration responds with the options for
+// navigator.credentials.create, to add a passkey with the name in the form.
+func (app *application) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	name := r.FormValue("name")
+	creation, session, err := app.passkeys.BeginRegistration(r.Context(), user, name)
+	if err != nil {
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			app.writeError(w, http.StatusUnprocessableEntity, v.FieldErrors["name"].Error())
+			return
+		}
+		app.logger.Error("could not begin passkey registration", "user", user.ID, "error", err.Error())
+		app.writeError(w, http.StatusInternalServerError, "Could not add a passkey. Please try again.")
+		return
+	}
+	app.sessionManager.Put(r.Context(), "passkeyRegistration", session)
+	app.sessionManager.Put(r.Context(), "passkeyName", name)
+	app.writeJSON(w, http.StatusOK, creation)
+}
+
+// FinishPasskeyRegistration saves the passkey the browser created, and
+// renders the account page with it.
+func (app *application) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	session := app.sessionManager.PopString(r.Context(), "passkeyRegistration")
+	name := app.sessionManager.PopString(r.Context(), "passkeyName")
+	credential, err := app.passkeys.FinishRegistration(r.Context(), user, name, session, http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE))
+	if err != nil {
+		var v *validator.Validator
+		flash := "Could not add the passkey. Please try again."
+		switch {
+		case errors.As(err, &v), errors.Is(err, service.ErrInvalidPasskey):
+			app.logger.Info("invalid passkey registration", "user", user.ID, "error", err.Error())
+		case err == models.ErrDuplicateCredential:
+			flash = "That passkey has already been added"
+		default:
+			app.logger.Error("could not add passkey", "user", user.ID, "error", err.Error())
+		}
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+		app.renderAccount(w, r, pages.AccountView{})
+		return
+	}
+	app.logger.Info("added passkey", "id", credential.ID, "user", user.ID)
+	app.renderAccount(w, r, pages.AccountView{})
+}
+
+func (app *application) RemovePasskey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	userId := r.Context().Value(components.UserKey).(uuid.UUID)
+	err = app.passkeys.Remove(r.Context(), userId, id)
+	if err != nil {
+		app.logger.Error("could not remove passkey", "id", id, "user", userId, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not remove passkey. Please try again."))
+	} else {
+		app.logger.Info("removed passkey", "id", id, "user", userId)
+	}
+	app.renderAccount(w, r, pages.AccountView{})
+}
+
+// SetPasskeyRequired changes whether logging in with a password also asks for
+// a passkey.
+func (app *application) SetPasskeyRequired(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.confirmPassword(w, r)
+	if !ok {
+		return
+	}
+	required := r.FormValue("required") == "true"
+	err := app.passkeys.SetRequired(r.Context(), user, required)
+	if err != nil {
+		app.logger.Error("could not change whether a passkey is required", "user", user.ID, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not change your passkey settings. Please try again."))
+	} else {
+		app.logger.Info("changed whether a passkey is required", "user", user.ID, "required", required)
+	}
+	app.renderAccount(w, r, pages.AccountView{})
+}
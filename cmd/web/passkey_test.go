@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/passkeytest"
+	"github.com/hunterwilkins2/trolly/internal/totp"
+)
+
+// postJSON posts the body as JSON, like passkeys.js does with credentials.
+func (ts *testServer) postJSON(t *testing.T, path string, body []byte) response {
+	t.Helper()
+	res, err := ts.client.Post(ts.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response{res.StatusCode, res.Header, string(b)}
+}
+
+// logInWithPasskey goes through logging in with a passkey on the
+// authenticator, returning the server's response to it.
+func (ts *testServer) logInWithPasskey(t *testing.T, authenticator *passkeytest.Authenticator) response {
+	t.Helper()
+	begin := ts.do(t, http.MethodPost, "/login/passkey/begin", nil)
+	if begin.status != http.StatusOK {
+		t.Fatalf("POST /login/passkey/begin = %d: %s", begin.status, begin.body)
+	}
+	assertion, err := authenticator.Get([]byte(begin.body))
+	if err != nil {
+		t.Fatalf("could not use passkey: %v", err)
+	}
+	return ts.postJSON(t, "/login/passkey", assertion)
+}
+
+func TestPasskeys(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	login := url.Values{"email": {"test@example.com"}, "password": {"pa55word"}}
+	authenticator := passkeytest.New("http://trolly.test")
+
+	contains(t, ts.get(t, "/account").fragment(t, "passkeys"), "data-passkey-register")
+	contains(t, ts.get(t, "/login").body, "data-passkey-login", "/static/js/passkeys.js")
+	if res := ts.do(t, http.MethodPost, "/account/passkeys/begin", url.Values{"name": {""}}); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("POST /account/passkeys/begin without a name = %d, want %d", res.status, http.StatusUnprocessableEntity)
+	}
+	begin := ts.do(t, http.MethodPost, "/account/passkeys/begin", url.Values{"name": {"Phone"}})
+	creation, err := authenticator.Create([]byte(begin.body))
+	if err != nil {
+		t.Fatalf("could not create passkey: %v", err)
+	}
+	passkeys := ts.postJSON(t, "/account/passkeys", creation).fragment(t, "passkeys")
+	contains(t, passkeys, "Phone", `hx-post="/account/passkeys/required"`)
+	id := find(t, passkeys, `id="passkey-([0-9]+)"`)
+	contains(t, ts.postJSON(t, "/account/passkeys", creation).fragment(t, "account"), "Could not add the passkey")
+
+	// A passkey logs in without an email or password
+	other := ts.session(t)
+	res := other.logInWithPasskey(t, authenticator)
+	if res.status != http.StatusOK || res.body != "{\"redirect\":\"/\"}\n" {
+		t.Fatalf("POST /login/passkey = %d: %s", res.status, res.body)
+	}
+	if res := other.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after logging in with a passkey = %d, want %d", res.status, http.StatusOK)
+	}
+	if passkeys := ts.get(t, "/account").fragment(t, "passkeys"); strings.Contains(passkeys, "Never") {
+		t.Errorf("the passkey's last use is not shown:\n%s", passkeys)
+	}
+
+	other = ts.session(t)
+	if res := other.postJSON(t, "/login/passkey", []byte("{}")); res.status != http.StatusUnauthorized {
+		t.Errorf("POST /login/passkey without beginning = %d, want %d", res.status, http.StatusUnauthorized)
+	}
+	other.get(t, "/pantry").redirectsTo(t, "/login")
+	authenticator.UserVerified = false
+	if res := other.logInWithPasskey(t, authenticator); res.status != http.StatusUnauthorized {
+		t.Errorf("POST /login/passkey without user verification = %d, want %d", res.status, http.StatusUnauthorized)
+	}
+	authenticator.UserVerified = true
+
+	// A passkey can be required after the password too
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/")
+	contains(t, ts.do(t, http.MethodPost, "/account/passkeys/required", url.Values{"required": {"true"}, "password": {"wrong"}}).fragment(t, "account"), "Password is incorrect")
+	passkeys = ts.do(t, http.MethodPost, "/account/passkeys/required", url.Values{"required": {"true"}, "password": {"pa55word"}}).fragment(t, "passkeys")
+	contains(t, passkeys, "Logging in with your password also asks for one of your passkeys")
+	other = ts.session(t)
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/login/2fa")
+	other.get(t, "/").redirectsTo(t, "/login")
+	page := other.get(t, "/login/2fa").body
+	contains(t, page, "data-passkey-login")
+	if strings.Contains(page, `name="code"`) {
+		t.Error("the code is asked for without two-factor authentication")
+	}
+	if res := other.logInWithPasskey(t, authenticator); res.status != http.StatusOK {
+		t.Fatalf("POST /login/passkey as the second factor = %d: %s", res.status, res.body)
+	}
+	if res := other.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after the passkey = %d, want %d", res.status, http.StatusOK)
+	}
+
+	// Removing the last passkey stops it being asked for
+	passkeys = ts.do(t, http.MethodDelete, "/account/passkeys/"+id, nil).fragment(t, "passkeys")
+	if strings.Contains(passkeys, `id="passkey-`+id+`"`) {
+		t.Errorf("passkey %s was not removed:\n%s", id, passkeys)
+	}
+	ts.session(t).do(t, http.MethodPost, "/login", login).redirectsTo(t, "/")
+	if res := ts.session(t).logInWithPasskey(t, authenticator); res.status != http.StatusUnauthorized {
+		t.Errorf("POST /login/passkey with a removed passkey = %d, want %d", res.status, http.StatusUnauthorized)
+	}
+}
+
+func TestPasskeyRequiredWithTwoFactor(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	login := url.Values{"email": {"test@example.com"}, "password": {"pa55word"}}
+	authenticator := passkeytest.New("http://trolly.test")
+
+	account := ts.do(t, http.MethodPost, "/account/2fa", nil).fragment(t, "account")
+	secret := find(t, account, `select-all text-sm">([A-Z2-7]+)<`)
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+	account = ts.do(t, http.MethodPost, "/account/2fa/enable", url.Values{"code": {code}}).fragment(t, "account")
+	recovery := find(t, account, `<ul id="recovery-codes"[^>]*>\s*<li>([^<]+)</li>`)
+	begin := ts.do(t, http.MethodPost, "/account/passkeys/begin", url.Values{"name": {"Phone"}})
+	creation, err := authenticator.Create([]byte(begin.body))
+	if err != nil {
+		t.Fatalf("could not create passkey: %v", err)
+	}
+	ts.postJSON(t, "/account/passkeys", creation)
+	ts.do(t, http.MethodPost, "/account/passkeys/required", url.Values{"required": {"true"}, "password": {"pa55word"}})
+
+	// Neither the authenticator app nor a recovery code stands in for the
+	// passkey
+	other := ts.session(t)
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/login/2fa")
+	page := other.get(t, "/login/2fa").body
+	contains(t, page, "data-passkey-login")
+	if strings.Contains(page, `name="code"`) {
+		t.Error("a code is asked for when a passkey is required")
+	}
+	next, _ := totp.Code(secret, step+1)
+	for _, code := range []string{next, recovery} {
+		contains(t, other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {code}}).body, "Use one of your passkeys to finish logging in")
+		other.get(t, "/pantry").redirectsTo(t, "/login")
+	}
+
+	if res := other.logInWithPasskey(t, authenticator); res.status != http.StatusOK {
+		t.Fatalf("POST /login/passkey as the second factor = %d: %s", res.status, res.body)
+	}
+	if res := other.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after the passkey = %d, want %d", res.status, http.StatusOK)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/flow"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+func (app *application) ItemPage(w http.ResponseWriter, r *http.Request) {
+	itemId, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	history, err := app.items.PriceHistory(r.Context(), itemId)
+	if err != nil {
+		app.logger.Error("could not get price history", "id", itemId, "error", err.Error())
+		if err == models.ErrItemNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	pages.ItemDetail(history).Render(r.Context(), w)
+}
+
+// SetPriceMode switches between showing the latest price of items and their
+// rolling average price.
+func (app *application) SetPriceMode(w http.ResponseWriter, r *http.Request) {
+	mode := r.FormValue("mode")
+	if mode != models.PriceLatest && mode != models.PriceAverage {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "priceMode", mode)
+	w.Header().Add("HX-Refresh", "true")
+}
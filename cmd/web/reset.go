@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/mail"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+func (app *application) ForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	pages.ForgotPassword("", false, nil).Render(r.Context(), w)
+}
+
+// ForgotPassword emails a reset link to the address if it has an account. The
+// page says the same either way, so it cannot be used to find out who has one.
+// Another link is only sent once PASSWORD_RESET_INTERVAL has passed.
+func (app *application) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	email := r.FormValue("email")
+	v := validator.New()
+	models.ValidateEmail(v, email)
+	if v.HasErrors() {
+		pages.ForgotPassword(email, false, v.FieldErrors).Render(r.Context(), w)
+		return
+	}
+
+	user, token, err := app.users.ForgotPassword(r.Context(), email)
+	if err == models.ErrUserNotFound {
+		app.logger.Info("password reset for unknown email", "email", email)
+	} else if err == service.ErrResetTooSoon {
+		app.logger.Info("password reset asked for again too soon", "email", email)
+	} else if err != nil {
+		app.logger.Error("could not create password reset", "email", email, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not send a reset link. Please try again."))
+		pages.ForgotPassword(email, false, nil).Render(r.Context(), w)
+		return
+	} else {
+		err = app.config.mailer.Send(r.Context(), mail.Message{
+			To:      user.Email,
+			Subject: "Reset your Trolly password",
+			Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your Trolly account. "+
+				"To choose a new password, open this link within the next hour:\n\n%s/reset-password?token=%s\n\n"+
+				"If you did not ask for this, you can ignore this email.\n",
+				user.Name, app.config.baseURL, url.QueryEscape(token)),
+		})
+		if err != nil {
+			app.logger.Error("could not send password reset", "user", user.ID, "error", err.Error())
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not send a reset link. Please try again."))
+			pages.ForgotPassword(email, false, nil).Render(r.Context(), w)
+			return
+		}
+		app.logger.Info("sent password reset", "user", user.ID)
+	}
+	pages.ForgotPassword(email, true, nil).Render(r.Context(), w)
+}
+
+func (app *application) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	_, err := app.users.CheckPasswordReset(r.Context(), token)
+	if err != nil {
+		r = app.resetFailed(r, err)
+	}
+	pages.ResetPassword(token, nil).Render(r.Context(), w)
+}
+
+// ResetPassword sets the new password and logs the user in, asking for their
+// code if they have two-factor authentication. Any other sessions they had are
+// logged out.
+func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	user, err := app.users.ResetPassword(r.Context(), token, r.FormValue("password"))
+	if err != nil {
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			pages.ResetPassword(token, v.FieldErrors).Render(r.Context(), w)
+			return
+		}
+		pages.ResetPassword(token, nil).Render(app.resetFailed(r, err).Context(), w)
+		return
+	}
+	app.logger.Info("reset password", "user", user.ID)
+
+	next, err := app.logIn(r, user)
+	if err != nil {
+		app.logger.Error("could not log user in", "user", user.ID, "error", err.Error())
+		next = "/login"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// resetFailed adds a flash explaining why the reset token cannot be used.
+func (app *application) resetFailed(r *http.Request, err error) *http.Request {
+	flash := "This reset link has expired or has already been used."
+	if err != service.ErrInvalidToken {
+		app.logger.Error("could not check password reset", "error", err.Error())
+		flash = "Could not reset your password. Please try again."
+	}
+	return r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResetPassword(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	other := ts.session(t)
+	other.do(t, http.MethodPost, "/login", url.Values{"email": {"test@example.com"}, "password": {"pa55word"}})
+	if res := other.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Fatalf("other session GET /pantry = %d, want %d", res.status, http.StatusOK)
+	}
+
+	contains(t, ts.get(t, "/login").body, `href="/forgot-password"`)
+	sent := ts.mail.Len()
+	res := ts.do(t, http.MethodPost, "/forgot-password", url.Values{"email": {"nobody@example.com"}})
+	contains(t, res.body, "If an account exists for nobody@example.com")
+	if ts.mail.Len() != sent {
+		t.Fatalf("sent mail to an unknown address:\n%s", ts.mail)
+	}
+
+	res = ts.do(t, http.MethodPost, "/forgot-password", url.Values{"email": {"test@example.com"}})
+	contains(t, res.body, "If an account exists for test@example.com")
+	contains(t, ts.mail.String(), "To: test@example.com", "Subject: Reset your Trolly password")
+	path := ts.link(t, "test@example.com", "/reset-password")
+	sent = ts.mail.Len()
+	res = ts.do(t, http.MethodPost, "/forgot-password", url.Values{"email": {"test@example.com"}})
+	contains(t, res.body, "If an account exists for test@example.com")
+	if ts.mail.Len() != sent {
+		t.Fatalf("sent another reset link straight away:\n%s", ts.mail)
+	}
+	token, err := url.ParseQuery(strings.TrimPrefix(path, "/reset-password?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contains(t, ts.get(t, path).body, `name="token" value="`+token.Get("token")+`"`)
+	res = ts.do(t, http.MethodPost, "/reset-password", url.Values{"token": {token.Get("token")}, "password": {"short"}})
+	contains(t, res.body, "Password must be at least 6 characters")
+	res = ts.do(t, http.MethodPost, "/reset-password", url.Values{"token": {token.Get("token")}, "password": {"n3wpa55word"}})
+	res.redirectsTo(t, "/")
+	if res := ts.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after reset = %d, want %d", res.status, http.StatusOK)
+	}
+	other.get(t, "/pantry").redirectsTo(t, "/login")
+
+	contains(t, ts.get(t, path).body, "This reset link has expired or has already been used.")
+	res = ts.do(t, http.MethodPost, "/reset-password", url.Values{"token": {token.Get("token")}, "password": {"an0therpa55word"}})
+	contains(t, res.body, "This reset link has expired or has already been used.")
+
+	other.do(t, http.MethodPost, "/login", url.Values{"email": {"test@example.com"}, "password": {"pa55word"}})
+	other.get(t, "/pantry").redirectsTo(t, "/login")
+	other.do(t, http.MethodPost, "/login", url.Values{"email": {"test@example.com"}, "password": {"n3wpa55word"}})
+	if res := other.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after logging in with the new password = %d, want %d", res.status, http.StatusOK)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/hunterwilkins2/trolly/api"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+func (app *application) routes(hotReload bool) http.Handler {
+	mux := flow.New()
+	if hotReload {
+		mux.HandleFunc("/hot-reload", HotReload)
+		mux.HandleFunc("/hot-reload/ready", Ready, http.MethodGet)
+	}
+
+	fs := http.FileServer(http.Dir("./static"))
+	mux.Handle("/static/...", http.StripPrefix("/static/", fs))
+
+	mux.Use(app.RecoverPanic, UseHotReload(hotReload), app.LoginOptions, app.Currency, app.LogRequest, app.sessionManager.LoadAndSave)
+	mux.HandleFunc("/signup", app.RegisterPage, http.MethodGet)
+	mux.HandleFunc("/register", app.Register, http.MethodPost)
+	mux.HandleFunc("/user/validate/name", app.ValidateName, http.MethodPost)
+	mux.HandleFunc("/user/validate/email", app.ValidateEmail, http.MethodPost)
+	mux.HandleFunc("/user/validate/password", app.ValidatePassword, http.MethodPost)
+
+	mux.HandleFunc("/login", app.LoginPage, http.MethodGet)
+	mux.HandleFunc("/login", app.Login, http.MethodPost)
+	mux.HandleFunc("/login/2fa", app.TwoFactorPage, http.MethodGet)
+	mux.HandleFunc("/login/2fa", app.TwoFactorLogin, http.MethodPost)
+	mux.HandleFunc("/login/passkey/begin", app.BeginPasskeyLogin, http.MethodPost)
+	mux.HandleFunc("/login/passkey", app.FinishPasskeyLogin, http.MethodPost)
+	mux.HandleFunc("/login/oidc", app.OIDCLogin, http.MethodGet)
+	mux.HandleFunc("/login/oidc/callback", app.OIDCCallback, http.MethodGet)
+	mux.HandleFunc("/logout", app.Logout, http.MethodPost)
+	mux.HandleFunc("/forgot-password", app.ForgotPasswordPage, http.MethodGet)
+	mux.HandleFunc("/forgot-password", app.ForgotPassword, http.MethodPost)
+	mux.HandleFunc("/reset-password", app.ResetPasswordPage, http.MethodGet)
+	mux.HandleFunc("/reset-password", app.ResetPassword, http.MethodPost)
+	mux.HandleFunc("/verify-email", app.VerifyEmailPage, http.MethodGet)
+	mux.HandleFunc("/verify-email", app.ResendVerification, http.MethodPost)
+
+	mux.Group(func(m *flow.Mux) {
+		m.Use(app.Authenticated(models.RoleViewer), app.CurrentList)
+		m.HandleFunc("/", app.Home, http.MethodGet)
+		m.HandleFunc("/pantry", app.PantryPage, http.MethodGet)
+		m.HandleFunc("/search", app.Search, http.MethodPost)
+		m.HandleFunc("/items/:id|^[0-9]+$", app.ItemPage, http.MethodGet)
+		m.HandleFunc("/items/export", app.ExportItems, http.MethodGet)
+		m.HandleFunc("/prices/mode", app.SetPriceMode, http.MethodPost)
+
+		m.HandleFunc("/lists", app.ListsPage, http.MethodGet)
+		m.HandleFunc("/lists/:listId", app.GroceryListPage, http.MethodGet)
+		m.HandleFunc("/lists/:listId/suggestions", app.Suggest, http.MethodGet)
+		m.HandleFunc("/lists/:listId/events", app.BasketEvents, http.MethodGet)
+		m.HandleFunc("/lists/:listId/export", app.ExportBasket, http.MethodGet)
+
+		m.HandleFunc("/trips", app.TripsPage, http.MethodGet)
+		m.HandleFunc("/trips/:id", app.TripPage, http.MethodGet)
+
+		m.HandleFunc("/household", app.HouseholdPage, http.MethodGet)
+		m.HandleFunc("/household/switch", app.SwitchHousehold, http.MethodPost)
+		m.HandleFunc("/household/join", app.JoinHousehold, http.MethodPost)
+		m.HandleFunc("/household/leave", app.LeaveHousehold, http.MethodPost)
+		m.HandleFunc("/invitations/:id", app.AcceptInvitation, http.MethodPost)
+		m.HandleFunc("/invitations/:id", app.DeclineInvitation, http.MethodDelete)
+
+		m.HandleFunc("/account", app.AccountPage, http.MethodGet)
+		m.HandleFunc("/account/tokens", app.CreateToken, http.MethodPost)
+		m.HandleFunc("/account/tokens/:id", app.RevokeToken, http.MethodDelete)
+		m.HandleFunc("/account/2fa", app.EnrolTwoFactor, http.MethodPost)
+		m.HandleFunc("/account/2fa/enable", app.EnableTwoFactor, http.MethodPost)
+		m.HandleFunc("/account/2fa/disable", app.DisableTwoFactor, http.MethodPost)
+		m.HandleFunc("/account/2fa/recovery-codes", app.NewRecoveryCodes, http.MethodPost)
+		m.HandleFunc("/account/passkeys/begin", app.BeginPasskeyRegistration, http.MethodPost)
+		m.HandleFunc("/account/passkeys", app.FinishPasskeyRegistration, http.MethodPost)
+		m.HandleFunc("/account/passkeys/required", app.SetPasskeyRequired, http.MethodPost)
+		m.HandleFunc("/account/passkeys/:id", app.RemovePasskey, http.MethodDelete)
+	})
+
+	mux.Group(func(m *flow.Mux) {
+		m.Use(app.Authenticated(models.RoleEditor), app.CurrentList)
+		m.HandleFunc("/lists", app.CreateList, http.MethodPost)
+		m.HandleFunc("/lists/:listId", app.RenameList, http.MethodPatch)
+		m.HandleFunc("/lists/:listId", app.DeleteList, http.MethodDelete)
+		m.HandleFunc("/lists/:listId/edit", app.EditListPage, http.MethodGet)
+
+		m.HandleFunc("/items", app.AddItem, http.MethodPost)
+		m.HandleFunc("/items/:id", app.DeleteItem, http.MethodDelete)
+		m.HandleFunc("/items/edit", app.EditItemPage, http.MethodGet)
+		m.HandleFunc("/items/import", app.ImportItems, http.MethodPost)
+		m.HandleFunc("/items/:id", app.EditItem, http.MethodPatch)
+
+		m.HandleFunc("/lists/:listId/basket", app.CreateNewItemAndAddToBasket, http.MethodPost)
+		m.HandleFunc("/lists/:listId/basket/:itemId", app.AddItemToBasket, http.MethodPost)
+		m.HandleFunc("/lists/:listId/basket/:id", app.MarkPurchased, http.MethodPatch)
+		m.HandleFunc("/lists/:listId/basket/:id/quantity", app.UpdateBasketQuantity, http.MethodPatch)
+		m.HandleFunc("/lists/:listId/basket/:id", app.RemoveItemFromBasket, http.MethodDelete)
+		m.HandleFunc("/lists/:listId/basket", app.RemoveAllItems, http.MethodDelete)
+		m.HandleFunc("/lists/:listId/trip", app.FinishTrip, http.MethodPost)
+	})
+
+	mux.Group(func(m *flow.Mux) {
+		m.Use(app.Authenticated(models.RoleOwner))
+		m.HandleFunc("/household", app.RenameHousehold, http.MethodPatch)
+		m.HandleFunc("/household/code", app.RegenerateJoinCode, http.MethodPost)
+		m.HandleFunc("/household/invitations", app.InviteMember, http.MethodPost)
+		m.HandleFunc("/household/invitations/:id", app.CancelInvitation, http.MethodDelete)
+		m.HandleFunc("/household/members/:userId", app.ChangeMemberRole, http.MethodPatch)
+		m.HandleFunc("/household/members/:userId", app.RemoveMember, http.MethodDelete)
+	})
+
+	mux.HandleFunc("/api/openapi.json", app.OpenAPI, http.MethodGet)
+	for _, route := range app.apiRoutes() {
+		handler := http.Handler(route.handler)
+		if strings.Contains(route.pattern, ":listId") {
+			handler = app.APIList(handler)
+		}
+		mux.Handle(api.PREFIX+route.pattern, app.APIAuthenticated(route.role)(handler), route.method)
+	}
+
+	return mux
+}
+
+// apiRoute is an endpoint of the JSON API. They are registered from a table so
+// the OpenAPI document can be checked against them.
+type apiRoute struct {
+	method  string
+	pattern string
+	role    models.Role
+	handler http.HandlerFunc
+}
+
+func (app *application) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{http.MethodGet, "/items", models.RoleViewer, app.APISearchItems},
+		{http.MethodPost, "/items", models.RoleEditor, app.APICreateItem},
+		{http.MethodGet, "/items/:id", models.RoleViewer, app.APIGetItem},
+		{http.MethodPatch, "/items/:id", models.RoleEditor, app.APIUpdateItem},
+		{http.MethodDelete, "/items/:id", models.RoleEditor, app.APIDeleteItem},
+
+		{http.MethodGet, "/lists", models.RoleViewer, app.APIGetLists},
+		{http.MethodGet, "/lists/:listId/basket", models.RoleViewer, app.APIGetBasket},
+		{http.MethodPost, "/lists/:listId/basket", models.RoleEditor, app.APIAddToBasket},
+		{http.MethodDelete, "/lists/:listId/basket", models.RoleEditor, app.APIClearBasket},
+		{http.MethodPatch, "/lists/:listId/basket/:id", models.RoleEditor, app.APIUpdateBasketItem},
+		{http.MethodDelete, "/lists/:listId/basket/:id", models.RoleEditor, app.APIRemoveFromBasket},
+	}
+}
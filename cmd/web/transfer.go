@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/transfer"
+)
+
+const MAX_IMPORT_SIZE = 1 << 20
+
+func (app *application) ExportItems(w http.ResponseWriter, r *http.Request) {
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	records, err := app.items.Export(r.Context())
+	if err != nil {
+		app.logger.Error("could not export items", "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	attachment(w, "pantry", format)
+	err = transfer.WriteItems(w, format, records)
+	if err != nil {
+		app.logger.Error("could not write items", "error", err.Error())
+	}
+}
+
+func (app *application) ExportBasket(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	basket, err := app.basket.GetItems(r.Context(), listId)
+	if err != nil {
+		app.logger.Error("could not get basket", "list", listId, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	attachment(w, fmt.Sprintf("basket-%d", listId), format)
+	err = transfer.WriteBasket(w, format, basket)
+	if err != nil {
+		app.logger.Error("could not write basket", "list", listId, "error", err.Error())
+	}
+}
+
+// attachment makes the response download as a file named after what it holds
+// and today's date.
+func attachment(w http.ResponseWriter, name string, format transfer.Format) {
+	filename := fmt.Sprintf("trolly-%s-%s.%s", name, time.Now().Format(time.DateOnly), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// ImportItems previews importing an uploaded file when dryRun is set, and
+// otherwise imports the data the preview posts back.
+func (app *application) ImportItems(w http.ResponseWriter, r *http.Request) {
+	data, format, err := readImport(w, r)
+	view := pages.ImportView{DryRun: r.FormValue("dryRun") == "true"}
+	if err != nil {
+		app.logger.Info("could not read import", "error", err.Error())
+		view.Error = err.Error()
+		pages.Import(view).Render(r.Context(), w)
+		return
+	}
+	view.Data, view.Format = data, format
+
+	rows, err := transfer.ReadItems(strings.NewReader(data), format, app.config.currency)
+	if err != nil {
+		view.Error = fmt.Sprintf("Could not read the %s file: %v", strings.ToUpper(string(format)), err)
+		pages.Import(view).Render(r.Context(), w)
+		return
+	}
+	view.Results, err = app.items.Import(r.Context(), rows, view.DryRun)
+	if err != nil {
+		app.logger.Error("could not import items", "error", err.Error())
+		view.Error = "Could not import items. Please try again."
+	} else if !view.DryRun {
+		app.logger.Info("imported items", "rows", len(rows))
+	}
+	pages.Import(view).Render(r.Context(), w)
+}
+
+// readImport returns the uploaded file, or the data field posted back by a
+// preview, along with its format.
+func readImport(w http.ResponseWriter, r *http.Request) (string, transfer.Format, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_IMPORT_SIZE)
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		format, err := transfer.ParseFormat(r.PostFormValue("format"))
+		if err != nil {
+			return "", "", err
+		}
+		return r.PostFormValue("data"), format, nil
+	} else if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return "", "", fmt.Errorf("files can be at most %d MB", MAX_IMPORT_SIZE>>20)
+		}
+		return "", "", err
+	}
+	defer file.Close()
+
+	format, err := transfer.ParseFormat(header.Filename)
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not a .csv or .json file", header.Filename)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), format, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// upload posts the file as a multipart form, as the import form does.
+func (ts *testServer) upload(t *testing.T, path string, filename string, content string, fields url.Values) response {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, values := range fields {
+		for _, value := range values {
+			form.WriteField(key, value)
+		}
+	}
+	file, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(file, content)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	res, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response{res.StatusCode, res.Header, string(b)}
+}
+
+func TestTransfer(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	listPath := ts.get(t, "/").header.Get("Location")
+	ts.do(t, http.MethodPost, "/items", url.Values{"item": {"Milk $3.49 #dairy\nEggs $2.50"}})
+	ts.do(t, http.MethodPost, listPath+"/basket", url.Values{"item": {"2x Milk @costco"}})
+
+	pantry := ts.get(t, "/pantry").fragment(t, "pantry")
+	contains(t, pantry, `href="/items/export?format=csv"`, `href="`+listPath+`/export?format=json"`, `hx-post="/items/import"`)
+
+	res := ts.get(t, "/items/export?format=csv")
+	if res.status != http.StatusOK || res.header.Get("Content-Type") != "text/csv; charset=utf-8" || !strings.HasPrefix(res.header.Get("Content-Disposition"), `attachment; filename="trolly-pantry-`) {
+		t.Fatalf("CSV export = %d %v", res.status, res.header)
+	}
+	contains(t, res.body, "name,price,currency,category,times_bought,last_purchase_date,created_at\nEggs,2.50,USD,,0,,", "\nMilk,3.49,USD,dairy,0,,")
+	if res := ts.get(t, "/items/export?format=xml"); res.status != http.StatusBadRequest {
+		t.Errorf("export as xml = %d, want %d", res.status, http.StatusBadRequest)
+	}
+
+	res = ts.get(t, listPath+"/export?format=json")
+	var basket []map[string]any
+	if err := json.Unmarshal([]byte(res.body), &basket); err != nil || len(basket) != 1 || basket[0]["name"] != "Milk" || basket[0]["store"] != "costco" || basket[0]["quantity"] != 2.0 {
+		t.Errorf("basket JSON export = %q, %v", res.body, err)
+	}
+
+	file := "name,price,category\nmilk,3.99,Drinks\nApples,1.99,fruit\nPears,abc,\n"
+	preview := ts.upload(t, "/items/import", "pantry.csv", file, url.Values{"dryRun": {"true"}}).fragment(t, "import")
+	contains(t, preview, "1 new, 1 updated, 0 unchanged and 1 skipped", "price $3.99 replaces $3.49", "category dairy is kept over Drinks", `price &#34;abc&#34;: amount must be a number`)
+	contains(t, ts.get(t, "/pantry").fragment(t, "pantry"), "$3.49")
+	if strings.Contains(ts.get(t, "/pantry").body, "Apples") {
+		t.Error("the preview imported Apples")
+	}
+
+	data := find(t, preview, `(?s)<textarea name="data"[^>]*>(.*?)</textarea>`)
+	if data != file {
+		t.Errorf("preview posts back %q, want the uploaded file", data)
+	}
+	imported := ts.do(t, http.MethodPost, "/items/import", url.Values{"format": {"csv"}, "data": {file}}).fragment(t, "import")
+	contains(t, imported, "Imported 1 new and 1 updated items, 1 skipped")
+	contains(t, ts.get(t, "/pantry").fragment(t, "pantry"), "Apples", "$1.99", "$3.99")
+
+	res = ts.upload(t, "/items/import", "pantry.txt", file, url.Values{"dryRun": {"true"}})
+	contains(t, res.fragment(t, "import"), "pantry.txt is not a .csv or .json file")
+	res = ts.upload(t, "/items/import", "pantry.json", `{"name": "Milk"}`, url.Values{"dryRun": {"true"}})
+	contains(t, res.fragment(t, "import"), "Could not read the JSON file")
+}
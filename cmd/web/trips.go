@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/flow"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+func (app *application) FinishTrip(w http.ResponseWriter, r *http.Request) {
+	listId := r.Context().Value(components.ListKey).(int64)
+	store := r.Header.Get("HX-Prompt")
+	if store == "" {
+		store = r.FormValue("store")
+	}
+	trip, err := app.trips.Finish(r.Context(), listId, store)
+	if err != nil {
+		app.logger.Error("could not finish trip", "list", listId, "error", err.Error())
+		var v *validator.Validator
+		if errors.As(err, &v) {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, v.GetError("store").Error()))
+		} else if err == service.ErrNothingPurchased {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Mark items as purchased before finishing the trip"))
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not finish trip. Please try again."))
+		}
+		app.renderGroceryList(w, r)
+		return
+	}
+	app.logger.Info("finished trip", "list", listId, "trip", trip.ID, "items", trip.ItemCount, "total", trip.Total)
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/trips/%d", trip.ID))
+}
+
+func (app *application) TripsPage(w http.ResponseWriter, r *http.Request) {
+	trips, err := app.trips.GetAll(r.Context())
+	if err != nil {
+		app.logger.Error("could not get trips", "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not get trips"))
+	}
+	pages.Trips(trips).Render(r.Context(), w)
+}
+
+func (app *application) TripPage(w http.ResponseWriter, r *http.Request) {
+	tripId, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	trip, err := app.trips.Get(r.Context(), tripId)
+	if err != nil {
+		app.logger.Error("could not get trip", "id", tripId, "error", err.Error())
+		if err == models.ErrTripNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	pages.Trip(trip).Render(r.Context(), w)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
+)
+
+// TWO_FACTOR_TIMEOUT is how long a user has to enter their code after their
+// password before having to log in again.
+const TWO_FACTOR_TIMEOUT = 5 * time.Minute
+
+// logIn starts a session for the user and returns where to send them. Users
+// with two-factor authentication, or who require a passkey, are only partly
+// logged in until they use their second factor, which Authenticated does not
+// accept. Users who require a passkey can only finish with one, even if they
+// have an authenticator app too.
+func (app *application) logIn(r *http.Request, user *models.User) (string, error) {
+	passkey, err := app.passkeys.Required(r.Context(), user)
+	if err != nil {
+		return "", err
+	}
+	pending := passkey
+	if !pending {
+		pending, err = app.twoFactor.Enabled(r.Context(), user.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	app.sessionManager.RenewToken(r.Context())
+	app.sessionManager.Put(r.Context(), "userId", user.ID)
+	app.sessionManager.Put(r.Context(), "sessionVersion", user.SessionVersion)
+	app.sessionManager.Remove(r.Context(), "twoFactorRequires")
+	if !pending {
+		app.sessionManager.Remove(r.Context(), "twoFactorPending")
+		return "/", nil
+	}
+	app.sessionManager.Put(r.Context(), "twoFactorPending", true)
+	if passkey {
+		app.sessionManager.Put(r.Context(), "twoFactorRequires", "passkey")
+	}
+	app.sessionManager.Put(r.Context(), "twoFactorStartedAt", time.Now())
+	return "/login/2fa", nil
+}
+
+// finishLogIn fully logs in the user who was waiting on their second factor.
+func (app *application) finishLogIn(r *http.Request) {
+	app.sessionManager.RenewToken(r.Context())
+	app.sessionManager.Remove(r.Context(), "twoFactorPending")
+	app.sessionManager.Remove(r.Context(), "twoFactorRequires")
+	app.sessionManager.Remove(r.Context(), "twoFactorStartedAt")
+}
+
+// pendingUser returns the user who has entered their password but not yet
+// their code, if there is one and they have not run out of time.
+func (app *application) pendingUser(r *http.Request) (*models.User, bool) {
+	if !app.sessionManager.GetBool(r.Context(), "twoFactorPending") {
+		return nil, false
+	}
+	if time.Since(app.sessionManager.GetTime(r.Context(), "twoFactorStartedAt")) > TWO_FACTOR_TIMEOUT {
+		return nil, false
+	}
+	id, ok := app.sessionManager.Get(r.Context(), "userId").(uuid.UUID)
+	if !ok {
+		return nil, false
+	}
+	user, err := app.users.GetUser(r.Context(), id)
+	if err != nil || app.sessionManager.GetInt(r.Context(), "sessionVersion") != user.SessionVersion {
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) TwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.pendingUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	app.renderTwoFactor(w, r, user)
+}
+
+// passkeyRequired reports whether the pending login can only be finished with
+// a passkey.
+func (app *application) passkeyRequired(r *http.Request) bool {
+	return app.sessionManager.GetString(r.Context(), "twoFactorRequires") == "passkey"
+}
+
+// renderTwoFactor renders the second step of logging in, with the factors the
+// user can finish it with.
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, user *models.User) {
+	totp, err := app.twoFactor.Enabled(r.Context(), user.ID)
+	if err != nil {
+		app.logger.Error("could not get two-factor authentication", "user", user.ID, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	totp = totp && !app.passkeyRequired(r)
+	passkeys, err := app.passkeys.GetAll(r.Context(), user.ID)
+	if err != nil {
+		app.logger.Error("could not get passkeys", "user", user.ID, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	pages.TwoFactorLogin(totp, len(passkeys) > 0).Render(r.Context(), w)
+}
+
+// TwoFactorLogin finishes logging in with a code from the user's authenticator
+// app or a recovery code. Once the user has entered too many wrong codes they
+// are sent back to log in again, and cannot finish until the lockout is over.
+func (app *application) TwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.pendingUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if app.passkeyRequired(r) {
+		app.logger.Info("two-factor code used when a passkey is required", "user", user.ID)
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Use one of your passkeys to finish logging in"))
+		app.renderTwoFactor(w, r, user)
+		return
+	}
+
+	err := app.twoFactor.Verify(r.Context(), user.ID, r.FormValue("code"))
+	if err != nil {
+		flash := "Could not check the code. Please try again."
+		switch err {
+		case service.ErrInvalidCode:
+			app.logger.Info("invalid two-factor code", "user", user.ID)
+			flash = "That code is not valid"
+		case service.ErrTooManyAttempts:
+			app.logger.Info("too many invalid two-factor codes", "user", user.ID)
+			app.sessionManager.RenewToken(r.Context())
+			app.sessionManager.Remove(r.Context(), "userId")
+			app.sessionManager.Remove(r.Context(), "twoFactorPending")
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Too many invalid codes. Please try again later."))
+			pages.Login(map[string]string{"email": user.Email}, nil).Render(r.Context(), w)
+			return
+		default:
+			app.logger.Error("could not verify two-factor code", "user", user.ID, "error", err.Error())
+		}
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+		app.renderTwoFactor(w, r, user)
+		return
+	}
+	app.logger.Info("login from", "name", user.Name, "email", user.Email, "twoFactor", true)
+
+	app.finishLogIn(r)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// EnrolTwoFactor starts setting up two-factor authentication with a new
+// secret. It cannot be set up without a secret key to keep the secret with.
+func (app *application) EnrolTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.config.randomKey {
+		app.renderAccount(w, r, pages.AccountView{})
+		return
+	}
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	enrolment, err := app.twoFactor.Enrol(r.Context(), user)
+	if err != nil {
+		if err != service.ErrTwoFactorEnabled {
+			app.logger.Error("could not enrol two-factor authentication", "user", user.ID, "error", err.Error())
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not set up two-factor authentication. Please try again."))
+		}
+		app.renderAccount(w, r, pages.AccountView{})
+		return
+	}
+	app.renderAccount(w, r, pages.AccountView{Enrolment: &enrolment})
+}
+
+// EnableTwoFactor turns on two-factor authentication once the user enters a
+// code from the secret they are setting up, and shows their recovery codes.
+func (app *application) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.config.randomKey {
+		app.renderAccount(w, r, pages.AccountView{})
+		return
+	}
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	codes, err := app.twoFactor.Enable(r.Context(), user.ID, r.FormValue("code"))
+	if err != nil {
+		view := pages.AccountView{}
+		switch err {
+		case service.ErrInvalidCode:
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "That code is not valid. Check your authenticator app and try again."))
+			if enrolment, err := app.twoFactor.Pending(r.Context(), user); err == nil {
+				view.Enrolment = &enrolment
+			}
+		case models.ErrTOTPNotFound, service.ErrTwoFactorEnabled:
+		default:
+			app.logger.Error("could not enable two-factor authentication", "user", user.ID, "error", err.Error())
+			r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not turn on two-factor authentication. Please try again."))
+		}
+		app.renderAccount(w, r, view)
+		return
+	}
+	app.logger.Info("enabled two-factor authentication", "user", user.ID)
+	app.renderAccount(w, r, pages.AccountView{RecoveryCodes: codes})
+}
+
+func (app *application) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.confirmPassword(w, r)
+	if !ok {
+		return
+	}
+	err := app.twoFactor.Disable(r.Context(), user.ID)
+	if err != nil {
+		app.logger.Error("could not disable two-factor authentication", "user", user.ID, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not turn off two-factor authentication. Please try again."))
+	} else {
+		app.logger.Info("disabled two-factor authentication", "user", user.ID)
+	}
+	app.renderAccount(w, r, pages.AccountView{})
+}
+
+func (app *application) NewRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.confirmPassword(w, r)
+	if !ok {
+		return
+	}
+	codes, err := app.twoFactor.NewRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		app.logger.Error("could not create recovery codes", "user", user.ID, "error", err.Error())
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not create recovery codes. Please try again."))
+		app.renderAccount(w, r, pages.AccountView{})
+		return
+	}
+	app.logger.Info("created recovery codes", "user", user.ID)
+	app.renderAccount(w, r, pages.AccountView{RecoveryCodes: codes})
+}
+
+// confirmPassword checks the password the user entered to change how they
+// log in, rendering the account page if it is wrong.
+func (app *application) confirmPassword(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := app.users.GetUser(r.Context(), r.Context().Value(components.UserKey).(uuid.UUID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	_, err = app.users.Login(r.Context(), user.Email, r.FormValue("password"))
+	if err != nil {
+		flash := "Password is incorrect"
+		if err != service.ErrInvalidCredentials {
+			app.logger.Error("could not check password", "user", user.ID, "error", err.Error())
+			flash = "Could not check your password. Please try again."
+		}
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+		app.renderAccount(w, r, pages.AccountView{})
+		return nil, false
+	}
+	return user, true
+}
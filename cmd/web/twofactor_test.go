@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/internal/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register(t, "Test", "test@example.com")
+	login := url.Values{"email": {"test@example.com"}, "password": {"pa55word"}}
+
+	contains(t, ts.get(t, "/account").fragment(t, "two-factor"), `hx-post="/account/2fa"`)
+	account := ts.do(t, http.MethodPost, "/account/2fa", nil).fragment(t, "account")
+	contains(t, account, `<div id="qr-code"`, "<svg ")
+	secret := find(t, account, `select-all text-sm">([A-Z2-7]+)<`)
+
+	account = ts.do(t, http.MethodPost, "/account/2fa/enable", url.Values{"code": {"123"}}).fragment(t, "account")
+	contains(t, account, "That code is not valid", secret)
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+	account = ts.do(t, http.MethodPost, "/account/2fa/enable", url.Values{"code": {code}}).fragment(t, "account")
+	recovery := strings.Split(strings.TrimSpace(strings.NewReplacer("<li>", "", "</li>", "\n").Replace(
+		find(t, account, `<ul id="recovery-codes"[^>]*>(.*?)</ul>`))), "\n")
+	if len(recovery) != 10 {
+		t.Fatalf("got recovery codes %q", recovery)
+	}
+	contains(t, ts.get(t, "/account").fragment(t, "two-factor"), "You have 10 recovery codes left")
+
+	// The password alone only partly logs in
+	other := ts.session(t)
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/login/2fa")
+	other.get(t, "/").redirectsTo(t, "/login")
+	other.get(t, "/verify-email").redirectsTo(t, "/login")
+	if res := other.get(t, "/api/v1/items"); res.status != http.StatusUnauthorized {
+		t.Errorf("GET /api/v1/items partly logged in = %d, want %d", res.status, http.StatusUnauthorized)
+	}
+	contains(t, other.get(t, "/login/2fa").body, `action="/login/2fa"`)
+	contains(t, other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {code}}).body, "That code is not valid")
+	next, _ := totp.Code(secret, step+1)
+	other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {next}}).redirectsTo(t, "/")
+	if res := other.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry after the code = %d, want %d", res.status, http.StatusOK)
+	}
+
+	// Recovery codes work once
+	other = ts.session(t)
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/login/2fa")
+	other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {recovery[0]}}).redirectsTo(t, "/")
+	other = ts.session(t)
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/login/2fa")
+	contains(t, other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {recovery[0]}}).body, "That code is not valid")
+	for i := 1; i < service.MAX_TWO_FACTOR_ATTEMPTS-1; i++ {
+		other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {"000000"}})
+	}
+	contains(t, other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {"000000"}}).body, "Too many invalid codes", `action="/login"`)
+	other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {recovery[1]}}).redirectsTo(t, "/login")
+
+	// Logging in again does not give any more guesses
+	other = ts.session(t)
+	other.do(t, http.MethodPost, "/login", login).redirectsTo(t, "/login/2fa")
+	contains(t, other.do(t, http.MethodPost, "/login/2fa", url.Values{"code": {recovery[1]}}).body, "Too many invalid codes")
+	other.get(t, "/pantry").redirectsTo(t, "/login")
+
+	contains(t, ts.do(t, http.MethodPost, "/account/2fa/recovery-codes", url.Values{"password": {"wrong"}}).fragment(t, "account"), "Password is incorrect")
+	account = ts.do(t, http.MethodPost, "/account/2fa/recovery-codes", url.Values{"password": {"pa55word"}}).fragment(t, "account")
+	contains(t, account, `<ul id="recovery-codes"`, "You have 10 recovery codes left")
+
+	contains(t, ts.do(t, http.MethodPost, "/account/2fa/disable", url.Values{"password": {"wrong"}}).fragment(t, "account"), "Password is incorrect")
+	contains(t, ts.do(t, http.MethodPost, "/account/2fa/disable", url.Values{"password": {"pa55word"}}).fragment(t, "two-factor"), `hx-post="/account/2fa"`)
+	ts.session(t).do(t, http.MethodPost, "/login", login).redirectsTo(t, "/")
+}
+
+func TestTwoFactorRandomKey(t *testing.T) {
+	ts := newTestServer(t, func(cfg *config) {
+		cfg.randomKey = true
+	})
+	ts.register(t, "Test", "test@example.com")
+
+	section := ts.get(t, "/account").fragment(t, "two-factor")
+	contains(t, section, "cannot be set up until the server is given a secret key")
+	if strings.Contains(section, `hx-post="/account/2fa"`) {
+		t.Error("two-factor authentication is offered without a secret key")
+	}
+	for _, path := range []string{"/account/2fa", "/account/2fa/enable"} {
+		if account := ts.do(t, http.MethodPost, path, url.Values{"code": {"123456"}}).fragment(t, "account"); strings.Contains(account, `<div id="qr-code"`) {
+			t.Errorf("POST %s set up two-factor authentication without a secret key", path)
+		}
+	}
+	ts.session(t).do(t, http.MethodPost, "/login", url.Values{"email": {"test@example.com"}, "password": {"pa55word"}}).redirectsTo(t, "/")
+}
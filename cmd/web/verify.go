@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/components/pages"
+	"github.com/hunterwilkins2/trolly/internal/mail"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/service"
+)
+
+// VERIFICATION_RESEND_INTERVAL is how long a user has to wait to be sent
+// another verification link.
+const VERIFICATION_RESEND_INTERVAL = time.Minute
+
+// VerifyEmailPage verifies the email with the link's token, or asks the user
+// who is logged in to open the link they were sent.
+func (app *application) VerifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	user, status := app.sessionUser(r)
+	if token := r.URL.Query().Get("token"); token != "" {
+		verified, err := app.users.VerifyEmail(r.Context(), token)
+		if err == nil {
+			app.logger.Info("verified email", "user", verified.ID)
+			if status == http.StatusOK && user.ID == verified.ID {
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			pages.VerifyEmail(pages.VerifyEmailView{Verified: true}).Render(r.Context(), w)
+			return
+		}
+
+		flash := "This link has expired or is not valid."
+		if err != service.ErrInvalidToken {
+			app.logger.Error("could not verify email", "error", err.Error())
+			flash = "Could not verify your email. Please try again."
+		}
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, flash))
+	} else if status != http.StatusOK {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	view := pages.VerifyEmailView{}
+	if status == http.StatusOK {
+		if user.Verified() {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		view.Email = user.Email
+	}
+	pages.VerifyEmail(view).Render(r.Context(), w)
+}
+
+// ResendVerification sends the user who is logged in a new link, at most once
+// every VERIFICATION_RESEND_INTERVAL.
+func (app *application) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, status := app.sessionUser(r)
+	if status != http.StatusOK {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if user.Verified() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	view := pages.VerifyEmailView{Email: user.Email}
+	sentAt := app.sessionManager.GetTime(r.Context(), "verificationSentAt")
+	if time.Since(sentAt) < VERIFICATION_RESEND_INTERVAL {
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "A link was sent less than a minute ago. Please wait before sending another."))
+	} else if err := app.sendVerification(r, user); err != nil {
+		r = r.WithContext(context.WithValue(r.Context(), components.FlashKey, "Could not send a new link. Please try again."))
+	} else {
+		view.Sent = true
+	}
+	pages.VerifyEmail(view).Render(r.Context(), w)
+}
+
+// sendVerification emails the user a link to verify their email with.
+func (app *application) sendVerification(r *http.Request, user *models.User) error {
+	token := app.users.VerificationToken(user)
+	err := app.config.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Trolly email",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to Trolly! To verify your email and start using your account, "+
+			"open this link within the next day:\n\n%s/verify-email?token=%s\n\n"+
+			"If you did not sign up for Trolly, you can ignore this email.\n",
+			user.Name, app.config.baseURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		app.logger.Error("could not send verification", "user", user.ID, "error", err.Error())
+		return err
+	}
+	app.sessionManager.Put(r.Context(), "verificationSentAt", time.Now())
+	app.logger.Info("sent verification", "user", user.ID)
+	return nil
+}
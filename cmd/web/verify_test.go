@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	ts := newTestServer(t)
+	ts.do(t, http.MethodPost, "/register", url.Values{"name": {"Test"}, "email": {"test@example.com"}, "password": {"pa55word"}}).redirectsTo(t, "/")
+	contains(t, ts.mail.String(), "To: test@example.com", "Subject: Verify your Trolly email")
+	link := ts.link(t, "test@example.com", "/verify-email")
+
+	// Unverified users can only get to the page asking them to verify
+	ts.get(t, "/").redirectsTo(t, "/verify-email")
+	ts.get(t, "/pantry").redirectsTo(t, "/verify-email")
+	ts.do(t, http.MethodPost, "/items", url.Values{"item": {"Milk"}}).redirectsTo(t, "/verify-email")
+	if res := ts.get(t, "/api/v1/items"); res.status != http.StatusForbidden {
+		t.Errorf("GET /api/v1/items = %d, want %d", res.status, http.StatusForbidden)
+	}
+	contains(t, ts.get(t, "/verify-email").body, "We sent a link to test@example.com", `action="/verify-email"`, `hx-post="/logout"`)
+
+	// Links can only be resent once a minute
+	res := ts.do(t, http.MethodPost, "/verify-email", nil)
+	contains(t, res.body, "A link was sent less than a minute ago")
+
+	res = ts.get(t, "/verify-email?token=not-a-token")
+	contains(t, res.body, "This link has expired or is not valid.", "We sent a link to test@example.com")
+
+	// The link works without being logged in, such as on another device
+	other := ts.session(t)
+	contains(t, other.get(t, link).body, "Your email has been verified.")
+	ts.get(t, "/verify-email").redirectsTo(t, "/")
+	if res := ts.get(t, "/pantry"); res.status != http.StatusOK {
+		t.Errorf("GET /pantry once verified = %d, want %d", res.status, http.StatusOK)
+	}
+	ts.get(t, link).redirectsTo(t, "/")
+
+	other.get(t, "/verify-email").redirectsTo(t, "/login")
+	other.do(t, http.MethodPost, "/verify-email", nil).redirectsTo(t, "/login")
+}
@@ -0,0 +1,61 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+const (
+	CHART_WIDTH   = 600
+	CHART_HEIGHT  = 200
+	CHART_PADDING = 20
+)
+
+type chartPoint struct {
+	X     float64
+	Y     float64
+	Price models.ItemPrice
+}
+
+// priceChart places each price on a CHART_WIDTH by CHART_HEIGHT chart, spaced
+// by when it was recorded and scaled between the lowest and highest price.
+func priceChart(prices []models.ItemPrice, min, max money.Amount) []chartPoint {
+	if len(prices) == 0 {
+		return nil
+	}
+	start := prices[0].RecordedAt
+	span := prices[len(prices)-1].RecordedAt.Sub(start).Seconds()
+	width := float64(CHART_WIDTH - 2*CHART_PADDING)
+	height := float64(CHART_HEIGHT - 2*CHART_PADDING)
+
+	points := make([]chartPoint, len(prices))
+	for i, price := range prices {
+		x := 0.5
+		if span > 0 {
+			x = price.RecordedAt.Sub(start).Seconds() / span
+		} else if len(prices) > 1 {
+			x = float64(i) / float64(len(prices)-1)
+		}
+		y := 0.5
+		if max.Minor > min.Minor {
+			y = float64(price.Price.Minor-min.Minor) / float64(max.Minor-min.Minor)
+		}
+		points[i] = chartPoint{
+			X:     CHART_PADDING + x*width,
+			Y:     CHART_PADDING + (1-y)*height,
+			Price: price,
+		}
+	}
+	return points
+}
+
+func chartLine(points []chartPoint) string {
+	coords := make([]string, len(points))
+	for i, point := range points {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", point.X, point.Y)
+	}
+	return strings.Join(coords, " ")
+}
@@ -0,0 +1,40 @@
+package pages
+
+import (
+	"context"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+// currency is the currency of the instance, which amounts without one are
+// shown in.
+func currency(ctx context.Context) money.Currency {
+	if currency, ok := ctx.Value(components.CurrencyKey).(money.Currency); ok && currency != "" {
+		return currency
+	}
+	return money.DEFAULT_CURRENCY
+}
+
+// inCurrency gives the amount the instance's currency if it has none.
+func inCurrency(ctx context.Context, amount money.Amount) money.Amount {
+	if amount.Currency == "" {
+		amount.Currency = currency(ctx)
+	}
+	return amount
+}
+
+// formatPrice formats the amount with its currency's symbol.
+func formatPrice(ctx context.Context, amount money.Amount) string {
+	return inCurrency(ctx, amount).String()
+}
+
+// lineTotal formats the price of quantity of an item, or nothing if it is too
+// large to count.
+func lineTotal(ctx context.Context, price money.Amount, quantity int) string {
+	total, err := inCurrency(ctx, price).Mul(quantity)
+	if err != nil {
+		return ""
+	}
+	return total.String()
+}
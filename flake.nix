@@ -9,11 +9,12 @@
     system = "x86_64-linux";
     pkgs = nixpkgs.legacyPackages.${system};
     fs = nixpkgs.lib.fileset;
-    goFiles = fs.unions [ ./cmd ./internal (fs.fileFilter (file: nixpkgs.lib.hasSuffix ".go" file.name) ./components) ];
+    goFiles = fs.unions [ ./api ./cmd ./internal (fs.fileFilter (file: nixpkgs.lib.hasSuffix ".go" file.name) ./components) ];
     staticFiles = fs.unions [ ./static/css/dist/output.css ./static/img ./static/js ];
     source = fs.unions [ 
       ./go.mod
       ./go.sum
+      ./migrations
       goFiles
       staticFiles
     ];
@@ -42,13 +43,9 @@
 
       migration = pkgs.writeShellApplication {
         name = "trolly-migrate";
-        runtimeInputs = let 
-          go-migrate-pg = pkgs.go-migrate.overrideAttrs(oldAttrs: {
-            tags = ["mysql"];
-          }); 
-        in [ go-migrate-pg ]; 
+        runtimeInputs = [ self.packages.${system}.default ];
         text = ''
-          migrate -path=${./migrations} -database="mysql://$DB_USER@$DB_HOST/trolly" up
+          trolly -db-host "$DB_HOST" -db-user "$DB_USER" -db-name "$DB_NAME" migrate up
         '';
       };
     };
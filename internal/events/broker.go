@@ -0,0 +1,72 @@
+package events
+
+import "sync"
+
+const SUBSCRIBER_BUFFER = 16
+
+const (
+	BasketItemAdded   = "basket.added"
+	BasketItemUpdated = "basket.updated"
+	BasketItemRemoved = "basket.removed"
+	BasketCleared     = "basket.cleared"
+	TripFinished      = "trip.finished"
+)
+
+type Event struct {
+	Type     string `json:"type"`
+	ListID   int64  `json:"listId"`
+	BasketID int64  `json:"basketId,omitempty"`
+}
+
+// Broker fans basket events out to every subscriber of a list. Events are only
+// delivered to subscribers connected to the same process.
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[int64]map[chan Event]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[int64]map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the list's events and a function that
+// unsubscribes and closes the channel.
+func (b *Broker) Subscribe(listId int64) (<-chan Event, func()) {
+	ch := make(chan Event, SUBSCRIBER_BUFFER)
+
+	b.mu.Lock()
+	if b.subscribers[listId] == nil {
+		b.subscribers[listId] = make(map[chan Event]struct{})
+	}
+	b.subscribers[listId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers[listId], ch)
+			if len(b.subscribers[listId]) == 0 {
+				delete(b.subscribers, listId)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the event to the list's subscribers without blocking.
+// Subscribers with a full buffer miss the event.
+func (b *Broker) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[event.ListID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
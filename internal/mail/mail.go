@@ -0,0 +1,123 @@
+// Package mail sends the emails Trolly needs, like password reset links.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidHeader = errors.New("headers cannot contain line breaks")
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format renders the message with its headers, ready to be sent.
+func (m Message) format(from string, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(from+m.To+m.Subject, "\r\n") {
+		return nil, ErrInvalidHeader
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.Write(bytes.ReplaceAll([]byte(m.Body), []byte("\n"), []byte("\r\n")))
+	b.WriteString("\r\n")
+	return b.Bytes(), nil
+}
+
+// SMTPMailer sends mail through an SMTP server, upgrading to TLS when the
+// server supports STARTTLS. Username and password are optional.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func NewSMTPMailer(host string, port int, username string, password string, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		From:     from,
+		Username: username,
+		Password: password,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	b, err := msg.format(m.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail cannot be cancelled, so the context only stops the wait
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.Addr, auth, from.Address, []string{msg.To}, b)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer writes mail to w instead of sending it, for development and tests.
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{
+		w:    w,
+		from: from,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	b, err := msg.format(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = m.w.Write(append(bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n")), '\n'))
+	return err
+}
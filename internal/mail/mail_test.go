@@ -0,0 +1,98 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf, "Trolly <trolly@example.com>")
+	err := m.Send(context.Background(), Message{To: "test@example.com", Subject: "Réinitialiser", Body: "Hello\nWorld"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From: Trolly <trolly@example.com>\n", "To: test@example.com\n", "Subject: =?utf-8?q?R=C3=A9initialiser?=\n", "\n\nHello\nWorld\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+
+	err = m.Send(context.Background(), Message{To: "test@example.com\r\nBcc: evil@example.com", Subject: "Hi"})
+	if err != ErrInvalidHeader {
+		t.Errorf("Send() with a line break in To = %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+// TestSMTPMailer sends a message to a server that speaks just enough SMTP to
+// receive it.
+func TestSMTPMailer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type received struct {
+		from, to, data string
+	}
+	got := make(chan received, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		conn := textproto.NewConn(c)
+		var r received
+		conn.PrintfLine("220 localhost ready")
+		for {
+			line, err := conn.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				conn.PrintfLine("250 localhost")
+			case "MAIL":
+				r.from = arg
+				conn.PrintfLine("250 OK")
+			case "RCPT":
+				r.to = arg
+				conn.PrintfLine("250 OK")
+			case "DATA":
+				conn.PrintfLine("354 Go ahead")
+				lines, _ := conn.ReadDotLines()
+				r.data = strings.Join(lines, "\n")
+				conn.PrintfLine("250 OK")
+			case "QUIT":
+				conn.PrintfLine("221 Bye")
+				got <- r
+				return
+			default:
+				conn.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	m := NewSMTPMailer(host, p, "", "", "Trolly <trolly@example.com>")
+	err = m.Send(context.Background(), Message{To: "test@example.com", Subject: "Hi", Body: "Hello\n.\nWorld"})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	r := <-got
+	if r.from != "FROM:<trolly@example.com>" || r.to != "TO:<test@example.com>" {
+		t.Errorf("envelope = %s %s", r.from, r.to)
+	}
+	if !strings.Contains(r.data, "Subject: Hi\n") || !strings.HasSuffix(r.data, "\nHello\n.\nWorld") {
+		t.Errorf("data = %q", r.data)
+	}
+}
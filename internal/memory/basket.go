@@ -0,0 +1,251 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+type BasketRepository struct {
+	db *DB
+}
+
+func NewBasketRepository(db *DB) *BasketRepository {
+	return &BasketRepository{
+		db: db,
+	}
+}
+
+// basketRow returns the row in the list's basket matching the filter, or nil if
+// there is none.
+func (t *tables) basketRow(householdId, listId int64, match func(b *basketRow) bool) *basketRow {
+	for n := range t.basket {
+		b := &t.basket[n]
+		if b.householdId == householdId && b.listId == listId && match(b) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (t *tables) toBasketItem(b *basketRow) models.BasketItem {
+	return models.BasketItem{
+		BasketID:  b.id,
+		Purchased: b.purchased,
+		Quantity:  b.quantity,
+		Unit:      b.unit,
+		Store:     b.store,
+		Note:      b.note,
+		Item:      t.toItem(t.item(b.householdId, b.itemId)),
+	}
+}
+
+func (r *BasketRepository) Get(ctx context.Context, listId int64) (models.Basket, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	items := []models.BasketItem{}
+	var total money.Amount
+	for n := range r.db.basket {
+		b := &r.db.basket[n]
+		if b.householdId != householdId || b.listId != listId {
+			continue
+		}
+		item := r.db.toBasketItem(b)
+		item.Price = r.db.shownPrice(ctx, r.db.item(householdId, b.itemId))
+		line, err := item.Price.Mul(item.Quantity)
+		if err != nil {
+			return models.Basket{}, err
+		}
+		total, err = total.Add(line)
+		if err != nil {
+			return models.Basket{}, err
+		}
+		items = append(items, item)
+	}
+	slices.SortStableFunc(items, func(a, b models.BasketItem) int {
+		return cmp.Compare(boolInt(a.Purchased), boolInt(b.Purchased))
+	})
+
+	return models.Basket{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (r *BasketRepository) GetItem(ctx context.Context, listId int64, basketId int64) (models.BasketItem, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	b := r.db.basketRow(householdId, listId, func(b *basketRow) bool { return b.id == basketId })
+	if b == nil {
+		return models.BasketItem{}, models.ErrBasketItemNotFound
+	}
+	item := r.db.toBasketItem(b)
+	item.Price = r.db.shownPrice(ctx, r.db.item(householdId, b.itemId))
+	return item, nil
+}
+
+// Add puts the item in the list's basket. Items that are already in the basket
+// have their quantity increased instead of being added a second time, and keep
+// their unit, store and note unless new ones are given. Items that have been
+// bought are put back to buy again with just the new quantity.
+func (r *BasketRepository) Add(ctx context.Context, listId int64, item models.BasketItem) (models.BasketItem, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	b := r.db.basketRow(householdId, listId, func(b *basketRow) bool { return b.itemId == item.ID })
+	if b != nil {
+		if b.purchased {
+			b.quantity = min(item.Quantity, 9999)
+			b.purchased = false
+		} else {
+			b.quantity = min(b.quantity+item.Quantity, 9999)
+		}
+		if item.Unit != "" {
+			b.unit = item.Unit
+		}
+		if item.Store != "" {
+			b.store = item.Store
+		}
+		if item.Note != "" {
+			b.note = item.Note
+		}
+	} else {
+		r.db.basket = append(r.db.basket, basketRow{
+			id:          r.db.nextId(),
+			householdId: householdId,
+			listId:      listId,
+			itemId:      item.ID,
+			userId:      userId,
+			quantity:    item.Quantity,
+			unit:        item.Unit,
+			store:       item.Store,
+			note:        item.Note,
+		})
+		b = &r.db.basket[len(r.db.basket)-1]
+	}
+
+	item.BasketID = b.id
+	item.Purchased = b.purchased
+	item.Quantity = b.quantity
+	item.Unit = b.unit
+	item.Store = b.store
+	item.Note = b.note
+	return item, nil
+}
+
+func (r *BasketRepository) UpdateQuantity(ctx context.Context, listId int64, item *models.BasketItem) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	if b := r.db.basketRow(householdId, listId, func(b *basketRow) bool { return b.id == item.BasketID }); b != nil {
+		b.quantity = item.Quantity
+		b.unit = item.Unit
+	}
+	return nil
+}
+
+func (r *BasketRepository) TogglePurchased(ctx context.Context, listId int64, item *models.BasketItem) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	b := r.db.basketRow(householdId, listId, func(b *basketRow) bool { return b.id == item.BasketID })
+	if b == nil {
+		return models.ErrBasketItemNotFound
+	}
+	if b.purchased != item.Purchased {
+		return models.ErrBasketItemChanged
+	}
+	b.purchased = !item.Purchased
+	item.Purchased = !item.Purchased
+	return nil
+}
+
+// remove deletes the list's basket rows matching the filter, unlinking the
+// purchases made from them, and returns how many there were.
+func (t *tables) remove(householdId, listId int64, match func(b *basketRow) bool) int {
+	removed := map[int64]bool{}
+	t.basket = slices.DeleteFunc(t.basket, func(b basketRow) bool {
+		if b.householdId == householdId && b.listId == listId && match(&b) {
+			removed[b.id] = true
+			return true
+		}
+		return false
+	})
+	for n := range t.purchases {
+		if removed[t.purchases[n].basketId] {
+			t.purchases[n].basketId = 0
+		}
+	}
+	return len(removed)
+}
+
+func (r *BasketRepository) Remove(ctx context.Context, listId int64, basketId int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	if r.db.remove(householdId, listId, func(b *basketRow) bool { return b.id == basketId }) == 0 {
+		return models.ErrBasketItemNotFound
+	}
+	return nil
+}
+
+func (r *BasketRepository) RemoveAll(ctx context.Context, listId int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	if r.db.remove(householdId, listId, func(b *basketRow) bool { return true }) == 0 {
+		return models.ErrBasketItemNotFound
+	}
+	return nil
+}
+
+// GetPurchased returns the purchased items on the list at the price they were
+// bought for, which is the item's latest price if no purchase was recorded.
+func (r *BasketRepository) GetPurchased(ctx context.Context, listId int64) ([]models.BasketItem, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	items := []models.BasketItem{}
+	for n := range r.db.basket {
+		b := &r.db.basket[n]
+		if b.householdId == householdId && b.listId == listId && b.purchased {
+			item := r.db.toBasketItem(b)
+			item.TimesBought = 0
+			for _, p := range r.db.purchases {
+				if p.householdId == householdId && p.basketId == b.id {
+					item.Price = r.db.stored(p.price)
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b models.BasketItem) int {
+		return cmp.Compare(a.BasketID, b.BasketID)
+	})
+	return items, nil
+}
+
+func (r *BasketRepository) RemovePurchased(ctx context.Context, listId int64, basketIds []int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	r.db.remove(householdId, listId, func(b *basketRow) bool {
+		return b.purchased && slices.Contains(basketIds, b.id)
+	})
+	return nil
+}
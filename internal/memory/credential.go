@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type CredentialRepository struct {
+	db *DB
+}
+
+func NewCredentialRepository(db *DB) *CredentialRepository {
+	return &CredentialRepository{
+		db: db,
+	}
+}
+
+func (r *CredentialRepository) Create(ctx context.Context, credential *models.Credential) error {
+	defer r.db.lock(ctx)()
+
+	for _, existing := range r.db.credentials {
+		if existing.CredentialID == credential.CredentialID {
+			return models.ErrDuplicateCredential
+		}
+	}
+	credential.ID = r.db.nextId()
+	credential.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	saved := *credential
+	saved.Data = slices.Clone(credential.Data)
+	r.db.credentials = append(r.db.credentials, saved)
+	return nil
+}
+
+func (r *CredentialRepository) GetAll(ctx context.Context, userId uuid.UUID) ([]models.Credential, error) {
+	defer r.db.lock(ctx)()
+
+	credentials := []models.Credential{}
+	for _, credential := range r.db.credentials {
+		if credential.UserID == userId {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *CredentialRepository) GetByCredentialID(ctx context.Context, credentialId string) (models.Credential, error) {
+	defer r.db.lock(ctx)()
+
+	for _, credential := range r.db.credentials {
+		if credential.CredentialID == credentialId {
+			return credential, nil
+		}
+	}
+	return models.Credential{}, models.ErrCredentialNotFound
+}
+
+func (r *CredentialRepository) Used(ctx context.Context, credential *models.Credential) error {
+	defer r.db.lock(ctx)()
+
+	credential.LastUsedAt = time.Now().UTC().Truncate(time.Second)
+	for n := range r.db.credentials {
+		if r.db.credentials[n].ID == credential.ID {
+			r.db.credentials[n].Data = slices.Clone(credential.Data)
+			r.db.credentials[n].LastUsedAt = credential.LastUsedAt
+		}
+	}
+	return nil
+}
+
+func (r *CredentialRepository) Delete(ctx context.Context, userId uuid.UUID, id int64) error {
+	defer r.db.lock(ctx)()
+
+	n := len(r.db.credentials)
+	r.db.credentials = slices.DeleteFunc(r.db.credentials, func(credential models.Credential) bool {
+		return credential.UserID == userId && credential.ID == id
+	})
+	if len(r.db.credentials) == n {
+		return models.ErrCredentialNotFound
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type HouseholdRepository struct {
+	db *DB
+}
+
+func NewHouseholdRepository(db *DB) *HouseholdRepository {
+	return &HouseholdRepository{
+		db: db,
+	}
+}
+
+func (t *tables) household(id int64) *household {
+	for n := range t.households {
+		if t.households[n].id == id {
+			return &t.households[n]
+		}
+	}
+	return nil
+}
+
+func (t *tables) user(id uuid.UUID) *models.User {
+	for n := range t.users {
+		if t.users[n].ID == id {
+			return &t.users[n]
+		}
+	}
+	return nil
+}
+
+// toMembers returns the members that match, skipping any whose household or
+// user is missing as the SQL joins would.
+func (t *tables) toMembers(match func(m *member) bool) []models.Member {
+	members := []models.Member{}
+	for n := range t.members {
+		m := &t.members[n]
+		if !match(m) {
+			continue
+		}
+		h := t.household(m.householdId)
+		u := t.user(m.userId)
+		if h == nil || u == nil {
+			continue
+		}
+		members = append(members, models.Member{
+			HouseholdID:   h.id,
+			HouseholdName: h.name,
+			UserID:        u.ID,
+			Name:          u.Name,
+			Email:         u.Email,
+			Role:          m.role,
+		})
+	}
+	return members
+}
+
+func (t *tables) toInvitations(match func(i *invitation) bool) []models.Invitation {
+	invitations := []models.Invitation{}
+	for n := range t.invitations {
+		i := &t.invitations[n]
+		if !match(i) {
+			continue
+		}
+		h := t.household(i.householdId)
+		u := t.user(i.invitedBy)
+		if h == nil || u == nil {
+			continue
+		}
+		invitations = append(invitations, models.Invitation{
+			ID:            i.id,
+			HouseholdID:   h.id,
+			HouseholdName: h.name,
+			Email:         i.email,
+			Role:          i.role,
+			InvitedBy:     u.Name,
+		})
+	}
+	return invitations
+}
+
+func (t *tables) joinCodeTaken(code string, id int64) bool {
+	for _, h := range t.households {
+		if h.joinCode == code && h.id != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *HouseholdRepository) Create(ctx context.Context, h *models.Household) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	defer r.db.lock(ctx)()
+
+	if r.db.joinCodeTaken(h.JoinCode, 0) {
+		return models.ErrDuplicateJoinCode
+	}
+	h.ID = r.db.nextId()
+	r.db.households = append(r.db.households, household{
+		id:        h.ID,
+		name:      h.Name,
+		joinCode:  h.JoinCode,
+		createdBy: userId,
+	})
+	r.db.members = append(r.db.members, member{
+		householdId: h.ID,
+		userId:      userId,
+		role:        models.RoleOwner,
+	})
+	return nil
+}
+
+func (r *HouseholdRepository) Get(ctx context.Context, id int64) (models.Household, error) {
+	defer r.db.lock(ctx)()
+
+	h := r.db.household(id)
+	if h == nil {
+		return models.Household{}, models.ErrHouseholdNotFound
+	}
+	return models.Household{ID: h.id, Name: h.name, JoinCode: h.joinCode}, nil
+}
+
+func (r *HouseholdRepository) GetByJoinCode(ctx context.Context, code string) (models.Household, error) {
+	defer r.db.lock(ctx)()
+
+	for _, h := range r.db.households {
+		if h.joinCode == code {
+			return models.Household{ID: h.id, Name: h.name, JoinCode: h.joinCode}, nil
+		}
+	}
+	return models.Household{}, models.ErrHouseholdNotFound
+}
+
+func (r *HouseholdRepository) Update(ctx context.Context, household *models.Household) error {
+	defer r.db.lock(ctx)()
+
+	if r.db.joinCodeTaken(household.JoinCode, household.ID) {
+		return models.ErrDuplicateJoinCode
+	}
+	if h := r.db.household(household.ID); h != nil {
+		h.name = household.Name
+		h.joinCode = household.JoinCode
+	}
+	return nil
+}
+
+func (r *HouseholdRepository) GetMembership(ctx context.Context, householdId int64) (models.Member, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	defer r.db.lock(ctx)()
+
+	members := r.db.toMembers(func(m *member) bool {
+		return m.householdId == householdId && m.userId == userId
+	})
+	if len(members) == 0 {
+		return models.Member{}, models.ErrMemberNotFound
+	}
+	return members[0], nil
+}
+
+func (r *HouseholdRepository) GetMemberships(ctx context.Context) ([]models.Member, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	defer r.db.lock(ctx)()
+
+	return r.db.toMembers(func(m *member) bool {
+		return m.userId == userId
+	}), nil
+}
+
+func (r *HouseholdRepository) GetMembers(ctx context.Context, householdId int64) ([]models.Member, error) {
+	defer r.db.lock(ctx)()
+
+	return r.db.toMembers(func(m *member) bool {
+		return m.householdId == householdId
+	}), nil
+}
+
+// LockMembers has nothing to lock, as transactions already run one at a time.
+func (r *HouseholdRepository) LockMembers(ctx context.Context, householdId int64) error {
+	return nil
+}
+
+func (r *HouseholdRepository) AddMember(ctx context.Context, householdId int64, userId uuid.UUID, role models.Role) error {
+	defer r.db.lock(ctx)()
+
+	for _, m := range r.db.members {
+		if m.householdId == householdId && m.userId == userId {
+			return models.ErrAlreadyMember
+		}
+	}
+	r.db.members = append(r.db.members, member{
+		householdId: householdId,
+		userId:      userId,
+		role:        role,
+	})
+	return nil
+}
+
+func (r *HouseholdRepository) UpdateMember(ctx context.Context, householdId int64, userId uuid.UUID, role models.Role) error {
+	defer r.db.lock(ctx)()
+
+	for n := range r.db.members {
+		if r.db.members[n].householdId == householdId && r.db.members[n].userId == userId {
+			r.db.members[n].role = role
+		}
+	}
+	return nil
+}
+
+func (r *HouseholdRepository) RemoveMember(ctx context.Context, householdId int64, userId uuid.UUID) error {
+	defer r.db.lock(ctx)()
+
+	n := len(r.db.members)
+	r.db.members = slices.DeleteFunc(r.db.members, func(m member) bool {
+		return m.householdId == householdId && m.userId == userId
+	})
+	if len(r.db.members) == n {
+		return models.ErrMemberNotFound
+	}
+	return nil
+}
+
+func (r *HouseholdRepository) CreateInvitation(ctx context.Context, i *models.Invitation) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	defer r.db.lock(ctx)()
+
+	for _, existing := range r.db.invitations {
+		if existing.householdId == i.HouseholdID && existing.email == i.Email {
+			return models.ErrDuplicateInvitation
+		}
+	}
+	i.ID = r.db.nextId()
+	r.db.invitations = append(r.db.invitations, invitation{
+		id:          i.ID,
+		householdId: i.HouseholdID,
+		email:       i.Email,
+		role:        i.Role,
+		invitedBy:   userId,
+	})
+	return nil
+}
+
+func (r *HouseholdRepository) GetInvitation(ctx context.Context, id int64) (models.Invitation, error) {
+	defer r.db.lock(ctx)()
+
+	invitations := r.db.toInvitations(func(i *invitation) bool {
+		return i.id == id
+	})
+	if len(invitations) == 0 {
+		return models.Invitation{}, models.ErrInvitationNotFound
+	}
+	return invitations[0], nil
+}
+
+func (r *HouseholdRepository) GetInvitations(ctx context.Context, householdId int64) ([]models.Invitation, error) {
+	defer r.db.lock(ctx)()
+
+	return r.db.toInvitations(func(i *invitation) bool {
+		return i.householdId == householdId
+	}), nil
+}
+
+func (r *HouseholdRepository) GetInvitationsForEmail(ctx context.Context, email string) ([]models.Invitation, error) {
+	defer r.db.lock(ctx)()
+
+	return r.db.toInvitations(func(i *invitation) bool {
+		return i.email == email
+	}), nil
+}
+
+func (r *HouseholdRepository) DeleteInvitation(ctx context.Context, id int64) error {
+	defer r.db.lock(ctx)()
+
+	n := len(r.db.invitations)
+	r.db.invitations = slices.DeleteFunc(r.db.invitations, func(i invitation) bool {
+		return i.id == id
+	})
+	if len(r.db.invitations) == n {
+		return models.ErrInvitationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type IdentityRepository struct {
+	db *DB
+}
+
+func NewIdentityRepository(db *DB) *IdentityRepository {
+	return &IdentityRepository{
+		db: db,
+	}
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, identity *models.Identity) error {
+	defer r.db.lock(ctx)()
+
+	identity.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	r.db.identities = append(r.db.identities, *identity)
+	return nil
+}
+
+func (r *IdentityRepository) Get(ctx context.Context, issuer string, subject string) (models.Identity, error) {
+	defer r.db.lock(ctx)()
+
+	for _, identity := range r.db.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return models.Identity{}, models.ErrIdentityNotFound
+}
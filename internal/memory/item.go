@@ -0,0 +1,227 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type ItemRepository struct {
+	db *DB
+}
+
+func NewItemRepository(db *DB) *ItemRepository {
+	return &ItemRepository{
+		db: db,
+	}
+}
+
+// item returns the household's item, or nil if it does not have one with the
+// id.
+func (t *tables) item(householdId, id int64) *item {
+	for n := range t.items {
+		if t.items[n].householdId == householdId && t.items[n].id == id {
+			return &t.items[n]
+		}
+	}
+	return nil
+}
+
+// stats returns how many of the item its household has bought and when it last
+// did.
+func (t *tables) stats(i *item) (int, time.Time) {
+	timesBought := 0
+	var lastPurchase time.Time
+	for _, p := range t.purchases {
+		if p.householdId == i.householdId && p.itemId == i.id {
+			timesBought += p.quantity
+			if p.purchasedAt.After(lastPurchase) {
+				lastPurchase = p.purchasedAt
+			}
+		}
+	}
+	return timesBought, lastPurchase
+}
+
+func (t *tables) toItem(i *item) models.Item {
+	timesBought, _ := t.stats(i)
+	return models.Item{
+		ID:          i.id,
+		Name:        i.name,
+		Price:       i.price,
+		Category:    i.category,
+		TimesBought: timesBought,
+	}
+}
+
+func (r *ItemRepository) GetAll(ctx context.Context, search string, page int, pageSize int, orderBy string) (models.Metadata, []models.Item, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	type sortable struct {
+		item         *item
+		timesBought  int
+		lastPurchase time.Time
+	}
+	matches := []sortable{}
+	search = strings.ToLower(search)
+	for n := range r.db.items {
+		i := &r.db.items[n]
+		if i.householdId != householdId {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(i.name), strings.TrimSpace(search)) {
+			continue
+		}
+		timesBought, lastPurchase := r.db.stats(i)
+		matches = append(matches, sortable{i, timesBought, lastPurchase})
+	}
+
+	slices.SortFunc(matches, func(a, b sortable) int {
+		// Items without a price come first so they get one
+		if a.item.price.IsZero() != b.item.price.IsZero() {
+			if a.item.price.IsZero() {
+				return -1
+			}
+			return 1
+		}
+		var c int
+		switch orderBy {
+		case "recentlyPurchased":
+			c = b.lastPurchase.Compare(a.lastPurchase)
+		case "recentlyAdded":
+			c = b.item.createdAt.Compare(a.item.createdAt)
+		default:
+			c = cmp.Compare(b.timesBought, a.timesBought)
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(b.item.id, a.item.id)
+	})
+
+	items := []models.Item{}
+	start := min((page-1)*pageSize, len(matches))
+	end := min(start+pageSize, len(matches))
+	for _, match := range matches[start:end] {
+		item := r.db.toItem(match.item)
+		item.Price = r.db.shownPrice(ctx, match.item)
+		items = append(items, item)
+	}
+
+	totalRecords := len(matches)
+	if len(items) == 0 {
+		totalRecords = 0
+	}
+	return models.CalculateMetadata(totalRecords, page, pageSize), items, nil
+}
+
+func (r *ItemRepository) Export(ctx context.Context) ([]models.ItemRecord, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	records := []models.ItemRecord{}
+	for n := range r.db.items {
+		i := &r.db.items[n]
+		if i.householdId != householdId {
+			continue
+		}
+		_, lastPurchase := r.db.stats(i)
+		records = append(records, models.ItemRecord{
+			Item:             r.db.toItem(i),
+			LastPurchaseDate: lastPurchase,
+			CreatedAt:        i.createdAt,
+		})
+	}
+	slices.SortFunc(records, func(a, b models.ItemRecord) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	return records, nil
+}
+
+func (r *ItemRepository) GetById(ctx context.Context, id int64) (models.Item, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	i := r.db.item(householdId, id)
+	if i == nil {
+		return models.Item{}, models.ErrItemNotFound
+	}
+	return r.db.toItem(i), nil
+}
+
+func (r *ItemRepository) GetByName(ctx context.Context, name string) (models.Item, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	for n := range r.db.items {
+		i := &r.db.items[n]
+		if i.householdId == householdId && strings.EqualFold(i.name, name) {
+			return r.db.toItem(i), nil
+		}
+	}
+	return models.Item{}, models.ErrItemNotFound
+}
+
+func (r *ItemRepository) Create(ctx context.Context, i *models.Item) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	i.ID = r.db.nextId()
+	r.db.items = append(r.db.items, item{
+		id:          i.ID,
+		householdId: householdId,
+		userId:      userId,
+		name:        i.Name,
+		price:       r.db.stored(i.Price),
+		category:    i.Category,
+		createdAt:   time.Now(),
+	})
+	return nil
+}
+
+func (r *ItemRepository) Update(ctx context.Context, i *models.Item) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	if existing := r.db.item(householdId, i.ID); existing != nil {
+		existing.name = i.Name
+		existing.price = r.db.stored(i.Price)
+		existing.category = i.Category
+	}
+	return nil
+}
+
+// Delete removes the item along with its purchases and prices.
+func (r *ItemRepository) Delete(ctx context.Context, id int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	if r.db.item(householdId, id) == nil {
+		return models.ErrItemNotFound
+	}
+	r.db.items = slices.DeleteFunc(r.db.items, func(i item) bool {
+		return i.id == id
+	})
+	r.db.purchases = slices.DeleteFunc(r.db.purchases, func(p purchase) bool {
+		return p.itemId == id
+	})
+	r.db.prices = slices.DeleteFunc(r.db.prices, func(p itemPrice) bool {
+		return p.itemId == id
+	})
+	for _, t := range r.db.trips {
+		for n := range t.Items {
+			if t.Items[n].ItemID == id {
+				t.Items[n].ItemID = 0
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type ListRepository struct {
+	db *DB
+}
+
+func NewListRepository(db *DB) *ListRepository {
+	return &ListRepository{
+		db: db,
+	}
+}
+
+func (r *ListRepository) GetAll(ctx context.Context) ([]models.List, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	lists := []models.List{}
+	for _, l := range r.db.lists {
+		if l.householdId == householdId {
+			lists = append(lists, models.List{ID: l.id, Name: l.name})
+		}
+	}
+	return lists, nil
+}
+
+func (r *ListRepository) Get(ctx context.Context, id int64) (models.List, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	for _, l := range r.db.lists {
+		if l.householdId == householdId && l.id == id {
+			return models.List{ID: l.id, Name: l.name}, nil
+		}
+	}
+	return models.List{}, models.ErrListNotFound
+}
+
+func (r *ListRepository) GetDefault(ctx context.Context) (models.List, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	for _, l := range r.db.lists {
+		if l.householdId == householdId {
+			return models.List{ID: l.id, Name: l.name}, nil
+		}
+	}
+	return models.List{}, models.ErrListNotFound
+}
+
+func (r *ListRepository) Create(ctx context.Context, l *models.List) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	l.ID = r.db.nextId()
+	r.db.lists = append(r.db.lists, list{
+		id:          l.ID,
+		householdId: householdId,
+		userId:      userId,
+		name:        l.Name,
+	})
+	return nil
+}
+
+func (r *ListRepository) Update(ctx context.Context, l *models.List) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	for n := range r.db.lists {
+		if r.db.lists[n].householdId == householdId && r.db.lists[n].id == l.ID {
+			r.db.lists[n].name = l.Name
+		}
+	}
+	return nil
+}
+
+// Delete removes the list along with its basket, keeping the trips finished
+// from it.
+func (r *ListRepository) Delete(ctx context.Context, id int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	n := len(r.db.lists)
+	r.db.lists = slices.DeleteFunc(r.db.lists, func(l list) bool {
+		return l.householdId == householdId && l.id == id
+	})
+	if len(r.db.lists) == n {
+		return models.ErrListNotFound
+	}
+	r.db.remove(householdId, id, func(b *basketRow) bool { return true })
+	for n := range r.db.trips {
+		if r.db.trips[n].listId == id {
+			r.db.trips[n].listId = 0
+		}
+	}
+	return nil
+}
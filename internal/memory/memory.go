@@ -0,0 +1,221 @@
+// Package memory keeps the repositories in memory instead of a database. It is
+// meant for tests and trying the app out, as nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+type item struct {
+	id          int64
+	householdId int64
+	userId      uuid.UUID
+	name        string
+	price       money.Amount
+	category    string
+	createdAt   time.Time
+}
+
+type basketRow struct {
+	id          int64
+	householdId int64
+	listId      int64
+	itemId      int64
+	userId      uuid.UUID
+	purchased   bool
+	quantity    int
+	unit        string
+	store       string
+	note        string
+}
+
+type purchase struct {
+	id          int64
+	householdId int64
+	itemId      int64
+	basketId    int64
+	userId      uuid.UUID
+	price       money.Amount
+	quantity    int
+	purchasedAt time.Time
+}
+
+type itemPrice struct {
+	id         int64
+	itemId     int64
+	purchaseId int64
+	price      money.Amount
+	source     string
+	recordedAt time.Time
+}
+
+type household struct {
+	id        int64
+	name      string
+	joinCode  string
+	createdBy uuid.UUID
+}
+
+type member struct {
+	householdId int64
+	userId      uuid.UUID
+	role        models.Role
+}
+
+type invitation struct {
+	id          int64
+	householdId int64
+	email       string
+	role        models.Role
+	invitedBy   uuid.UUID
+}
+
+type list struct {
+	id          int64
+	householdId int64
+	userId      uuid.UUID
+	name        string
+}
+
+type trip struct {
+	models.Trip
+	householdId int64
+	listId      int64
+	userId      uuid.UUID
+}
+
+type recoveryCode struct {
+	userId uuid.UUID
+	hash   string
+}
+
+type tables struct {
+	lastId        int64
+	users         []models.User
+	households    []household
+	members       []member
+	invitations   []invitation
+	lists         []list
+	items         []item
+	basket        []basketRow
+	purchases     []purchase
+	prices        []itemPrice
+	trips         []trip
+	resets        []models.PasswordReset
+	tokens        []models.Token
+	secrets       []models.TOTPSecret
+	recoveryCodes []recoveryCode
+	credentials   []models.Credential
+	identities    []models.Identity
+}
+
+func (t tables) clone() tables {
+	t.users = slices.Clone(t.users)
+	t.households = slices.Clone(t.households)
+	t.members = slices.Clone(t.members)
+	t.invitations = slices.Clone(t.invitations)
+	t.lists = slices.Clone(t.lists)
+	t.items = slices.Clone(t.items)
+	t.basket = slices.Clone(t.basket)
+	t.purchases = slices.Clone(t.purchases)
+	t.prices = slices.Clone(t.prices)
+	t.trips = slices.Clone(t.trips)
+	for n := range t.trips {
+		t.trips[n].Items = slices.Clone(t.trips[n].Items)
+	}
+	t.resets = slices.Clone(t.resets)
+	t.tokens = slices.Clone(t.tokens)
+	t.secrets = slices.Clone(t.secrets)
+	t.recoveryCodes = slices.Clone(t.recoveryCodes)
+	t.credentials = slices.Clone(t.credentials)
+	t.identities = slices.Clone(t.identities)
+	return t
+}
+
+func (t *tables) nextId() int64 {
+	t.lastId++
+	return t.lastId
+}
+
+// DB holds the tables shared by the repositories. Currency is the currency
+// amounts without one are stored in, money.DEFAULT_CURRENCY if it is empty.
+type DB struct {
+	mu sync.Mutex
+	tx sync.Mutex
+	tables
+	Currency money.Currency
+}
+
+func New() *DB {
+	return &DB{}
+}
+
+type txKey struct{}
+
+type Transactor struct {
+	db *DB
+}
+
+func NewTransactor(db *DB) *Transactor {
+	return &Transactor{
+		db: db,
+	}
+}
+
+// WithinTx runs fn one transaction at a time, putting the tables back how they
+// were if fn returns an error. Calls made outside a transaction wait for it to
+// finish, so none are lost when it is undone.
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	t.db.tx.Lock()
+	defer t.db.tx.Unlock()
+
+	t.db.mu.Lock()
+	saved := t.db.tables.clone()
+	t.db.mu.Unlock()
+
+	err := fn(context.WithValue(ctx, txKey{}, true))
+	if err != nil {
+		t.db.mu.Lock()
+		t.db.tables = saved
+		t.db.mu.Unlock()
+	}
+	return err
+}
+
+// lock locks the tables for a repository call, returning the func that unlocks
+// them. Calls outside a transaction wait for any running one to finish first.
+func (db *DB) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) != nil {
+		db.mu.Lock()
+		return db.mu.Unlock
+	}
+
+	db.tx.Lock()
+	db.mu.Lock()
+	return func() {
+		db.mu.Unlock()
+		db.tx.Unlock()
+	}
+}
+
+// stored is the amount as the database would give it back.
+func (db *DB) stored(amount money.Amount) money.Amount {
+	if amount.Currency == "" {
+		amount.Currency = db.Currency
+	}
+	if amount.Currency == "" {
+		amount.Currency = money.DEFAULT_CURRENCY
+	}
+	return amount
+}
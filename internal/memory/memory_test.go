@@ -0,0 +1,30 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/internal/memory"
+	"github.com/hunterwilkins2/trolly/internal/service/servicetest"
+)
+
+func TestRepositories(t *testing.T) {
+	servicetest.TestRepositories(t, func(t *testing.T) servicetest.Backend {
+		db := memory.New()
+		return servicetest.Backend{
+			Users:       memory.NewUserRepository(db),
+			Resets:      memory.NewPasswordResetRepository(db),
+			Households:  memory.NewHouseholdRepository(db),
+			Lists:       memory.NewListRepository(db),
+			Items:       memory.NewItemRepository(db),
+			Prices:      memory.NewPriceRepository(db),
+			Basket:      memory.NewBasketRepository(db),
+			Purchases:   memory.NewPurchaseRepository(db),
+			Trips:       memory.NewTripRepository(db),
+			Tokens:      memory.NewTokenRepository(db),
+			TOTP:        memory.NewTOTPRepository(db),
+			Credentials: memory.NewCredentialRepository(db),
+			Identities:  memory.NewIdentityRepository(db),
+			Transactor:  memory.NewTransactor(db),
+		}
+	})
+}
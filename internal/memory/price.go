@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+type PriceRepository struct {
+	db *DB
+}
+
+func NewPriceRepository(db *DB) *PriceRepository {
+	return &PriceRepository{
+		db: db,
+	}
+}
+
+func (r *PriceRepository) Record(ctx context.Context, price *models.ItemPrice) error {
+	defer r.db.lock(ctx)()
+
+	price.RecordedAt = time.Now()
+	r.db.prices = append(r.db.prices, itemPrice{
+		id:         r.db.nextId(),
+		itemId:     price.ItemID,
+		purchaseId: price.PurchaseID,
+		price:      r.db.stored(price.Price),
+		source:     price.Source,
+		recordedAt: price.RecordedAt,
+	})
+	return nil
+}
+
+func (r *PriceRepository) GetHistory(ctx context.Context, itemId int64) ([]models.ItemPrice, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	prices := []models.ItemPrice{}
+	if i := r.db.item(householdId, itemId); i == nil {
+		return prices, nil
+	}
+	for _, p := range r.db.prices {
+		if p.itemId == itemId {
+			prices = append(prices, models.ItemPrice{
+				ItemID:     p.itemId,
+				PurchaseID: p.purchaseId,
+				Price:      p.price,
+				Source:     p.source,
+				RecordedAt: p.recordedAt,
+			})
+		}
+	}
+	slices.SortStableFunc(prices, func(a, b models.ItemPrice) int {
+		return a.RecordedAt.Compare(b.RecordedAt)
+	})
+	return prices, nil
+}
+
+// averagePrice is the rolling average of the prices recorded for the item, and
+// false if none were recorded recently enough.
+func (t *tables) averagePrice(itemId int64) (int64, bool) {
+	since := time.Now().AddDate(0, 0, -models.PRICE_AVERAGE_DAYS)
+	var sum, n int64
+	for _, p := range t.prices {
+		if p.itemId == itemId && !p.recordedAt.Before(since) {
+			sum += p.price.Minor
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	if sum < 0 {
+		return (sum - n/2) / n, true
+	}
+	return (sum + n/2) / n, true
+}
+
+// shownPrice is the price the item is shown with, which is the rolling average
+// when the context asks for it.
+func (t *tables) shownPrice(ctx context.Context, i *item) money.Amount {
+	if mode, _ := ctx.Value(components.PriceModeKey).(string); mode == models.PriceAverage {
+		if average, ok := t.averagePrice(i.id); ok {
+			return money.New(average, i.price.Currency)
+		}
+	}
+	return i.price
+}
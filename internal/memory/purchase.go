@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type PurchaseRepository struct {
+	db *DB
+}
+
+func NewPurchaseRepository(db *DB) *PurchaseRepository {
+	return &PurchaseRepository{
+		db: db,
+	}
+}
+
+func (r *PurchaseRepository) Create(ctx context.Context, p *models.Purchase) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	p.ID = r.db.nextId()
+	p.PurchasedAt = time.Now()
+	r.db.purchases = append(r.db.purchases, purchase{
+		id:          p.ID,
+		householdId: householdId,
+		itemId:      p.ItemID,
+		basketId:    p.BasketID,
+		userId:      userId,
+		price:       r.db.stored(p.Price),
+		quantity:    p.Quantity,
+		purchasedAt: p.PurchasedAt,
+	})
+	return nil
+}
+
+// latestPurchase returns the latest purchase made from the basket row, or nil
+// if there are none.
+func (t *tables) latestPurchase(householdId, basketId int64) *purchase {
+	var latest *purchase
+	for n := range t.purchases {
+		p := &t.purchases[n]
+		if p.householdId == householdId && p.basketId == basketId && (latest == nil || p.id > latest.id) {
+			latest = p
+		}
+	}
+	return latest
+}
+
+func (r *PurchaseRepository) UpdateQuantity(ctx context.Context, basketId int64, quantity int) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	if p := r.db.latestPurchase(householdId, basketId); p != nil {
+		p.quantity = quantity
+	}
+	return nil
+}
+
+// Reverse removes the latest purchase made from the basket row along with the
+// price recorded for it.
+func (r *PurchaseRepository) Reverse(ctx context.Context, basketId int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	p := r.db.latestPurchase(householdId, basketId)
+	if p == nil {
+		return nil
+	}
+	id := p.id
+	r.db.purchases = slices.DeleteFunc(r.db.purchases, func(p purchase) bool {
+		return p.id == id
+	})
+	r.db.prices = slices.DeleteFunc(r.db.prices, func(p itemPrice) bool {
+		return p.purchaseId == id
+	})
+	return nil
+}
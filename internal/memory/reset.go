@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type PasswordResetRepository struct {
+	db *DB
+}
+
+func NewPasswordResetRepository(db *DB) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db: db,
+	}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	defer r.db.lock(ctx)()
+
+	reset.ID = r.db.nextId()
+	reset.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	r.db.resets = append(r.db.resets, models.PasswordReset{
+		ID:        reset.ID,
+		UserID:    reset.UserID,
+		Hash:      reset.Hash,
+		CreatedAt: reset.CreatedAt,
+		ExpiresAt: reset.ExpiresAt.UTC(),
+	})
+	return nil
+}
+
+func (r *PasswordResetRepository) GetByHash(ctx context.Context, hash string) (models.PasswordReset, error) {
+	defer r.db.lock(ctx)()
+
+	for _, reset := range r.db.resets {
+		if reset.Hash == hash {
+			return reset, nil
+		}
+	}
+	return models.PasswordReset{}, models.ErrPasswordResetNotFound
+}
+
+func (r *PasswordResetRepository) Latest(ctx context.Context, userId uuid.UUID) (models.PasswordReset, error) {
+	defer r.db.lock(ctx)()
+
+	var latest models.PasswordReset
+	for _, reset := range r.db.resets {
+		if reset.UserID == userId && !reset.CreatedAt.Before(latest.CreatedAt) {
+			latest = reset
+		}
+	}
+	if latest.ID == 0 {
+		return models.PasswordReset{}, models.ErrPasswordResetNotFound
+	}
+	return latest, nil
+}
+
+func (r *PasswordResetRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	defer r.db.lock(ctx)()
+
+	r.db.resets = slices.DeleteFunc(r.db.resets, func(reset models.PasswordReset) bool {
+		return reset.Expired(now)
+	})
+	return nil
+}
+
+func (r *PasswordResetRepository) DeleteAll(ctx context.Context, userId uuid.UUID) error {
+	defer r.db.lock(ctx)()
+
+	r.db.resets = slices.DeleteFunc(r.db.resets, func(reset models.PasswordReset) bool {
+		return reset.UserID == userId
+	})
+	return nil
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type TokenRepository struct {
+	db *DB
+}
+
+func NewTokenRepository(db *DB) *TokenRepository {
+	return &TokenRepository{
+		db: db,
+	}
+}
+
+func (r *TokenRepository) Create(ctx context.Context, token *models.Token) error {
+	token.UserID = ctx.Value(components.UserKey).(uuid.UUID)
+	token.HouseholdID = ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	token.ID = r.db.nextId()
+	token.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	saved := *token
+	saved.ExpiresAt = saved.ExpiresAt.UTC()
+	r.db.tokens = append(r.db.tokens, saved)
+	return nil
+}
+
+func (r *TokenRepository) GetAll(ctx context.Context) ([]models.Token, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	defer r.db.lock(ctx)()
+
+	tokens := []models.Token{}
+	for _, token := range r.db.tokens {
+		if token.UserID == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b models.Token) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return tokens, nil
+}
+
+func (r *TokenRepository) GetByHash(ctx context.Context, hash string) (models.Token, error) {
+	defer r.db.lock(ctx)()
+
+	for _, token := range r.db.tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return models.Token{}, models.ErrTokenNotFound
+}
+
+func (r *TokenRepository) SetLastUsed(ctx context.Context, id int64, at time.Time) error {
+	defer r.db.lock(ctx)()
+
+	for n := range r.db.tokens {
+		if r.db.tokens[n].ID == id {
+			r.db.tokens[n].LastUsedAt = at.UTC()
+		}
+	}
+	return nil
+}
+
+func (r *TokenRepository) Delete(ctx context.Context, id int64) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	defer r.db.lock(ctx)()
+
+	n := len(r.db.tokens)
+	r.db.tokens = slices.DeleteFunc(r.db.tokens, func(token models.Token) bool {
+		return token.UserID == userId && token.ID == id
+	})
+	if len(r.db.tokens) == n {
+		return models.ErrTokenNotFound
+	}
+	return nil
+}
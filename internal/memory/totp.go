@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type TOTPRepository struct {
+	db *DB
+}
+
+func NewTOTPRepository(db *DB) *TOTPRepository {
+	return &TOTPRepository{
+		db: db,
+	}
+}
+
+func (t *tables) secret(userId uuid.UUID) *models.TOTPSecret {
+	for n := range t.secrets {
+		if t.secrets[n].UserID == userId {
+			return &t.secrets[n]
+		}
+	}
+	return nil
+}
+
+func (r *TOTPRepository) Get(ctx context.Context, userId uuid.UUID) (models.TOTPSecret, error) {
+	defer r.db.lock(ctx)()
+
+	secret := r.db.secret(userId)
+	if secret == nil {
+		return models.TOTPSecret{}, models.ErrTOTPNotFound
+	}
+	return *secret, nil
+}
+
+func (r *TOTPRepository) Save(ctx context.Context, secret *models.TOTPSecret) error {
+	defer r.db.lock(ctx)()
+
+	secret.EnabledAt = time.Time{}
+	secret.LastStep = 0
+	r.db.secrets = slices.DeleteFunc(r.db.secrets, func(s models.TOTPSecret) bool {
+		return s.UserID == secret.UserID
+	})
+	r.db.secrets = append(r.db.secrets, models.TOTPSecret{
+		UserID: secret.UserID,
+		Secret: secret.Secret,
+	})
+	return nil
+}
+
+func (r *TOTPRepository) Enable(ctx context.Context, userId uuid.UUID) error {
+	defer r.db.lock(ctx)()
+
+	secret := r.db.secret(userId)
+	if secret == nil {
+		return models.ErrTOTPNotFound
+	}
+	secret.EnabledAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+func (r *TOTPRepository) UseStep(ctx context.Context, userId uuid.UUID, step int64) (bool, error) {
+	defer r.db.lock(ctx)()
+
+	secret := r.db.secret(userId)
+	if secret == nil || secret.LastStep >= step {
+		return false, nil
+	}
+	secret.LastStep = step
+	return true, nil
+}
+
+func (r *TOTPRepository) Fail(ctx context.Context, userId uuid.UUID) (int, error) {
+	defer r.db.lock(ctx)()
+
+	secret := r.db.secret(userId)
+	if secret == nil {
+		return 0, models.ErrTOTPNotFound
+	}
+	secret.FailedAttempts++
+	secret.FailedAt = time.Now().UTC().Truncate(time.Second)
+	return secret.FailedAttempts, nil
+}
+
+func (r *TOTPRepository) ResetAttempts(ctx context.Context, userId uuid.UUID) error {
+	defer r.db.lock(ctx)()
+
+	if secret := r.db.secret(userId); secret != nil {
+		secret.FailedAttempts = 0
+		secret.FailedAt = time.Time{}
+	}
+	return nil
+}
+
+func (r *TOTPRepository) Delete(ctx context.Context, userId uuid.UUID) error {
+	defer r.db.lock(ctx)()
+
+	r.db.deleteRecoveryCodes(userId)
+	r.db.secrets = slices.DeleteFunc(r.db.secrets, func(s models.TOTPSecret) bool {
+		return s.UserID == userId
+	})
+	return nil
+}
+
+func (t *tables) deleteRecoveryCodes(userId uuid.UUID) {
+	t.recoveryCodes = slices.DeleteFunc(t.recoveryCodes, func(c recoveryCode) bool {
+		return c.userId == userId
+	})
+}
+
+func (r *TOTPRepository) SetRecoveryCodes(ctx context.Context, userId uuid.UUID, hashes []string) error {
+	defer r.db.lock(ctx)()
+
+	r.db.deleteRecoveryCodes(userId)
+	for _, hash := range hashes {
+		r.db.recoveryCodes = append(r.db.recoveryCodes, recoveryCode{userId: userId, hash: hash})
+	}
+	return nil
+}
+
+func (r *TOTPRepository) UseRecoveryCode(ctx context.Context, userId uuid.UUID, hash string) (bool, error) {
+	defer r.db.lock(ctx)()
+
+	n := len(r.db.recoveryCodes)
+	r.db.recoveryCodes = slices.DeleteFunc(r.db.recoveryCodes, func(c recoveryCode) bool {
+		return c.userId == userId && c.hash == hash
+	})
+	return len(r.db.recoveryCodes) < n, nil
+}
+
+func (r *TOTPRepository) CountRecoveryCodes(ctx context.Context, userId uuid.UUID) (int, error) {
+	defer r.db.lock(ctx)()
+
+	n := 0
+	for _, c := range r.db.recoveryCodes {
+		if c.userId == userId {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *TOTPRepository) CountEnabled(ctx context.Context) (int, error) {
+	defer r.db.lock(ctx)()
+
+	n := 0
+	for _, secret := range r.db.secrets {
+		if secret.Enabled() {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type TripRepository struct {
+	db *DB
+}
+
+func NewTripRepository(db *DB) *TripRepository {
+	return &TripRepository{
+		db: db,
+	}
+}
+
+func (r *TripRepository) GetAll(ctx context.Context) ([]models.Trip, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	trips := []models.Trip{}
+	for _, t := range r.db.trips {
+		if t.householdId == householdId {
+			trip := t.Trip
+			trip.ItemCount = len(t.Items)
+			trip.Items = nil
+			trips = append(trips, trip)
+		}
+	}
+	slices.SortFunc(trips, func(a, b models.Trip) int {
+		return cmp.Or(b.FinishedAt.Compare(a.FinishedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return trips, nil
+}
+
+func (r *TripRepository) Get(ctx context.Context, id int64) (models.Trip, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	for _, t := range r.db.trips {
+		if t.householdId == householdId && t.ID == id {
+			trip := t.Trip
+			trip.Items = slices.Clone(t.Items)
+			trip.ItemCount = len(trip.Items)
+			return trip, nil
+		}
+	}
+	return models.Trip{}, models.ErrTripNotFound
+}
+
+func (r *TripRepository) Create(ctx context.Context, listId int64, t *models.Trip) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	defer r.db.lock(ctx)()
+
+	t.ID = r.db.nextId()
+	t.FinishedAt = time.Now().UTC().Truncate(time.Second)
+	t.ItemCount = len(t.Items)
+	saved := *t
+	saved.Total = r.db.stored(saved.Total)
+	saved.Items = make([]models.TripItem, len(t.Items))
+	for n, item := range t.Items {
+		item.Price = r.db.stored(item.Price)
+		saved.Items[n] = item
+	}
+	r.db.trips = append(r.db.trips, trip{
+		Trip:        saved,
+		householdId: householdId,
+		listId:      listId,
+		userId:      userId,
+	})
+	return nil
+}
@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+type UserRepository struct {
+	db *DB
+}
+
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{
+		db: db,
+	}
+}
+
+func (r *UserRepository) Create(ctx context.Context, u *models.User) error {
+	defer r.db.lock(ctx)()
+
+	for _, existing := range r.db.users {
+		if strings.EqualFold(existing.Email, u.Email) {
+			return models.ErrDuplicateEmail
+		}
+	}
+	r.db.users = append(r.db.users, models.User{
+		ID:             u.ID,
+		Name:           u.Name,
+		Email:          u.Email,
+		HashedPassword: u.HashedPassword,
+	})
+	return nil
+}
+
+func (r *UserRepository) Get(ctx context.Context, email string) (*models.User, error) {
+	defer r.db.lock(ctx)()
+
+	for _, u := range r.db.users {
+		if strings.EqualFold(u.Email, email) {
+			return &u, nil
+		}
+	}
+	return nil, models.ErrUserNotFound
+}
+
+func (r *UserRepository) GetById(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	defer r.db.lock(ctx)()
+
+	for _, u := range r.db.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, models.ErrUserNotFound
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, u *models.User) error {
+	defer r.db.lock(ctx)()
+
+	for n := range r.db.users {
+		if r.db.users[n].ID == u.ID {
+			r.db.users[n].HashedPassword = u.HashedPassword
+			r.db.users[n].SessionVersion++
+			u.SessionVersion = r.db.users[n].SessionVersion
+			return nil
+		}
+	}
+	return models.ErrUserNotFound
+}
+
+func (r *UserRepository) Verify(ctx context.Context, u *models.User) error {
+	defer r.db.lock(ctx)()
+
+	for n := range r.db.users {
+		if r.db.users[n].ID == u.ID {
+			if !r.db.users[n].Verified() {
+				r.db.users[n].VerifiedAt = time.Now().UTC().Truncate(time.Second)
+			}
+			u.VerifiedAt = r.db.users[n].VerifiedAt
+			return nil
+		}
+	}
+	return models.ErrUserNotFound
+}
+
+func (r *UserRepository) SetPasskeyRequired(ctx context.Context, id uuid.UUID, required bool) error {
+	defer r.db.lock(ctx)()
+
+	if u := r.db.user(id); u != nil {
+		u.PasskeyRequired = required
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Package migrate applies the SQL migrations to a database. The applied version
+// is kept in the same schema_migrations table the migrate CLI uses, so
+// databases it migrated carry on from where they are.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+var (
+	ErrDirty   = errors.New("a migration failed part way through and has to be fixed by hand")
+	ErrLocked  = errors.New("timed out waiting for another migration to finish")
+	ErrVersion = errors.New("database is at a version there is no migration for")
+)
+
+// LOCK_TIMEOUT is how long, in seconds, to wait for another replica to finish
+// migrating.
+const LOCK_TIMEOUT = 60
+
+// LOCK_NAME names the lock held while migrating. Postgres locks are numbered,
+// so it uses LOCK_ID.
+const (
+	LOCK_NAME = "trolly_migrate"
+	LOCK_ID   = 741865
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status is whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied bool
+}
+
+type Migrator struct {
+	db         *models.DB
+	migrations []Migration
+}
+
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// New reads the migrations for the database's dialect from files, which holds
+// a directory for each dialect.
+func New(db *models.DB, files fs.FS) (*Migrator, error) {
+	dir := string(db.Dialect)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileRX.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %s has an invalid version", entry.Name())
+		}
+		script, err := fs.ReadFile(files, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(script)
+		} else {
+			migration.down = string(script)
+		}
+	}
+
+	m := &Migrator{db: db}
+	for _, migration := range byVersion {
+		if migration.up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		m.migrations = append(m.migrations, *migration)
+	}
+	slices.SortFunc(m.migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return m, nil
+}
+
+// Latest is the version the database will be at once every migration has been
+// applied.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`
+
+// Version returns the version the database is at, which is 0 before any
+// migrations have been applied.
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	if _, err := m.db.ExecContext(ctx, createTable); err != nil {
+		return 0, false, err
+	}
+	err = m.db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	version, _, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []Status{}
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied:   migration.Version <= version,
+		})
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration, returning how many there were.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(q querier) error {
+		version, err := m.current(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if err := m.run(ctx, q, migration.Version, migration.up); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of migrations, or all of them if steps is
+// negative. It returns how many were rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	rolledBack := 0
+	err := m.locked(ctx, func(q querier) error {
+		version, err := m.current(ctx, q)
+		if err != nil {
+			return err
+		}
+		for n := len(m.migrations) - 1; n >= 0 && steps != rolledBack; n-- {
+			migration := m.migrations[n]
+			if migration.Version > version {
+				continue
+			}
+			var previous int64
+			if n > 0 {
+				previous = m.migrations[n-1].Version
+			}
+			if err := m.run(ctx, q, previous, migration.down); err != nil {
+				return fmt.Errorf("rolling back migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack++
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// current returns the version the database is at, checking there is a
+// migration for it and that none were left part way through.
+func (m *Migrator) current(ctx context.Context, q querier) (int64, error) {
+	var version int64
+	var dirty bool
+	err := q.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w: version %d", ErrDirty, version)
+	}
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+		return 0, fmt.Errorf("%w: version %d", ErrVersion, version)
+	}
+	return version, nil
+}
+
+// run runs the script and moves the database to the version. The version is
+// marked dirty while the script runs, as MySQL cannot roll back a script that
+// fails part way.
+func (m *Migrator) run(ctx context.Context, q querier, version int64, script string) error {
+	if err := setVersion(ctx, q, version, true); err != nil {
+		return err
+	}
+	if script != "" {
+		if _, err := q.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+	return setVersion(ctx, q, version, false)
+}
+
+// setVersion replaces the version in a single round trip so the database is
+// never left without one. The values are formatted into the statement as a
+// query cannot have several statements and take arguments.
+func setVersion(ctx context.Context, q querier, version int64, dirty bool) error {
+	stmt := `DELETE FROM schema_migrations;`
+	if version != 0 || dirty {
+		stmt += fmt.Sprintf(` INSERT INTO schema_migrations (version, dirty) VALUES (%d, %t);`, version, dirty)
+	}
+	_, err := q.ExecContext(ctx, stmt)
+	return err
+}
+
+// querier is the part of *sql.Conn and *sql.Tx the migrations are run with.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// locked runs fn while holding a lock that stops other replicas migrating at
+// the same time. SQLite has no such locks, so fn runs in a transaction that
+// holds the write lock until it ends instead.
+func (m *Migrator) locked(ctx context.Context, fn func(q querier) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.db.Dialect {
+	case models.SQLite:
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(ctx, createTable); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+
+	case models.Postgres:
+		lockCtx, cancel := context.WithTimeout(ctx, LOCK_TIMEOUT*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(lockCtx, `SELECT pg_advisory_lock($1)`, LOCK_ID); err != nil {
+			if lockCtx.Err() != nil && ctx.Err() == nil {
+				return ErrLocked
+			}
+			return err
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, LOCK_ID)
+
+	default:
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, LOCK_NAME, LOCK_TIMEOUT).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return ErrLocked
+		}
+		defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, LOCK_NAME)
+	}
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
@@ -0,0 +1,129 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/migrations"
+)
+
+var testFiles = fstest.MapFS{
+	"sqlite/000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+	"sqlite/000001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"sqlite/000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER); INSERT INTO b VALUES (1);")},
+	"sqlite/000002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+}
+
+func openSQLite(t *testing.T, path string) *models.DB {
+	t.Helper()
+	db, err := models.Open(models.SQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newMigrator(t *testing.T, db *models.DB, files fstest.MapFS) *Migrator {
+	t.Helper()
+	m, err := New(db, files)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return m
+}
+
+func checkVersion(t *testing.T, m *Migrator, want int64) {
+	t.Helper()
+	version, dirty, err := m.Version(context.Background())
+	if err != nil || version != want || dirty {
+		t.Errorf("Version() = %d, %t, %v, want %d", version, dirty, err, want)
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	m := newMigrator(t, openSQLite(t, filepath.Join(t.TempDir(), "test.db")), testFiles)
+	checkVersion(t, m, 0)
+
+	if n, err := m.Up(ctx); n != 2 || err != nil {
+		t.Fatalf("Up() = %d, %v, want 2", n, err)
+	}
+	checkVersion(t, m, 2)
+	if n, err := m.Up(ctx); n != 0 || err != nil {
+		t.Errorf("Up() again = %d, %v, want 0", n, err)
+	}
+
+	if n, err := m.Down(ctx, 1); n != 1 || err != nil {
+		t.Fatalf("Down(1) = %d, %v, want 1", n, err)
+	}
+	checkVersion(t, m, 1)
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied || statuses[1].Name != "create_b" {
+		t.Errorf("Status() = %+v, %v", statuses, err)
+	}
+
+	m.Up(ctx)
+	if n, err := m.Down(ctx, -1); n != 2 || err != nil {
+		t.Fatalf("Down(-1) = %d, %v, want 2", n, err)
+	}
+	checkVersion(t, m, 0)
+}
+
+func TestFailedMigration(t *testing.T) {
+	files := fstest.MapFS{
+		"sqlite/000001_create_a.up.sql": testFiles["sqlite/000001_create_a.up.sql"],
+		"sqlite/000002_broken.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER); NOT SQL;")},
+	}
+	m := newMigrator(t, openSQLite(t, filepath.Join(t.TempDir(), "test.db")), files)
+
+	if _, err := m.Up(context.Background()); err == nil {
+		t.Fatal("Up() = nil, want an error")
+	}
+	// SQLite rolls the whole run back
+	checkVersion(t, m, 0)
+}
+
+func TestConcurrentUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var wg sync.WaitGroup
+	applied := make([]int, 4)
+	for n := range applied {
+		m := newMigrator(t, openSQLite(t, path), testFiles)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			applied[n], err = m.Up(context.Background())
+			if err != nil {
+				t.Errorf("Up() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range applied {
+		total += n
+	}
+	if total != 2 {
+		t.Errorf("replicas applied %d migrations between them, want 2", total)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	for _, dialect := range models.Dialects {
+		m, err := New(models.NewDB(nil, dialect), migrations.FS)
+		if err != nil {
+			t.Errorf("New() for %s = %v", dialect, err)
+			continue
+		}
+		if m.Latest() == 0 {
+			t.Errorf("no migrations embedded for %s", dialect)
+		}
+	}
+}
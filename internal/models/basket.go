@@ -2,80 +2,109 @@ package models
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/validator"
 )
 
 var (
 	ErrBasketItemNotFound = errors.New("basket item could not be found")
+	ErrBasketItemChanged  = errors.New("basket item was changed at the same time")
 )
 
 type BasketItem struct {
 	BasketID  int64
 	Purchased bool
+	Quantity  int
+	Unit      string
+	Store     string
+	Note      string
 	Item
 }
 
 type Basket struct {
 	Items []BasketItem
-	Total float32
+	Total money.Amount
+}
+
+func (b Basket) HasPurchased() bool {
+	for _, item := range b.Items {
+		if item.Purchased {
+			return true
+		}
+	}
+	return false
 }
 
 type BasketRepository struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewBasketRepository(db *sql.DB) *BasketRepository {
+func NewBasketRepository(db *DB) *BasketRepository {
 	return &BasketRepository{
 		db: db,
 	}
 }
 
-func (r *BasketRepository) Get(ctx context.Context) (Basket, error) {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `SELECT b.id, b.purchased, i.id, i.name, i.price, i.times_bought 
+func (r *BasketRepository) Get(ctx context.Context, listId int64) (Basket, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT b.id, b.purchased, b.quantity, b.unit, b.store, b.note, i.id, i.name, ` + priceColumn(ctx) + `, i.currency, i.category, COALESCE(s.times_bought, 0) 
 	FROM basket b 
 	INNER JOIN items i 
 	ON i.id = b.item_id 
-	WHERE b.user_id = ?
+	` + itemStats + `
+	` + averagePrices(r.db) + `
+	WHERE b.household_id = ? AND b.list_id = ?
 	ORDER BY b.purchased ASC`
 
-	rows, err := r.db.QueryContext(ctx, stmt, userId)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId, householdId, listId)
 	if err != nil {
 		return Basket{}, err
 	}
+	defer rows.Close()
+
 	items := []BasketItem{}
-	total := 0.0
+	var total money.Amount
 	for rows.Next() {
 		var item BasketItem
-		err := rows.Scan(&item.BasketID, &item.Purchased, &item.ID, &item.Name, &item.Price, &item.TimesBought)
+		err := rows.Scan(&item.BasketID, &item.Purchased, &item.Quantity, &item.Unit, &item.Store, &item.Note, &item.ID, &item.Name, &item.Price.Minor, &item.Price.Currency, &item.Category, &item.TimesBought)
+		if err != nil {
+			return Basket{}, err
+		}
+		line, err := item.Price.Mul(item.Quantity)
+		if err != nil {
+			return Basket{}, err
+		}
+		total, err = total.Add(line)
 		if err != nil {
 			return Basket{}, err
 		}
-		total += float64(item.Price)
 		items = append(items, item)
 	}
 
 	return Basket{
 		Items: items,
-		Total: float32(total),
+		Total: total,
 	}, nil
 }
 
-func (r *BasketRepository) GetItem(ctx context.Context, basketId int64) (BasketItem, error) {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `SELECT b.id, b.purchased, i.id, i.name, i.price, i.times_bought
+func (r *BasketRepository) GetItem(ctx context.Context, listId int64, basketId int64) (BasketItem, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT b.id, b.purchased, b.quantity, b.unit, b.store, b.note, i.id, i.name, ` + priceColumn(ctx) + `, i.currency, i.category, COALESCE(s.times_bought, 0)
 	FROM basket b
 	INNER JOIN items i
 	ON i.id = b.item_id
-	WHERE b.user_id = ? AND b.id = ?`
+	` + itemStats + `
+	` + averagePrices(r.db) + `
+	WHERE b.household_id = ? AND b.list_id = ? AND b.id = ?`
 
 	var item BasketItem
-	err := r.db.QueryRowContext(ctx, stmt, userId, basketId).Scan(
-		&item.BasketID, &item.Purchased, &item.ID, &item.Name, &item.Price, &item.TimesBought,
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, householdId, listId, basketId).Scan(
+		&item.BasketID, &item.Purchased, &item.Quantity, &item.Unit, &item.Store, &item.Note, &item.ID, &item.Name, &item.Price.Minor, &item.Price.Currency, &item.Category, &item.TimesBought,
 	)
 	if err != nil {
 		return BasketItem{}, ErrBasketItemNotFound
@@ -85,32 +114,60 @@ func (r *BasketRepository) GetItem(ctx context.Context, basketId int64) (BasketI
 
 }
 
-func (r *BasketRepository) Add(ctx context.Context, item Item) (BasketItem, error) {
+// Add puts the item in the list's basket. Items that are already in the basket
+// have their quantity increased instead of being added a second time, and keep
+// their unit, store and note unless new ones are given. Items that have been
+// bought are put back to buy again with just the new quantity.
+func (r *BasketRepository) Add(ctx context.Context, listId int64, item BasketItem) (BasketItem, error) {
 	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `INSERT INTO basket (user_id, item_id)
-	VALUES (?, ?)`
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	// Adding the same item at once from two requests has to leave one row
+	// with both quantities, even inside a transaction, which on Postgres
+	// cannot carry on after a failed insert. purchased is set last as MySQL
+	// assigns the columns in order
+	keep := func(column string) string {
+		return "CASE WHEN " + r.db.inserted(column) + " = '' THEN basket." + column + " ELSE " + r.db.inserted(column) + " END"
+	}
+	stmt := `INSERT INTO basket (user_id, household_id, list_id, item_id, quantity, unit, store, note)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	` + r.db.upsert("list_id, item_id") + `
+		quantity = CASE WHEN basket.purchased THEN ` + r.db.least(r.db.inserted("quantity"), "9999") + `
+			ELSE ` + r.db.least("basket.quantity + "+r.db.inserted("quantity"), "9999") + ` END,
+		unit = ` + keep("unit") + `,
+		store = ` + keep("store") + `,
+		note = ` + keep("note") + `,
+		purchased = false`
+	query := `SELECT id, purchased, quantity, unit, store, note FROM basket
+	WHERE household_id = ? AND list_id = ? AND item_id = ?`
 
-	row, err := r.db.ExecContext(ctx, stmt, userId, item.ID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, userId, householdId, listId, item.ID, item.Quantity, item.Unit, item.Store, item.Note)
 	if err != nil {
 		return BasketItem{}, err
 	}
 
-	id, err := row.LastInsertId()
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, householdId, listId, item.ID).Scan(
+		&item.BasketID, &item.Purchased, &item.Quantity, &item.Unit, &item.Store, &item.Note,
+	)
 	if err != nil {
 		return BasketItem{}, err
 	}
+	return item, nil
+}
 
-	return BasketItem{
-		id,
-		false,
-		item,
-	}, nil
+func (r *BasketRepository) UpdateQuantity(ctx context.Context, listId int64, item *BasketItem) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `UPDATE basket SET quantity = ?, unit = ? WHERE household_id = ? AND list_id = ? AND id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, item.Quantity, item.Unit, householdId, listId, item.BasketID)
+	return err
 }
 
-func (r *BasketRepository) TogglePurchased(ctx context.Context, item *BasketItem) error {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `UPDATE basket SET purchased = ? WHERE user_id = ? AND id = ?`
-	row, err := r.db.ExecContext(ctx, stmt, !item.Purchased, userId, item.BasketID)
+// TogglePurchased flips the item from the state it was read in. If it has
+// been toggled since, ErrBasketItemChanged is returned and nothing changes.
+func (r *BasketRepository) TogglePurchased(ctx context.Context, listId int64, item *BasketItem) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `UPDATE basket SET purchased = ? WHERE household_id = ? AND list_id = ? AND id = ? AND purchased = ?`
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, !item.Purchased, householdId, listId, item.BasketID, item.Purchased)
 	if err != nil {
 		return err
 	}
@@ -119,18 +176,22 @@ func (r *BasketRepository) TogglePurchased(ctx context.Context, item *BasketItem
 		return err
 	}
 	if n == 0 {
-		return ErrBasketItemNotFound
+		_, err = r.GetItem(ctx, listId, item.BasketID)
+		if err != nil {
+			return err
+		}
+		return ErrBasketItemChanged
 	}
 
 	item.Purchased = !item.Purchased
 	return nil
 }
 
-func (r *BasketRepository) Remove(ctx context.Context, basketId int64) error {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `DELETE FROM basket WHERE user_id = ? AND id = ?`
+func (r *BasketRepository) Remove(ctx context.Context, listId int64, basketId int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `DELETE FROM basket WHERE household_id = ? AND list_id = ? AND id = ?`
 
-	row, err := r.db.ExecContext(ctx, stmt, userId, basketId)
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, listId, basketId)
 	if err != nil {
 		return err
 	}
@@ -145,11 +206,11 @@ func (r *BasketRepository) Remove(ctx context.Context, basketId int64) error {
 	return nil
 }
 
-func (r *BasketRepository) RemoveAll(ctx context.Context) error {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `DELETE FROM basket WHERE user_id = ?`
+func (r *BasketRepository) RemoveAll(ctx context.Context, listId int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `DELETE FROM basket WHERE household_id = ? AND list_id = ?`
 
-	row, err := r.db.ExecContext(ctx, stmt, userId)
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, listId)
 	if err != nil {
 		return err
 	}
@@ -163,3 +224,83 @@ func (r *BasketRepository) RemoveAll(ctx context.Context) error {
 
 	return nil
 }
+
+// GetPurchased returns the purchased items on the list at the price they were
+// bought for, which is the item's latest price if no purchase was recorded.
+func (r *BasketRepository) GetPurchased(ctx context.Context, listId int64) ([]BasketItem, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT b.id, b.purchased, b.quantity, b.unit, b.store, b.note, i.id, i.name,
+		COALESCE(p.price, i.price), COALESCE(p.currency, i.currency), i.category
+	FROM basket b
+	INNER JOIN items i
+	ON i.id = b.item_id
+	LEFT JOIN purchases p
+	ON p.id = (SELECT MAX(id) FROM purchases WHERE household_id = b.household_id AND basket_id = b.id)
+	WHERE b.household_id = ? AND b.list_id = ? AND b.purchased = true
+	ORDER BY b.id ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId, listId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []BasketItem{}
+	for rows.Next() {
+		var item BasketItem
+		err := rows.Scan(&item.BasketID, &item.Purchased, &item.Quantity, &item.Unit, &item.Store, &item.Note, &item.ID, &item.Name, &item.Price.Minor, &item.Price.Currency, &item.Category)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RemovePurchased removes the purchased items on the list with the basket ids.
+// Items checked off since the ids were read are left for the next trip.
+func (r *BasketRepository) RemovePurchased(ctx context.Context, listId int64, basketIds []int64) error {
+	if len(basketIds) == 0 {
+		return nil
+	}
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `DELETE FROM basket WHERE household_id = ? AND list_id = ? AND purchased = true
+	AND id IN (?` + strings.Repeat(", ?", len(basketIds)-1) + `)`
+
+	args := []any{householdId, listId}
+	for _, id := range basketIds {
+		args = append(args, id)
+	}
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, args...)
+	return err
+}
+
+func (i *BasketItem) Validate() error {
+	v := validator.New()
+
+	ValidateQuantity(v, i.Quantity)
+	ValidateUnit(v, i.Unit)
+	ValidateStore(v, i.Store)
+	ValidateNote(v, i.Note)
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func ValidateQuantity(v *validator.Validator, quantity int) {
+	v.Check(quantity < 1, "quantity", "Quantity must be at least 1")
+	v.Check(quantity > 9999, "quantity", "Quantity cannot be more than 9999")
+}
+
+func ValidateUnit(v *validator.Validator, unit string) {
+	v.Check(len(unit) > 32, "unit", "Unit cannot be more than 32 characters")
+}
+
+func ValidateStore(v *validator.Validator, store string) {
+	v.Check(len(store) > 64, "store", "Store cannot be more than 64 characters")
+}
+
+func ValidateNote(v *validator.Validator, note string) {
+	v.Check(len(note) > 255, "note", "Note cannot be more than 255 characters")
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+var (
+	ErrCredentialNotFound  = errors.New("passkey could not be found")
+	ErrDuplicateCredential = errors.New("passkey already exists")
+)
+
+// Credential is a passkey a user can log in with. CredentialID is the
+// base64url ID the authenticator knows it by, and Data is the rest of what
+// WebAuthn keeps about it, as JSON.
+type Credential struct {
+	ID           int64
+	UserID       uuid.UUID
+	CredentialID string
+	Name         string
+	Data         []byte
+	CreatedAt    time.Time
+	LastUsedAt   time.Time
+}
+
+type CredentialRepository struct {
+	db *DB
+}
+
+func NewCredentialRepository(db *DB) *CredentialRepository {
+	return &CredentialRepository{
+		db: db,
+	}
+}
+
+func (r *CredentialRepository) Create(ctx context.Context, credential *Credential) error {
+	credential.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	stmt := `INSERT INTO credentials (user_id, credential_id, name, data, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING id`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt,
+		credential.UserID.String(), credential.CredentialID, credential.Name, string(credential.Data), credential.CreatedAt,
+	).Scan(&credential.ID)
+	if err != nil {
+		if r.db.isDuplicate(err, "credentials_uc_credential_id") {
+			return ErrDuplicateCredential
+		}
+		return err
+	}
+	return nil
+}
+
+// GetAll returns the user's passkeys, oldest first.
+func (r *CredentialRepository) GetAll(ctx context.Context, userId uuid.UUID) ([]Credential, error) {
+	stmt := `SELECT id, user_id, credential_id, name, data, created_at, last_used_at
+	FROM credentials
+	WHERE user_id = ?
+	ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, userId.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []Credential{}
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *CredentialRepository) GetByCredentialID(ctx context.Context, credentialId string) (Credential, error) {
+	stmt := `SELECT id, user_id, credential_id, name, data, created_at, last_used_at
+	FROM credentials
+	WHERE credential_id = ?`
+
+	credential, err := scanCredential(conn(ctx, r.db).QueryRowContext(ctx, stmt, credentialId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Credential{}, ErrCredentialNotFound
+		}
+		return Credential{}, err
+	}
+	return credential, nil
+}
+
+// Used saves the data from logging in with the passkey, which has its new
+// signature counter.
+func (r *CredentialRepository) Used(ctx context.Context, credential *Credential) error {
+	credential.LastUsedAt = time.Now().UTC().Truncate(time.Second)
+	stmt := `UPDATE credentials
+	SET data = ?, last_used_at = ?
+	WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, string(credential.Data), credential.LastUsedAt, credential.ID)
+	return err
+}
+
+// Delete removes one of the user's passkeys.
+func (r *CredentialRepository) Delete(ctx context.Context, userId uuid.UUID, id int64) error {
+	stmt := `DELETE FROM credentials WHERE user_id = ? AND id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, userId.String(), id)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+func scanCredential(row interface{ Scan(dest ...any) error }) (Credential, error) {
+	var credential Credential
+	var data string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&credential.ID, &credential.UserID, &credential.CredentialID, &credential.Name, &data, &credential.CreatedAt, &lastUsedAt,
+	)
+	credential.Data = []byte(data)
+	credential.LastUsedAt = lastUsedAt.Time
+	return credential, err
+}
+
+func ValidateCredentialName(v *validator.Validator, name string) {
+	v.Check(len(name) == 0, "name", "Passkey name cannot be empty")
+	v.Check(len(name) > 64, "name", "Passkey name cannot be more than 64 characters")
+}
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect is the flavour of SQL a database speaks.
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+var Dialects = []Dialect{MySQL, SQLite, Postgres}
+
+func (d Dialect) Valid() bool {
+	for _, dialect := range Dialects {
+		if d == dialect {
+			return true
+		}
+	}
+	return false
+}
+
+// Driver is the name of the database/sql driver that connects to the dialect.
+func (d Dialect) Driver() string {
+	if d == Postgres {
+		return "pgx"
+	}
+	return string(d)
+}
+
+// DB is a database connection along with the dialect its queries need to be
+// written in. Currency is the currency amounts without one are stored in,
+// money.DEFAULT_CURRENCY if it is empty.
+type DB struct {
+	*sql.DB
+	Dialect  Dialect
+	Currency money.Currency
+}
+
+func NewDB(db *sql.DB, dialect Dialect) *DB {
+	return &DB{
+		DB:      db,
+		Dialect: dialect,
+	}
+}
+
+// Open opens a database of the dialect. It does not check the database can be
+// reached.
+func Open(dialect Dialect, dsn string) (*DB, error) {
+	return open(dialect, dsn, false)
+}
+
+// OpenForMigrations opens a database like Open, but lets each query run
+// several statements at once as migration scripts do. It is kept apart from
+// the application's connections, which should only ever run one.
+func OpenForMigrations(dialect Dialect, dsn string) (*DB, error) {
+	return open(dialect, dsn, true)
+}
+
+func open(dialect Dialect, dsn string, multiStatements bool) (*DB, error) {
+	switch dialect {
+	case SQLite:
+		dsn = sqliteDSN(dsn)
+	case MySQL:
+		var err error
+		dsn, err = mysqlDSN(dsn, multiStatements)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open(dialect.Driver(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewDB(db, dialect), nil
+}
+
+// mysqlDSN scans times into time.Time, and lets migrations run several
+// statements at once when multiStatements is set.
+func mysqlDSN(dsn string, multiStatements bool) (string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	cfg.ParseTime = true
+	cfg.MultiStatements = multiStatements
+	return cfg.FormatDSN(), nil
+}
+
+// sqliteDSN turns on the foreign keys the schema relies on, and lets writers
+// wait on each other rather than failing while another connection holds the
+// database.
+func sqliteDSN(dsn string) string {
+	params := []string{
+		"_pragma=foreign_keys(1)",
+		"_pragma=busy_timeout(5000)",
+		"_pragma=journal_mode(WAL)",
+		"_txlock=immediate",
+		"_time_format=sqlite",
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+// bind makes queries written with ? placeholders run on q.
+func (db *DB) bind(q querier) querier {
+	if db.Dialect == Postgres {
+		return numbered{q}
+	}
+	return q
+}
+
+// numbered rewrites ? placeholders to the $1, $2, ... that Postgres expects.
+type numbered struct {
+	q querier
+}
+
+func (n numbered) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return n.q.ExecContext(ctx, rebind(query), args...)
+}
+
+func (n numbered) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return n.q.QueryContext(ctx, rebind(query), args...)
+}
+
+func (n numbered) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return n.q.QueryRowContext(ctx, rebind(query), args...)
+}
+
+// rebind numbers each ? placeholder in query, leaving string literals alone.
+func rebind(query string) string {
+	var b strings.Builder
+	quoted := false
+	n := 0
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// least returns the smaller of two expressions.
+func (db *DB) least(a, b string) string {
+	if db.Dialect == SQLite {
+		return fmt.Sprintf("MIN(%s, %s)", a, b)
+	}
+	return fmt.Sprintf("LEAST(%s, %s)", a, b)
+}
+
+// concat joins string expressions together.
+func (db *DB) concat(parts ...string) string {
+	if db.Dialect == SQLite {
+		return "(" + strings.Join(parts, " || ") + ")"
+	}
+	return "CONCAT(" + strings.Join(parts, ", ") + ")"
+}
+
+// daysAgo is the time the given number of days before now.
+func (db *DB) daysAgo(days int) string {
+	switch db.Dialect {
+	case SQLite:
+		return fmt.Sprintf("DATETIME('now', '-%d days')", days)
+	case Postgres:
+		return fmt.Sprintf("NOW() - INTERVAL '%d days'", days)
+	}
+	return fmt.Sprintf("NOW() - INTERVAL %d DAY", days)
+}
+
+// integer converts a numeric expression to a whole number.
+func (db *DB) integer(expr string) string {
+	switch db.Dialect {
+	case SQLite:
+		return fmt.Sprintf("CAST(%s AS INTEGER)", expr)
+	case Postgres:
+		return fmt.Sprintf("CAST(%s AS BIGINT)", expr)
+	}
+	return fmt.Sprintf("CAST(%s AS SIGNED)", expr)
+}
+
+// forUpdate ends a SELECT that locks the rows it reads until the transaction
+// ends. SQLite has no row locks, but its transactions take the write lock as
+// they begin so they already run one at a time.
+func (db *DB) forUpdate() string {
+	if db.Dialect == SQLite {
+		return ""
+	}
+	return "FOR UPDATE"
+}
+
+// upsert starts the clause of an INSERT that updates the row already holding
+// the unique columns instead. The assignments after it refer to the values
+// that were being inserted with inserted.
+func (db *DB) upsert(columns string) string {
+	if db.Dialect == MySQL {
+		return "ON DUPLICATE KEY UPDATE"
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET", columns)
+}
+
+// inserted is the value of the column in the row an upsert tried to insert.
+func (db *DB) inserted(column string) string {
+	if db.Dialect == MySQL {
+		return fmt.Sprintf("VALUES(%s)", column)
+	}
+	return "excluded." + column
+}
+
+// sqliteUniqueColumns are the columns SQLite names in its errors for each unique
+// key, as it leaves out the name of the constraint.
+var sqliteUniqueColumns = map[string]string{
+	"users_uc_email":                 "users.email",
+	"households_uc_join_code":        "households.join_code",
+	"household_invitations_uc_email": "household_invitations.household_id, household_invitations.email",
+	"credentials_uc_credential_id":   "credentials.credential_id",
+}
+
+// isDuplicate reports whether err is a violation of the unique key. MySQL calls
+// every primary key PRIMARY where Postgres names it after the table, and SQLite
+// only gives the columns, which sqliteUniqueColumns has for each key.
+func (db *DB) isDuplicate(err error, key string) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, key)
+	}
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) {
+		if pgError.Code != "23505" {
+			return false
+		}
+		if key == "PRIMARY" {
+			return strings.HasSuffix(pgError.ConstraintName, "_pkey")
+		}
+		return pgError.ConstraintName == key
+	}
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) {
+		if key == "PRIMARY" {
+			return sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+		}
+		columns, ok := sqliteUniqueColumns[key]
+		return ok && sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteError.Error(), "constraint failed: "+columns+" (")
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM items WHERE id = ?", "SELECT * FROM items WHERE id = $1"},
+		{"UPDATE basket SET quantity = ? WHERE id = ? AND list_id = ?", "UPDATE basket SET quantity = $1 WHERE id = $2 AND list_id = $3"},
+		{"SELECT '?' FROM items WHERE name = ?", "SELECT '?' FROM items WHERE name = $1"},
+		{"SELECT 'it''s ?' WHERE a = ? OR b = ''", "SELECT 'it''s ?' WHERE a = $1 OR b = ''"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	tests := []struct {
+		multiStatements bool
+		want            string
+	}{
+		{false, "trolly:pa55word@tcp(localhost:3306)/trolly?parseTime=true"},
+		{true, "trolly:pa55word@tcp(localhost:3306)/trolly?multiStatements=true&parseTime=true"},
+	}
+	for _, tt := range tests {
+		got, err := mysqlDSN("trolly:pa55word@tcp(localhost:3306)/trolly", tt.multiStatements)
+		if err != nil || got != tt.want {
+			t.Errorf("mysqlDSN(%t) = %q, %v, want %q", tt.multiStatements, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsDuplicateSQLite(t *testing.T) {
+	db, err := Open(SQLite, filepath.Join(t.TempDir(), "trolly.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	stmts := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, name TEXT, CONSTRAINT users_uc_email UNIQUE (email), CONSTRAINT users_uc_name UNIQUE (name))`,
+		`INSERT INTO users VALUES (1, 'a@example.com', 'a')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		stmt string
+		key  string
+		want bool
+	}{
+		{`INSERT INTO users VALUES (2, 'a@example.com', 'b')`, "users_uc_email", true},
+		{`INSERT INTO users VALUES (2, 'b@example.com', 'a')`, "users_uc_email", false},
+		{`INSERT INTO users VALUES (2, 'a@example.com', 'b')`, "households_uc_join_code", false},
+		{`INSERT INTO users VALUES (1, 'b@example.com', 'b')`, "PRIMARY", true},
+		{`INSERT INTO users VALUES (1, 'b@example.com', 'b')`, "users_uc_email", false},
+		{`INSERT INTO users VALUES (2, 'a@example.com', 'b')`, "PRIMARY", false},
+	}
+	for _, tt := range tests {
+		_, err := db.ExecContext(ctx, tt.stmt)
+		if got := db.isDuplicate(err, tt.key); got != tt.want {
+			t.Errorf("isDuplicate(%v, %q) = %t, want %t", err, tt.key, got, tt.want)
+		}
+	}
+}
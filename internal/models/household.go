@@ -0,0 +1,403 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+var (
+	ErrHouseholdNotFound   = errors.New("household could not be found")
+	ErrMemberNotFound      = errors.New("household member could not be found")
+	ErrAlreadyMember       = errors.New("user is already a member of the household")
+	ErrInvitationNotFound  = errors.New("invitation could not be found")
+	ErrDuplicateInvitation = errors.New("email address has already been invited")
+	ErrDuplicateJoinCode   = errors.New("join code already exists")
+)
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var Roles = []Role{RoleViewer, RoleEditor, RoleOwner}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Includes reports whether r grants at least the permissions of role.
+func (r Role) Includes(role Role) bool {
+	return r.rank() >= role.rank()
+}
+
+func (r Role) Valid() bool {
+	return r.rank() != 0
+}
+
+type Household struct {
+	ID       int64
+	Name     string
+	JoinCode string
+}
+
+type Member struct {
+	HouseholdID   int64
+	HouseholdName string
+	UserID        uuid.UUID
+	Name          string
+	Email         string
+	Role          Role
+}
+
+type Invitation struct {
+	ID            int64
+	HouseholdID   int64
+	HouseholdName string
+	Email         string
+	Role          Role
+	InvitedBy     string
+}
+
+type HouseholdRepository struct {
+	db *DB
+}
+
+func NewHouseholdRepository(db *DB) *HouseholdRepository {
+	return &HouseholdRepository{
+		db: db,
+	}
+}
+
+// Create inserts the household and adds the current user as its owner. Call it
+// within a transaction so the household is not left without its owner.
+func (r *HouseholdRepository) Create(ctx context.Context, household *Household) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	stmt := `INSERT INTO households (name, join_code, created_by)
+	VALUES (?, ?, ?)
+	RETURNING id`
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, household.Name, household.JoinCode, userId.String()).Scan(&household.ID)
+	if err != nil {
+		if r.db.isDuplicate(err, "households_uc_join_code") {
+			return ErrDuplicateJoinCode
+		}
+		return err
+	}
+
+	stmt = `INSERT INTO household_members (household_id, user_id, role)
+	VALUES (?, ?, ?)`
+	_, err = conn(ctx, r.db).ExecContext(ctx, stmt, household.ID, userId.String(), RoleOwner)
+	return err
+}
+
+func (r *HouseholdRepository) Get(ctx context.Context, id int64) (Household, error) {
+	stmt := `SELECT id, name, join_code FROM households WHERE id = ?`
+
+	var household Household
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, id).Scan(&household.ID, &household.Name, &household.JoinCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Household{}, ErrHouseholdNotFound
+		}
+		return Household{}, err
+	}
+	return household, nil
+}
+
+func (r *HouseholdRepository) GetByJoinCode(ctx context.Context, code string) (Household, error) {
+	stmt := `SELECT id, name, join_code FROM households WHERE join_code = ?`
+
+	var household Household
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, code).Scan(&household.ID, &household.Name, &household.JoinCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Household{}, ErrHouseholdNotFound
+		}
+		return Household{}, err
+	}
+	return household, nil
+}
+
+func (r *HouseholdRepository) Update(ctx context.Context, household *Household) error {
+	stmt := `UPDATE households SET name = ?, join_code = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, household.Name, household.JoinCode, household.ID)
+	if err != nil {
+		if r.db.isDuplicate(err, "households_uc_join_code") {
+			return ErrDuplicateJoinCode
+		}
+		return err
+	}
+	return nil
+}
+
+// GetMembership returns the current user's membership of a household.
+func (r *HouseholdRepository) GetMembership(ctx context.Context, householdId int64) (Member, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	stmt := `SELECT m.household_id, h.name, u.id, u.name, u.email, m.role
+	FROM household_members m
+	INNER JOIN households h
+	ON h.id = m.household_id
+	INNER JOIN users u
+	ON u.id = m.user_id
+	WHERE m.household_id = ? AND m.user_id = ?`
+
+	var member Member
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, userId).Scan(
+		&member.HouseholdID, &member.HouseholdName, &member.UserID, &member.Name, &member.Email, &member.Role,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Member{}, ErrMemberNotFound
+		}
+		return Member{}, err
+	}
+	return member, nil
+}
+
+// GetMemberships returns every household the current user belongs to, oldest
+// membership first.
+func (r *HouseholdRepository) GetMemberships(ctx context.Context) ([]Member, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	stmt := `SELECT m.household_id, h.name, u.id, u.name, u.email, m.role
+	FROM household_members m
+	INNER JOIN households h
+	ON h.id = m.household_id
+	INNER JOIN users u
+	ON u.id = m.user_id
+	WHERE m.user_id = ?
+	ORDER BY m.joined_at ASC, m.household_id ASC`
+
+	return r.queryMembers(ctx, stmt, userId)
+}
+
+func (r *HouseholdRepository) GetMembers(ctx context.Context, householdId int64) ([]Member, error) {
+	stmt := `SELECT m.household_id, h.name, u.id, u.name, u.email, m.role
+	FROM household_members m
+	INNER JOIN households h
+	ON h.id = m.household_id
+	INNER JOIN users u
+	ON u.id = m.user_id
+	WHERE m.household_id = ?
+	ORDER BY m.joined_at ASC`
+
+	return r.queryMembers(ctx, stmt, householdId)
+}
+
+// LockMembers locks the household's members until the transaction ends, so
+// changes that depend on the other members are made one at a time.
+func (r *HouseholdRepository) LockMembers(ctx context.Context, householdId int64) error {
+	stmt := `SELECT user_id FROM household_members WHERE household_id = ? ` + r.db.forUpdate()
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+func (r *HouseholdRepository) queryMembers(ctx context.Context, stmt string, args ...any) ([]Member, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		err := rows.Scan(&member.HouseholdID, &member.HouseholdName, &member.UserID, &member.Name, &member.Email, &member.Role)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *HouseholdRepository) AddMember(ctx context.Context, householdId int64, userId uuid.UUID, role Role) error {
+	stmt := `INSERT INTO household_members (household_id, user_id, role)
+	VALUES (?, ?, ?)`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, userId.String(), role)
+	if err != nil {
+		if r.db.isDuplicate(err, "PRIMARY") {
+			return ErrAlreadyMember
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *HouseholdRepository) UpdateMember(ctx context.Context, householdId int64, userId uuid.UUID, role Role) error {
+	stmt := `UPDATE household_members SET role = ? WHERE household_id = ? AND user_id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, role, householdId, userId)
+	return err
+}
+
+func (r *HouseholdRepository) RemoveMember(ctx context.Context, householdId int64, userId uuid.UUID) error {
+	stmt := `DELETE FROM household_members WHERE household_id = ? AND user_id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, userId)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+func (r *HouseholdRepository) CreateInvitation(ctx context.Context, invitation *Invitation) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	stmt := `INSERT INTO household_invitations (household_id, email, role, invited_by)
+	VALUES (?, ?, ?, ?)
+	RETURNING id`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, invitation.HouseholdID, invitation.Email, invitation.Role, userId.String()).Scan(&invitation.ID)
+	if err != nil {
+		if r.db.isDuplicate(err, "household_invitations_uc_email") {
+			return ErrDuplicateInvitation
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *HouseholdRepository) GetInvitation(ctx context.Context, id int64) (Invitation, error) {
+	stmt := `SELECT i.id, i.household_id, h.name, i.email, i.role, u.name
+	FROM household_invitations i
+	INNER JOIN households h
+	ON h.id = i.household_id
+	INNER JOIN users u
+	ON u.id = i.invited_by
+	WHERE i.id = ?`
+
+	var invitation Invitation
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, id).Scan(
+		&invitation.ID, &invitation.HouseholdID, &invitation.HouseholdName, &invitation.Email, &invitation.Role, &invitation.InvitedBy,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Invitation{}, ErrInvitationNotFound
+		}
+		return Invitation{}, err
+	}
+	return invitation, nil
+}
+
+func (r *HouseholdRepository) GetInvitations(ctx context.Context, householdId int64) ([]Invitation, error) {
+	stmt := `SELECT i.id, i.household_id, h.name, i.email, i.role, u.name
+	FROM household_invitations i
+	INNER JOIN households h
+	ON h.id = i.household_id
+	INNER JOIN users u
+	ON u.id = i.invited_by
+	WHERE i.household_id = ?
+	ORDER BY i.created_at ASC`
+
+	return r.queryInvitations(ctx, stmt, householdId)
+}
+
+func (r *HouseholdRepository) GetInvitationsForEmail(ctx context.Context, email string) ([]Invitation, error) {
+	stmt := `SELECT i.id, i.household_id, h.name, i.email, i.role, u.name
+	FROM household_invitations i
+	INNER JOIN households h
+	ON h.id = i.household_id
+	INNER JOIN users u
+	ON u.id = i.invited_by
+	WHERE i.email = ?
+	ORDER BY i.created_at ASC`
+
+	return r.queryInvitations(ctx, stmt, email)
+}
+
+func (r *HouseholdRepository) queryInvitations(ctx context.Context, stmt string, args ...any) ([]Invitation, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		err := rows.Scan(&invitation.ID, &invitation.HouseholdID, &invitation.HouseholdName, &invitation.Email, &invitation.Role, &invitation.InvitedBy)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *HouseholdRepository) DeleteInvitation(ctx context.Context, id int64) error {
+	stmt := `DELETE FROM household_invitations WHERE id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (h *Household) Validate() error {
+	v := validator.New()
+
+	ValidateHouseholdName(v, h.Name)
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func (i *Invitation) Validate() error {
+	v := validator.New()
+
+	ValidateEmail(v, i.Email)
+	ValidateRole(v, i.Role)
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func ValidateHouseholdName(v *validator.Validator, name string) {
+	v.Check(len(name) == 0, "name", "Household name cannot be empty")
+	v.Check(len(name) > 255, "name", "Household name cannot be more than 255 characters")
+}
+
+func ValidateRole(v *validator.Validator, role Role) {
+	v.Check(!role.Valid(), "role", "Role must be owner, editor or viewer")
+}
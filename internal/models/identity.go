@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrIdentityNotFound = errors.New("identity could not be found")
+)
+
+// Identity links a user to their account with a single sign-on identity
+// provider. Subject is the provider's ID for them, which unlike their email
+// never changes.
+type Identity struct {
+	Issuer    string
+	Subject   string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type IdentityRepository struct {
+	db *DB
+}
+
+func NewIdentityRepository(db *DB) *IdentityRepository {
+	return &IdentityRepository{
+		db: db,
+	}
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, identity *Identity) error {
+	identity.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	stmt := `INSERT INTO identities (issuer, subject, user_id, created_at)
+	VALUES (?, ?, ?, ?)`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, identity.Issuer, identity.Subject, identity.UserID.String(), identity.CreatedAt)
+	return err
+}
+
+func (r *IdentityRepository) Get(ctx context.Context, issuer string, subject string) (Identity, error) {
+	stmt := `SELECT issuer, subject, user_id, created_at
+	FROM identities
+	WHERE issuer = ? AND subject = ?`
+
+	var identity Identity
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, issuer, subject).Scan(&identity.Issuer, &identity.Subject, &identity.UserID, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Identity{}, ErrIdentityNotFound
+		}
+		return Identity{}, err
+	}
+	return identity, nil
+}
@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/validator"
 )
 
 var (
@@ -18,10 +21,19 @@ var (
 type Item struct {
 	ID          int64
 	Name        string
-	Price       float32
+	Price       money.Amount
+	Category    string
 	TimesBought int
 }
 
+// ItemRecord is an item along with the dates it is exported with.
+// LastPurchaseDate is zero for items that have never been bought.
+type ItemRecord struct {
+	Item
+	LastPurchaseDate time.Time
+	CreatedAt        time.Time
+}
+
 type Metadata struct {
 	CurrentPage  int
 	PageSize     int
@@ -30,7 +42,7 @@ type Metadata struct {
 	TotalRecords int
 }
 
-func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+func CalculateMetadata(totalRecords, page, pageSize int) Metadata {
 	return Metadata{
 		CurrentPage:  page,
 		PageSize:     pageSize,
@@ -40,64 +52,140 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
+// itemStats joins the household's purchase history onto items i, giving
+// times_bought and last_purchase_date columns. It takes the household id as a
+// placeholder, which comes before any in the rest of the query.
+const itemStats = `LEFT JOIN (
+		SELECT item_id, SUM(quantity) AS times_bought, MAX(purchased_at) AS last_purchase_date
+		FROM purchases
+		WHERE household_id = ?
+		GROUP BY item_id
+	) s
+	ON s.item_id = i.id`
+
+// averagePrices joins the rolling average price onto items i as average_price.
+func averagePrices(db *DB) string {
+	return fmt.Sprintf(`LEFT JOIN (
+		SELECT item_id, %s AS average_price
+		FROM item_prices
+		WHERE recorded_at >= %s
+		GROUP BY item_id
+	) a
+	ON a.item_id = i.id`, db.integer("ROUND(AVG(price))"), db.daysAgo(PRICE_AVERAGE_DAYS))
+}
+
+// priceColumn is the price items i are shown with, which is the rolling average
+// when the context asks for it.
+func priceColumn(ctx context.Context) string {
+	if mode, _ := ctx.Value(components.PriceModeKey).(string); mode == PriceAverage {
+		return "COALESCE(a.average_price, i.price)"
+	}
+	return "i.price"
+}
+
 type ItemRepository struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewItemRepository(db *sql.DB) *ItemRepository {
+func NewItemRepository(db *DB) *ItemRepository {
 	return &ItemRepository{
 		db: db,
 	}
 }
 
 func (r *ItemRepository) GetAll(ctx context.Context, search string, page int, pageSize int, orderBy string) (Metadata, []Item, error) {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
 	stmt := fmt.Sprintf(`
-	SELECT count(*) OVER(), id, name, price, times_bought
-	FROM items	
-	WHERE user_id = ? AND (? = '' OR name LIKE CONCAT('%%', TRIM(?), '%%'))
-	ORDER BY price = 0 DESC, %s DESC, id DESC 
+	SELECT count(*) OVER(), i.id, i.name, %s, i.currency, i.category, COALESCE(s.times_bought, 0) AS times_bought
+	FROM items i
+	%s
+	%s
+	WHERE i.household_id = ? AND (? = '' OR i.name LIKE %s)
+	ORDER BY i.price = 0 DESC, %s, i.id DESC 
 	LIMIT ? OFFSET ?
-	`, orderedBy(orderBy))
+	`, priceColumn(ctx), itemStats, averagePrices(r.db), r.db.concat("'%'", "TRIM(?)", "'%'"), orderedBy(orderBy))
 
-	rows, err := r.db.QueryContext(ctx, stmt, userId.String(), search, search, pageSize, (page-1)*pageSize)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId, householdId, search, search, pageSize, (page-1)*pageSize)
 	if err != nil {
 		return Metadata{}, nil, err
 	}
+	defer rows.Close()
 
 	totalRecords := 0
 	items := []Item{}
 	for rows.Next() {
 		item := Item{}
-		err := rows.Scan(&totalRecords, &item.ID, &item.Name, &item.Price, &item.TimesBought)
+		err := rows.Scan(&totalRecords, &item.ID, &item.Name, &item.Price.Minor, &item.Price.Currency, &item.Category, &item.TimesBought)
 		if err != nil {
 			return Metadata{}, nil, err
 		}
 		items = append(items, item)
 	}
-	return calculateMetadata(totalRecords, page, pageSize), items, nil
+	return CalculateMetadata(totalRecords, page, pageSize), items, nil
 }
 
+// orderedBy is the ORDER BY clause for the sort. Items that have never been
+// bought go after those that have, which Postgres would otherwise put first.
 func orderedBy(col string) string {
 	switch col {
 	case "recentlyPurchased":
-		return "last_purchase_date"
+		return "s.last_purchase_date IS NULL, s.last_purchase_date DESC"
 	case "recentlyAdded":
-		return "created_at"
+		return "i.created_at DESC"
 	case "timeBought":
-		return "times_bought"
+		return "times_bought DESC"
 	default:
-		return "times_bought"
+		return "times_bought DESC"
+	}
+}
+
+// Export returns every item in the household, ordered by name, at the price
+// it was last set to.
+func (r *ItemRepository) Export(ctx context.Context) ([]ItemRecord, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT i.id, i.name, i.price, i.currency, i.category, COALESCE(s.times_bought, 0), p.purchased_at, i.created_at
+	FROM items i
+	LEFT JOIN (
+		SELECT item_id, SUM(quantity) AS times_bought, MAX(id) AS last_purchase_id
+		FROM purchases
+		WHERE household_id = ?
+		GROUP BY item_id
+	) s
+	ON s.item_id = i.id
+	LEFT JOIN purchases p
+	ON p.id = s.last_purchase_id
+	WHERE i.household_id = ?
+	ORDER BY i.name, i.id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId, householdId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ItemRecord{}
+	for rows.Next() {
+		var record ItemRecord
+		var lastPurchase sql.NullTime
+		err := rows.Scan(&record.ID, &record.Name, &record.Price.Minor, &record.Price.Currency, &record.Category, &record.TimesBought, &lastPurchase, &record.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		record.LastPurchaseDate = lastPurchase.Time
+		records = append(records, record)
 	}
+	return records, rows.Err()
 }
 
 func (r *ItemRepository) GetById(ctx context.Context, id int64) (Item, error) {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `SELECT id, name, price, times_bought FROM items
-	WHERE user_id = ? AND id = ?`
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT i.id, i.name, i.price, i.currency, i.category, COALESCE(s.times_bought, 0)
+	FROM items i
+	` + itemStats + `
+	WHERE i.household_id = ? AND i.id = ?`
 
 	item := &Item{}
-	err := r.db.QueryRowContext(ctx, stmt, userId, id).Scan(&item.ID, &item.Name, &item.Price, &item.TimesBought)
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, householdId, id).Scan(&item.ID, &item.Name, &item.Price.Minor, &item.Price.Currency, &item.Category, &item.TimesBought)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Item{}, ErrItemNotFound
@@ -107,13 +195,17 @@ func (r *ItemRepository) GetById(ctx context.Context, id int64) (Item, error) {
 	return *item, nil
 }
 
+// GetByName finds the item with the name, ignoring case whatever collation the
+// column has.
 func (r *ItemRepository) GetByName(ctx context.Context, name string) (Item, error) {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `SELECT id, name, price, times_bought FROM items
-	WHERE user_id = ? AND name = ?`
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT i.id, i.name, i.price, i.currency, i.category, COALESCE(s.times_bought, 0)
+	FROM items i
+	` + itemStats + `
+	WHERE i.household_id = ? AND LOWER(i.name) = LOWER(?)`
 
 	item := &Item{}
-	err := r.db.QueryRowContext(ctx, stmt, userId, name).Scan(&item.ID, &item.Name, &item.Price, &item.TimesBought)
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, householdId, name).Scan(&item.ID, &item.Name, &item.Price.Minor, &item.Price.Currency, &item.Category, &item.TimesBought)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Item{}, ErrItemNotFound
@@ -125,11 +217,12 @@ func (r *ItemRepository) GetByName(ctx context.Context, name string) (Item, erro
 
 func (r *ItemRepository) Create(ctx context.Context, item *Item) error {
 	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `INSERT INTO items (name, price, user_id)
-	VALUES (?, ?, ?)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `INSERT INTO items (name, price, currency, category, user_id, household_id)
+	VALUES (?, ?, ?, ?, ?, ?)
 	RETURNING id`
 
-	err := r.db.QueryRowContext(ctx, stmt, item.Name, item.Price, userId.String()).Scan(&item.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, item.Name, item.Price.Minor, r.db.currency(item.Price), item.Category, userId.String(), householdId).Scan(&item.ID)
 	if err != nil {
 		return err
 	}
@@ -138,12 +231,12 @@ func (r *ItemRepository) Create(ctx context.Context, item *Item) error {
 }
 
 func (r *ItemRepository) Update(ctx context.Context, item *Item) error {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
 	stmt := `UPDATE items
-	SET name=?, price=?
-	WHERE user_id=? AND id=?`
+	SET name=?, price=?, currency=?, category=?
+	WHERE household_id=? AND id=?`
 
-	_, err := r.db.ExecContext(ctx, stmt, item.Name, item.Price, userId, item.ID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, item.Name, item.Price.Minor, r.db.currency(item.Price), item.Category, householdId, item.ID)
 	if err != nil {
 		return err
 	}
@@ -151,10 +244,10 @@ func (r *ItemRepository) Update(ctx context.Context, item *Item) error {
 }
 
 func (r *ItemRepository) Delete(ctx context.Context, id int64) error {
-	userId := ctx.Value(components.UserKey).(uuid.UUID)
-	stmt := `DELETE FROM items WHERE user_id = ? AND id = ?`
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `DELETE FROM items WHERE household_id = ? AND id = ?`
 
-	row, err := r.db.ExecContext(ctx, stmt, userId, id)
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, id)
 	if err != nil {
 		return err
 	}
@@ -168,3 +261,23 @@ func (r *ItemRepository) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+func (i *Item) Validate() error {
+	v := validator.New()
+
+	ValidateItemName(v, i.Name)
+	ValidateCategory(v, i.Category)
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func ValidateItemName(v *validator.Validator, name string) {
+	v.Check(len(name) == 0, "name", "Item name cannot be empty")
+	v.Check(len(name) > 255, "name", "Item name cannot be more than 255 characters")
+}
+
+func ValidateCategory(v *validator.Validator, category string) {
+	v.Check(len(category) > 64, "category", "Category cannot be more than 64 characters")
+}
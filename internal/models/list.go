@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+var (
+	ErrListNotFound = errors.New("list could not be found")
+)
+
+type List struct {
+	ID   int64
+	Name string
+}
+
+type ListRepository struct {
+	db *DB
+}
+
+func NewListRepository(db *DB) *ListRepository {
+	return &ListRepository{
+		db: db,
+	}
+}
+
+func (r *ListRepository) GetAll(ctx context.Context) ([]List, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT id, name FROM lists
+	WHERE household_id = ?
+	ORDER BY id ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(&list.ID, &list.Name)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (r *ListRepository) Get(ctx context.Context, id int64) (List, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT id, name FROM lists
+	WHERE household_id = ? AND id = ?`
+
+	var list List
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, id).Scan(&list.ID, &list.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return List{}, ErrListNotFound
+		}
+		return List{}, err
+	}
+	return list, nil
+}
+
+// GetDefault returns the household's oldest list, which is the list that existing
+// basket items were migrated into.
+func (r *ListRepository) GetDefault(ctx context.Context) (List, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT id, name FROM lists
+	WHERE household_id = ?
+	ORDER BY id ASC
+	LIMIT 1`
+
+	var list List
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId).Scan(&list.ID, &list.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return List{}, ErrListNotFound
+		}
+		return List{}, err
+	}
+	return list, nil
+}
+
+func (r *ListRepository) Create(ctx context.Context, list *List) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `INSERT INTO lists (name, user_id, household_id)
+	VALUES (?, ?, ?)
+	RETURNING id`
+
+	return conn(ctx, r.db).QueryRowContext(ctx, stmt, list.Name, userId.String(), householdId).Scan(&list.ID)
+}
+
+func (r *ListRepository) Update(ctx context.Context, list *List) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `UPDATE lists SET name = ? WHERE household_id = ? AND id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, list.Name, householdId, list.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ListRepository) Delete(ctx context.Context, id int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `DELETE FROM lists WHERE household_id = ? AND id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, id)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrListNotFound
+	}
+	return nil
+}
+
+func (l *List) Validate() error {
+	v := validator.New()
+
+	ValidateListName(v, l.Name)
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func ValidateListName(v *validator.Validator, name string) {
+	v.Check(len(name) == 0, "name", "List name cannot be empty")
+	v.Check(len(name) > 255, "name", "List name cannot be more than 255 characters")
+}
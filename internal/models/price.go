@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+// Sources of a recorded price.
+const (
+	PriceCreated   = "created"
+	PriceEdited    = "edited"
+	PricePurchased = "purchased"
+)
+
+// Ways an item's price can be shown.
+const (
+	PriceLatest  = "latest"
+	PriceAverage = "average"
+)
+
+// PRICE_AVERAGE_DAYS is how far back the rolling average price looks.
+const PRICE_AVERAGE_DAYS = 90
+
+type ItemPrice struct {
+	ItemID     int64
+	PurchaseID int64
+	Price      money.Amount
+	Source     string
+	RecordedAt time.Time
+}
+
+type PriceRepository struct {
+	db *DB
+}
+
+func NewPriceRepository(db *DB) *PriceRepository {
+	return &PriceRepository{
+		db: db,
+	}
+}
+
+// Record saves a price for the item. Prices recorded for a purchase are removed
+// along with it.
+func (r *PriceRepository) Record(ctx context.Context, price *ItemPrice) error {
+	stmt := `INSERT INTO item_prices (item_id, purchase_id, price, currency, source)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING recorded_at`
+
+	var purchaseId sql.NullInt64
+	if price.PurchaseID != 0 {
+		purchaseId = sql.NullInt64{Int64: price.PurchaseID, Valid: true}
+	}
+	return conn(ctx, r.db).QueryRowContext(ctx, stmt, price.ItemID, purchaseId, price.Price.Minor, r.db.currency(price.Price), price.Source).Scan(&price.RecordedAt)
+}
+
+// GetHistory returns every price recorded for the item, oldest first.
+func (r *PriceRepository) GetHistory(ctx context.Context, itemId int64) ([]ItemPrice, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT p.item_id, COALESCE(p.purchase_id, 0), p.price, p.currency, p.source, p.recorded_at
+	FROM item_prices p
+	INNER JOIN items i
+	ON i.id = p.item_id
+	WHERE i.household_id = ? AND p.item_id = ?
+	ORDER BY p.recorded_at ASC, p.id ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId, itemId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := []ItemPrice{}
+	for rows.Next() {
+		var price ItemPrice
+		err := rows.Scan(&price.ItemID, &price.PurchaseID, &price.Price.Minor, &price.Price.Currency, &price.Source, &price.RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+	return prices, rows.Err()
+}
+
+// currency is the currency code an amount is stored with. Amounts without a
+// currency are stored in the database's one.
+func (db *DB) currency(amount money.Amount) string {
+	if amount.Currency != "" {
+		return string(amount.Currency)
+	}
+	if db.Currency != "" {
+		return string(db.Currency)
+	}
+	return string(money.DEFAULT_CURRENCY)
+}
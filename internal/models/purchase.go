@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+// Purchase records an item being marked as purchased. BasketID is 0 once the
+// basket row it was bought from has been removed.
+type Purchase struct {
+	ID          int64
+	ItemID      int64
+	BasketID    int64
+	Price       money.Amount
+	Quantity    int
+	PurchasedAt time.Time
+}
+
+type PurchaseRepository struct {
+	db *DB
+}
+
+func NewPurchaseRepository(db *DB) *PurchaseRepository {
+	return &PurchaseRepository{
+		db: db,
+	}
+}
+
+func (r *PurchaseRepository) Create(ctx context.Context, purchase *Purchase) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `INSERT INTO purchases (household_id, item_id, basket_id, price, currency, quantity, user_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id, purchased_at`
+
+	return conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, purchase.ItemID, purchase.BasketID, purchase.Price.Minor, r.db.currency(purchase.Price), purchase.Quantity, userId.String()).Scan(
+		&purchase.ID, &purchase.PurchasedAt,
+	)
+}
+
+// latestPurchase selects the id of the latest purchase made from a basket row.
+// It goes through a derived table as MySQL will not otherwise update or delete
+// from a table it is selecting from.
+const latestPurchase = `SELECT id FROM (
+		SELECT MAX(id) AS id FROM purchases WHERE household_id = ? AND basket_id = ?
+	) latest`
+
+// UpdateQuantity changes the quantity of the purchase made from the basket row.
+func (r *PurchaseRepository) UpdateQuantity(ctx context.Context, basketId int64, quantity int) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `UPDATE purchases SET quantity = ?
+	WHERE id = (` + latestPurchase + `)`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, quantity, householdId, basketId)
+	return err
+}
+
+// Reverse removes the latest purchase made from the basket row, for when an
+// item is unchecked.
+func (r *PurchaseRepository) Reverse(ctx context.Context, basketId int64) error {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `DELETE FROM purchases
+	WHERE id = (` + latestPurchase + `)`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, householdId, basketId)
+	return err
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPasswordResetNotFound = errors.New("password reset could not be found")
+)
+
+// PasswordReset lets a user who has forgotten their password choose a new
+// one. Only the hash of its token is stored.
+type PasswordReset struct {
+	ID        int64
+	UserID    uuid.UUID
+	Hash      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (p PasswordReset) Expired(now time.Time) bool {
+	return !now.Before(p.ExpiresAt)
+}
+
+type PasswordResetRepository struct {
+	db *DB
+}
+
+func NewPasswordResetRepository(db *DB) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db: db,
+	}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, reset *PasswordReset) error {
+	reset.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	stmt := `INSERT INTO password_resets (user_id, token_hash, created_at, expires_at)
+	VALUES (?, ?, ?, ?)
+	RETURNING id`
+
+	return conn(ctx, r.db).QueryRowContext(ctx, stmt, reset.UserID.String(), reset.Hash, reset.CreatedAt, reset.ExpiresAt.UTC()).Scan(&reset.ID)
+}
+
+func (r *PasswordResetRepository) GetByHash(ctx context.Context, hash string) (PasswordReset, error) {
+	stmt := `SELECT id, user_id, token_hash, created_at, expires_at
+	FROM password_resets
+	WHERE token_hash = ?`
+
+	var reset PasswordReset
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, hash).Scan(&reset.ID, &reset.UserID, &reset.Hash, &reset.CreatedAt, &reset.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PasswordReset{}, ErrPasswordResetNotFound
+		}
+		return PasswordReset{}, err
+	}
+	return reset, nil
+}
+
+// Latest returns the password reset the user was sent last.
+func (r *PasswordResetRepository) Latest(ctx context.Context, userId uuid.UUID) (PasswordReset, error) {
+	stmt := `SELECT id, user_id, token_hash, created_at, expires_at
+	FROM password_resets
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT 1`
+
+	var reset PasswordReset
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, userId.String()).Scan(&reset.ID, &reset.UserID, &reset.Hash, &reset.CreatedAt, &reset.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PasswordReset{}, ErrPasswordResetNotFound
+		}
+		return PasswordReset{}, err
+	}
+	return reset, nil
+}
+
+// DeleteExpired removes every password reset that has expired by now.
+func (r *PasswordResetRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	stmt := `DELETE FROM password_resets WHERE expires_at <= ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, now.UTC())
+	return err
+}
+
+// DeleteAll removes every password reset for the user, so none of the links
+// they have been sent can be used again.
+func (r *PasswordResetRepository) DeleteAll(ctx context.Context, userId uuid.UUID) error {
+	stmt := `DELETE FROM password_resets WHERE user_id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, userId.String())
+	return err
+}
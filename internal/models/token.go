@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+var (
+	ErrTokenNotFound = errors.New("token could not be found")
+)
+
+// TokenScope limits what an API token can do on top of the user's role.
+type TokenScope string
+
+const (
+	ScopeRead  TokenScope = "read"
+	ScopeWrite TokenScope = "write"
+)
+
+var TokenScopes = []TokenScope{ScopeRead, ScopeWrite}
+
+func (s TokenScope) Valid() bool {
+	for _, scope := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether a token with the scope can be used on routes that
+// require role. Read tokens can only be used where viewers are allowed.
+func (s TokenScope) Allows(role Role) bool {
+	return s == ScopeWrite || role == RoleViewer
+}
+
+// Token is a personal access token. Only the hash of the token is stored, and
+// it acts on the household it was created in. ExpiresAt and LastUsedAt are
+// zero for tokens that never expire or have not been used.
+type Token struct {
+	ID          int64
+	UserID      uuid.UUID
+	HouseholdID int64
+	Name        string
+	Scope       TokenScope
+	Hash        string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LastUsedAt  time.Time
+}
+
+func (t Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+type TokenRepository struct {
+	db *DB
+}
+
+func NewTokenRepository(db *DB) *TokenRepository {
+	return &TokenRepository{
+		db: db,
+	}
+}
+
+// Create saves a token for the current user in their current household.
+func (r *TokenRepository) Create(ctx context.Context, token *Token) error {
+	token.UserID = ctx.Value(components.UserKey).(uuid.UUID)
+	token.HouseholdID = ctx.Value(components.HouseholdKey).(int64)
+	token.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	stmt := `INSERT INTO api_tokens (user_id, household_id, name, scope, token_hash, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id`
+
+	return conn(ctx, r.db).QueryRowContext(ctx, stmt,
+		token.UserID.String(), token.HouseholdID, token.Name, token.Scope, token.Hash, token.CreatedAt, nullTime(token.ExpiresAt),
+	).Scan(&token.ID)
+}
+
+// GetAll returns the current user's tokens, newest first.
+func (r *TokenRepository) GetAll(ctx context.Context) ([]Token, error) {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	stmt := `SELECT id, user_id, household_id, name, scope, token_hash, created_at, expires_at, last_used_at
+	FROM api_tokens
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, userId.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *TokenRepository) GetByHash(ctx context.Context, hash string) (Token, error) {
+	stmt := `SELECT id, user_id, household_id, name, scope, token_hash, created_at, expires_at, last_used_at
+	FROM api_tokens
+	WHERE token_hash = ?`
+
+	token, err := scanToken(conn(ctx, r.db).QueryRowContext(ctx, stmt, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Token{}, ErrTokenNotFound
+		}
+		return Token{}, err
+	}
+	return token, nil
+}
+
+func (r *TokenRepository) SetLastUsed(ctx context.Context, id int64, at time.Time) error {
+	stmt := `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, at.UTC(), id)
+	return err
+}
+
+// Delete removes one of the current user's tokens.
+func (r *TokenRepository) Delete(ctx context.Context, id int64) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	stmt := `DELETE FROM api_tokens WHERE user_id = ? AND id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, userId.String(), id)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func scanToken(row interface{ Scan(dest ...any) error }) (Token, error) {
+	var token Token
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.HouseholdID, &token.Name, &token.Scope, &token.Hash, &token.CreatedAt, &expiresAt, &lastUsedAt,
+	)
+	token.ExpiresAt = expiresAt.Time
+	token.LastUsedAt = lastUsedAt.Time
+	return token, err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func (t *Token) Validate() error {
+	v := validator.New()
+
+	ValidateTokenName(v, t.Name)
+	ValidateTokenScope(v, t.Scope)
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func ValidateTokenName(v *validator.Validator, name string) {
+	v.Check(len(name) == 0, "name", "Token name cannot be empty")
+	v.Check(len(name) > 64, "name", "Token name cannot be more than 64 characters")
+}
+
+func ValidateTokenScope(v *validator.Validator, scope TokenScope) {
+	v.Check(!scope.Valid(), "scope", "Scope must be read or write")
+}
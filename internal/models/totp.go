@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTOTPNotFound = errors.New("two-factor authentication is not set up")
+)
+
+// TOTPSecret is a user's authenticator app secret, which is only used to log
+// in once EnabledAt is set. Secret is encrypted.
+type TOTPSecret struct {
+	UserID    uuid.UUID
+	Secret    string
+	EnabledAt time.Time
+	// LastStep is the step of the last code used, as codes can only be used
+	// once.
+	LastStep int64
+	// FailedAttempts is how many invalid codes have been entered since the
+	// last valid one, and FailedAt when the latest was.
+	FailedAttempts int
+	FailedAt       time.Time
+}
+
+func (s TOTPSecret) Enabled() bool {
+	return !s.EnabledAt.IsZero()
+}
+
+type TOTPRepository struct {
+	db *DB
+}
+
+func NewTOTPRepository(db *DB) *TOTPRepository {
+	return &TOTPRepository{
+		db: db,
+	}
+}
+
+func (r *TOTPRepository) Get(ctx context.Context, userId uuid.UUID) (TOTPSecret, error) {
+	stmt := `SELECT user_id, secret, enabled_at, last_step, failed_attempts, failed_at
+	FROM totp_secrets
+	WHERE user_id = ?`
+
+	var secret TOTPSecret
+	var enabledAt, failedAt sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, userId.String()).Scan(&secret.UserID, &secret.Secret, &enabledAt, &secret.LastStep, &secret.FailedAttempts, &failedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TOTPSecret{}, ErrTOTPNotFound
+		}
+		return TOTPSecret{}, err
+	}
+	secret.EnabledAt = enabledAt.Time
+	secret.FailedAt = failedAt.Time
+	return secret, nil
+}
+
+// Save replaces the user's secret with a new one that is not enabled yet.
+func (r *TOTPRepository) Save(ctx context.Context, secret *TOTPSecret) error {
+	secret.EnabledAt = time.Time{}
+	secret.LastStep = 0
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM totp_secrets WHERE user_id = ?`, secret.UserID.String())
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO totp_secrets (user_id, secret)
+	VALUES (?, ?)`
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, stmt, secret.UserID.String(), secret.Secret)
+	return err
+}
+
+func (r *TOTPRepository) Enable(ctx context.Context, userId uuid.UUID) error {
+	stmt := `UPDATE totp_secrets
+	SET enabled_at = ?
+	WHERE user_id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, time.Now().UTC().Truncate(time.Second), userId.String())
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTOTPNotFound
+	}
+	return nil
+}
+
+// UseStep records that the code for the step has been used. It returns false
+// if a code for the step, or a later one, already has been.
+func (r *TOTPRepository) UseStep(ctx context.Context, userId uuid.UUID, step int64) (bool, error) {
+	stmt := `UPDATE totp_secrets
+	SET last_step = ?
+	WHERE user_id = ? AND last_step < ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, step, userId.String(), step)
+	if err != nil {
+		return false, err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Fail records an invalid code being entered for the user, returning how many
+// have been since the last valid one.
+func (r *TOTPRepository) Fail(ctx context.Context, userId uuid.UUID) (int, error) {
+	stmt := `UPDATE totp_secrets
+	SET failed_attempts = failed_attempts + 1, failed_at = ?
+	WHERE user_id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, time.Now().UTC().Truncate(time.Second), userId.String())
+	if err != nil {
+		return 0, err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrTOTPNotFound
+	}
+
+	var attempts int
+	err = conn(ctx, r.db).QueryRowContext(ctx, `SELECT failed_attempts FROM totp_secrets WHERE user_id = ?`, userId.String()).Scan(&attempts)
+	return attempts, err
+}
+
+// ResetAttempts clears the user's invalid codes once they enter a valid one.
+func (r *TOTPRepository) ResetAttempts(ctx context.Context, userId uuid.UUID) error {
+	stmt := `UPDATE totp_secrets
+	SET failed_attempts = 0, failed_at = NULL
+	WHERE user_id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, userId.String())
+	return err
+}
+
+// Delete turns off two-factor authentication for the user, removing their
+// secret and recovery codes.
+func (r *TOTPRepository) Delete(ctx context.Context, userId uuid.UUID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userId.String())
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, `DELETE FROM totp_secrets WHERE user_id = ?`, userId.String())
+	return err
+}
+
+// SetRecoveryCodes replaces the user's recovery codes with the hashes.
+func (r *TOTPRepository) SetRecoveryCodes(ctx context.Context, userId uuid.UUID, hashes []string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userId.String())
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO recovery_codes (user_id, code_hash)
+	VALUES (?, ?)`
+
+	for _, hash := range hashes {
+		_, err = conn(ctx, r.db).ExecContext(ctx, stmt, userId.String(), hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode removes the recovery code, returning false if the user does
+// not have it.
+func (r *TOTPRepository) UseRecoveryCode(ctx context.Context, userId uuid.UUID, hash string) (bool, error) {
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, userId.String(), hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// CountRecoveryCodes is how many unused recovery codes the user has left.
+func (r *TOTPRepository) CountRecoveryCodes(ctx context.Context, userId uuid.UUID) (int, error) {
+	stmt := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`
+
+	var n int
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, userId.String()).Scan(&n)
+	return n, err
+}
+
+// CountEnabled is how many users have two-factor authentication enabled.
+func (r *TOTPRepository) CountEnabled(ctx context.Context) (int, error) {
+	stmt := `SELECT COUNT(*) FROM totp_secrets WHERE enabled_at IS NOT NULL`
+
+	var n int
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+var (
+	ErrTripNotFound = errors.New("trip could not be found")
+)
+
+type Trip struct {
+	ID         int64
+	ListName   string
+	Store      string
+	Total      money.Amount
+	FinishedAt time.Time
+	ItemCount  int
+	Items      []TripItem
+}
+
+// TripItem is a basket item as it was when the trip was finished. ItemID is 0
+// once the item has been deleted from the pantry.
+type TripItem struct {
+	ItemID   int64
+	Name     string
+	Quantity int
+	Unit     string
+	Price    money.Amount
+	Store    string
+	Note     string
+}
+
+type TripRepository struct {
+	db *DB
+}
+
+func NewTripRepository(db *DB) *TripRepository {
+	return &TripRepository{
+		db: db,
+	}
+}
+
+func (r *TripRepository) GetAll(ctx context.Context) ([]Trip, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT t.id, t.list_name, t.store, t.total, t.currency, t.finished_at, COUNT(ti.id)
+	FROM trips t
+	LEFT JOIN trip_items ti
+	ON ti.trip_id = t.id
+	WHERE t.household_id = ?
+	GROUP BY t.id
+	ORDER BY t.finished_at DESC, t.id DESC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, stmt, householdId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trips := []Trip{}
+	for rows.Next() {
+		var trip Trip
+		err := rows.Scan(&trip.ID, &trip.ListName, &trip.Store, &trip.Total.Minor, &trip.Total.Currency, &trip.FinishedAt, &trip.ItemCount)
+		if err != nil {
+			return nil, err
+		}
+		trips = append(trips, trip)
+	}
+	return trips, rows.Err()
+}
+
+func (r *TripRepository) Get(ctx context.Context, id int64) (Trip, error) {
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `SELECT id, list_name, store, total, currency, finished_at FROM trips
+	WHERE household_id = ? AND id = ?`
+	itemsStmt := `SELECT item_id, name, quantity, unit, price, currency, store, note FROM trip_items
+	WHERE trip_id = ?
+	ORDER BY id ASC`
+
+	var trip Trip
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, id).Scan(
+		&trip.ID, &trip.ListName, &trip.Store, &trip.Total.Minor, &trip.Total.Currency, &trip.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Trip{}, ErrTripNotFound
+		}
+		return Trip{}, err
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, itemsStmt, trip.ID)
+	if err != nil {
+		return Trip{}, err
+	}
+	defer rows.Close()
+
+	trip.Items = []TripItem{}
+	for rows.Next() {
+		var item TripItem
+		var itemId sql.NullInt64
+		err := rows.Scan(&itemId, &item.Name, &item.Quantity, &item.Unit, &item.Price.Minor, &item.Price.Currency, &item.Store, &item.Note)
+		if err != nil {
+			return Trip{}, err
+		}
+		item.ItemID = itemId.Int64
+		trip.Items = append(trip.Items, item)
+	}
+	trip.ItemCount = len(trip.Items)
+	return trip, rows.Err()
+}
+
+// Create saves the trip and its items. It should be called within a
+// transaction so a trip is never saved without its items.
+func (r *TripRepository) Create(ctx context.Context, listId int64, trip *Trip) error {
+	userId := ctx.Value(components.UserKey).(uuid.UUID)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+	stmt := `INSERT INTO trips (household_id, list_id, list_name, store, total, currency, user_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id, finished_at`
+	itemStmt := `INSERT INTO trip_items (trip_id, item_id, name, quantity, unit, price, currency, store, note)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, householdId, listId, trip.ListName, trip.Store, trip.Total.Minor, r.db.currency(trip.Total), userId.String()).Scan(
+		&trip.ID, &trip.FinishedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range trip.Items {
+		_, err := conn(ctx, r.db).ExecContext(ctx, itemStmt, trip.ID, item.ItemID, item.Name, item.Quantity, item.Unit, item.Price.Minor, r.db.currency(item.Price), item.Store, item.Note)
+		if err != nil {
+			return err
+		}
+	}
+	trip.ItemCount = len(trip.Items)
+	return nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+type txKey struct{}
+
+type txState struct {
+	tx    *sql.Tx
+	after []func()
+}
+
+// querier is the part of *sql.DB and *sql.Tx used by the repositories.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction started by WithinTx if ctx has one, otherwise
+// the database.
+func conn(ctx context.Context, db *DB) querier {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return db.bind(state.tx)
+	}
+	return db.bind(db.DB)
+}
+
+// AfterCommit runs fn once the transaction in ctx commits, or straight away if
+// ctx is not in a transaction.
+func AfterCommit(ctx context.Context, fn func()) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.after = append(state.after, fn)
+		return
+	}
+	fn()
+}
+
+type Transactor struct {
+	db *DB
+}
+
+func NewTransactor(db *DB) *Transactor {
+	return &Transactor{
+		db: db,
+	}
+}
+
+// WithinTx runs fn in a transaction that repositories called with the context
+// it is given will use. The transaction is rolled back if fn returns an error.
+// Calls inside a transaction join it instead of starting another.
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	state := &txState{tx: tx}
+	err = fn(context.WithValue(ctx, txKey{}, state))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	for _, fn := range state.after {
+		fn()
+	}
+	return nil
+}
@@ -4,9 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/hunterwilkins2/trolly/internal/validator"
 )
@@ -22,13 +21,26 @@ type User struct {
 	Email          string
 	Password       string
 	HashedPassword []byte
+	// SessionVersion is stored in the user's sessions when they log in, and
+	// changing it logs every one of them out.
+	SessionVersion int
+	// VerifiedAt is when the user confirmed they own their email, and is zero
+	// until they have.
+	VerifiedAt time.Time
+	// PasskeyRequired is whether logging in with a password also needs one of
+	// the user's passkeys.
+	PasskeyRequired bool
+}
+
+func (u *User) Verified() bool {
+	return !u.VerifiedAt.IsZero()
 }
 
 type UserRepository struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
+func NewUserRepository(db *DB) *UserRepository {
 	return &UserRepository{
 		db: db,
 	}
@@ -38,13 +50,10 @@ func (r *UserRepository) Create(ctx context.Context, user *User) error {
 	stmt := `INSERT INTO users (id, name, email, hashed_password)
 	VALUES(?, ?, ?, ?)`
 
-	_, err := r.db.Exec(stmt, user.ID, user.Name, user.Email, string(user.HashedPassword))
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, user.ID, user.Name, user.Email, string(user.HashedPassword))
 	if err != nil {
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		if r.db.isDuplicate(err, "users_uc_email") {
+			return ErrDuplicateEmail
 		}
 		return err
 	}
@@ -52,12 +61,13 @@ func (r *UserRepository) Create(ctx context.Context, user *User) error {
 }
 
 func (r *UserRepository) Get(ctx context.Context, email string) (*User, error) {
-	stmt := `SELECT id, name, email, hashed_password
+	stmt := `SELECT id, name, email, hashed_password, session_version, verified_at, passkey_required
 	FROM users
 	WHERE email = ?`
 
 	user := &User{}
-	err := r.db.QueryRowContext(ctx, stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.HashedPassword)
+	var verifiedAt sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.HashedPassword, &user.SessionVersion, &verifiedAt, &user.PasskeyRequired)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -65,16 +75,18 @@ func (r *UserRepository) Get(ctx context.Context, email string) (*User, error) {
 			return nil, err
 		}
 	}
+	user.VerifiedAt = verifiedAt.Time
 	return user, nil
 }
 
 func (r *UserRepository) GetById(ctx context.Context, id uuid.UUID) (*User, error) {
-	stmt := `SELECT id, name, email, hashed_password
+	stmt := `SELECT id, name, email, hashed_password, session_version, verified_at, passkey_required
 	FROM users
 	WHERE id = ?`
 
 	user := &User{}
-	err := r.db.QueryRowContext(ctx, stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.HashedPassword)
+	var verifiedAt sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.HashedPassword, &user.SessionVersion, &verifiedAt, &user.PasskeyRequired)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -82,9 +94,65 @@ func (r *UserRepository) GetById(ctx context.Context, id uuid.UUID) (*User, erro
 			return nil, err
 		}
 	}
+	user.VerifiedAt = verifiedAt.Time
 	return user, nil
 }
 
+// UpdatePassword sets the user's password and logs them out everywhere.
+func (r *UserRepository) UpdatePassword(ctx context.Context, user *User) error {
+	stmt := `UPDATE users
+	SET hashed_password = ?, session_version = session_version + 1
+	WHERE id = ?`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, string(user.HashedPassword), user.ID)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	stmt = `SELECT session_version FROM users WHERE id = ?`
+	return conn(ctx, r.db).QueryRowContext(ctx, stmt, user.ID).Scan(&user.SessionVersion)
+}
+
+// Verify marks the user's email as verified, unless it already is.
+func (r *UserRepository) Verify(ctx context.Context, user *User) error {
+	verifiedAt := time.Now().UTC().Truncate(time.Second)
+	stmt := `UPDATE users
+	SET verified_at = ?
+	WHERE id = ? AND verified_at IS NULL`
+
+	row, err := conn(ctx, r.db).ExecContext(ctx, stmt, verifiedAt, user.ID)
+	if err != nil {
+		return err
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		existing, err := r.GetById(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		verifiedAt = existing.VerifiedAt
+	}
+	user.VerifiedAt = verifiedAt
+	return nil
+}
+
+func (r *UserRepository) SetPasskeyRequired(ctx context.Context, id uuid.UUID, required bool) error {
+	stmt := `UPDATE users SET passkey_required = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt, required, id)
+	return err
+}
+
 func (u *User) Validate() error {
 	v := validator.New()
 
@@ -0,0 +1,176 @@
+// Package money represents prices exactly as a whole number of a currency's
+// minor units, e.g. cents, instead of as floating point numbers.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount    = errors.New("amount must be a number")
+	ErrTooPrecise       = errors.New("amount has more decimal places than the currency allows")
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+	ErrOverflow         = errors.New("amount is too large")
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+const (
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	GBP Currency = "GBP"
+	CAD Currency = "CAD"
+	AUD Currency = "AUD"
+	JPY Currency = "JPY"
+)
+
+const DEFAULT_CURRENCY = USD
+
+var symbols = map[Currency]string{
+	USD: "$",
+	EUR: "€",
+	GBP: "£",
+	CAD: "$",
+	AUD: "$",
+	JPY: "¥",
+}
+
+// Valid reports whether the currency looks like an ISO 4217 code, three upper
+// case letters.
+func (c Currency) Valid() bool {
+	if len(c) != 3 {
+		return false
+	}
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Exponent is the number of decimal places in the currency's minor unit.
+func (c Currency) Exponent() int {
+	if c == JPY {
+		return 0
+	}
+	return 2
+}
+
+func (c Currency) Symbol() string {
+	if c == "" {
+		c = DEFAULT_CURRENCY
+	}
+	if symbol, ok := symbols[c]; ok {
+		return symbol
+	}
+	return string(c) + " "
+}
+
+// Amount is an exact amount of money. The zero Amount has no currency and can
+// be added to an amount of any currency.
+type Amount struct {
+	Minor    int64
+	Currency Currency
+}
+
+func New(minor int64, currency Currency) Amount {
+	return Amount{
+		Minor:    minor,
+		Currency: currency,
+	}
+}
+
+// Parse reads a non-negative decimal amount such as "3.49", ".5" or "12" in the
+// currency. It fails rather than rounding amounts more precise than the
+// currency's minor unit.
+func Parse(s string, currency Currency) (Amount, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Amount{}, ErrInvalidAmount
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > currency.Exponent() {
+		return Amount{}, ErrTooPrecise
+	}
+
+	var minor int64
+	digits := whole + fraction + strings.Repeat("0", currency.Exponent()-len(fraction))
+	for _, d := range digits {
+		if minor > (math.MaxInt64-int64(d-'0'))/10 {
+			return Amount{}, ErrInvalidAmount
+		}
+		minor = minor*10 + int64(d-'0')
+	}
+	return New(minor, currency), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) IsZero() bool {
+	return a.Minor == 0
+}
+
+// Add returns the sum of the amounts, which must be in the same currency unless
+// one of them is the zero Amount.
+func (a Amount) Add(b Amount) (Amount, error) {
+	switch {
+	case a == Amount{}:
+		return b, nil
+	case b == Amount{}:
+		return a, nil
+	case a.Currency != b.Currency:
+		return Amount{}, ErrCurrencyMismatch
+	case b.Minor > 0 && a.Minor > math.MaxInt64-b.Minor, b.Minor < 0 && a.Minor < math.MinInt64-b.Minor:
+		return Amount{}, ErrOverflow
+	}
+	return New(a.Minor+b.Minor, a.Currency), nil
+}
+
+// Mul returns the amount n times over, failing rather than wrapping around if
+// it does not fit.
+func (a Amount) Mul(n int) (Amount, error) {
+	m := int64(n)
+	product := a.Minor * m
+	if m != 0 && (product/m != a.Minor || m == -1 && a.Minor == math.MinInt64) {
+		return Amount{}, ErrOverflow
+	}
+	return New(product, a.Currency), nil
+}
+
+// Decimal formats the amount as a plain number with the currency's decimal
+// places, e.g. "3.49", which Parse reads back.
+func (a Amount) Decimal() string {
+	exponent := a.Currency.Exponent()
+	// The magnitude is unsigned so the most negative amount has one too
+	minor := uint64(a.Minor)
+	sign := ""
+	if a.Minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	if exponent == 0 {
+		return fmt.Sprintf("%s%d", sign, minor)
+	}
+	scale := uint64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/scale, exponent, minor%scale)
+}
+
+// String formats the amount for display, e.g. "$3.49".
+func (a Amount) String() string {
+	if a.Minor < 0 {
+		return "-" + a.Currency.Symbol() + strings.TrimPrefix(a.Decimal(), "-")
+	}
+	return a.Currency.Symbol() + a.Decimal()
+}
@@ -0,0 +1,135 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		currency Currency
+		want     Amount
+		err      error
+	}{
+		{"3.49", USD, New(349, USD), nil},
+		{"12", USD, New(1200, USD), nil},
+		{".5", USD, New(50, USD), nil},
+		{"5.", USD, New(500, USD), nil},
+		{"1.50000", USD, New(150, USD), nil},
+		{"0", USD, New(0, USD), nil},
+		{"92233720368547758.07", USD, New(math.MaxInt64, USD), nil},
+		{"1200", JPY, New(1200, JPY), nil},
+		{"1.234", USD, Amount{}, ErrTooPrecise},
+		{"1.5", JPY, Amount{}, ErrTooPrecise},
+		{"1.0", JPY, New(1, JPY), nil},
+		{"92233720368547758.08", USD, Amount{}, ErrInvalidAmount},
+		{"99999999999999999999", JPY, Amount{}, ErrInvalidAmount},
+		{"", USD, Amount{}, ErrInvalidAmount},
+		{".", USD, Amount{}, ErrInvalidAmount},
+		{"-1.00", USD, Amount{}, ErrInvalidAmount},
+		{"1,000", USD, Amount{}, ErrInvalidAmount},
+		{"$3.49", USD, Amount{}, ErrInvalidAmount},
+		{"1.2.3", USD, Amount{}, ErrInvalidAmount},
+		{" 1", USD, Amount{}, ErrInvalidAmount},
+	} {
+		got, err := Parse(tt.s, tt.currency)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %s) = %+v, %v, want %+v, %v", tt.s, tt.currency, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b Amount
+		want Amount
+		err  error
+	}{
+		{"same currency", New(349, USD), New(151, USD), New(500, USD), nil},
+		{"negative", New(349, USD), New(-500, USD), New(-151, USD), nil},
+		{"zero Amount first", Amount{}, New(1200, JPY), New(1200, JPY), nil},
+		{"zero Amount second", New(1200, JPY), Amount{}, New(1200, JPY), nil},
+		{"zero in a currency", New(0, USD), New(100, EUR), Amount{}, ErrCurrencyMismatch},
+		{"different currencies", New(100, USD), New(100, EUR), Amount{}, ErrCurrencyMismatch},
+		{"overflow", New(math.MaxInt64, USD), New(1, USD), Amount{}, ErrOverflow},
+		{"underflow", New(math.MinInt64, USD), New(-1, USD), Amount{}, ErrOverflow},
+		{"largest", New(math.MaxInt64-1, USD), New(1, USD), New(math.MaxInt64, USD), nil},
+	} {
+		got, err := tt.a.Add(tt.b)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%s: %+v.Add(%+v) = %+v, %v, want %+v, %v", tt.name, tt.a, tt.b, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	for _, tt := range []struct {
+		a    Amount
+		n    int
+		want Amount
+		err  error
+	}{
+		{New(349, USD), 3, New(1047, USD), nil},
+		{New(349, USD), 0, New(0, USD), nil},
+		{New(349, USD), -1, New(-349, USD), nil},
+		{New(0, USD), math.MaxInt, New(0, USD), nil},
+		{New(math.MaxInt64/2+1, USD), 2, Amount{}, ErrOverflow},
+		{New(math.MaxInt64, USD), 9999, Amount{}, ErrOverflow},
+		{New(math.MinInt64, USD), -1, Amount{}, ErrOverflow},
+		{New(-1, USD), math.MinInt, Amount{}, ErrOverflow},
+	} {
+		got, err := tt.a.Mul(tt.n)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%+v.Mul(%d) = %+v, %v, want %+v, %v", tt.a, tt.n, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range []struct {
+		amount  Amount
+		decimal string
+		str     string
+	}{
+		{New(349, USD), "3.49", "$3.49"},
+		{New(5, USD), "0.05", "$0.05"},
+		{New(0, USD), "0.00", "$0.00"},
+		{New(-349, USD), "-3.49", "-$3.49"},
+		{New(-5, EUR), "-0.05", "-€0.05"},
+		{New(1200, JPY), "1200", "¥1200"},
+		{New(-1200, JPY), "-1200", "-¥1200"},
+		{New(100, "CHF"), "1.00", "CHF 1.00"},
+		{New(100, ""), "1.00", "$1.00"},
+		{New(math.MinInt64, USD), "-92233720368547758.08", "-$92233720368547758.08"},
+	} {
+		if got := tt.amount.Decimal(); got != tt.decimal {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.amount, got, tt.decimal)
+		}
+		if got := tt.amount.String(); got != tt.str {
+			t.Errorf("%+v.String() = %q, want %q", tt.amount, got, tt.str)
+		}
+	}
+
+	// Decimal is read back by Parse
+	for _, amount := range []Amount{New(349, USD), New(1200, JPY), New(math.MaxInt64, USD)} {
+		if got, err := Parse(amount.Decimal(), amount.Currency); err != nil || got != amount {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", amount.Decimal(), got, err, amount)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, c := range []Currency{USD, JPY, "CHF"} {
+		if !c.Valid() {
+			t.Errorf("%q is not valid", c)
+		}
+	}
+	for _, c := range []Currency{"", "usd", "US", "USDT", "U$D"} {
+		if c.Valid() {
+			t.Errorf("%q is valid", c)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Package oidctest is a mock OpenID Connect issuer for tests. It approves
+// every authorization request as its current User, and checks the client,
+// redirect URI and PKCE verifier when the code is exchanged, like a real
+// provider would.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const KEY_ID = "test"
+
+var ErrNotRedirected = errors.New("the issuer did not redirect back to the client")
+
+var encoding = base64.RawURLEncoding
+
+// User is who the issuer logs in.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// grant is an authorization code waiting to be exchanged.
+type grant struct {
+	user          User
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+type Issuer struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// User is who the next authorization request is approved for.
+	User User
+	// OmitEmail leaves the email out of ID tokens, so clients have to get it
+	// from the user info endpoint.
+	OmitEmail bool
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	codes  map[string]grant
+	tokens map[string]User
+}
+
+// New starts an issuer for the client. Close it when the test is done.
+func New(clientID, clientSecret string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	issuer := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        make(map[string]grant),
+		tokens:       make(map[string]User),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /authorize", issuer.authorize)
+	mux.HandleFunc("POST /token", issuer.token)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("GET /userinfo", issuer.userInfo)
+	issuer.Server = httptest.NewServer(mux)
+	return issuer, nil
+}
+
+// Authorize visits the authorization URL a client sent the browser to, and
+// returns where the issuer sent it back to.
+func (i *Issuer) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotRedirected, res.Status)
+	}
+	return url.Parse(res.Header.Get("Location"))
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"userinfo_endpoint":                     i.URL + "/userinfo",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case query.Get("client_id") != i.ClientID:
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		redirectError(w, r, redirectURI, query.Get("state"), "unsupported_response_type")
+		return
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		redirectError(w, r, redirectURI, query.Get("state"), "invalid_request")
+		return
+	case !strings.Contains(" "+query.Get("scope")+" ", " openid "):
+		redirectError(w, r, redirectURI, query.Get("state"), "invalid_scope")
+		return
+	}
+
+	code := randomString()
+	i.mu.Lock()
+	i.codes[code] = grant{
+		user:          i.User,
+		redirectURI:   redirectURI.String(),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	values := redirectURI.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirectURI.RawQuery = values.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != i.ClientID || clientSecret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// Codes can only be used once, whether or not the exchange works
+	i.mu.Lock()
+	grant, ok := i.codes[r.PostFormValue("code")]
+	delete(i.codes, r.PostFormValue("code"))
+	i.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || grant.redirectURI != r.PostFormValue("redirect_uri") || grant.codeChallenge != encoding.EncodeToString(challenge[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss": i.URL,
+		"sub": grant.user.Subject,
+		"aud": i.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	if grant.nonce != "" {
+		claims["nonce"] = grant.nonce
+	}
+	if !i.OmitEmail {
+		claims["email"] = grant.user.Email
+		claims["email_verified"] = grant.user.EmailVerified
+		claims["name"] = grant.user.Name
+	}
+	idToken, err := i.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken := randomString()
+	i.mu.Lock()
+	i.tokens[accessToken] = grant.user
+	i.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &i.key.PublicKey,
+		KeyID:     KEY_ID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (i *Issuer) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	i.mu.Lock()
+	user, found := i.tokens[accessToken]
+	i.mu.Unlock()
+	if !ok || !found {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	})
+}
+
+// sign makes a JWT of the claims with the issuer's key.
+func (i *Issuer) sign(claims map[string]any) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: i.key, KeyID: KEY_ID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI *url.URL, state string, code string) {
+	values := redirectURI.Query()
+	values.Set("error", code)
+	values.Set("state", state)
+	redirectURI.RawQuery = values.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return encoding.EncodeToString(b)
+}
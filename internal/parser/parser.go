@@ -0,0 +1,373 @@
+// Package parser reads the shorthand typed into the add item boxes, e.g.
+//
+//	2x milk 1gal $3.49 @costco #dairy !get organic
+//
+// An entry is a list of whitespace separated tokens. Tokens that are not
+// recognised below make up the item name, in the order they were typed.
+//
+//	entry    = { token } [ note ]
+//	token    = quantity | amount | price | store | category | word
+//	quantity = integer ( "x" | "X" )   "2x", from 1 to 9999
+//	         | integer                 only as the first token, "3 avocados"
+//	amount   = number unit             "1gal", "500g", "1.5l"
+//	         | number " " unit         "2 kg"
+//	price    = ( "$" | symbol ) number "$3.49", "€3.49", "$1,299"
+//	store    = "@" word                "@costco"
+//	category = "#" word                "#dairy"
+//	note     = "!" { any }             "!get organic", runs to the end
+//	number   = digits [ "." { digit } ] | "." digits
+//	unit     = "g" | "kg" | "mg" | "oz" | "lb" | "lbs" | "ml" | "cl" | "dl" | "l"
+//	         | "gal" | "qt" | "pt" | "ct" | "pk" | "doz"
+//
+// Units are case insensitive. Each of quantity, amount, price, store and
+// category may only be given once, and an entry must have a name.
+//
+// Prices are in the currency given to Parse, and may have as many decimal
+// places as it does. They can be marked with "$" whatever the currency, or
+// with the currency's own symbol.
+//
+// ParseAll reads a batch of entries separated by newlines or commas. A comma
+// inside a note or between two digits, as in "$1,299" or "1,000 island
+// dressing", is part of the entry rather than the start of a new one.
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+const MAX_QUANTITY = 9999
+
+var (
+	ErrMissingName     = errors.New("item name cannot be empty")
+	ErrInvalidQuantity = fmt.Errorf("quantity must be a whole number from 1 to %d", MAX_QUANTITY)
+	ErrInvalidAmount   = errors.New("amount must be a positive number")
+	ErrInvalidPrice    = errors.New("price must be a number with no more decimal places than the currency has")
+	ErrEmptyStore      = errors.New("store cannot be empty")
+	ErrEmptyCategory   = errors.New("category cannot be empty")
+	ErrDuplicate       = errors.New("can only be given once")
+)
+
+var (
+	quantityRX  = regexp.MustCompile(`^([0-9]+)[xX]$`)
+	integerRX   = regexp.MustCompile(`^[0-9]+$`)
+	numberRX    = regexp.MustCompile(`^([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	amountRX    = regexp.MustCompile(`^([0-9]+(?:\.[0-9]*)?|\.[0-9]+)([a-zA-Z]+)$`)
+	thousandsRX = regexp.MustCompile(`^[0-9]{1,3}(,[0-9]{3})+(\.[0-9]*)?$`)
+)
+
+var units = map[string]bool{
+	"g": true, "kg": true, "mg": true, "oz": true, "lb": true, "lbs": true,
+	"ml": true, "cl": true, "dl": true, "l": true,
+	"gal": true, "qt": true, "pt": true, "ct": true, "pk": true, "doz": true,
+}
+
+// Entry is a parsed item. Quantity is 1 unless one was given, and Amount and
+// Unit describe the size of a single item.
+type Entry struct {
+	Name     string
+	Quantity int
+	Amount   float64
+	Unit     string
+	Price    money.Amount
+	Store    string
+	Category string
+	Note     string
+}
+
+// Measure returns the amount and unit of the entry as it is typed, or an empty
+// string if no amount was given.
+func (e Entry) Measure() string {
+	if e.Unit == "" {
+		return ""
+	}
+	return strconv.FormatFloat(e.Amount, 'f', -1, 64) + e.Unit
+}
+
+// String formats the entry in the grammar Parse reads.
+func (e Entry) String() string {
+	parts := []string{fmt.Sprintf("%dx", e.Quantity), e.Name}
+	if e.Unit != "" {
+		parts = append(parts, e.Measure())
+	}
+	if e.Price != (money.Amount{}) {
+		parts = append(parts, "$"+e.Price.Decimal())
+	}
+	if e.Store != "" {
+		parts = append(parts, "@"+e.Store)
+	}
+	if e.Category != "" {
+		parts = append(parts, "#"+e.Category)
+	}
+	if e.Note != "" {
+		parts = append(parts, "!"+e.Note)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Error reports a token that could not be parsed. Offset is the byte offset of
+// the token in the input.
+type Error struct {
+	Token  string
+	Offset int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Token == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%q %v", e.Token, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type token struct {
+	text   string
+	offset int
+}
+
+// Parse reads a single entry with its price in currency, or in
+// money.DEFAULT_CURRENCY if currency is empty. The returned error is always an
+// *Error.
+func Parse(input string, currency money.Currency) (Entry, error) {
+	if currency == "" {
+		currency = money.DEFAULT_CURRENCY
+	}
+	entry := Entry{Quantity: 1}
+	tokens, note := tokenize(input)
+	entry.Note = note
+
+	var name []string
+	seen := map[string]bool{}
+	once := func(t token, kind string) error {
+		if seen[kind] {
+			return &Error{Token: t.text, Offset: t.offset, Err: fmt.Errorf("%s %w", kind, ErrDuplicate)}
+		}
+		seen[kind] = true
+		return nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case isPrice(t.text, currency):
+			if err := once(t, "price"); err != nil {
+				return Entry{}, err
+			}
+			price, ok := parsePrice(t.text, currency)
+			if !ok {
+				return Entry{}, &Error{Token: t.text, Offset: t.offset, Err: ErrInvalidPrice}
+			}
+			entry.Price = price
+		case t.text[0] == '@':
+			if err := once(t, "store"); err != nil {
+				return Entry{}, err
+			}
+			if len(t.text) == 1 {
+				return Entry{}, &Error{Token: t.text, Offset: t.offset, Err: ErrEmptyStore}
+			}
+			entry.Store = t.text[1:]
+		case t.text[0] == '#':
+			if err := once(t, "category"); err != nil {
+				return Entry{}, err
+			}
+			if len(t.text) == 1 {
+				return Entry{}, &Error{Token: t.text, Offset: t.offset, Err: ErrEmptyCategory}
+			}
+			entry.Category = t.text[1:]
+		case quantityRX.MatchString(t.text):
+			if err := once(t, "quantity"); err != nil {
+				return Entry{}, err
+			}
+			quantity, ok := parseQuantity(t.text[:len(t.text)-1])
+			if !ok {
+				return Entry{}, &Error{Token: t.text, Offset: t.offset, Err: ErrInvalidQuantity}
+			}
+			entry.Quantity = quantity
+		case amountRX.MatchString(t.text) && isUnit(amountRX.FindStringSubmatch(t.text)[2]):
+			if err := once(t, "amount"); err != nil {
+				return Entry{}, err
+			}
+			match := amountRX.FindStringSubmatch(t.text)
+			amount, ok := parseAmount(match[1])
+			if !ok {
+				return Entry{}, &Error{Token: t.text, Offset: t.offset, Err: ErrInvalidAmount}
+			}
+			entry.Amount, entry.Unit = amount, strings.ToLower(match[2])
+		case numberRX.MatchString(t.text) && i+1 < len(tokens) && isUnit(tokens[i+1].text):
+			if err := once(t, "amount"); err != nil {
+				return Entry{}, err
+			}
+			amount, ok := parseAmount(t.text)
+			if !ok {
+				return Entry{}, &Error{Token: t.text + " " + tokens[i+1].text, Offset: t.offset, Err: ErrInvalidAmount}
+			}
+			entry.Amount, entry.Unit = amount, strings.ToLower(tokens[i+1].text)
+			i++
+		case i == 0 && integerRX.MatchString(t.text):
+			seen["quantity"] = true
+			quantity, ok := parseQuantity(t.text)
+			if !ok {
+				return Entry{}, &Error{Token: t.text, Offset: t.offset, Err: ErrInvalidQuantity}
+			}
+			entry.Quantity = quantity
+		default:
+			name = append(name, t.text)
+		}
+	}
+
+	entry.Name = strings.Join(name, " ")
+	if entry.Name == "" {
+		return Entry{}, &Error{Offset: len(input), Err: ErrMissingName}
+	}
+	return entry, nil
+}
+
+// Line is an entry of a batch and the result of parsing it.
+type Line struct {
+	Text  string
+	Entry Entry
+	Err   error
+}
+
+// ParseAll parses every entry in input, skipping blank ones. An entry that
+// fails to parse does not stop the rest of the batch from being parsed.
+func ParseAll(input string, currency money.Currency) []Line {
+	var lines []Line
+	for _, text := range split(input) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		entry, err := Parse(text, currency)
+		lines = append(lines, Line{Text: text, Entry: entry, Err: err})
+	}
+	return lines
+}
+
+// split breaks input into entries at newlines and at commas that are not part
+// of a note or a number.
+func split(input string) []string {
+	var entries []string
+	start := 0
+	inNote := false
+	atTokenStart := true
+	var prev rune
+	for i, r := range input {
+		_, size := utf8.DecodeRuneInString(input[i:])
+		next, _ := utf8.DecodeRuneInString(input[i+size:])
+		inNumber := isDigit(prev) && isDigit(next)
+		prev = r
+		switch {
+		case r == '\n' || r == '\r':
+			entries = append(entries, input[start:i])
+			start = i + 1
+			inNote = false
+			atTokenStart = true
+		case r == ',' && !inNote && !inNumber:
+			entries = append(entries, input[start:i])
+			start = i + 1
+			atTokenStart = true
+		case unicode.IsSpace(r):
+			atTokenStart = true
+		default:
+			if r == '!' && atTokenStart {
+				inNote = true
+			}
+			atTokenStart = false
+		}
+	}
+	return append(entries, input[start:])
+}
+
+// tokenize splits the input on whitespace up to the first token starting with
+// "!", which is returned as the note.
+func tokenize(input string) ([]token, string) {
+	var tokens []token
+	start := -1
+	for i, r := range input {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, token{input[start:i], start})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			if r == '!' {
+				return tokens, strings.TrimSpace(input[i+utf8.RuneLen(r):])
+			}
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{input[start:], start})
+	}
+	return tokens, ""
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isUnit(s string) bool {
+	return units[strings.ToLower(s)]
+}
+
+func parseQuantity(s string) (int, bool) {
+	quantity, err := strconv.Atoi(s)
+	if err != nil || quantity < 1 || quantity > MAX_QUANTITY {
+		return 0, false
+	}
+	return quantity, true
+}
+
+func parseAmount(s string) (float64, bool) {
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+	return amount, true
+}
+
+// symbol is the currency's symbol if it has one of its own, rather than
+// falling back to its code.
+func symbol(currency money.Currency) string {
+	symbol := currency.Symbol()
+	if strings.HasSuffix(symbol, " ") {
+		return "$"
+	}
+	return symbol
+}
+
+func isPrice(s string, currency money.Currency) bool {
+	return strings.HasPrefix(s, "$") || strings.HasPrefix(s, symbol(currency))
+}
+
+func parsePrice(s string, currency money.Currency) (money.Amount, bool) {
+	s, ok := strings.CutPrefix(s, "$")
+	if !ok {
+		s = strings.TrimPrefix(s, symbol(currency))
+	}
+	if strings.Contains(s, ",") {
+		if !thousandsRX.MatchString(s) {
+			return money.Amount{}, false
+		}
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	price, err := money.Parse(s, currency)
+	if err != nil {
+		return money.Amount{}, false
+	}
+	return price, true
+}
@@ -0,0 +1,222 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Entry
+	}{
+		{"name only", "milk", Entry{Name: "milk", Quantity: 1}},
+		{"multi word name", "  peanut   butter ", Entry{Name: "peanut butter", Quantity: 1}},
+		{"price", "milk $3.49", Entry{Name: "milk", Quantity: 1, Price: money.New(349, money.USD)}},
+		{"price before name", "$2 bread", Entry{Name: "bread", Quantity: 1, Price: money.New(200, money.USD)}},
+		{"price without leading digit", "gum $.99", Entry{Name: "gum", Quantity: 1, Price: money.New(99, money.USD)}},
+		{"price with thousands separator", "tv $1,299.99", Entry{Name: "tv", Quantity: 1, Price: money.New(129999, money.USD)}},
+		{"comma in name", "1,000 island dressing", Entry{Name: "1,000 island dressing", Quantity: 1}},
+		{"quantity suffix", "2x milk", Entry{Name: "milk", Quantity: 2}},
+		{"quantity upper case", "milk 3X", Entry{Name: "milk", Quantity: 3}},
+		{"leading quantity", "3 avocados", Entry{Name: "avocados", Quantity: 3}},
+		{"number inside name", "hot dog buns 8", Entry{Name: "hot dog buns 8", Quantity: 1}},
+		{"amount", "flour 2kg", Entry{Name: "flour", Quantity: 1, Amount: 2, Unit: "kg"}},
+		{"amount with space", "2 kg flour", Entry{Name: "flour", Quantity: 1, Amount: 2, Unit: "kg"}},
+		{"amount decimal", "1.5L water", Entry{Name: "water", Quantity: 1, Amount: 1.5, Unit: "l"}},
+		{"unknown unit", "2cups sugar", Entry{Name: "2cups sugar", Quantity: 1}},
+		{"store", "eggs @costco", Entry{Name: "eggs", Quantity: 1, Store: "costco"}},
+		{"category", "eggs #dairy", Entry{Name: "eggs", Quantity: 1, Category: "dairy"}},
+		{"note", "eggs !free range, large", Entry{Name: "eggs", Quantity: 1, Note: "free range, large"}},
+		{"note swallows tokens", "eggs !$5 @store", Entry{Name: "eggs", Quantity: 1, Note: "$5 @store"}},
+		{"exclamation inside word", "yahoo! cereal", Entry{Name: "yahoo! cereal", Quantity: 1}},
+		{"empty note", "eggs !", Entry{Name: "eggs", Quantity: 1}},
+		{
+			"everything",
+			"2x milk 1gal $3.49 @costco #dairy !get organic",
+			Entry{Name: "milk", Quantity: 2, Amount: 1, Unit: "gal", Price: money.New(349, money.USD), Store: "costco", Category: "dairy", Note: "get organic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input, money.USD)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		err    error
+		token  string
+		offset int
+	}{
+		{"empty", "", ErrMissingName, "", 0},
+		{"only tokens", "2x $3 @costco", ErrMissingName, "", 13},
+		{"bad price", "milk $abc", ErrInvalidPrice, "$abc", 5},
+		{"empty price", "milk $", ErrInvalidPrice, "$", 5},
+		{"negative price", "milk $-3", ErrInvalidPrice, "$-3", 5},
+		{"price not a number", "milk $NaN", ErrInvalidPrice, "$NaN", 5},
+		{"price smaller than a cent", "milk $3.499", ErrInvalidPrice, "$3.499", 5},
+		{"price badly grouped", "tv $12,99", ErrInvalidPrice, "$12,99", 3},
+		{"zero quantity", "0x milk", ErrInvalidQuantity, "0x", 0},
+		{"leading zero quantity", "0 milk", ErrInvalidQuantity, "0", 0},
+		{"large quantity", "milk 10000x", ErrInvalidQuantity, "10000x", 5},
+		{"zero amount", "milk 0gal", ErrInvalidAmount, "0gal", 5},
+		{"empty store", "milk @", ErrEmptyStore, "@", 5},
+		{"empty category", "milk #", ErrEmptyCategory, "#", 5},
+		{"two prices", "milk $1 $2", ErrDuplicate, "$2", 8},
+		{"two quantities", "2 milk 3x", ErrDuplicate, "3x", 7},
+		{"two amounts", "milk 1gal 2 l", ErrDuplicate, "2", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input, money.USD)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.input, err, tt.err)
+			}
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q) error %T is not a *Error", tt.input, err)
+			}
+			if parseErr.Token != tt.token || parseErr.Offset != tt.offset {
+				t.Errorf("Parse(%q) error at %q:%d, want %q:%d", tt.input, parseErr.Token, parseErr.Offset, tt.token, tt.offset)
+			}
+		})
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		currency money.Currency
+		want     money.Amount
+		err      error
+	}{
+		{"dollar sign", "milk $3.49", money.EUR, money.New(349, money.EUR), nil},
+		{"own symbol", "milk €3.49", money.EUR, money.New(349, money.EUR), nil},
+		{"no decimal places", "milk ¥300", money.JPY, money.New(300, money.JPY), nil},
+		{"too precise", "milk ¥3.5", money.JPY, money.Amount{}, ErrInvalidPrice},
+		{"symbol of another currency", "milk €3", money.USD, money.Amount{}, nil},
+		{"no symbol of its own", "milk $3", money.Currency("CHF"), money.New(300, "CHF"), nil},
+		{"default", "milk $3", "", money.New(300, money.DEFAULT_CURRENCY), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input, tt.currency)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse(%q, %q) error = %v, want %v", tt.input, tt.currency, err, tt.err)
+			}
+			if got.Price != tt.want {
+				t.Errorf("Parse(%q, %q) price = %+v, want %+v", tt.input, tt.currency, got.Price, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	entry := Entry{Name: "milk", Quantity: 2, Amount: 1, Unit: "gal", Price: money.New(349, money.USD), Store: "costco", Category: "dairy", Note: "get organic"}
+	want := "2x milk 1gal $3.49 @costco #dairy !get organic"
+	if got := entry.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"milk",
+		"2x milk 1gal $3.49 @costco #dairy !get organic",
+		"3 avocados",
+		"2 kg flour",
+		"$abc",
+		"milk @ # !",
+		"1.5L water $.99",
+		"tv $1,299.99, 1,000 island dressing",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		entry, err := Parse(input, money.USD)
+		if err != nil {
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q) error %T is not a *Error", input, err)
+			}
+			if parseErr.Offset < 0 || parseErr.Offset > len(input) {
+				t.Fatalf("Parse(%q) error offset %d out of range", input, parseErr.Offset)
+			}
+			return
+		}
+		if entry.Name == "" {
+			t.Fatalf("Parse(%q) returned an empty name", input)
+		}
+		if entry.Quantity < 1 || entry.Quantity > MAX_QUANTITY {
+			t.Fatalf("Parse(%q) returned quantity %d", input, entry.Quantity)
+		}
+		if entry.Price.Minor < 0 {
+			t.Fatalf("Parse(%q) returned price %v", input, entry.Price)
+		}
+
+		again, err := Parse(entry.String(), money.USD)
+		if err != nil {
+			t.Fatalf("Parse(%q) of formatted entry returned error: %v", entry.String(), err)
+		}
+		if again != entry {
+			t.Fatalf("round trip of %q = %+v, want %+v", input, again, entry)
+		}
+	})
+}
+
+func TestParseAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		errs  []bool
+	}{
+		{"single", "milk", []string{"milk"}, []bool{false}},
+		{"newlines", "milk\r\neggs\n\nbread", []string{"milk", "eggs", "bread"}, []bool{false, false, false}},
+		{"commas", "milk, eggs ,bread,", []string{"milk", "eggs", "bread"}, []bool{false, false, false}},
+		{"comma in note", "eggs !large, free range\nmilk", []string{"eggs !large, free range", "milk"}, []bool{false, false}},
+		{"exclamation inside word", "yahoo!, milk", []string{"yahoo!", "milk"}, []bool{false, false}},
+		{"thousands separator", "tv $1,299, milk", []string{"tv $1,299", "milk"}, []bool{false, false}},
+		{"thousands separator in name", "1,000 island dressing,2x eggs", []string{"1,000 island dressing", "2x eggs"}, []bool{false, false}},
+		{"comma after a number", "milk 2,eggs", []string{"milk 2", "eggs"}, []bool{false, false}},
+		{"comma before a number", "milk,2x eggs", []string{"milk", "2x eggs"}, []bool{false, false}},
+		{"bad line kept", "milk $abc, eggs", []string{"milk $abc", "eggs"}, []bool{true, false}},
+		{"blank", " ,\n ", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := ParseAll(tt.input, money.USD)
+			if len(lines) != len(tt.want) {
+				t.Fatalf("ParseAll(%q) returned %d lines, want %d", tt.input, len(lines), len(tt.want))
+			}
+			for i, line := range lines {
+				if line.Text != tt.want[i] {
+					t.Errorf("line %d text = %q, want %q", i, line.Text, tt.want[i])
+				}
+				if (line.Err != nil) != tt.errs[i] {
+					t.Errorf("line %d error = %v, want error %v", i, line.Err, tt.errs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Package passkeytest is a software passkey authenticator for tests. It takes
+// the options the server sends to navigator.credentials and returns the JSON
+// a browser would post back, so WebAuthn ceremonies can run without one.
+package passkeytest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	ErrExcluded  = errors.New("the authenticator already has a passkey for the user")
+	ErrNoPasskey = errors.New("the authenticator has no passkey for the site")
+)
+
+var encoding = base64.RawURLEncoding
+
+type passkey struct {
+	id         []byte
+	rpId       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	counter    uint32
+}
+
+type Authenticator struct {
+	// Origin is the site the browser is on.
+	Origin string
+	// UserVerified is whether the authenticator says it checked who is using
+	// it, with a PIN or biometrics.
+	UserVerified bool
+	passkeys     []*passkey
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerified: true}
+}
+
+// options is the part of the creation and request options the
+// authenticator uses.
+type options struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		RPID string `json:"rpId"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		ExcludeCredentials []struct {
+			ID string `json:"id"`
+		} `json:"excludeCredentials"`
+		AllowCredentials []struct {
+			ID string `json:"id"`
+		} `json:"allowCredentials"`
+	} `json:"publicKey"`
+}
+
+// Create makes a passkey from the options for navigator.credentials.create
+// and returns the credential to post to the server.
+func (a *Authenticator) Create(creationOptions []byte) ([]byte, error) {
+	var opts options
+	err := json.Unmarshal(creationOptions, &opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, excluded := range opts.PublicKey.ExcludeCredentials {
+		if a.find(opts.PublicKey.RP.ID, excluded.ID) != nil {
+			return nil, ErrExcluded
+		}
+	}
+	userHandle, err := encoding.DecodeString(opts.PublicKey.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	p := &passkey{id: id, rpId: opts.PublicKey.RP.ID, userHandle: userHandle, key: key}
+	a.passkeys = append(a.passkeys, p)
+
+	publicKey, err := cbor.Marshal(map[int]any{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authData(p, flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{
+		"id":    encoding.EncodeToString(id),
+		"rawId": encoding.EncodeToString(id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encoding.EncodeToString(a.clientData("webauthn.create", opts.PublicKey.Challenge)),
+			"attestationObject": encoding.EncodeToString(attestation),
+			"transports":        []string{"internal"},
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+}
+
+// Get signs the challenge in the options for navigator.credentials.get with
+// one of the authenticator's passkeys, and returns the assertion to post to
+// the server.
+func (a *Authenticator) Get(requestOptions []byte) ([]byte, error) {
+	var opts options
+	err := json.Unmarshal(requestOptions, &opts)
+	if err != nil {
+		return nil, err
+	}
+	var p *passkey
+	if len(opts.PublicKey.AllowCredentials) == 0 {
+		p = a.find(opts.PublicKey.RPID, "")
+	}
+	for _, allowed := range opts.PublicKey.AllowCredentials {
+		if p = a.find(opts.PublicKey.RPID, allowed.ID); p != nil {
+			break
+		}
+	}
+	if p == nil {
+		return nil, ErrNoPasskey
+	}
+
+	p.counter++
+	authData := a.authData(p, 0)
+	clientData := a.clientData("webauthn.get", opts.PublicKey.Challenge)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, p.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{
+		"id":    encoding.EncodeToString(p.id),
+		"rawId": encoding.EncodeToString(p.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encoding.EncodeToString(clientData),
+			"authenticatorData": encoding.EncodeToString(authData),
+			"signature":         encoding.EncodeToString(signature),
+			"userHandle":        encoding.EncodeToString(p.userHandle),
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+}
+
+// find returns the passkey for the site with the ID, or any of them if id is
+// empty.
+func (a *Authenticator) find(rpId string, id string) *passkey {
+	for _, p := range a.passkeys {
+		if p.rpId == rpId && (id == "" || encoding.EncodeToString(p.id) == id) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) authData(p *passkey, flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	rpIdHash := sha256.Sum256([]byte(p.rpId))
+	authData := append(rpIdHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, p.counter)
+}
+
+func (a *Authenticator) clientData(typ string, challenge string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return b
+}
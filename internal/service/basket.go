@@ -2,48 +2,147 @@ package service
 
 import (
 	"context"
+	"strings"
 
+	"github.com/hunterwilkins2/trolly/internal/events"
 	"github.com/hunterwilkins2/trolly/internal/models"
 )
 
 type BasketService struct {
-	repository *models.BasketRepository
+	repository BasketRepository
+	purchases  PurchaseRepository
+	prices     PriceRepository
+	transactor Transactor
+	broker     *events.Broker
 }
 
-func NewBasketService(r *models.BasketRepository) *BasketService {
+func NewBasketService(r BasketRepository, purchases PurchaseRepository, prices PriceRepository, transactor Transactor, broker *events.Broker) *BasketService {
 	return &BasketService{
 		repository: r,
+		purchases:  purchases,
+		prices:     prices,
+		transactor: transactor,
+		broker:     broker,
 	}
 }
 
-func (s *BasketService) GetItems(ctx context.Context) (models.Basket, error) {
-	return s.repository.Get(ctx)
+func (s *BasketService) GetItems(ctx context.Context, listId int64) (models.Basket, error) {
+	return s.repository.Get(ctx, listId)
 }
 
-func (s *BasketService) GetItem(ctx context.Context, basketId int64) (models.BasketItem, error) {
-	return s.repository.GetItem(ctx, basketId)
+func (s *BasketService) GetItem(ctx context.Context, listId int64, basketId int64) (models.BasketItem, error) {
+	return s.repository.GetItem(ctx, listId, basketId)
 }
 
-func (s *BasketService) AddItem(ctx context.Context, item models.Item) (models.BasketItem, error) {
-	return s.repository.Add(ctx, item)
+func (s *BasketService) AddItem(ctx context.Context, listId int64, item models.BasketItem) (models.BasketItem, error) {
+	err := item.Validate()
+	if err != nil {
+		return models.BasketItem{}, err
+	}
+	basketItem, err := s.repository.Add(ctx, listId, item)
+	if err != nil {
+		return models.BasketItem{}, err
+	}
+	s.publish(ctx, events.Event{Type: events.BasketItemAdded, ListID: listId, BasketID: basketItem.BasketID})
+	return basketItem, nil
 }
 
-func (s *BasketService) TogglePurchased(ctx context.Context, basketId int64) (models.BasketItem, error) {
-	item, err := s.GetItem(ctx, basketId)
+// TogglePurchased checks or unchecks the item. Checking it records a purchase
+// and the price paid at the item's current price, and unchecking it reverses
+// both.
+func (s *BasketService) TogglePurchased(ctx context.Context, listId int64, basketId int64) (models.BasketItem, error) {
+	var item models.BasketItem
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		item, err = s.GetItem(ctx, listId, basketId)
+		if err != nil {
+			return err
+		}
+		err = s.repository.TogglePurchased(ctx, listId, &item)
+		if err != nil {
+			return err
+		}
+
+		if !item.Purchased {
+			return s.purchases.Reverse(ctx, item.BasketID)
+		}
+		purchase := &models.Purchase{
+			ItemID:   item.ID,
+			BasketID: item.BasketID,
+			Price:    item.Price,
+			Quantity: item.Quantity,
+		}
+		err = s.purchases.Create(ctx, purchase)
+		if err != nil || purchase.Price.IsZero() {
+			return err
+		}
+		return s.prices.Record(ctx, &models.ItemPrice{
+			ItemID:     item.ID,
+			PurchaseID: purchase.ID,
+			Price:      purchase.Price,
+			Source:     models.PricePurchased,
+		})
+	})
 	if err != nil {
 		return models.BasketItem{}, err
 	}
-	err = s.repository.TogglePurchased(ctx, &item)
+	s.publish(ctx, events.Event{Type: events.BasketItemUpdated, ListID: listId, BasketID: basketId})
+	return item, nil
+}
+
+func (s *BasketService) UpdateQuantity(ctx context.Context, listId int64, basketId int64, quantity int, unit string) (models.BasketItem, error) {
+	var item models.BasketItem
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		item, err = s.GetItem(ctx, listId, basketId)
+		if err != nil {
+			return err
+		}
+		item.Quantity = quantity
+		item.Unit = strings.TrimSpace(unit)
+		err = item.Validate()
+		if err != nil {
+			return err
+		}
+		err = s.repository.UpdateQuantity(ctx, listId, &item)
+		if err != nil {
+			return err
+		}
+
+		if item.Purchased {
+			return s.purchases.UpdateQuantity(ctx, item.BasketID, item.Quantity)
+		}
+		return nil
+	})
 	if err != nil {
 		return models.BasketItem{}, err
 	}
+	s.publish(ctx, events.Event{Type: events.BasketItemUpdated, ListID: listId, BasketID: basketId})
 	return item, nil
 }
 
-func (s *BasketService) RemoveItem(ctx context.Context, basketId int64) error {
-	return s.repository.Remove(ctx, basketId)
+func (s *BasketService) RemoveItem(ctx context.Context, listId int64, basketId int64) error {
+	err := s.repository.Remove(ctx, listId, basketId)
+	if err != nil {
+		return err
+	}
+	s.publish(ctx, events.Event{Type: events.BasketItemRemoved, ListID: listId, BasketID: basketId})
+	return nil
+}
+
+func (s *BasketService) RemoveAllItems(ctx context.Context, listId int64) error {
+	err := s.repository.RemoveAll(ctx, listId)
+	if err != nil {
+		return err
+	}
+	s.publish(ctx, events.Event{Type: events.BasketCleared, ListID: listId})
+	return nil
 }
 
-func (s *BasketService) RemoveAllItems(ctx context.Context) error {
-	return s.repository.RemoveAll(ctx)
+// publish sends the event once the change it describes is committed, so
+// subscribers never reload the basket before they can see it.
+func (s *BasketService) publish(ctx context.Context, event events.Event) {
+	models.AfterCommit(ctx, func() {
+		s.broker.Publish(event)
+	})
 }
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+const JOIN_CODE_ALPHABET = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const JOIN_CODE_LENGTH = 8
+
+var (
+	ErrLastOwner       = errors.New("household must have at least one owner")
+	ErrInvitationEmail = errors.New("invitation was sent to a different email address")
+	ErrInvalidJoinCode = errors.New("join code does not match a household")
+)
+
+type HouseholdService struct {
+	repository HouseholdRepository
+	transactor Transactor
+}
+
+func NewHouseholdService(r HouseholdRepository, transactor Transactor) *HouseholdService {
+	return &HouseholdService{
+		repository: r,
+		transactor: transactor,
+	}
+}
+
+// Current returns the user's membership of the preferred household. Users that
+// are no longer a member of it fall back to their oldest membership, and users
+// who have left every household get a new one that they own. New users are
+// given theirs by CreateFirst when they sign up.
+func (s *HouseholdService) Current(ctx context.Context, user *models.User, preferred int64) (models.Member, error) {
+	member, err := s.repository.GetMembership(ctx, preferred)
+	if err == nil {
+		return member, nil
+	} else if err != models.ErrMemberNotFound {
+		return models.Member{}, err
+	}
+
+	memberships, err := s.repository.GetMemberships(ctx)
+	if err != nil {
+		return models.Member{}, err
+	}
+	if len(memberships) > 0 {
+		return memberships[0], nil
+	}
+
+	household, err := s.CreateFirst(ctx, user)
+	if err != nil {
+		return models.Member{}, err
+	}
+	return s.repository.GetMembership(ctx, household.ID)
+}
+
+// CreateFirst makes the household a user starts out with, which they own. Call
+// it in the same transaction as creating the user, so they have a household
+// before their first request.
+func (s *HouseholdService) CreateFirst(ctx context.Context, user *models.User) (models.Household, error) {
+	return s.Create(context.WithValue(ctx, components.UserKey, user.ID), user.Name+"'s household")
+}
+
+func (s *HouseholdService) Create(ctx context.Context, name string) (models.Household, error) {
+	household := &models.Household{
+		Name: name,
+	}
+	err := household.Validate()
+	if err != nil {
+		return models.Household{}, err
+	}
+
+	for {
+		household.JoinCode, err = generateJoinCode()
+		if err != nil {
+			return models.Household{}, err
+		}
+		err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return s.repository.Create(ctx, household)
+		})
+		if err != models.ErrDuplicateJoinCode {
+			break
+		}
+	}
+	if err != nil {
+		return models.Household{}, err
+	}
+	return *household, nil
+}
+
+func (s *HouseholdService) Get(ctx context.Context, id int64) (models.Household, error) {
+	return s.repository.Get(ctx, id)
+}
+
+func (s *HouseholdService) Memberships(ctx context.Context) ([]models.Member, error) {
+	return s.repository.GetMemberships(ctx)
+}
+
+func (s *HouseholdService) Members(ctx context.Context, householdId int64) ([]models.Member, error) {
+	return s.repository.GetMembers(ctx, householdId)
+}
+
+func (s *HouseholdService) Switch(ctx context.Context, householdId int64) (models.Member, error) {
+	return s.repository.GetMembership(ctx, householdId)
+}
+
+func (s *HouseholdService) Rename(ctx context.Context, householdId int64, name string) (models.Household, error) {
+	household, err := s.repository.Get(ctx, householdId)
+	if err != nil {
+		return models.Household{}, err
+	}
+
+	household.Name = name
+	err = household.Validate()
+	if err != nil {
+		return models.Household{}, err
+	}
+	err = s.repository.Update(ctx, &household)
+	if err != nil {
+		return models.Household{}, err
+	}
+	return household, nil
+}
+
+func (s *HouseholdService) RegenerateJoinCode(ctx context.Context, householdId int64) (models.Household, error) {
+	household, err := s.repository.Get(ctx, householdId)
+	if err != nil {
+		return models.Household{}, err
+	}
+
+	for {
+		household.JoinCode, err = generateJoinCode()
+		if err != nil {
+			return models.Household{}, err
+		}
+		err = s.repository.Update(ctx, &household)
+		if err != models.ErrDuplicateJoinCode {
+			break
+		}
+	}
+	if err != nil {
+		return models.Household{}, err
+	}
+	return household, nil
+}
+
+// Join adds the current user to the household with the join code as an
+// editor.
+func (s *HouseholdService) Join(ctx context.Context, userId uuid.UUID, code string) (models.Household, error) {
+	household, err := s.repository.GetByJoinCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if err == models.ErrHouseholdNotFound {
+		return models.Household{}, ErrInvalidJoinCode
+	} else if err != nil {
+		return models.Household{}, err
+	}
+
+	err = s.repository.AddMember(ctx, household.ID, userId, models.RoleEditor)
+	if err != nil {
+		return models.Household{}, err
+	}
+	return household, nil
+}
+
+func (s *HouseholdService) ChangeRole(ctx context.Context, householdId int64, userId uuid.UUID, role models.Role) error {
+	v := validator.New()
+	models.ValidateRole(v, role)
+	if v.HasErrors() {
+		return v
+	}
+	return s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.ensureOwnerRemains(ctx, householdId, userId, role)
+		if err != nil {
+			return err
+		}
+		return s.repository.UpdateMember(ctx, householdId, userId, role)
+	})
+}
+
+func (s *HouseholdService) RemoveMember(ctx context.Context, householdId int64, userId uuid.UUID) error {
+	return s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.ensureOwnerRemains(ctx, householdId, userId, "")
+		if err != nil {
+			return err
+		}
+		return s.repository.RemoveMember(ctx, householdId, userId)
+	})
+}
+
+// ensureOwnerRemains stops the last owner of a household from being demoted to
+// role or removed from it. It locks the members so two owners cannot each
+// demote the other at once, and must be called within the transaction that
+// makes the change.
+func (s *HouseholdService) ensureOwnerRemains(ctx context.Context, householdId int64, userId uuid.UUID, role models.Role) error {
+	err := s.repository.LockMembers(ctx, householdId)
+	if err != nil {
+		return err
+	}
+	members, err := s.repository.GetMembers(ctx, householdId)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	owners := 0
+	for _, member := range members {
+		if member.Role == models.RoleOwner && (member.UserID != userId || role == models.RoleOwner) {
+			owners++
+		}
+		if member.UserID == userId {
+			found = true
+		}
+	}
+	if !found {
+		return models.ErrMemberNotFound
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func (s *HouseholdService) Invite(ctx context.Context, householdId int64, email string, role models.Role) (models.Invitation, error) {
+	invitation := &models.Invitation{
+		HouseholdID: householdId,
+		Email:       strings.TrimSpace(email),
+		Role:        role,
+	}
+	err := invitation.Validate()
+	if err != nil {
+		return models.Invitation{}, err
+	}
+
+	members, err := s.repository.GetMembers(ctx, householdId)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.Email, invitation.Email) {
+			return models.Invitation{}, models.ErrAlreadyMember
+		}
+	}
+
+	err = s.repository.CreateInvitation(ctx, invitation)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	return *invitation, nil
+}
+
+func (s *HouseholdService) Invitations(ctx context.Context, householdId int64) ([]models.Invitation, error) {
+	return s.repository.GetInvitations(ctx, householdId)
+}
+
+func (s *HouseholdService) PendingInvitations(ctx context.Context, user *models.User) ([]models.Invitation, error) {
+	return s.repository.GetInvitationsForEmail(ctx, user.Email)
+}
+
+func (s *HouseholdService) CancelInvitation(ctx context.Context, householdId int64, invitationId int64) error {
+	invitation, err := s.repository.GetInvitation(ctx, invitationId)
+	if err != nil {
+		return err
+	}
+	if invitation.HouseholdID != householdId {
+		return models.ErrInvitationNotFound
+	}
+	return s.repository.DeleteInvitation(ctx, invitationId)
+}
+
+// AcceptInvitation adds the user to the invited household with the role they
+// were invited with.
+func (s *HouseholdService) AcceptInvitation(ctx context.Context, user *models.User, invitationId int64) (models.Invitation, error) {
+	invitation, err := s.repository.GetInvitation(ctx, invitationId)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return models.Invitation{}, ErrInvitationEmail
+	}
+
+	err = s.repository.AddMember(ctx, invitation.HouseholdID, user.ID, invitation.Role)
+	if err != nil && err != models.ErrAlreadyMember {
+		return models.Invitation{}, err
+	}
+	err = s.repository.DeleteInvitation(ctx, invitation.ID)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	return invitation, nil
+}
+
+func (s *HouseholdService) DeclineInvitation(ctx context.Context, user *models.User, invitationId int64) error {
+	invitation, err := s.repository.GetInvitation(ctx, invitationId)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return ErrInvitationEmail
+	}
+	return s.repository.DeleteInvitation(ctx, invitation.ID)
+}
+
+func generateJoinCode() (string, error) {
+	b := make([]byte, JOIN_CODE_LENGTH)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = JOIN_CODE_ALPHABET[int(b[i])%len(JOIN_CODE_ALPHABET)]
+	}
+	return string(b), nil
+}
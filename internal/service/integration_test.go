@@ -0,0 +1,1184 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/events"
+	"github.com/hunterwilkins2/trolly/internal/migrate"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/oidctest"
+	"github.com/hunterwilkins2/trolly/internal/passkeytest"
+	"github.com/hunterwilkins2/trolly/internal/service"
+	"github.com/hunterwilkins2/trolly/internal/service/servicetest"
+	"github.com/hunterwilkins2/trolly/internal/totp"
+	"github.com/hunterwilkins2/trolly/internal/transfer"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+	"github.com/hunterwilkins2/trolly/migrations"
+)
+
+// The integration tests run against SQLite, and against Postgres and MySQL when
+// a DSN for an empty database is given in these variables.
+const (
+	POSTGRES_DSN_ENV = "TROLLY_TEST_POSTGRES_DSN"
+	MYSQL_DSN_ENV    = "TROLLY_TEST_MYSQL_DSN"
+)
+
+type testDatabase struct {
+	dialect models.Dialect
+	dsn     string
+}
+
+func testDatabases(t *testing.T) []testDatabase {
+	databases := []testDatabase{
+		{models.SQLite, filepath.Join(t.TempDir(), "trolly.db")},
+	}
+	if dsn := os.Getenv(POSTGRES_DSN_ENV); dsn != "" {
+		databases = append(databases, testDatabase{models.Postgres, dsn})
+	}
+	if dsn := os.Getenv(MYSQL_DSN_ENV); dsn != "" {
+		databases = append(databases, testDatabase{models.MySQL, dsn})
+	}
+	return databases
+}
+
+// eachDatabase runs fn against a freshly migrated database of every dialect
+// the tests can reach.
+func eachDatabase(t *testing.T, fn func(t *testing.T, app *testApp)) {
+	for _, database := range testDatabases(t) {
+		t.Run(string(database.dialect), func(t *testing.T) {
+			fn(t, newTestApp(t, openDatabase(t, database)))
+		})
+	}
+}
+
+// exec runs a statement straight against the database, for putting it in a
+// state the services would not.
+func (app *testApp) exec(t *testing.T, stmt string) {
+	t.Helper()
+	if _, err := app.db.ExecContext(context.Background(), stmt); err != nil {
+		t.Fatalf("could not run %q: %v", stmt, err)
+	}
+}
+
+// openDatabase opens the database and migrates it up, rolling the migrations
+// back once the test is done.
+func openDatabase(t *testing.T, database testDatabase) *models.DB {
+	t.Helper()
+	db, err := models.Open(database.dialect, database.dsn)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrationDb, err := models.OpenForMigrations(database.dialect, database.dsn)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	t.Cleanup(func() { migrationDb.Close() })
+
+	migrator, err := migrate.New(migrationDb, migrations.FS)
+	if err != nil {
+		t.Fatalf("could not read migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := migrator.Down(context.Background(), -1); err != nil {
+			t.Errorf("could not roll back migrations: %v", err)
+		}
+	})
+	return db
+}
+
+type testApp struct {
+	db         *models.DB
+	users      *service.UserService
+	households *service.HouseholdService
+	items      *service.ItemService
+	basket     *service.BasketService
+	lists      *service.ListService
+	trips      *service.TripService
+	tokens     *service.TokenService
+	twoFactor  *service.TwoFactorService
+	totp       *models.TOTPRepository
+	passkeys   *service.PasskeyService
+	oidc       *service.OIDCService
+	issuer     *oidctest.Issuer
+	transactor *models.Transactor
+}
+
+func newTestApp(t *testing.T, db *models.DB) *testApp {
+	t.Helper()
+	transactor := models.NewTransactor(db)
+	broker := events.NewBroker()
+	itemRepo := models.NewItemRepository(db)
+	priceRepo := models.NewPriceRepository(db)
+	basketRepo := models.NewBasketRepository(db)
+	listRepo := models.NewListRepository(db)
+	households := service.NewHouseholdService(models.NewHouseholdRepository(db), transactor)
+	passkeys, err := service.NewPasskeyService(models.NewCredentialRepository(db), models.NewUserRepository(db), "https://trolly.test")
+	if err != nil {
+		t.Fatalf("could not create passkey service: %v", err)
+	}
+	issuer, err := oidctest.New("trolly", "secret")
+	if err != nil {
+		t.Fatalf("could not start identity provider: %v", err)
+	}
+	t.Cleanup(issuer.Close)
+	return &testApp{
+		db:         db,
+		users:      service.NewUserService(models.NewUserRepository(db), models.NewPasswordResetRepository(db), transactor, []byte("test key")),
+		households: households,
+		items:      service.NewItemService(itemRepo, priceRepo, transactor),
+		basket:     service.NewBasketService(basketRepo, models.NewPurchaseRepository(db), priceRepo, transactor, broker),
+		lists:      service.NewListService(listRepo),
+		trips:      service.NewTripService(models.NewTripRepository(db), basketRepo, listRepo, transactor, broker),
+		tokens:     service.NewTokenService(models.NewTokenRepository(db)),
+		twoFactor:  service.NewTwoFactorService(models.NewTOTPRepository(db), transactor, []byte("test key")),
+		totp:       models.NewTOTPRepository(db),
+		passkeys:   passkeys,
+		oidc: service.NewOIDCService(models.NewUserRepository(db), models.NewIdentityRepository(db), households, transactor, service.OIDCConfig{
+			Issuer:       issuer.URL,
+			ClientID:     "trolly",
+			ClientSecret: "secret",
+			Scopes:       []string{"openid", "email", "profile"},
+			RedirectURL:  "https://trolly.test/login/oidc/callback",
+		}),
+		issuer:     issuer,
+		transactor: transactor,
+	}
+}
+
+// login registers a user and returns a context for them in their own household.
+func (app *testApp) login(t *testing.T, email string) (context.Context, *models.User) {
+	t.Helper()
+	user, err := app.users.Register(context.Background(), "Test", email, "pa55word")
+	if err != nil {
+		t.Fatalf("could not register %s: %v", email, err)
+	}
+	ctx := context.WithValue(context.Background(), components.UserKey, user.ID)
+	member, err := app.households.Current(ctx, user, 0)
+	if err != nil {
+		t.Fatalf("could not get household: %v", err)
+	}
+	ctx = context.WithValue(ctx, components.HouseholdKey, member.HouseholdID)
+	return ctx, user
+}
+
+func (app *testApp) defaultList(t *testing.T, ctx context.Context) models.List {
+	t.Helper()
+	list, err := app.lists.Default(ctx)
+	if err != nil {
+		t.Fatalf("could not get default list: %v", err)
+	}
+	return list
+}
+
+func TestUsers(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+		_, err := app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+		if err != nil {
+			t.Fatalf("Register returned error: %v", err)
+		}
+
+		_, err = app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+		if !errors.Is(err, models.ErrDuplicateEmail) {
+			t.Errorf("Register with a taken email returned %v, want %v", err, models.ErrDuplicateEmail)
+		}
+
+		_, err = app.users.Login(ctx, "test@example.com", "pa55word")
+		if err != nil {
+			t.Errorf("Login returned error: %v", err)
+		}
+		_, err = app.users.Login(ctx, "test@example.com", "wrong password")
+		if !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Errorf("Login with the wrong password returned %v, want %v", err, service.ErrInvalidCredentials)
+		}
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+		registered, _ := app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+		if _, _, err := app.users.ForgotPassword(ctx, "missing@example.com"); !errors.Is(err, models.ErrUserNotFound) {
+			t.Errorf("ForgotPassword for a missing user returned %v, want %v", err, models.ErrUserNotFound)
+		}
+
+		user, first, err := app.users.ForgotPassword(ctx, "TEST@example.com")
+		if err != nil || user.ID != registered.ID {
+			t.Fatalf("ForgotPassword returned %+v, %v", user, err)
+		}
+		if _, _, err := app.users.ForgotPassword(ctx, "test@example.com"); !errors.Is(err, service.ErrResetTooSoon) {
+			t.Errorf("ForgotPassword again straight away returned %v, want %v", err, service.ErrResetTooSoon)
+		}
+
+		// Once the interval has passed another link can be sent
+		app.exec(t, "UPDATE password_resets SET created_at = '2000-01-01 00:00:00'")
+		_, second, err := app.users.ForgotPassword(ctx, "test@example.com")
+		if err != nil {
+			t.Fatalf("ForgotPassword after the interval returned %v", err)
+		}
+		if got, err := app.users.CheckPasswordReset(ctx, first); err != nil || got.ID != registered.ID {
+			t.Errorf("CheckPasswordReset returned %+v, %v", got, err)
+		}
+		if _, err := app.users.CheckPasswordReset(ctx, "not a token"); !errors.Is(err, service.ErrInvalidToken) {
+			t.Errorf("CheckPasswordReset with a bad token returned %v, want %v", err, service.ErrInvalidToken)
+		}
+
+		var v *validator.Validator
+		if _, err := app.users.ResetPassword(ctx, first, "short"); !errors.As(err, &v) || v.GetError("password") == nil {
+			t.Errorf("ResetPassword with a short password returned %v, want a password error", err)
+		}
+		user, err = app.users.ResetPassword(ctx, first, "n3w pa55word")
+		if err != nil {
+			t.Fatalf("ResetPassword returned error: %v", err)
+		}
+		if user.SessionVersion != registered.SessionVersion+1 {
+			t.Errorf("SessionVersion = %d, want %d", user.SessionVersion, registered.SessionVersion+1)
+		}
+		if !user.Verified() {
+			t.Error("ResetPassword did not verify the user's email")
+		}
+		if _, err := app.users.Login(ctx, "test@example.com", "pa55word"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Errorf("Login with the old password returned %v", err)
+		}
+		if _, err := app.users.Login(ctx, "test@example.com", "n3w pa55word"); err != nil {
+			t.Errorf("Login with the new password returned %v", err)
+		}
+
+		// Resetting uses up every link that was sent
+		for _, token := range []string{first, second} {
+			if _, err := app.users.ResetPassword(ctx, token, "an0ther pa55word"); !errors.Is(err, service.ErrInvalidToken) {
+				t.Errorf("ResetPassword with a used token returned %v, want %v", err, service.ErrInvalidToken)
+			}
+		}
+
+		// Expired resets are cleared out when another is sent
+		_, expired, _ := app.users.ForgotPassword(ctx, "test@example.com")
+		app.exec(t, "UPDATE password_resets SET created_at = '2000-01-01 00:00:00', expires_at = '2000-01-01 01:00:00'")
+		if _, _, err := app.users.ForgotPassword(ctx, "test@example.com"); err != nil {
+			t.Fatalf("ForgotPassword after the last link expired returned %v", err)
+		}
+		var n int
+		if err := app.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM password_resets").Scan(&n); err != nil || n != 1 {
+			t.Errorf("%d password resets are kept, want 1: %v", n, err)
+		}
+		if _, err := app.users.CheckPasswordReset(ctx, expired); !errors.Is(err, service.ErrInvalidToken) {
+			t.Errorf("CheckPasswordReset with an expired token returned %v, want %v", err, service.ErrInvalidToken)
+		}
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+		user, _ := app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+		other, _ := app.users.Register(ctx, "Other", "other@example.com", "pa55word")
+		if user.Verified() {
+			t.Fatal("a new user is verified")
+		}
+
+		token := app.users.VerificationToken(user)
+		id, rest, _ := strings.Cut(token, ".")
+		expires, signature, _ := strings.Cut(rest, ".")
+		for _, bad := range []string{
+			"",
+			"not a token",
+			other.ID.String() + "." + rest,
+			id + "." + expires + "0." + signature,
+			id + "." + expires + "." + signature + "x",
+			service.NewUserService(nil, nil, nil, []byte("another key")).VerificationToken(user),
+		} {
+			if _, err := app.users.VerifyEmail(ctx, bad); !errors.Is(err, service.ErrInvalidToken) {
+				t.Errorf("VerifyEmail(%q) returned %v, want %v", bad, err, service.ErrInvalidToken)
+			}
+		}
+		if got, _ := app.users.GetUser(ctx, user.ID); got.Verified() {
+			t.Fatal("bad tokens verified the user")
+		}
+
+		verified, err := app.users.VerifyEmail(ctx, token)
+		if err != nil || verified.ID != user.ID || !verified.Verified() {
+			t.Fatalf("VerifyEmail returned %+v, %v", verified, err)
+		}
+		if got, err := app.users.GetUser(ctx, user.ID); err != nil || !got.Verified() {
+			t.Errorf("GetUser after VerifyEmail returned %+v, %v", got, err)
+		}
+		if again, err := app.users.VerifyEmail(ctx, token); err != nil || !again.VerifiedAt.Equal(verified.VerifiedAt) {
+			t.Errorf("VerifyEmail again returned %+v, %v", again, err)
+		}
+		if got, _ := app.users.GetUser(ctx, other.ID); got.Verified() {
+			t.Error("verifying one user verified another")
+		}
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+		user, _ := app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+		if enabled, err := app.twoFactor.Enabled(ctx, user.ID); err != nil || enabled {
+			t.Fatalf("Enabled for a new user returned %v, %v", enabled, err)
+		}
+
+		enrolment, err := app.twoFactor.Enrol(ctx, user)
+		if err != nil || !strings.HasPrefix(enrolment.URL, "otpauth://totp/Trolly:test@example.com?") || !strings.HasPrefix(enrolment.QR, "<svg") {
+			t.Fatalf("Enrol returned %+v, %v", enrolment, err)
+		}
+		stored, _ := app.totp.Get(ctx, user.ID)
+		if stored.Secret == enrolment.Secret || strings.Contains(stored.Secret, enrolment.Secret) {
+			t.Errorf("the secret is stored in plain text: %q", stored.Secret)
+		}
+		if pending, err := app.twoFactor.Pending(ctx, user); err != nil || pending.Secret != enrolment.Secret {
+			t.Errorf("Pending returned %+v, %v", pending, err)
+		}
+		if enabled, _ := app.twoFactor.Enabled(ctx, user.ID); enabled {
+			t.Error("two-factor authentication is enabled before a code was entered")
+		}
+		if n, err := app.totp.CountEnabled(ctx); err != nil || n != 0 {
+			t.Errorf("CountEnabled before a code was entered returned %d, %v, want 0", n, err)
+		}
+
+		now := totp.Step(time.Now())
+		code, _ := totp.Code(enrolment.Secret, now)
+		if _, err := app.twoFactor.Enable(ctx, user.ID, "000000x"); !errors.Is(err, service.ErrInvalidCode) {
+			t.Errorf("Enable with a bad code returned %v, want %v", err, service.ErrInvalidCode)
+		}
+		codes, err := app.twoFactor.Enable(ctx, user.ID, code)
+		if err != nil || len(codes) != service.RECOVERY_CODES {
+			t.Fatalf("Enable returned %v, %v", codes, err)
+		}
+		if enabled, _ := app.twoFactor.Enabled(ctx, user.ID); !enabled {
+			t.Error("two-factor authentication is not enabled")
+		}
+		if n, err := app.totp.CountEnabled(ctx); err != nil || n != 1 {
+			t.Errorf("CountEnabled returned %d, %v, want 1", n, err)
+		}
+		if _, err := app.twoFactor.Enrol(ctx, user); !errors.Is(err, service.ErrTwoFactorEnabled) {
+			t.Errorf("Enrol once enabled returned %v, want %v", err, service.ErrTwoFactorEnabled)
+		}
+
+		// Codes cannot be replayed
+		if err := app.twoFactor.Verify(ctx, user.ID, code); !errors.Is(err, service.ErrInvalidCode) {
+			t.Errorf("Verify with a used code returned %v, want %v", err, service.ErrInvalidCode)
+		}
+		next, _ := totp.Code(enrolment.Secret, now+1)
+		if err := app.twoFactor.Verify(ctx, user.ID, next); err != nil {
+			t.Errorf("Verify with the next code returned %v", err)
+		}
+
+		recovery := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+		if err := app.twoFactor.Verify(ctx, user.ID, recovery); err != nil {
+			t.Errorf("Verify with recovery code %q returned %v", recovery, err)
+		}
+		if err := app.twoFactor.Verify(ctx, user.ID, codes[0]); !errors.Is(err, service.ErrInvalidCode) {
+			t.Errorf("Verify with a used recovery code returned %v, want %v", err, service.ErrInvalidCode)
+		}
+		if left, err := app.twoFactor.RecoveryCodesLeft(ctx, user.ID); err != nil || left != service.RECOVERY_CODES-1 {
+			t.Errorf("RecoveryCodesLeft returned %d, %v", left, err)
+		}
+		newCodes, err := app.twoFactor.NewRecoveryCodes(ctx, user.ID)
+		if err != nil || len(newCodes) != service.RECOVERY_CODES {
+			t.Fatalf("NewRecoveryCodes returned %v, %v", newCodes, err)
+		}
+		if err := app.twoFactor.Verify(ctx, user.ID, codes[1]); !errors.Is(err, service.ErrInvalidCode) {
+			t.Errorf("Verify with a replaced recovery code returned %v, want %v", err, service.ErrInvalidCode)
+		}
+
+		// Too many invalid codes locks the user out, even with a valid one,
+		// until the lockout is over. Two invalid codes have been entered
+		// since the last valid one.
+		for i := 3; i < service.MAX_TWO_FACTOR_ATTEMPTS; i++ {
+			if err := app.twoFactor.Verify(ctx, user.ID, "000000"); !errors.Is(err, service.ErrInvalidCode) {
+				t.Errorf("Verify with invalid code %d returned %v, want %v", i, err, service.ErrInvalidCode)
+			}
+		}
+		if err := app.twoFactor.Verify(ctx, user.ID, "000000"); !errors.Is(err, service.ErrTooManyAttempts) {
+			t.Errorf("Verify with the last invalid code returned %v, want %v", err, service.ErrTooManyAttempts)
+		}
+		if err := app.twoFactor.Verify(ctx, user.ID, newCodes[1]); !errors.Is(err, service.ErrTooManyAttempts) {
+			t.Errorf("Verify while locked out returned %v, want %v", err, service.ErrTooManyAttempts)
+		}
+		app.exec(t, "UPDATE totp_secrets SET failed_at = '2000-01-01 00:00:00'")
+		if err := app.twoFactor.Verify(ctx, user.ID, newCodes[1]); err != nil {
+			t.Errorf("Verify after the lockout returned %v", err)
+		}
+		if stored, _ := app.totp.Get(ctx, user.ID); stored.FailedAttempts != 0 {
+			t.Errorf("%d invalid codes are kept after a valid one, want 0", stored.FailedAttempts)
+		}
+
+		if err := app.twoFactor.Disable(ctx, user.ID); err != nil {
+			t.Fatalf("Disable returned %v", err)
+		}
+		if enabled, _ := app.twoFactor.Enabled(ctx, user.ID); enabled {
+			t.Error("two-factor authentication is still enabled")
+		}
+		if err := app.twoFactor.Verify(ctx, user.ID, newCodes[0]); !errors.Is(err, service.ErrInvalidCode) {
+			t.Errorf("Verify once disabled returned %v, want %v", err, service.ErrInvalidCode)
+		}
+	})
+}
+
+func TestPasskeys(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+		user, _ := app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+		other, _ := app.users.Register(ctx, "Other", "other@example.com", "pa55word")
+		authenticator := passkeytest.New("https://trolly.test")
+
+		var v *validator.Validator
+		if _, _, err := app.passkeys.BeginRegistration(ctx, user, ""); !errors.As(err, &v) {
+			t.Errorf("BeginRegistration without a name returned %v, want a validation error", err)
+		}
+		credential := register(t, app, authenticator, user, "Phone")
+		if credential.CredentialID == "" || credential.Name != "Phone" || credential.UserID != user.ID {
+			t.Errorf("FinishRegistration returned %+v", credential)
+		}
+		if passkeys, err := app.passkeys.GetAll(ctx, user.ID); err != nil || len(passkeys) != 1 || passkeys[0].ID != credential.ID {
+			t.Errorf("GetAll returned %+v, %v", passkeys, err)
+		}
+
+		// The authenticator is told about the passkey it already has
+		creation, _, err := app.passkeys.BeginRegistration(ctx, user, "Phone again")
+		if err != nil {
+			t.Fatalf("BeginRegistration returned %v", err)
+		}
+		if _, err := authenticator.Create(toJSON(t, creation)); !errors.Is(err, passkeytest.ErrExcluded) {
+			t.Errorf("creating a second passkey on the authenticator returned %v, want %v", err, passkeytest.ErrExcluded)
+		}
+
+		// Logging in without an email finds the user from the passkey
+		got, err := logInWithPasskey(t, app, authenticator, nil)
+		if err != nil || got.ID != user.ID {
+			t.Fatalf("FinishLogin returned %v, %v", got, err)
+		}
+		if passkeys, _ := app.passkeys.GetAll(ctx, user.ID); passkeys[0].LastUsedAt.IsZero() {
+			t.Error("the passkey's last use was not recorded")
+		}
+		if got, err := logInWithPasskey(t, app, authenticator, user); err != nil || got.ID != user.ID {
+			t.Errorf("FinishLogin as the user returned %v, %v", got, err)
+		}
+		if _, _, err := app.passkeys.BeginLogin(ctx, other); !errors.Is(err, models.ErrCredentialNotFound) {
+			t.Errorf("BeginLogin for a user without passkeys returned %v, want %v", err, models.ErrCredentialNotFound)
+		}
+
+		authenticator.UserVerified = false
+		if _, err := logInWithPasskey(t, app, authenticator, nil); !errors.Is(err, service.ErrInvalidPasskey) {
+			t.Errorf("FinishLogin without user verification returned %v, want %v", err, service.ErrInvalidPasskey)
+		}
+		authenticator.UserVerified = true
+		authenticator.Origin = "https://trolly.example"
+		if _, err := logInWithPasskey(t, app, authenticator, nil); !errors.Is(err, service.ErrInvalidPasskey) {
+			t.Errorf("FinishLogin from another site returned %v, want %v", err, service.ErrInvalidPasskey)
+		}
+		authenticator.Origin = "https://trolly.test"
+
+		// Each challenge can only be answered by the ceremony that made it
+		assertion, _, _ := app.passkeys.BeginLogin(ctx, nil)
+		_, session, _ := app.passkeys.BeginLogin(ctx, nil)
+		response, _ := authenticator.Get(toJSON(t, assertion))
+		if _, err := app.passkeys.FinishLogin(ctx, nil, session, bytes.NewReader(response)); !errors.Is(err, service.ErrInvalidPasskey) {
+			t.Errorf("FinishLogin with another challenge returned %v, want %v", err, service.ErrInvalidPasskey)
+		}
+		if _, err := app.passkeys.FinishLogin(ctx, nil, "", bytes.NewReader(response)); !errors.Is(err, service.ErrInvalidPasskey) {
+			t.Errorf("FinishLogin without a session returned %v, want %v", err, service.ErrInvalidPasskey)
+		}
+
+		if required, err := app.passkeys.Required(ctx, user); err != nil || required {
+			t.Errorf("Required before it was set returned %v, %v", required, err)
+		}
+		if err := app.passkeys.SetRequired(ctx, user, true); err != nil {
+			t.Fatalf("SetRequired returned %v", err)
+		}
+		if got, _ := app.users.GetUser(ctx, user.ID); !got.PasskeyRequired {
+			t.Error("requiring a passkey was not saved")
+		}
+		if required, err := app.passkeys.Required(ctx, user); err != nil || !required {
+			t.Errorf("Required returned %v, %v", required, err)
+		}
+
+		if err := app.passkeys.Remove(ctx, other.ID, credential.ID); !errors.Is(err, models.ErrCredentialNotFound) {
+			t.Errorf("removing another user's passkey returned %v, want %v", err, models.ErrCredentialNotFound)
+		}
+		if err := app.passkeys.Remove(ctx, user.ID, credential.ID); err != nil {
+			t.Fatalf("Remove returned %v", err)
+		}
+		if required, err := app.passkeys.Required(ctx, user); err != nil || required {
+			t.Errorf("Required without any passkeys returned %v, %v", required, err)
+		}
+		if _, err := logInWithPasskey(t, app, authenticator, nil); !errors.Is(err, service.ErrInvalidPasskey) {
+			t.Errorf("FinishLogin with a removed passkey returned %v, want %v", err, service.ErrInvalidPasskey)
+		}
+	})
+}
+
+// register adds a passkey for the user on the authenticator.
+func register(t *testing.T, app *testApp, authenticator *passkeytest.Authenticator, user *models.User, name string) models.Credential {
+	t.Helper()
+	creation, session, err := app.passkeys.BeginRegistration(context.Background(), user, name)
+	if err != nil {
+		t.Fatalf("BeginRegistration returned %v", err)
+	}
+	response, err := authenticator.Create(toJSON(t, creation))
+	if err != nil {
+		t.Fatalf("could not create passkey: %v", err)
+	}
+	credential, err := app.passkeys.FinishRegistration(context.Background(), user, name, session, bytes.NewReader(response))
+	if err != nil {
+		t.Fatalf("FinishRegistration returned %v", err)
+	}
+	if _, err := app.passkeys.FinishRegistration(context.Background(), user, name, session, bytes.NewReader(response)); !errors.Is(err, models.ErrDuplicateCredential) {
+		t.Errorf("finishing the registration again returned %v, want %v", err, models.ErrDuplicateCredential)
+	}
+	return credential
+}
+
+// logInWithPasskey logs in with a passkey on the authenticator, as the user if
+// they are not nil.
+func logInWithPasskey(t *testing.T, app *testApp, authenticator *passkeytest.Authenticator, user *models.User) (*models.User, error) {
+	t.Helper()
+	assertion, session, err := app.passkeys.BeginLogin(context.Background(), user)
+	if err != nil {
+		t.Fatalf("BeginLogin returned %v", err)
+	}
+	response, err := authenticator.Get(toJSON(t, assertion))
+	if err != nil {
+		t.Fatalf("could not use passkey: %v", err)
+	}
+	return app.passkeys.FinishLogin(context.Background(), user, session, bytes.NewReader(response))
+}
+
+func toJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOIDC(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+
+		// Users new to Trolly get an account, which the provider has verified
+		app.issuer.User = oidctest.User{Subject: "1", Email: "New@example.com", EmailVerified: true, Name: "New"}
+		user, err := logInWithOIDC(t, app)
+		if err != nil {
+			t.Fatalf("Finish returned %v", err)
+		}
+		if user.Email != "new@example.com" || user.Name != "New" || !user.Verified() {
+			t.Errorf("Finish created %+v", user)
+		}
+		if _, err := app.users.Login(ctx, "new@example.com", ""); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Errorf("logging in with a password returned %v, want %v", err, service.ErrInvalidCredentials)
+		}
+		if memberships, err := app.households.Memberships(context.WithValue(ctx, components.UserKey, user.ID)); err != nil || len(memberships) != 1 || memberships[0].Role != models.RoleOwner {
+			t.Errorf("the new account has memberships %+v, %v, want it to own one household", memberships, err)
+		}
+
+		// The identity is remembered, so changing the email there does not
+		// make another account
+		app.issuer.User.Email = "renamed@example.com"
+		if got, err := logInWithOIDC(t, app); err != nil || got.ID != user.ID {
+			t.Errorf("Finish after changing the email returned %v, %v", got, err)
+		}
+
+		// Existing accounts are linked by email
+		existing, _ := app.users.Register(ctx, "Existing", "existing@example.com", "pa55word")
+		app.issuer.User = oidctest.User{Subject: "2", Email: "existing@example.com", EmailVerified: true}
+		if got, err := logInWithOIDC(t, app); err != nil || got.ID != existing.ID || !got.Verified() {
+			t.Errorf("Finish for an existing user returned %v, %v", got, err)
+		}
+		if _, err := app.users.Login(ctx, "existing@example.com", "pa55word"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Errorf("the password of an unverified account was kept, logging in returned %v", err)
+		}
+		verified, _ := app.users.Register(ctx, "Verified", "verified@example.com", "pa55word")
+		_, _ = app.users.VerifyEmail(ctx, app.users.VerificationToken(verified))
+		app.issuer.User = oidctest.User{Subject: "3", Email: "verified@example.com", EmailVerified: true}
+		if got, err := logInWithOIDC(t, app); err != nil || got.ID != verified.ID {
+			t.Errorf("Finish for a verified user returned %v, %v", got, err)
+		}
+		if _, err := app.users.Login(ctx, "verified@example.com", "pa55word"); err != nil {
+			t.Errorf("logging in with the password of a verified account returned %v", err)
+		}
+
+		// Emails are only trusted once the provider has verified them
+		app.issuer.User = oidctest.User{Subject: "4", Email: "verified@example.com", EmailVerified: false}
+		if _, err := logInWithOIDC(t, app); !errors.Is(err, service.ErrEmailNotVerified) {
+			t.Errorf("Finish with an unverified email returned %v, want %v", err, service.ErrEmailNotVerified)
+		}
+
+		// The email comes from the user info endpoint when the ID token has none
+		app.issuer.User = oidctest.User{Subject: "5", Email: "info@example.com", EmailVerified: true, Name: "Info"}
+		app.issuer.OmitEmail = true
+		if got, err := logInWithOIDC(t, app); err != nil || got.Email != "info@example.com" {
+			t.Errorf("Finish with the email from user info returned %v, %v", got, err)
+		}
+		app.issuer.OmitEmail = false
+
+		login, err := app.oidc.Begin(ctx)
+		if err != nil {
+			t.Fatalf("Begin returned %v", err)
+		}
+		callback, err := app.issuer.Authorize(login.URL)
+		if err != nil {
+			t.Fatalf("could not authorize: %v", err)
+		}
+		code := callback.Query().Get("code")
+		if _, err := app.oidc.Finish(ctx, login, "wrong", code); !errors.Is(err, service.ErrInvalidOIDCLogin) {
+			t.Errorf("Finish with another state returned %v, want %v", err, service.ErrInvalidOIDCLogin)
+		}
+		if _, err := app.oidc.Finish(ctx, login, login.State, code); err != nil {
+			t.Fatalf("Finish returned %v", err)
+		}
+		if _, err := app.oidc.Finish(ctx, login, login.State, code); !errors.Is(err, service.ErrInvalidOIDCLogin) {
+			t.Errorf("Finish with a used code returned %v, want %v", err, service.ErrInvalidOIDCLogin)
+		}
+
+		// The code is bound to the verifier of the login that asked for it
+		login, _ = app.oidc.Begin(ctx)
+		callback, _ = app.issuer.Authorize(login.URL)
+		other, _ := app.oidc.Begin(ctx)
+		if _, err := app.oidc.Finish(ctx, other, other.State, callback.Query().Get("code")); !errors.Is(err, service.ErrInvalidOIDCLogin) {
+			t.Errorf("Finish with another login's verifier returned %v, want %v", err, service.ErrInvalidOIDCLogin)
+		}
+	})
+}
+
+// logInWithOIDC logs in as the issuer's user.
+func logInWithOIDC(t *testing.T, app *testApp) (*models.User, error) {
+	t.Helper()
+	login, err := app.oidc.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin returned %v", err)
+	}
+	callback, err := app.issuer.Authorize(login.URL)
+	if err != nil {
+		t.Fatalf("could not authorize: %v", err)
+	}
+	return app.oidc.Finish(context.Background(), login, callback.Query().Get("state"), callback.Query().Get("code"))
+}
+
+func TestFirstHousehold(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		var user *models.User
+		var household models.Household
+		err := app.transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			var err error
+			user, err = app.users.Register(ctx, "Test", "test@example.com", "pa55word")
+			if err != nil {
+				return err
+			}
+			household, err = app.households.CreateFirst(ctx, user)
+			return err
+		})
+		if err != nil || household.Name != "Test's household" {
+			t.Fatalf("CreateFirst returned %+v, %v", household, err)
+		}
+
+		// Requests made straight after signing up all find the same household
+		ctx := context.WithValue(context.Background(), components.UserKey, user.ID)
+		var wg sync.WaitGroup
+		members := make([]models.Member, 8)
+		errs := make([]error, len(members))
+		for i := range members {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				members[i], errs[i] = app.households.Current(ctx, user, 0)
+			}()
+		}
+		wg.Wait()
+		for i := range members {
+			if errs[i] != nil || members[i].HouseholdID != household.ID || members[i].Role != models.RoleOwner {
+				t.Errorf("Current returned %+v, %v, want to own household %d", members[i], errs[i], household.ID)
+			}
+		}
+		if memberships, err := app.households.Memberships(ctx); err != nil || len(memberships) != 1 {
+			t.Errorf("Memberships returned %+v, %v, want one household", memberships, err)
+		}
+	})
+}
+
+func TestHouseholds(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx, _ := app.login(t, "owner@example.com")
+		_, member := app.login(t, "member@example.com")
+		householdId := ctx.Value(components.HouseholdKey).(int64)
+		household, err := app.households.Get(ctx, householdId)
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+
+		_, err = app.households.Join(ctx, member.ID, household.JoinCode)
+		if err != nil {
+			t.Fatalf("Join returned error: %v", err)
+		}
+		_, err = app.households.Join(ctx, member.ID, household.JoinCode)
+		if !errors.Is(err, models.ErrAlreadyMember) {
+			t.Errorf("joining twice returned %v, want %v", err, models.ErrAlreadyMember)
+		}
+
+		members, err := app.households.Members(ctx, householdId)
+		if err != nil {
+			t.Fatalf("Members returned error: %v", err)
+		}
+		if len(members) != 2 {
+			t.Errorf("household has %d members, want 2", len(members))
+		}
+
+		_, err = app.households.Invite(ctx, householdId, "friend@example.com", models.RoleViewer)
+		if err != nil {
+			t.Fatalf("Invite returned error: %v", err)
+		}
+		_, err = app.households.Invite(ctx, householdId, "friend@example.com", models.RoleViewer)
+		if !errors.Is(err, models.ErrDuplicateInvitation) {
+			t.Errorf("inviting twice returned %v, want %v", err, models.ErrDuplicateInvitation)
+		}
+
+		err = app.households.RemoveMember(ctx, householdId, uuid.New())
+		if !errors.Is(err, models.ErrMemberNotFound) {
+			t.Errorf("removing a stranger returned %v, want %v", err, models.ErrMemberNotFound)
+		}
+
+		// Two owners demoting each other at once must leave one of them
+		err = app.households.ChangeRole(ctx, householdId, member.ID, models.RoleOwner)
+		if err != nil {
+			t.Fatalf("ChangeRole returned error: %v", err)
+		}
+		owner := ctx.Value(components.UserKey).(uuid.UUID)
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i, userId := range []uuid.UUID{owner, member.ID} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = app.households.ChangeRole(ctx, householdId, userId, models.RoleEditor)
+			}()
+		}
+		wg.Wait()
+		if (errs[0] == nil) == (errs[1] == nil) || !errors.Is(errors.Join(errs...), service.ErrLastOwner) {
+			t.Errorf("demoting both owners at once returned %v, want one %v", errs, service.ErrLastOwner)
+		}
+		members, err = app.households.Members(ctx, householdId)
+		if err != nil {
+			t.Fatalf("Members returned error: %v", err)
+		}
+		owners := 0
+		for _, m := range members {
+			if m.Role == models.RoleOwner {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("household has %d owners after both were demoted at once, want 1", owners)
+		}
+	})
+}
+
+func TestTokens(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx, user := app.login(t, "test@example.com")
+		otherCtx, _ := app.login(t, "other@example.com")
+
+		token, plaintext, err := app.tokens.Create(ctx, "Home Assistant", models.ScopeRead, time.Time{})
+		if err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		if !strings.HasPrefix(plaintext, service.TOKEN_PREFIX) || strings.Contains(token.Hash, plaintext) {
+			t.Errorf("Create returned token %q with hash %q", plaintext, token.Hash)
+		}
+		_, _, err = app.tokens.Create(ctx, "", models.ScopeWrite, time.Time{})
+		if err == nil {
+			t.Errorf("Create with no name returned nil, want an error")
+		}
+
+		authenticated, err := app.tokens.Authenticate(context.Background(), plaintext)
+		if err != nil {
+			t.Fatalf("Authenticate returned error: %v", err)
+		}
+		if authenticated.ID != token.ID || authenticated.UserID != user.ID || authenticated.HouseholdID != ctx.Value(components.HouseholdKey).(int64) || authenticated.Scope != models.ScopeRead {
+			t.Errorf("Authenticate returned %+v, want %+v", authenticated, token)
+		}
+		_, err = app.tokens.Authenticate(context.Background(), plaintext+"x")
+		if !errors.Is(err, service.ErrInvalidToken) {
+			t.Errorf("Authenticate with the wrong token returned %v, want %v", err, service.ErrInvalidToken)
+		}
+
+		tokens, err := app.tokens.GetAll(ctx)
+		if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt.IsZero() || !tokens[0].ExpiresAt.IsZero() {
+			t.Errorf("GetAll returned %+v, %v, want the used token", tokens, err)
+		}
+
+		_, expired, err := app.tokens.Create(ctx, "Expired", models.ScopeWrite, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		_, err = app.tokens.Authenticate(context.Background(), expired)
+		if !errors.Is(err, service.ErrInvalidToken) {
+			t.Errorf("Authenticate with an expired token returned %v, want %v", err, service.ErrInvalidToken)
+		}
+
+		err = app.tokens.Revoke(otherCtx, token.ID)
+		if !errors.Is(err, models.ErrTokenNotFound) {
+			t.Errorf("revoking another user's token returned %v, want %v", err, models.ErrTokenNotFound)
+		}
+		err = app.tokens.Revoke(ctx, token.ID)
+		if err != nil {
+			t.Fatalf("Revoke returned error: %v", err)
+		}
+		_, err = app.tokens.Authenticate(context.Background(), plaintext)
+		if !errors.Is(err, service.ErrInvalidToken) {
+			t.Errorf("Authenticate with a revoked token returned %v, want %v", err, service.ErrInvalidToken)
+		}
+	})
+}
+
+func TestItems(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx, _ := app.login(t, "test@example.com")
+		milk, err := app.items.Add(ctx, "Milk", money.New(349, money.USD), "dairy")
+		if err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+		_, err = app.items.Add(ctx, "Bread", money.Amount{}, "")
+		if err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+
+		again, err := app.items.Add(ctx, "milk", money.Amount{}, "")
+		if err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+		if again.ID != milk.ID {
+			t.Errorf("adding milk again created item %d, want %d", again.ID, milk.ID)
+		}
+
+		metadata, items, err := app.items.Search(ctx, "MIL", 1, 10, "timesBought")
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		if metadata.TotalRecords != 1 || len(items) != 1 || items[0].ID != milk.ID {
+			t.Errorf("Search(MIL) = %d records %+v, want only milk", metadata.TotalRecords, items)
+		}
+
+		_, err = app.items.Update(ctx, milk.ID, "", money.New(399, money.USD))
+		if err != nil {
+			t.Fatalf("Update returned error: %v", err)
+		}
+		history, err := app.items.PriceHistory(ctx, milk.ID)
+		if err != nil {
+			t.Fatalf("PriceHistory returned error: %v", err)
+		}
+		if len(history.Prices) != 2 || history.Min.Minor != 349 || history.Max.Minor != 399 || history.Average.Minor != 374 {
+			t.Errorf("PriceHistory = %d prices, min %v, max %v, average %v", len(history.Prices), history.Min, history.Max, history.Average)
+		}
+
+		average := context.WithValue(ctx, components.PriceModeKey, models.PriceAverage)
+		_, items, err = app.items.Search(average, "milk", 1, 10, "recentlyAdded")
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		if len(items) != 1 || items[0].Price != money.New(374, money.USD) {
+			t.Errorf("average price search = %+v, want milk at $3.74", items)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx, _ := app.login(t, "test@example.com")
+		milk, _ := app.items.Add(ctx, "Milk", money.New(349, money.USD), "Dairy")
+		bread, _ := app.items.Add(ctx, "Bread", money.New(250, money.USD), "")
+		app.items.Add(ctx, "Eggs", money.New(400, money.USD), "")
+
+		input := "name,price,category\nmilk,3.99,Drinks\nBread,2.50,Bakery\nEggs,4.00,\nApples,1.99,Fruit\n,1.00,\nPears,abc,\napples,2.49,\n"
+		rows, err := transfer.ReadItems(strings.NewReader(input), transfer.CSV, money.USD)
+		if err != nil {
+			t.Fatalf("ReadItems returned error: %v", err)
+		}
+
+		want := []struct {
+			name      string
+			action    service.ImportAction
+			conflicts int
+			err       bool
+		}{
+			{"milk", service.ImportUpdate, 2, false},
+			{"Bread", service.ImportUpdate, 0, false},
+			{"Eggs", service.ImportUnchanged, 0, false},
+			{"Apples", service.ImportCreate, 0, false},
+			{"", service.ImportSkip, 0, true},
+			{"Pears", service.ImportSkip, 0, true},
+			{"apples", service.ImportSkip, 0, true},
+		}
+		check := func(results []service.ImportResult) {
+			t.Helper()
+			if len(results) != len(want) {
+				t.Fatalf("Import returned %d results, want %d", len(results), len(want))
+			}
+			for i, result := range results {
+				w := want[i]
+				if result.Name != w.name || result.Action != w.action || len(result.Conflicts) != w.conflicts || (result.Err != nil) != w.err {
+					t.Errorf("line %d = %+v, want %+v", result.Line, result, w)
+				}
+			}
+		}
+
+		preview, err := app.items.Import(ctx, rows, true)
+		if err != nil {
+			t.Fatalf("dry run Import returned error: %v", err)
+		}
+		check(preview)
+		if preview[0].Line != 2 || preview[6].Line != 8 {
+			t.Errorf("lines = %d and %d, want 2 and 8", preview[0].Line, preview[6].Line)
+		}
+		records, _ := app.items.Export(ctx)
+		if len(records) != 3 {
+			t.Errorf("dry run created items, pantry has %d", len(records))
+		}
+
+		results, err := app.items.Import(ctx, rows, false)
+		if err != nil {
+			t.Fatalf("Import returned error: %v", err)
+		}
+		check(results)
+		if got, _ := app.items.Get(ctx, milk.ID); got.Price != money.New(399, money.USD) || got.Category != "Dairy" {
+			t.Errorf("imported milk = %+v, want the new price and the old category", got)
+		}
+		if got, _ := app.items.Get(ctx, bread.ID); got.Category != "Bakery" {
+			t.Errorf("imported bread = %+v, want the category filled in", got)
+		}
+		records, _ = app.items.Export(ctx)
+		if len(records) != 4 || records[0].Name != "Apples" || records[0].Price != money.New(199, money.USD) {
+			t.Errorf("Export after import = %+v", records)
+		}
+
+		rows, _ = transfer.ReadItems(strings.NewReader("name,price\nBREAD,2.50\n"), transfer.CSV, money.USD)
+		results, err = app.items.Import(ctx, rows, true)
+		if err != nil || results[0].Action != service.ImportUnchanged {
+			t.Errorf("Import of BREAD = %+v, %v, want the existing Bread unchanged", results, err)
+		}
+
+		// Prices in another currency are not imported, so the basket can
+		// still total everything in the pantry
+		rows, _ = transfer.ReadItems(strings.NewReader("name,price,currency\nCroissant,2.00,EUR\n"), transfer.CSV, money.USD)
+		results, err = app.items.Import(ctx, rows, false)
+		if err != nil || results[0].Action != service.ImportSkip || results[0].Err == nil {
+			t.Errorf("Import of a price in euros = %+v, %v", results, err)
+		}
+		list := app.defaultList(t, ctx)
+		_, items, _ := app.items.Search(ctx, "", 1, 10, "")
+		for _, item := range items {
+			if _, err := app.basket.AddItem(ctx, list.ID, models.BasketItem{Quantity: 1, Item: item}); err != nil {
+				t.Fatalf("AddItem(%s) returned error: %v", item.Name, err)
+			}
+		}
+		if basket, err := app.basket.GetItems(ctx, list.ID); err != nil || len(basket.Items) != 4 {
+			t.Errorf("GetItems after importing = %+v, %v", basket, err)
+		}
+	})
+}
+
+func TestBasket(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx, _ := app.login(t, "test@example.com")
+		list := app.defaultList(t, ctx)
+		milk, err := app.items.Add(ctx, "Milk", money.New(349, money.USD), "")
+		if err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+
+		item, err := app.basket.AddItem(ctx, list.ID, models.BasketItem{Quantity: 2, Unit: "gal", Item: milk})
+		if err != nil {
+			t.Fatalf("AddItem returned error: %v", err)
+		}
+		again, err := app.basket.AddItem(ctx, list.ID, models.BasketItem{Quantity: 9998, Item: milk})
+		if err != nil {
+			t.Fatalf("AddItem returned error: %v", err)
+		}
+		if again.BasketID != item.BasketID || again.Quantity != 9999 || again.Unit != "gal" {
+			t.Errorf("adding milk again = %+v, want the same row at quantity 9999 in gal", again)
+		}
+
+		_, err = app.basket.UpdateQuantity(ctx, list.ID, item.BasketID, 2, "gal")
+		if err != nil {
+			t.Fatalf("UpdateQuantity returned error: %v", err)
+		}
+		item, err = app.basket.TogglePurchased(ctx, list.ID, item.BasketID)
+		if err != nil {
+			t.Fatalf("TogglePurchased returned error: %v", err)
+		}
+		if !item.Purchased {
+			t.Errorf("item is not purchased after checking it")
+		}
+
+		basket, err := app.basket.GetItems(ctx, list.ID)
+		if err != nil {
+			t.Fatalf("GetItems returned error: %v", err)
+		}
+		if basket.Total != money.New(698, money.USD) || !basket.HasPurchased() {
+			t.Errorf("basket total = %v, want $6.98 with purchased items", basket.Total)
+		}
+
+		_, items, err := app.items.Search(ctx, "", 1, 10, "recentlyPurchased")
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		if len(items) != 1 || items[0].TimesBought != 2 {
+			t.Errorf("milk has been bought %+v times, want 2 for the 2 gallons", items)
+		}
+
+		_, err = app.basket.TogglePurchased(ctx, list.ID, item.BasketID)
+		if err != nil {
+			t.Fatalf("TogglePurchased returned error: %v", err)
+		}
+		_, items, err = app.items.Search(ctx, "", 1, 10, "timesBought")
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		if len(items) != 1 || items[0].TimesBought != 0 {
+			t.Errorf("unchecking milk left %+v, want it bought 0 times", items)
+		}
+
+		err = app.basket.RemoveItem(ctx, list.ID, item.BasketID)
+		if err != nil {
+			t.Fatalf("RemoveItem returned error: %v", err)
+		}
+		err = app.basket.RemoveItem(ctx, list.ID, item.BasketID)
+		if !errors.Is(err, models.ErrBasketItemNotFound) {
+			t.Errorf("removing twice returned %v, want %v", err, models.ErrBasketItemNotFound)
+		}
+
+		// Adding the same item at once, in transactions like adding many
+		// items does, leaves one row with every quantity
+		eggs, _ := app.items.Add(ctx, "Eggs", money.New(400, money.USD), "")
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- app.transactor.WithinTx(ctx, func(ctx context.Context) error {
+					_, err := app.basket.AddItem(ctx, list.ID, models.BasketItem{Quantity: 1, Item: eggs})
+					return err
+				})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("adding eggs at once returned %v", err)
+			}
+		}
+		basket, _ = app.basket.GetItems(ctx, list.ID)
+		if len(basket.Items) != 1 || basket.Items[0].Name != "Eggs" || basket.Items[0].Quantity != 8 {
+			t.Errorf("basket after adding eggs at once = %+v, want one row of 8", basket.Items)
+		}
+	})
+}
+
+func TestTrips(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, app *testApp) {
+		ctx, _ := app.login(t, "test@example.com")
+		list := app.defaultList(t, ctx)
+
+		_, err := app.trips.Finish(ctx, list.ID, "")
+		if !errors.Is(err, service.ErrNothingPurchased) {
+			t.Errorf("finishing an empty trip returned %v, want %v", err, service.ErrNothingPurchased)
+		}
+
+		for _, name := range []string{"Milk", "Eggs"} {
+			item, err := app.items.Add(ctx, name, money.New(250, money.USD), "")
+			if err != nil {
+				t.Fatalf("Add returned error: %v", err)
+			}
+			added, err := app.basket.AddItem(ctx, list.ID, models.BasketItem{Quantity: 2, Store: "costco", Item: item})
+			if err != nil {
+				t.Fatalf("AddItem returned error: %v", err)
+			}
+			_, err = app.basket.TogglePurchased(ctx, list.ID, added.BasketID)
+			if err != nil {
+				t.Fatalf("TogglePurchased returned error: %v", err)
+			}
+			// The trip keeps the price the item was bought for
+			_, err = app.items.Update(ctx, item.ID, name, money.New(999, money.USD))
+			if err != nil {
+				t.Fatalf("Update returned error: %v", err)
+			}
+		}
+
+		trip, err := app.trips.Finish(ctx, list.ID, "")
+		if err != nil {
+			t.Fatalf("Finish returned error: %v", err)
+		}
+		if trip.Total != money.New(1000, money.USD) || trip.Store != "costco" {
+			t.Errorf("Finish = total %v at %q, want $10.00 at costco", trip.Total, trip.Store)
+		}
+
+		got, err := app.trips.Get(ctx, trip.ID)
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		var names []string
+		for _, item := range got.Items {
+			names = append(names, item.Name)
+			if item.Price != money.New(250, money.USD) {
+				t.Errorf("%s was bought for %v, want $2.50", item.Name, item.Price)
+			}
+		}
+		if strings.Join(names, ",") != "Milk,Eggs" || got.FinishedAt.IsZero() {
+			t.Errorf("Get = items %v finished at %v", names, got.FinishedAt)
+		}
+
+		basket, err := app.basket.GetItems(ctx, list.ID)
+		if err != nil {
+			t.Fatalf("GetItems returned error: %v", err)
+		}
+		if len(basket.Items) != 0 {
+			t.Errorf("basket has %d items after the trip, want 0", len(basket.Items))
+		}
+	})
+}
+
+func TestRepositories(t *testing.T) {
+	for _, database := range testDatabases(t) {
+		t.Run(string(database.dialect), func(t *testing.T) {
+			servicetest.TestRepositories(t, func(t *testing.T) servicetest.Backend {
+				db := openDatabase(t, database)
+				return servicetest.Backend{
+					Users:       models.NewUserRepository(db),
+					Resets:      models.NewPasswordResetRepository(db),
+					Households:  models.NewHouseholdRepository(db),
+					Lists:       models.NewListRepository(db),
+					Items:       models.NewItemRepository(db),
+					Prices:      models.NewPriceRepository(db),
+					Basket:      models.NewBasketRepository(db),
+					Purchases:   models.NewPurchaseRepository(db),
+					Trips:       models.NewTripRepository(db),
+					Tokens:      models.NewTokenRepository(db),
+					TOTP:        models.NewTOTPRepository(db),
+					Credentials: models.NewCredentialRepository(db),
+					Identities:  models.NewIdentityRepository(db),
+					Transactor:  models.NewTransactor(db),
+				}
+			})
+		})
+	}
+}
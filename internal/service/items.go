@@ -2,56 +2,116 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/transfer"
+	"github.com/hunterwilkins2/trolly/internal/validator"
 )
 
 type ItemService struct {
-	repository *models.ItemRepository
+	repository ItemRepository
+	prices     PriceRepository
+	transactor Transactor
 }
 
-func NewItemService(r *models.ItemRepository) *ItemService {
+func NewItemService(r ItemRepository, prices PriceRepository, transactor Transactor) *ItemService {
 	return &ItemService{
 		repository: r,
+		prices:     prices,
+		transactor: transactor,
 	}
 }
 
+// PriceHistory is every price recorded for an item along with a summary of
+// them.
+type PriceHistory struct {
+	Item    models.Item
+	Prices  []models.ItemPrice
+	Min     money.Amount
+	Max     money.Amount
+	Average money.Amount
+}
+
 func (s *ItemService) Search(ctx context.Context, query string, page int, pageSize int, orderBy string) (models.Metadata, []models.Item, error) {
 	return s.repository.GetAll(ctx, query, page, pageSize, orderBy)
 }
 
-func (s *ItemService) Add(ctx context.Context, name string, price float32) (models.Item, error) {
+// Add returns the item with the given name, creating it if it does not exist.
+// Existing items are only updated to fill in a missing category.
+func (s *ItemService) Add(ctx context.Context, name string, price money.Amount, category string) (models.Item, error) {
 	existingItem, err := s.repository.GetByName(ctx, name)
 	if err == nil {
+		if existingItem.Category != "" || category == "" {
+			return existingItem, nil
+		}
+		existingItem.Category = category
+		err = existingItem.Validate()
+		if err != nil {
+			return models.Item{}, err
+		}
+		err = s.repository.Update(ctx, &existingItem)
+		if err != nil {
+			return models.Item{}, err
+		}
 		return existingItem, nil
 	}
 
 	item := &models.Item{
-		Name:  name,
-		Price: price,
+		Name:     name,
+		Price:    price,
+		Category: category,
+	}
+	err = item.Validate()
+	if err != nil {
+		return models.Item{}, err
 	}
-	err = s.repository.Create(ctx, item)
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.repository.Create(ctx, item)
+		if err != nil {
+			return err
+		}
+		if item.Price.IsZero() {
+			return nil
+		}
+		return s.prices.Record(ctx, &models.ItemPrice{
+			ItemID: item.ID,
+			Price:  item.Price,
+			Source: models.PriceCreated,
+		})
+	})
 	if err != nil {
 		return models.Item{}, err
 	}
 	return *item, nil
 }
 
-func (s *ItemService) Update(ctx context.Context, id int64, name string, price float32) (models.Item, error) {
+func (s *ItemService) Update(ctx context.Context, id int64, name string, price money.Amount) (models.Item, error) {
 	item, err := s.repository.GetById(ctx, id)
 	if err != nil {
 		return models.Item{}, err
 	}
-	fmt.Println(item)
-
 	if name != "" {
 		item.Name = name
 	}
-	if price != 0 {
+	priceChanged := !price.IsZero() && price != item.Price
+	if priceChanged {
 		item.Price = price
 	}
-	err = s.repository.Update(ctx, &item)
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.repository.Update(ctx, &item)
+		if err != nil || !priceChanged {
+			return err
+		}
+		return s.prices.Record(ctx, &models.ItemPrice{
+			ItemID: item.ID,
+			Price:  item.Price,
+			Source: models.PriceEdited,
+		})
+	})
 	if err != nil {
 		return models.Item{}, err
 	}
@@ -59,6 +119,39 @@ func (s *ItemService) Update(ctx context.Context, id int64, name string, price f
 	return item, nil
 }
 
+func (s *ItemService) PriceHistory(ctx context.Context, id int64) (PriceHistory, error) {
+	item, err := s.repository.GetById(ctx, id)
+	if err != nil {
+		return PriceHistory{}, err
+	}
+	prices, err := s.prices.GetHistory(ctx, id)
+	if err != nil {
+		return PriceHistory{}, err
+	}
+
+	history := PriceHistory{
+		Item:   item,
+		Prices: prices,
+	}
+	var total money.Amount
+	for i, price := range prices {
+		if i == 0 || price.Price.Minor < history.Min.Minor {
+			history.Min = price.Price
+		}
+		if price.Price.Minor > history.Max.Minor {
+			history.Max = price.Price
+		}
+		total, err = total.Add(price.Price)
+		if err != nil {
+			return PriceHistory{}, err
+		}
+	}
+	if n := int64(len(prices)); n > 0 {
+		history.Average = money.New((total.Minor+n/2)/n, total.Currency)
+	}
+	return history, nil
+}
+
 func (s *ItemService) Get(ctx context.Context, id int64) (models.Item, error) {
 	item, err := s.repository.GetById(ctx, id)
 	if err != nil {
@@ -70,3 +163,118 @@ func (s *ItemService) Get(ctx context.Context, id int64) (models.Item, error) {
 func (s *ItemService) Remove(ctx context.Context, id int64) error {
 	return s.repository.Delete(ctx, id)
 }
+
+func (s *ItemService) Export(ctx context.Context) ([]models.ItemRecord, error) {
+	return s.repository.Export(ctx)
+}
+
+type ImportAction string
+
+const (
+	ImportCreate    ImportAction = "create"
+	ImportUpdate    ImportAction = "update"
+	ImportUnchanged ImportAction = "unchanged"
+	ImportSkip      ImportAction = "skip"
+)
+
+// ImportResult is what importing a row did, or would do in a dry run.
+type ImportResult struct {
+	Line   int
+	Name   string
+	Action ImportAction
+	// Conflicts are how the row differs from the item that already has its
+	// name, and which value is kept.
+	Conflicts []string
+	// Err is why a skipped row is not imported.
+	Err error
+}
+
+// Import adds the rows to the pantry as Add does, also updating the price of
+// existing items when the row has a different one. Rows that are invalid are
+// skipped without stopping the rest. With dryRun nothing is changed, and the
+// results say what importing would do.
+func (s *ItemService) Import(ctx context.Context, rows []transfer.Row, dryRun bool) ([]ImportResult, error) {
+	var results []ImportResult
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		results = make([]ImportResult, 0, len(rows))
+		seen := map[string]int{}
+		for _, row := range rows {
+			result := ImportResult{Line: row.Line, Name: row.Item.Name, Action: ImportSkip, Err: row.Err}
+			if result.Err == nil {
+				result.Err = firstError(row.Item.Validate())
+			}
+			key := strings.ToLower(row.Item.Name)
+			if line, ok := seen[key]; ok && result.Err == nil {
+				result.Err = fmt.Errorf("%s is already imported by line %d", row.Item.Name, line)
+			} else if !ok {
+				seen[key] = row.Line
+			}
+			if result.Err != nil {
+				results = append(results, result)
+				continue
+			}
+
+			// Names are matched ignoring case, as the lines of the file are
+			existing, err := s.repository.GetByName(ctx, key)
+			if errors.Is(err, models.ErrItemNotFound) {
+				result.Action = ImportCreate
+			} else if err != nil {
+				return err
+			} else {
+				result.Action, result.Conflicts = importChanges(existing, row.Item)
+			}
+			results = append(results, result)
+			if dryRun || result.Action == ImportUnchanged {
+				continue
+			}
+
+			item, err := s.Add(ctx, row.Item.Name, row.Item.Price, row.Item.Category)
+			if err != nil {
+				return err
+			}
+			if result.Action == ImportUpdate && !row.Item.Price.IsZero() && row.Item.Price != item.Price {
+				_, err = s.Update(ctx, item.ID, "", row.Item.Price)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// importChanges compares an existing item with the row importing over it.
+// Prices are replaced, but categories are only filled in, as Add does.
+func importChanges(existing models.Item, row models.Item) (ImportAction, []string) {
+	action := ImportUnchanged
+	var conflicts []string
+	if !row.Price.IsZero() && row.Price != existing.Price {
+		action = ImportUpdate
+		if !existing.Price.IsZero() {
+			conflicts = append(conflicts, fmt.Sprintf("price %s replaces %s", row.Price, existing.Price))
+		}
+	}
+	if row.Category != "" && row.Category != existing.Category {
+		if existing.Category == "" {
+			action = ImportUpdate
+		} else {
+			conflicts = append(conflicts, fmt.Sprintf("category %s is kept over %s", existing.Category, row.Category))
+		}
+	}
+	return action, conflicts
+}
+
+// firstError returns one of the field errors of a validation error.
+func firstError(err error) error {
+	var v *validator.Validator
+	if errors.As(err, &v) {
+		for _, fieldErr := range v.FieldErrors {
+			return fieldErr
+		}
+	}
+	return err
+}
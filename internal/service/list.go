@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+const DEFAULT_LIST_NAME = "Groceries"
+
+var (
+	ErrLastList = errors.New("cannot remove the only list")
+)
+
+type ListService struct {
+	repository ListRepository
+}
+
+func NewListService(r ListRepository) *ListService {
+	return &ListService{
+		repository: r,
+	}
+}
+
+func (s *ListService) GetAll(ctx context.Context) ([]models.List, error) {
+	return s.repository.GetAll(ctx)
+}
+
+func (s *ListService) Get(ctx context.Context, id int64) (models.List, error) {
+	return s.repository.Get(ctx, id)
+}
+
+// Default returns the user's default list, creating it for users who do not
+// have any lists yet.
+func (s *ListService) Default(ctx context.Context) (models.List, error) {
+	list, err := s.repository.GetDefault(ctx)
+	if err == nil {
+		return list, nil
+	} else if err != models.ErrListNotFound {
+		return models.List{}, err
+	}
+	return s.Create(ctx, DEFAULT_LIST_NAME)
+}
+
+func (s *ListService) Create(ctx context.Context, name string) (models.List, error) {
+	list := &models.List{
+		Name: name,
+	}
+	err := list.Validate()
+	if err != nil {
+		return models.List{}, err
+	}
+
+	err = s.repository.Create(ctx, list)
+	if err != nil {
+		return models.List{}, err
+	}
+	return *list, nil
+}
+
+func (s *ListService) Rename(ctx context.Context, id int64, name string) (models.List, error) {
+	list, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return models.List{}, err
+	}
+
+	list.Name = name
+	err = list.Validate()
+	if err != nil {
+		return models.List{}, err
+	}
+	err = s.repository.Update(ctx, &list)
+	if err != nil {
+		return models.List{}, err
+	}
+	return list, nil
+}
+
+func (s *ListService) Remove(ctx context.Context, id int64) error {
+	lists, err := s.repository.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(lists) <= 1 {
+		return ErrLastList
+	}
+	return s.repository.Delete(ctx, id)
+}
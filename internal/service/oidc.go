@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrInvalidOIDCLogin = errors.New("single sign-on login could not be verified")
+	ErrEmailNotVerified = errors.New("the identity provider has not verified the email")
+)
+
+// OIDCConfig is the OpenID Connect identity provider users can log in with.
+// RedirectURL is where the provider sends them back to.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+}
+
+// OIDCLogin is a login started with the identity provider. The browser is
+// sent to URL, and the rest has to be kept until it comes back.
+type OIDCLogin struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// oidcClaims are the claims used from the ID token, or the user info
+// endpoint when the token has no email.
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// OIDCService logs users in with an OpenID Connect identity provider, using
+// the authorization code flow with PKCE.
+type OIDCService struct {
+	users      UserRepository
+	identities IdentityRepository
+	households *HouseholdService
+	transactor Transactor
+	config     OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCService(users UserRepository, identities IdentityRepository, households *HouseholdService, transactor Transactor, config OIDCConfig) *OIDCService {
+	return &OIDCService{
+		users:      users,
+		identities: identities,
+		households: households,
+		transactor: transactor,
+		config:     config,
+	}
+}
+
+// discover finds the provider's endpoints the first time they are needed, so
+// the server can start before the provider does.
+func (s *OIDCService) discover(ctx context.Context) (*oidc.Provider, *oauth2.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(ctx, s.config.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not discover identity provider: %w", err)
+		}
+		s.provider = provider
+	}
+	return s.provider, &oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		Endpoint:     s.provider.Endpoint(),
+		RedirectURL:  s.config.RedirectURL,
+		Scopes:       s.config.Scopes,
+	}, nil
+}
+
+// Begin starts logging in, returning where to send the browser.
+func (s *OIDCService) Begin(ctx context.Context) (OIDCLogin, error) {
+	_, config, err := s.discover(ctx)
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	login := OIDCLogin{Verifier: oauth2.GenerateVerifier()}
+	login.State, err = randomToken()
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	login.Nonce, err = randomToken()
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	login.URL = config.AuthCodeURL(login.State, oidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.Verifier))
+	return login, nil
+}
+
+// Finish exchanges the code the provider sent the browser back with for the
+// user's ID token, and returns who they are. Users are found by the identity
+// they logged in with before, or else linked to the account with their email,
+// which is created if there is not one. Only emails the provider has verified
+// are trusted.
+func (s *OIDCService) Finish(ctx context.Context, login OIDCLogin, state string, code string) (*models.User, error) {
+	if login.State == "" || !hmac.Equal([]byte(state), []byte(login.State)) {
+		return nil, fmt.Errorf("%w: state does not match", ErrInvalidOIDCLogin)
+	}
+	provider, config, err := s.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOIDCLogin, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no ID token", ErrInvalidOIDCLogin)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOIDCLogin, err)
+	}
+	if !hmac.Equal([]byte(idToken.Nonce), []byte(login.Nonce)) {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidOIDCLogin)
+	}
+
+	var claims oidcClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOIDCLogin, err)
+	}
+	if claims.Email == "" {
+		info, err := provider.UserInfo(ctx, config.TokenSource(ctx, token))
+		if err != nil {
+			return nil, err
+		}
+		if info.Subject != idToken.Subject {
+			return nil, fmt.Errorf("%w: user info is for another subject", ErrInvalidOIDCLogin)
+		}
+		err = info.Claims(&claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var user *models.User
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		identity, err := s.identities.Get(ctx, idToken.Issuer, idToken.Subject)
+		if err == nil {
+			user, err = s.users.GetById(ctx, identity.UserID)
+			return err
+		} else if err != models.ErrIdentityNotFound {
+			return err
+		}
+
+		if !claims.EmailVerified {
+			return ErrEmailNotVerified
+		}
+		user, err = s.users.Get(ctx, strings.ToLower(claims.Email))
+		if err == models.ErrUserNotFound {
+			user, err = s.create(ctx, claims)
+		} else if err == nil && !user.Verified() {
+			// Whoever signed up with the email never proved it was theirs,
+			// so their password and sessions are not kept
+			user.HashedPassword, err = randomPassword()
+			if err == nil {
+				err = s.users.UpdatePassword(ctx, user)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		err = s.users.Verify(ctx, user)
+		if err != nil {
+			return err
+		}
+		return s.identities.Create(ctx, &models.Identity{Issuer: idToken.Issuer, Subject: idToken.Subject, UserID: user.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// create makes an account for a user the provider has vouched for, along with
+// their first household. It gets a random password, which they can reset if
+// they want to log in without the provider.
+func (s *OIDCService) create(ctx context.Context, claims oidcClaims) (*models.User, error) {
+	user := &models.User{
+		ID:    uuid.New(),
+		Name:  claims.Name,
+		Email: strings.ToLower(claims.Email),
+	}
+	if user.Name == "" {
+		user.Name = claims.PreferredUsername
+	}
+	if user.Name == "" {
+		user.Name, _, _ = strings.Cut(user.Email, "@")
+	}
+	v := validator.New()
+	models.ValidateName(v, user.Name)
+	models.ValidateEmail(v, user.Email)
+	if v.HasErrors() {
+		return nil, v
+	}
+
+	var err error
+	user.HashedPassword, err = randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	err = s.users.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.households.CreateFirst(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// randomPassword returns the hash of a password nobody knows.
+func randomPassword() ([]byte, error) {
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash password: %v", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+const (
+	// PASSKEY_RP_NAME is who browsers say a passkey is for.
+	PASSKEY_RP_NAME = "Trolly"
+	// PASSKEY_TIMEOUT is how long the browser has to create or use a passkey.
+	PASSKEY_TIMEOUT = 5 * time.Minute
+)
+
+var (
+	ErrInvalidPasskey = errors.New("passkey could not be verified")
+)
+
+// passkeyUser is a user as WebAuthn sees them. Their ID is the handle
+// authenticators keep with a passkey, which finds them when they log in
+// without entering their email.
+type passkeyUser struct {
+	user        *models.User
+	credentials []webauthn.Credential
+}
+
+func (u passkeyUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// PasskeyService registers passkeys and logs in with them. Each ceremony is
+// started with a Begin method, which returns the options for the browser and
+// a session that has to be passed to the Finish method with its response.
+type PasskeyService struct {
+	repository CredentialRepository
+	users      UserRepository
+	webAuthn   *webauthn.WebAuthn
+}
+
+// NewPasskeyService creates a service for passkeys that work on the site at
+// baseURL.
+func NewPasskeyService(repository CredentialRepository, users UserRepository, baseURL string) (*PasskeyService, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", baseURL)
+	}
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: PASSKEY_TIMEOUT, TimeoutUVD: PASSKEY_TIMEOUT}
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: PASSKEY_RP_NAME,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyService{
+		repository: repository,
+		users:      users,
+		webAuthn:   webAuthn,
+	}, nil
+}
+
+// GetAll returns the user's passkeys.
+func (s *PasskeyService) GetAll(ctx context.Context, userId uuid.UUID) ([]models.Credential, error) {
+	return s.repository.GetAll(ctx, userId)
+}
+
+// Required reports whether the user has to use a passkey after their
+// password. It is only ever true when they have one to use.
+func (s *PasskeyService) Required(ctx context.Context, user *models.User) (bool, error) {
+	if !user.PasskeyRequired {
+		return false, nil
+	}
+	credentials, err := s.repository.GetAll(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+func (s *PasskeyService) SetRequired(ctx context.Context, user *models.User, required bool) error {
+	err := s.users.SetPasskeyRequired(ctx, user.ID, required)
+	if err != nil {
+		return err
+	}
+	user.PasskeyRequired = required
+	return nil
+}
+
+// BeginRegistration starts creating a passkey for the user. Passkeys are
+// stored on the authenticator so they can be used without an email.
+func (s *PasskeyService) BeginRegistration(ctx context.Context, user *models.User, name string) (*protocol.CredentialCreation, string, error) {
+	v := validator.New()
+	models.ValidateCredentialName(v, name)
+	if v.HasErrors() {
+		return nil, "", v
+	}
+
+	passkeyUser, err := s.passkeyUser(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+	creation, session, err := s.webAuthn.BeginRegistration(passkeyUser,
+		webauthn.WithExclusions(webauthn.Credentials(passkeyUser.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, encodeSession(session), nil
+}
+
+// FinishRegistration checks the browser's response and saves the passkey it
+// created.
+func (s *PasskeyService) FinishRegistration(ctx context.Context, user *models.User, name string, session string, response io.Reader) (models.Credential, error) {
+	v := validator.New()
+	models.ValidateCredentialName(v, name)
+	if v.HasErrors() {
+		return models.Credential{}, v
+	}
+
+	sessionData, err := decodeSession(session)
+	if err != nil {
+		return models.Credential{}, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		return models.Credential{}, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	passkeyUser, err := s.passkeyUser(ctx, user)
+	if err != nil {
+		return models.Credential{}, err
+	}
+	created, err := s.webAuthn.CreateCredential(passkeyUser, sessionData, parsed)
+	if err != nil {
+		return models.Credential{}, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	data, err := json.Marshal(created)
+	if err != nil {
+		return models.Credential{}, err
+	}
+	credential := models.Credential{
+		UserID:       user.ID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(created.ID),
+		Name:         name,
+		Data:         data,
+	}
+	err = s.repository.Create(ctx, &credential)
+	if err != nil {
+		return models.Credential{}, err
+	}
+	return credential, nil
+}
+
+// BeginLogin starts logging in with a passkey. Without a user, any passkey
+// for the site can be used, and it has to verify who is using it as it is
+// taking the place of their password too.
+func (s *PasskeyService) BeginLogin(ctx context.Context, user *models.User) (*protocol.CredentialAssertion, string, error) {
+	var assertion *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var err error
+	if user == nil {
+		assertion, session, err = s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		var passkeyUser passkeyUser
+		passkeyUser, err = s.passkeyUser(ctx, user)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(passkeyUser.credentials) == 0 {
+			return nil, "", models.ErrCredentialNotFound
+		}
+		assertion, session, err = s.webAuthn.BeginLogin(passkeyUser)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, encodeSession(session), nil
+}
+
+// FinishLogin checks the browser's response, returning who the passkey
+// belongs to. The user has to be the same one BeginLogin was called with.
+func (s *PasskeyService) FinishLogin(ctx context.Context, user *models.User, session string, response io.Reader) (*models.User, error) {
+	sessionData, err := decodeSession(session)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	var used *webauthn.Credential
+	if user == nil {
+		used, err = s.webAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			id, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			user, err = s.users.GetById(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return s.passkeyUser(ctx, user)
+		}, sessionData, parsed)
+	} else {
+		var passkeyUser passkeyUser
+		passkeyUser, err = s.passkeyUser(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		used, err = s.webAuthn.ValidateLogin(passkeyUser, sessionData, parsed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	// A counter going backwards means the passkey may have been copied
+	if used.Authenticator.CloneWarning {
+		return nil, fmt.Errorf("%w: signature counter went backwards", ErrInvalidPasskey)
+	}
+
+	credential, err := s.repository.GetByCredentialID(ctx, base64.RawURLEncoding.EncodeToString(used.ID))
+	if err != nil {
+		return nil, err
+	}
+	credential.Data, err = json.Marshal(used)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repository.Used(ctx, &credential)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Remove deletes one of the user's passkeys.
+func (s *PasskeyService) Remove(ctx context.Context, userId uuid.UUID, id int64) error {
+	return s.repository.Delete(ctx, userId, id)
+}
+
+func (s *PasskeyService) passkeyUser(ctx context.Context, user *models.User) (passkeyUser, error) {
+	stored, err := s.repository.GetAll(ctx, user.ID)
+	if err != nil {
+		return passkeyUser{}, err
+	}
+	credentials := make([]webauthn.Credential, len(stored))
+	for n, credential := range stored {
+		err = json.Unmarshal(credential.Data, &credentials[n])
+		if err != nil {
+			return passkeyUser{}, err
+		}
+	}
+	return passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// encodeSession turns the ceremony's session into a string to keep until it
+// is finished.
+func encodeSession(session *webauthn.SessionData) string {
+	b, _ := json.Marshal(session)
+	return string(b)
+}
+
+func decodeSession(session string) (webauthn.SessionData, error) {
+	var data webauthn.SessionData
+	err := json.Unmarshal([]byte(session), &data)
+	if err != nil || data.Challenge == "" {
+		return webauthn.SessionData{}, fmt.Errorf("%w: no passkey ceremony was started", ErrInvalidPasskey)
+	}
+	return data, nil
+}
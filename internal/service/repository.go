@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+// The repositories the services are built on. models has the SQL
+// implementations and memory has in-memory ones, and both are held to the same
+// behaviour by the servicetest conformance suite.
+
+type Transactor interface {
+	// WithinTx runs fn so that the repository calls made with the context it
+	// is given are undone if fn returns an error.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, email string) (*models.User, error)
+	GetById(ctx context.Context, id uuid.UUID) (*models.User, error)
+	UpdatePassword(ctx context.Context, user *models.User) error
+	Verify(ctx context.Context, user *models.User) error
+	SetPasskeyRequired(ctx context.Context, id uuid.UUID, required bool) error
+}
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	GetByHash(ctx context.Context, hash string) (models.PasswordReset, error)
+	Latest(ctx context.Context, userId uuid.UUID) (models.PasswordReset, error)
+	DeleteExpired(ctx context.Context, now time.Time) error
+	DeleteAll(ctx context.Context, userId uuid.UUID) error
+}
+
+type ItemRepository interface {
+	GetAll(ctx context.Context, search string, page int, pageSize int, orderBy string) (models.Metadata, []models.Item, error)
+	GetById(ctx context.Context, id int64) (models.Item, error)
+	GetByName(ctx context.Context, name string) (models.Item, error)
+	Export(ctx context.Context) ([]models.ItemRecord, error)
+	Create(ctx context.Context, item *models.Item) error
+	Update(ctx context.Context, item *models.Item) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type PriceRepository interface {
+	Record(ctx context.Context, price *models.ItemPrice) error
+	GetHistory(ctx context.Context, itemId int64) ([]models.ItemPrice, error)
+}
+
+type BasketRepository interface {
+	Get(ctx context.Context, listId int64) (models.Basket, error)
+	GetItem(ctx context.Context, listId int64, basketId int64) (models.BasketItem, error)
+	Add(ctx context.Context, listId int64, item models.BasketItem) (models.BasketItem, error)
+	UpdateQuantity(ctx context.Context, listId int64, item *models.BasketItem) error
+	TogglePurchased(ctx context.Context, listId int64, item *models.BasketItem) error
+	Remove(ctx context.Context, listId int64, basketId int64) error
+	RemoveAll(ctx context.Context, listId int64) error
+	GetPurchased(ctx context.Context, listId int64) ([]models.BasketItem, error)
+	RemovePurchased(ctx context.Context, listId int64, basketIds []int64) error
+}
+
+type PurchaseRepository interface {
+	Create(ctx context.Context, purchase *models.Purchase) error
+	UpdateQuantity(ctx context.Context, basketId int64, quantity int) error
+	Reverse(ctx context.Context, basketId int64) error
+}
+
+type HouseholdRepository interface {
+	Create(ctx context.Context, household *models.Household) error
+	Get(ctx context.Context, id int64) (models.Household, error)
+	GetByJoinCode(ctx context.Context, code string) (models.Household, error)
+	Update(ctx context.Context, household *models.Household) error
+	GetMembership(ctx context.Context, householdId int64) (models.Member, error)
+	GetMemberships(ctx context.Context) ([]models.Member, error)
+	GetMembers(ctx context.Context, householdId int64) ([]models.Member, error)
+	LockMembers(ctx context.Context, householdId int64) error
+	AddMember(ctx context.Context, householdId int64, userId uuid.UUID, role models.Role) error
+	UpdateMember(ctx context.Context, householdId int64, userId uuid.UUID, role models.Role) error
+	RemoveMember(ctx context.Context, householdId int64, userId uuid.UUID) error
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+	GetInvitation(ctx context.Context, id int64) (models.Invitation, error)
+	GetInvitations(ctx context.Context, householdId int64) ([]models.Invitation, error)
+	GetInvitationsForEmail(ctx context.Context, email string) ([]models.Invitation, error)
+	DeleteInvitation(ctx context.Context, id int64) error
+}
+
+type ListRepository interface {
+	GetAll(ctx context.Context) ([]models.List, error)
+	Get(ctx context.Context, id int64) (models.List, error)
+	GetDefault(ctx context.Context) (models.List, error)
+	Create(ctx context.Context, list *models.List) error
+	Update(ctx context.Context, list *models.List) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type TripRepository interface {
+	GetAll(ctx context.Context) ([]models.Trip, error)
+	Get(ctx context.Context, id int64) (models.Trip, error)
+	Create(ctx context.Context, listId int64, trip *models.Trip) error
+}
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *models.Token) error
+	GetAll(ctx context.Context) ([]models.Token, error)
+	GetByHash(ctx context.Context, hash string) (models.Token, error)
+	SetLastUsed(ctx context.Context, id int64, at time.Time) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type TOTPRepository interface {
+	Get(ctx context.Context, userId uuid.UUID) (models.TOTPSecret, error)
+	Save(ctx context.Context, secret *models.TOTPSecret) error
+	Enable(ctx context.Context, userId uuid.UUID) error
+	UseStep(ctx context.Context, userId uuid.UUID, step int64) (bool, error)
+	Fail(ctx context.Context, userId uuid.UUID) (int, error)
+	ResetAttempts(ctx context.Context, userId uuid.UUID) error
+	Delete(ctx context.Context, userId uuid.UUID) error
+	SetRecoveryCodes(ctx context.Context, userId uuid.UUID, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userId uuid.UUID, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userId uuid.UUID) (int, error)
+	CountEnabled(ctx context.Context) (int, error)
+}
+
+type CredentialRepository interface {
+	Create(ctx context.Context, credential *models.Credential) error
+	GetAll(ctx context.Context, userId uuid.UUID) ([]models.Credential, error)
+	GetByCredentialID(ctx context.Context, credentialId string) (models.Credential, error)
+	Used(ctx context.Context, credential *models.Credential) error
+	Delete(ctx context.Context, userId uuid.UUID, id int64) error
+}
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *models.Identity) error
+	Get(ctx context.Context, issuer string, subject string) (models.Identity, error)
+}
@@ -0,0 +1,1083 @@
+// Package servicetest holds the conformance suite every implementation of the
+// service repositories has to pass, so the services behave the same whichever
+// backend they are given.
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/components"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+	"github.com/hunterwilkins2/trolly/internal/service"
+)
+
+// Backend is a set of repositories sharing one store.
+type Backend struct {
+	Users       service.UserRepository
+	Resets      service.PasswordResetRepository
+	Households  service.HouseholdRepository
+	Lists       service.ListRepository
+	Items       service.ItemRepository
+	Prices      service.PriceRepository
+	Basket      service.BasketRepository
+	Purchases   service.PurchaseRepository
+	Trips       service.TripRepository
+	Tokens      service.TokenRepository
+	TOTP        service.TOTPRepository
+	Credentials service.CredentialRepository
+	Identities  service.IdentityRepository
+	Transactor  service.Transactor
+}
+
+// TestRepositories runs the suite, calling open for an empty backend in each
+// test.
+func TestRepositories(t *testing.T, open func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b Backend)
+	}{
+		{"Users", testUsers},
+		{"PasswordResets", testPasswordResets},
+		{"Households", testHouseholds},
+		{"Invitations", testInvitations},
+		{"Lists", testLists},
+		{"Items", testItems},
+		{"ItemOrder", testItemOrder},
+		{"ItemExport", testItemExport},
+		{"Prices", testPrices},
+		{"Basket", testBasket},
+		{"Purchases", testPurchases},
+		{"Trips", testTrips},
+		{"Tokens", testTokens},
+		{"TOTP", testTOTP},
+		{"Credentials", testCredentials},
+		{"Identities", testIdentities},
+		{"Transactions", testTransactions},
+		{"ConcurrentTransactions", testConcurrentTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+// login creates a user and returns a context for them in a new household, along
+// with the id of a list in it.
+func login(t *testing.T, b Backend) (context.Context, int64) {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), components.UserKey, createUser(t, b).ID)
+	household := models.Household{Name: "Test", JoinCode: uuid.NewString()[:8]}
+	if err := b.Households.Create(ctx, &household); err != nil {
+		t.Fatalf("could not create household: %v", err)
+	}
+	ctx = context.WithValue(ctx, components.HouseholdKey, household.ID)
+	list := models.List{Name: "Groceries"}
+	if err := b.Lists.Create(ctx, &list); err != nil {
+		t.Fatalf("could not create list: %v", err)
+	}
+	return ctx, list.ID
+}
+
+func createUser(t *testing.T, b Backend) *models.User {
+	t.Helper()
+	user := &models.User{
+		ID:             uuid.New(),
+		Name:           "Test",
+		Email:          uuid.NewString() + "@example.com",
+		HashedPassword: []byte("hash"),
+	}
+	if err := b.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	return user
+}
+
+func createItem(t *testing.T, b Backend, ctx context.Context, name string, price int64) models.Item {
+	t.Helper()
+	item := models.Item{Name: name, Price: money.New(price, money.DEFAULT_CURRENCY)}
+	if err := b.Items.Create(ctx, &item); err != nil {
+		t.Fatalf("could not create %s: %v", name, err)
+	}
+	return item
+}
+
+// buy puts the item in the list's basket and records a purchase of it.
+func buy(t *testing.T, b Backend, ctx context.Context, listId int64, item models.Item) models.Purchase {
+	t.Helper()
+	row, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 1, Item: item})
+	if err != nil {
+		t.Fatalf("could not add %s: %v", item.Name, err)
+	}
+	purchase := models.Purchase{ItemID: item.ID, BasketID: row.BasketID, Price: item.Price, Quantity: 1}
+	if err := b.Purchases.Create(ctx, &purchase); err != nil {
+		t.Fatalf("could not buy %s: %v", item.Name, err)
+	}
+	return purchase
+}
+
+func names(items []models.Item) []string {
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func testUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Name: "Test", Email: "test@example.com", HashedPassword: []byte("hash")}
+	if err := b.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	got, err := b.Users.Get(ctx, "TEST@example.com")
+	if err != nil || got.ID != user.ID || got.Name != "Test" || string(got.HashedPassword) != "hash" {
+		t.Errorf("Get() = %+v, %v", got, err)
+	}
+	got, err = b.Users.GetById(ctx, user.ID)
+	if err != nil || got.Email != "test@example.com" {
+		t.Errorf("GetById() = %+v, %v", got, err)
+	}
+
+	duplicate := &models.User{ID: uuid.New(), Name: "Test", Email: "Test@Example.com", HashedPassword: []byte("hash")}
+	if err := b.Users.Create(ctx, duplicate); !errors.Is(err, models.ErrDuplicateEmail) {
+		t.Errorf("Create() with a taken email = %v, want %v", err, models.ErrDuplicateEmail)
+	}
+	if _, err := b.Users.Get(ctx, "missing@example.com"); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("Get() for a missing user = %v, want %v", err, models.ErrUserNotFound)
+	}
+	if _, err := b.Users.GetById(ctx, uuid.New()); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("GetById() for a missing user = %v, want %v", err, models.ErrUserNotFound)
+	}
+
+	user.HashedPassword = []byte("new hash")
+	if err := b.Users.UpdatePassword(ctx, user); err != nil || user.SessionVersion != 1 {
+		t.Fatalf("UpdatePassword() = %v, SessionVersion = %d, want 1", err, user.SessionVersion)
+	}
+	got, err = b.Users.GetById(ctx, user.ID)
+	if err != nil || string(got.HashedPassword) != "new hash" || got.SessionVersion != 1 {
+		t.Errorf("GetById() after UpdatePassword() = %+v, %v", got, err)
+	}
+	missing := &models.User{ID: uuid.New()}
+	if err := b.Users.UpdatePassword(ctx, missing); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("UpdatePassword() for a missing user = %v, want %v", err, models.ErrUserNotFound)
+	}
+
+	if got.Verified() {
+		t.Errorf("new user is verified at %v", got.VerifiedAt)
+	}
+	if err := b.Users.Verify(ctx, user); err != nil || !user.Verified() {
+		t.Fatalf("Verify() = %v, VerifiedAt = %v", err, user.VerifiedAt)
+	}
+	verifiedAt := user.VerifiedAt
+	got, err = b.Users.Get(ctx, user.Email)
+	if err != nil || !got.VerifiedAt.Equal(verifiedAt) {
+		t.Errorf("Get() after Verify() = %+v, %v, want verified at %v", got, err, verifiedAt)
+	}
+	again := &models.User{ID: user.ID}
+	if err := b.Users.Verify(ctx, again); err != nil || !again.VerifiedAt.Equal(verifiedAt) {
+		t.Errorf("Verify() again = %v, VerifiedAt = %v, want it kept at %v", err, again.VerifiedAt, verifiedAt)
+	}
+	if err := b.Users.Verify(ctx, missing); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("Verify() for a missing user = %v, want %v", err, models.ErrUserNotFound)
+	}
+}
+
+func testPasswordResets(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Name: "Test", Email: "test@example.com", HashedPassword: []byte("hash")}
+	if err := b.Users.Create(ctx, user); err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	reset := models.PasswordReset{UserID: user.ID, Hash: "first", ExpiresAt: expiresAt}
+	if err := b.Resets.Create(ctx, &reset); err != nil || reset.ID == 0 || reset.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %v, reset = %+v", err, reset)
+	}
+	if _, err := b.Resets.Latest(ctx, user.ID); err != nil {
+		t.Errorf("Latest() = %v", err)
+	}
+	second := models.PasswordReset{UserID: user.ID, Hash: "second", ExpiresAt: expiresAt}
+	if err := b.Resets.Create(ctx, &second); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if got, err := b.Resets.Latest(ctx, user.ID); err != nil || got.ID != second.ID {
+		t.Errorf("Latest() = %+v, %v, want %+v", got, err, second)
+	}
+	if _, err := b.Resets.Latest(ctx, uuid.New()); !errors.Is(err, models.ErrPasswordResetNotFound) {
+		t.Errorf("Latest() for a user with no resets = %v, want %v", err, models.ErrPasswordResetNotFound)
+	}
+
+	got, err := b.Resets.GetByHash(ctx, "first")
+	if err != nil || got.ID != reset.ID || got.UserID != user.ID || !got.CreatedAt.Equal(reset.CreatedAt) || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("GetByHash() = %+v, %v, want %+v", got, err, reset)
+	}
+	if _, err := b.Resets.GetByHash(ctx, "missing"); !errors.Is(err, models.ErrPasswordResetNotFound) {
+		t.Errorf("GetByHash() for a missing reset = %v, want %v", err, models.ErrPasswordResetNotFound)
+	}
+
+	expired := models.PasswordReset{UserID: user.ID, Hash: "expired", ExpiresAt: expiresAt.Add(-2 * time.Hour)}
+	if err := b.Resets.Create(ctx, &expired); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if err := b.Resets.DeleteExpired(ctx, time.Now()); err != nil {
+		t.Fatalf("DeleteExpired() = %v", err)
+	}
+	if _, err := b.Resets.GetByHash(ctx, "expired"); !errors.Is(err, models.ErrPasswordResetNotFound) {
+		t.Errorf("GetByHash() after DeleteExpired() = %v, want %v", err, models.ErrPasswordResetNotFound)
+	}
+	if _, err := b.Resets.GetByHash(ctx, "first"); err != nil {
+		t.Errorf("GetByHash() for a reset that has not expired = %v", err)
+	}
+
+	if err := b.Resets.DeleteAll(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteAll() = %v", err)
+	}
+	for _, hash := range []string{"first", "second"} {
+		if _, err := b.Resets.GetByHash(ctx, hash); !errors.Is(err, models.ErrPasswordResetNotFound) {
+			t.Errorf("GetByHash(%q) after DeleteAll() = %v, want %v", hash, err, models.ErrPasswordResetNotFound)
+		}
+	}
+}
+
+func testItems(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	other, _ := login(t, b)
+
+	milk := models.Item{Name: "Milk", Category: "Dairy"}
+	if err := b.Items.Create(ctx, &milk); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	got, err := b.Items.GetById(ctx, milk.ID)
+	want := models.Item{ID: milk.ID, Name: "Milk", Price: money.New(0, money.DEFAULT_CURRENCY), Category: "Dairy"}
+	if err != nil || got != want {
+		t.Errorf("GetById() = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := b.Items.GetByName(ctx, "mILK"); err != nil || got.ID != milk.ID {
+		t.Errorf("GetByName() = %+v, %v", got, err)
+	}
+	if _, err := b.Items.GetById(other, milk.ID); !errors.Is(err, models.ErrItemNotFound) {
+		t.Errorf("GetById() from another household = %v, want %v", err, models.ErrItemNotFound)
+	}
+	if _, err := b.Items.GetByName(ctx, "Eggs"); !errors.Is(err, models.ErrItemNotFound) {
+		t.Errorf("GetByName() for a missing item = %v, want %v", err, models.ErrItemNotFound)
+	}
+
+	milk.Name = "Oat milk"
+	milk.Price = money.New(349, "EUR")
+	if err := b.Items.Update(ctx, &milk); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	got, _ = b.Items.GetById(ctx, milk.ID)
+	if got.Name != "Oat milk" || got.Price != money.New(349, "EUR") {
+		t.Errorf("GetById() after Update() = %+v", got)
+	}
+
+	if err := b.Items.Delete(other, milk.ID); !errors.Is(err, models.ErrItemNotFound) {
+		t.Errorf("Delete() from another household = %v, want %v", err, models.ErrItemNotFound)
+	}
+	buy(t, b, ctx, listId, milk)
+	if err := b.Basket.RemoveAll(ctx, listId); err != nil {
+		t.Fatalf("RemoveAll() = %v", err)
+	}
+	if err := b.Items.Delete(ctx, milk.ID); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := b.Items.GetById(ctx, milk.ID); !errors.Is(err, models.ErrItemNotFound) {
+		t.Errorf("GetById() after Delete() = %v, want %v", err, models.ErrItemNotFound)
+	}
+	if err := b.Items.Delete(ctx, milk.ID); !errors.Is(err, models.ErrItemNotFound) {
+		t.Errorf("Delete() twice = %v, want %v", err, models.ErrItemNotFound)
+	}
+}
+
+// testItemOrder relies on ids breaking ties, as the SQL backends only keep
+// times to the second.
+func testItemOrder(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	other, _ := login(t, b)
+	createItem(t, b, other, "Apple juice", 199)
+
+	bread := createItem(t, b, ctx, "Bread", 250)
+	apples := createItem(t, b, ctx, "Apples", 299)
+	createItem(t, b, ctx, "Butter", 0)
+	pineapple := createItem(t, b, ctx, "Pineapple", 399)
+	buy(t, b, ctx, listId, bread)
+	buy(t, b, ctx, listId, apples)
+	buy(t, b, ctx, listId, apples)
+
+	tests := []struct {
+		search  string
+		orderBy string
+		want    string
+	}{
+		{"", "", "[Butter Apples Bread Pineapple]"},
+		{"", "timeBought", "[Butter Apples Bread Pineapple]"},
+		{"", "recentlyAdded", "[Butter Pineapple Apples Bread]"},
+		{"", "recentlyPurchased", "[Butter Apples Bread Pineapple]"},
+		{" APPLE ", "", "[Apples Pineapple]"},
+		{"cheese", "", "[]"},
+	}
+	for _, tt := range tests {
+		metadata, items, err := b.Items.GetAll(ctx, tt.search, 1, 10, tt.orderBy)
+		if err != nil {
+			t.Fatalf("GetAll(%q, %q) = %v", tt.search, tt.orderBy, err)
+		}
+		if got := fmt.Sprint(names(items)); got != tt.want {
+			t.Errorf("GetAll(%q, %q) = %s, want %s", tt.search, tt.orderBy, got, tt.want)
+		}
+		if metadata.TotalRecords != len(items) {
+			t.Errorf("GetAll(%q, %q) TotalRecords = %d, want %d", tt.search, tt.orderBy, metadata.TotalRecords, len(items))
+		}
+	}
+
+	metadata, items, err := b.Items.GetAll(ctx, "", 2, 3, "")
+	if err != nil {
+		t.Fatalf("GetAll() = %v", err)
+	}
+	if len(items) != 1 || items[0].ID != pineapple.ID || items[0].TimesBought != 0 {
+		t.Errorf("GetAll() second page = %+v", items)
+	}
+	if metadata != models.CalculateMetadata(4, 2, 3) {
+		t.Errorf("GetAll() metadata = %+v", metadata)
+	}
+	if _, items, _ := b.Items.GetAll(ctx, "", 1, 1, ""); len(items) != 1 {
+		t.Errorf("GetAll() with a page size of 1 returned %d items", len(items))
+	}
+	if got, _ := b.Items.GetById(ctx, apples.ID); got.TimesBought != 2 {
+		t.Errorf("TimesBought = %d, want 2", got.TimesBought)
+	}
+}
+
+func testItemExport(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	other, _ := login(t, b)
+	createItem(t, b, other, "Apple juice", 199)
+
+	eggs := createItem(t, b, ctx, "Eggs", 400)
+	bread := createItem(t, b, ctx, "Bread", 250)
+	flour := createItem(t, b, ctx, "Flour", 125)
+	buy(t, b, ctx, listId, eggs)
+	last := buy(t, b, ctx, listId, eggs)
+	row, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 3, Item: flour})
+	if err != nil {
+		t.Fatalf("could not add Flour: %v", err)
+	}
+	if err := b.Purchases.Create(ctx, &models.Purchase{ItemID: flour.ID, BasketID: row.BasketID, Price: flour.Price, Quantity: 3}); err != nil {
+		t.Fatalf("could not buy Flour: %v", err)
+	}
+
+	records, err := b.Items.Export(ctx)
+	if err != nil {
+		t.Fatalf("Export() = %v", err)
+	}
+	if len(records) != 3 || records[0].ID != bread.ID || records[1].ID != eggs.ID || records[2].ID != flour.ID {
+		t.Fatalf("Export() = %+v, want Bread, Eggs and Flour", records)
+	}
+	if records[0].TimesBought != 0 || !records[0].LastPurchaseDate.IsZero() || records[0].CreatedAt.IsZero() {
+		t.Errorf("Export() Bread = %+v", records[0])
+	}
+	if records[1].TimesBought != 2 || !records[1].LastPurchaseDate.Equal(last.PurchasedAt) || records[1].Price != eggs.Price {
+		t.Errorf("Export() Eggs = %+v, want bought twice, last at %v", records[1], last.PurchasedAt)
+	}
+	if records[2].TimesBought != 3 {
+		t.Errorf("Export() Flour = %+v, want 3 bought at once counted 3 times", records[2])
+	}
+	if got, _ := b.Items.GetById(ctx, flour.ID); got.TimesBought != 3 {
+		t.Errorf("GetById() Flour TimesBought = %d, want 3", got.TimesBought)
+	}
+}
+
+func testPrices(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	other, _ := login(t, b)
+	eggs := createItem(t, b, ctx, "Eggs", 100)
+
+	for _, price := range []int64{100, 201} {
+		record := models.ItemPrice{ItemID: eggs.ID, Price: money.New(price, money.DEFAULT_CURRENCY), Source: models.PriceEdited}
+		if err := b.Prices.Record(ctx, &record); err != nil {
+			t.Fatalf("Record() = %v", err)
+		}
+		if record.RecordedAt.IsZero() {
+			t.Errorf("Record() did not set RecordedAt")
+		}
+	}
+	history, err := b.Prices.GetHistory(ctx, eggs.ID)
+	if err != nil || len(history) != 2 || history[0].Price.Minor != 100 || history[1].Price.Minor != 201 || history[1].Source != models.PriceEdited {
+		t.Errorf("GetHistory() = %+v, %v", history, err)
+	}
+	if history, _ := b.Prices.GetHistory(other, eggs.ID); len(history) != 0 {
+		t.Errorf("GetHistory() from another household = %+v", history)
+	}
+
+	average := context.WithValue(ctx, components.PriceModeKey, models.PriceAverage)
+	if _, items, _ := b.Items.GetAll(average, "", 1, 10, ""); len(items) != 1 || items[0].Price != money.New(151, money.DEFAULT_CURRENCY) {
+		t.Errorf("GetAll() average price = %+v", items)
+	}
+	if _, items, _ := b.Items.GetAll(ctx, "", 1, 10, ""); len(items) != 1 || items[0].Price.Minor != 100 {
+		t.Errorf("GetAll() latest price = %+v", items)
+	}
+
+	if _, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 2, Item: eggs}); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	basket, _ := b.Basket.Get(average, listId)
+	if basket.Total != money.New(302, money.DEFAULT_CURRENCY) {
+		t.Errorf("Get() average total = %v", basket.Total)
+	}
+	if got, err := b.Basket.GetItem(average, listId, basket.Items[0].BasketID); err != nil || got.Price != money.New(151, money.DEFAULT_CURRENCY) {
+		t.Errorf("GetItem() average price = %+v, %v", got.Price, err)
+	}
+}
+
+func testBasket(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	_, otherList := login(t, b)
+	eggs := createItem(t, b, ctx, "Eggs", 250)
+	flour := createItem(t, b, ctx, "Flour", 125)
+
+	added, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 2, Unit: "dozen", Store: "Market", Item: eggs})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	if added.BasketID == 0 || added.Quantity != 2 || added.Unit != "dozen" || added.Item != eggs {
+		t.Errorf("Add() = %+v", added)
+	}
+	again, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 9998, Note: "free range", Item: eggs})
+	if err != nil {
+		t.Fatalf("Add() again = %v", err)
+	}
+	if again.BasketID != added.BasketID || again.Quantity != 9999 || again.Unit != "dozen" || again.Store != "Market" || again.Note != "free range" {
+		t.Errorf("Add() again = %+v", again)
+	}
+
+	flourRow, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 1, Item: flour})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	flourRow.Quantity = 3
+	flourRow.Unit = "kg"
+	if err := b.Basket.UpdateQuantity(ctx, listId, &flourRow); err != nil {
+		t.Fatalf("UpdateQuantity() = %v", err)
+	}
+	if got, err := b.Basket.GetItem(ctx, listId, flourRow.BasketID); err != nil || got.Quantity != 3 || got.Unit != "kg" || got.Name != "Flour" {
+		t.Errorf("GetItem() = %+v, %v", got, err)
+	}
+	if _, err := b.Basket.GetItem(ctx, otherList, flourRow.BasketID); !errors.Is(err, models.ErrBasketItemNotFound) {
+		t.Errorf("GetItem() from another list = %v, want %v", err, models.ErrBasketItemNotFound)
+	}
+
+	if err := b.Basket.TogglePurchased(ctx, listId, &again); err != nil || !again.Purchased {
+		t.Fatalf("TogglePurchased() = %v, purchased %t", err, again.Purchased)
+	}
+	stale := again
+	stale.Purchased = false
+	if err := b.Basket.TogglePurchased(ctx, listId, &stale); !errors.Is(err, models.ErrBasketItemChanged) || stale.Purchased {
+		t.Errorf("TogglePurchased() of an item toggled since = %v, want %v", err, models.ErrBasketItemChanged)
+	}
+	missing := models.BasketItem{BasketID: again.BasketID}
+	if err := b.Basket.TogglePurchased(ctx, otherList, &missing); !errors.Is(err, models.ErrBasketItemNotFound) {
+		t.Errorf("TogglePurchased() on another list = %v, want %v", err, models.ErrBasketItemNotFound)
+	}
+
+	basket, err := b.Basket.Get(ctx, listId)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	if len(basket.Items) != 2 || basket.Items[0].Name != "Flour" || !basket.Items[1].Purchased {
+		t.Errorf("Get() = %+v", basket.Items)
+	}
+	if want := money.New(9999*250+3*125, money.DEFAULT_CURRENCY); basket.Total != want {
+		t.Errorf("Get() total = %v, want %v", basket.Total, want)
+	}
+
+	rebought, err := b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 1, Item: flour})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	if err := b.Basket.TogglePurchased(ctx, listId, &rebought); err != nil {
+		t.Fatalf("TogglePurchased() = %v", err)
+	}
+	rebought, err = b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 2, Item: flour})
+	if err != nil || rebought.BasketID != flourRow.BasketID || rebought.Purchased || rebought.Quantity != 2 || rebought.Unit != "kg" {
+		t.Errorf("Add() of a bought item = %+v, %v, want it back to buy 2", rebought, err)
+	}
+	rebought.Quantity = 3
+	if err := b.Basket.UpdateQuantity(ctx, listId, &rebought); err != nil {
+		t.Fatalf("UpdateQuantity() = %v", err)
+	}
+
+	purchased, err := b.Basket.GetPurchased(ctx, listId)
+	if err != nil || len(purchased) != 1 || purchased[0].BasketID != again.BasketID || purchased[0].Price.Minor != 250 {
+		t.Errorf("GetPurchased() = %+v, %v", purchased, err)
+	}
+	bought := models.Purchase{ItemID: again.ID, BasketID: again.BasketID, Price: money.New(199, money.DEFAULT_CURRENCY), Quantity: again.Quantity}
+	if err := b.Purchases.Create(ctx, &bought); err != nil {
+		t.Fatalf("could not buy %s: %v", again.Name, err)
+	}
+	if purchased, _ := b.Basket.GetPurchased(ctx, listId); len(purchased) != 1 || purchased[0].Price != bought.Price {
+		t.Errorf("GetPurchased() after a purchase = %+v, want it at %v", purchased, bought.Price)
+	}
+	if err := b.Basket.RemovePurchased(ctx, listId, []int64{flourRow.BasketID}); err != nil {
+		t.Fatalf("RemovePurchased() = %v", err)
+	}
+	if basket, _ := b.Basket.Get(ctx, listId); len(basket.Items) != 2 {
+		t.Errorf("Get() after RemovePurchased() of an item not purchased = %+v, want both items", basket.Items)
+	}
+	if err := b.Basket.RemovePurchased(ctx, listId, []int64{again.BasketID}); err != nil {
+		t.Fatalf("RemovePurchased() = %v", err)
+	}
+	if basket, _ := b.Basket.Get(ctx, listId); len(basket.Items) != 1 || basket.Items[0].BasketID != flourRow.BasketID {
+		t.Errorf("Get() after RemovePurchased() = %+v", basket.Items)
+	}
+
+	if err := b.Basket.Remove(ctx, otherList, flourRow.BasketID); !errors.Is(err, models.ErrBasketItemNotFound) {
+		t.Errorf("Remove() from another list = %v, want %v", err, models.ErrBasketItemNotFound)
+	}
+	if err := b.Basket.Remove(ctx, listId, flourRow.BasketID); err != nil {
+		t.Fatalf("Remove() = %v", err)
+	}
+	if err := b.Basket.Remove(ctx, listId, flourRow.BasketID); !errors.Is(err, models.ErrBasketItemNotFound) {
+		t.Errorf("Remove() twice = %v, want %v", err, models.ErrBasketItemNotFound)
+	}
+
+	b.Basket.Add(ctx, listId, models.BasketItem{Quantity: 1, Item: eggs})
+	if err := b.Basket.RemoveAll(ctx, listId); err != nil {
+		t.Fatalf("RemoveAll() = %v", err)
+	}
+	if err := b.Basket.RemoveAll(ctx, listId); !errors.Is(err, models.ErrBasketItemNotFound) {
+		t.Errorf("RemoveAll() on an empty basket = %v, want %v", err, models.ErrBasketItemNotFound)
+	}
+}
+
+func testPurchases(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	milk := createItem(t, b, ctx, "Milk", 199)
+
+	first := buy(t, b, ctx, listId, milk)
+	second := buy(t, b, ctx, listId, milk)
+	if first.ID == 0 || second.ID == first.ID || second.PurchasedAt.IsZero() {
+		t.Errorf("Create() = %+v, %+v", first, second)
+	}
+	record := models.ItemPrice{ItemID: milk.ID, PurchaseID: second.ID, Price: milk.Price, Source: models.PricePurchased}
+	if err := b.Prices.Record(ctx, &record); err != nil {
+		t.Fatalf("Record() = %v", err)
+	}
+
+	if err := b.Purchases.UpdateQuantity(ctx, first.BasketID, 4); err != nil {
+		t.Fatalf("UpdateQuantity() = %v", err)
+	}
+	if err := b.Purchases.Reverse(ctx, first.BasketID); err != nil {
+		t.Fatalf("Reverse() = %v", err)
+	}
+	if got, _ := b.Items.GetById(ctx, milk.ID); got.TimesBought != 1 {
+		t.Errorf("TimesBought after Reverse() = %d, want 1", got.TimesBought)
+	}
+	if history, _ := b.Prices.GetHistory(ctx, milk.ID); len(history) != 0 {
+		t.Errorf("GetHistory() after Reverse() = %+v", history)
+	}
+
+	// Purchases outlive the basket row they were made from
+	if err := b.Basket.Remove(ctx, listId, first.BasketID); err != nil {
+		t.Fatalf("Remove() = %v", err)
+	}
+	if err := b.Purchases.Reverse(ctx, first.BasketID); err != nil {
+		t.Fatalf("Reverse() after Remove() = %v", err)
+	}
+	if got, _ := b.Items.GetById(ctx, milk.ID); got.TimesBought != 1 {
+		t.Errorf("TimesBought after removing the basket row = %d, want 1", got.TimesBought)
+	}
+}
+
+func testTransactions(t *testing.T, b Backend) {
+	ctx, _ := login(t, b)
+	errFailed := errors.New("failed")
+
+	err := b.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		createItem(t, b, ctx, "Rolled back", 100)
+		return b.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			createItem(t, b, ctx, "Nested", 100)
+			return errFailed
+		})
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("WithinTx() = %v, want %v", err, errFailed)
+	}
+
+	err = b.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		createItem(t, b, ctx, "Committed", 100)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("WithinTx() = %v", err)
+	}
+
+	if _, items, _ := b.Items.GetAll(ctx, "", 1, 10, ""); fmt.Sprint(names(items)) != "[Committed]" {
+		t.Errorf("GetAll() after transactions = %v", names(items))
+	}
+}
+
+func testHouseholds(t *testing.T, b Backend) {
+	ctx, _ := login(t, b)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+
+	household, err := b.Households.Get(ctx, householdId)
+	if err != nil || household.Name != "Test" {
+		t.Fatalf("Get() = %+v, %v", household, err)
+	}
+	if got, err := b.Households.GetByJoinCode(ctx, household.JoinCode); err != nil || got.ID != householdId {
+		t.Errorf("GetByJoinCode() = %+v, %v, want %+v", got, err, household)
+	}
+	if _, err := b.Households.Get(ctx, householdId+1000); !errors.Is(err, models.ErrHouseholdNotFound) {
+		t.Errorf("Get() for a missing household = %v, want %v", err, models.ErrHouseholdNotFound)
+	}
+	if _, err := b.Households.GetByJoinCode(ctx, "missing"); !errors.Is(err, models.ErrHouseholdNotFound) {
+		t.Errorf("GetByJoinCode() for a missing code = %v, want %v", err, models.ErrHouseholdNotFound)
+	}
+	duplicate := models.Household{Name: "Duplicate", JoinCode: household.JoinCode}
+	if err := b.Households.Create(ctx, &duplicate); !errors.Is(err, models.ErrDuplicateJoinCode) {
+		t.Errorf("Create() with a taken join code = %v, want %v", err, models.ErrDuplicateJoinCode)
+	}
+
+	household.Name = "Home"
+	household.JoinCode = "newcode"
+	if err := b.Households.Update(ctx, &household); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	if got, err := b.Households.GetByJoinCode(ctx, "newcode"); err != nil || got.Name != "Home" {
+		t.Errorf("GetByJoinCode() after Update() = %+v, %v", got, err)
+	}
+	other, _ := login(t, b)
+	taken := models.Household{ID: other.Value(components.HouseholdKey).(int64), Name: "Other", JoinCode: "newcode"}
+	if err := b.Households.Update(other, &taken); !errors.Is(err, models.ErrDuplicateJoinCode) {
+		t.Errorf("Update() with a taken join code = %v, want %v", err, models.ErrDuplicateJoinCode)
+	}
+
+	if got, err := b.Households.GetMembership(ctx, householdId); err != nil || got.Role != models.RoleOwner || got.HouseholdName != "Home" {
+		t.Errorf("GetMembership() for the creator = %+v, %v, want an owner", got, err)
+	}
+	userId := other.Value(components.UserKey).(uuid.UUID)
+	if err := b.Households.AddMember(ctx, householdId, userId, models.RoleEditor); err != nil {
+		t.Fatalf("AddMember() = %v", err)
+	}
+	if err := b.Households.AddMember(ctx, householdId, userId, models.RoleViewer); !errors.Is(err, models.ErrAlreadyMember) {
+		t.Errorf("AddMember() again = %v, want %v", err, models.ErrAlreadyMember)
+	}
+	members, err := b.Households.GetMembers(ctx, householdId)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("GetMembers() = %+v, %v, want 2 members", members, err)
+	}
+	err = b.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return b.Households.LockMembers(ctx, householdId)
+	})
+	if err != nil {
+		t.Errorf("LockMembers() = %v", err)
+	}
+	if got, _ := b.Households.GetMemberships(other); len(got) != 2 {
+		t.Errorf("GetMemberships() for the new member = %+v, want their own household and the new one", got)
+	}
+
+	if err := b.Households.UpdateMember(ctx, householdId, userId, models.RoleViewer); err != nil {
+		t.Fatalf("UpdateMember() = %v", err)
+	}
+	if got, err := b.Households.GetMembership(other, householdId); err != nil || got.Role != models.RoleViewer || got.UserID != userId {
+		t.Errorf("GetMembership() after UpdateMember() = %+v, %v, want a viewer", got, err)
+	}
+
+	if err := b.Households.RemoveMember(ctx, householdId, userId); err != nil {
+		t.Fatalf("RemoveMember() = %v", err)
+	}
+	if err := b.Households.RemoveMember(ctx, householdId, userId); !errors.Is(err, models.ErrMemberNotFound) {
+		t.Errorf("RemoveMember() again = %v, want %v", err, models.ErrMemberNotFound)
+	}
+	if _, err := b.Households.GetMembership(other, householdId); !errors.Is(err, models.ErrMemberNotFound) {
+		t.Errorf("GetMembership() after RemoveMember() = %v, want %v", err, models.ErrMemberNotFound)
+	}
+}
+
+func testInvitations(t *testing.T, b Backend) {
+	ctx, _ := login(t, b)
+	householdId := ctx.Value(components.HouseholdKey).(int64)
+
+	invitation := models.Invitation{HouseholdID: householdId, Email: "invited@example.com", Role: models.RoleEditor}
+	if err := b.Households.CreateInvitation(ctx, &invitation); err != nil || invitation.ID == 0 {
+		t.Fatalf("CreateInvitation() = %v, invitation = %+v", err, invitation)
+	}
+	again := models.Invitation{HouseholdID: householdId, Email: "invited@example.com", Role: models.RoleViewer}
+	if err := b.Households.CreateInvitation(ctx, &again); !errors.Is(err, models.ErrDuplicateInvitation) {
+		t.Errorf("CreateInvitation() for the same email = %v, want %v", err, models.ErrDuplicateInvitation)
+	}
+
+	got, err := b.Households.GetInvitation(ctx, invitation.ID)
+	if err != nil || got.HouseholdName != "Test" || got.Email != "invited@example.com" || got.Role != models.RoleEditor || got.InvitedBy != "Test" {
+		t.Errorf("GetInvitation() = %+v, %v", got, err)
+	}
+	if got, err := b.Households.GetInvitations(ctx, householdId); err != nil || len(got) != 1 || got[0].ID != invitation.ID {
+		t.Errorf("GetInvitations() = %+v, %v, want the invitation", got, err)
+	}
+	if got, err := b.Households.GetInvitationsForEmail(ctx, "invited@example.com"); err != nil || len(got) != 1 || got[0].ID != invitation.ID {
+		t.Errorf("GetInvitationsForEmail() = %+v, %v, want the invitation", got, err)
+	}
+	if got, _ := b.Households.GetInvitationsForEmail(ctx, "other@example.com"); len(got) != 0 {
+		t.Errorf("GetInvitationsForEmail() for another email = %+v, want none", got)
+	}
+
+	if err := b.Households.DeleteInvitation(ctx, invitation.ID); err != nil {
+		t.Fatalf("DeleteInvitation() = %v", err)
+	}
+	if err := b.Households.DeleteInvitation(ctx, invitation.ID); !errors.Is(err, models.ErrInvitationNotFound) {
+		t.Errorf("DeleteInvitation() again = %v, want %v", err, models.ErrInvitationNotFound)
+	}
+	if _, err := b.Households.GetInvitation(ctx, invitation.ID); !errors.Is(err, models.ErrInvitationNotFound) {
+		t.Errorf("GetInvitation() after DeleteInvitation() = %v, want %v", err, models.ErrInvitationNotFound)
+	}
+}
+
+func testLists(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	other, _ := login(t, b)
+
+	if got, err := b.Lists.GetDefault(ctx); err != nil || got.ID != listId {
+		t.Errorf("GetDefault() = %+v, %v, want list %d", got, err, listId)
+	}
+	second := models.List{Name: "Hardware"}
+	if err := b.Lists.Create(ctx, &second); err != nil || second.ID == 0 {
+		t.Fatalf("Create() = %v, list = %+v", err, second)
+	}
+	second.Name = "DIY"
+	if err := b.Lists.Update(ctx, &second); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	if got, err := b.Lists.Get(ctx, second.ID); err != nil || got.Name != "DIY" {
+		t.Errorf("Get() after Update() = %+v, %v", got, err)
+	}
+	if got, err := b.Lists.GetAll(ctx); err != nil || fmt.Sprint(got) != fmt.Sprint([]models.List{{ID: listId, Name: "Groceries"}, second}) {
+		t.Errorf("GetAll() = %+v, %v", got, err)
+	}
+	if got, _ := b.Lists.GetDefault(ctx); got.ID != listId {
+		t.Errorf("GetDefault() with two lists = %+v, want the oldest", got)
+	}
+
+	if _, err := b.Lists.Get(other, second.ID); !errors.Is(err, models.ErrListNotFound) {
+		t.Errorf("Get() from another household = %v, want %v", err, models.ErrListNotFound)
+	}
+	if err := b.Lists.Delete(other, second.ID); !errors.Is(err, models.ErrListNotFound) {
+		t.Errorf("Delete() from another household = %v, want %v", err, models.ErrListNotFound)
+	}
+
+	milk := createItem(t, b, ctx, "Milk", 100)
+	if _, err := b.Basket.Add(ctx, second.ID, models.BasketItem{Quantity: 1, Item: milk}); err != nil {
+		t.Fatalf("could not add Milk: %v", err)
+	}
+	if err := b.Lists.Delete(ctx, second.ID); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := b.Lists.Get(ctx, second.ID); !errors.Is(err, models.ErrListNotFound) {
+		t.Errorf("Get() after Delete() = %v, want %v", err, models.ErrListNotFound)
+	}
+	if basket, err := b.Basket.Get(ctx, second.ID); err != nil || len(basket.Items) != 0 {
+		t.Errorf("basket of a deleted list = %+v, %v, want it emptied", basket, err)
+	}
+}
+
+func testTrips(t *testing.T, b Backend) {
+	ctx, listId := login(t, b)
+	other, _ := login(t, b)
+	milk := createItem(t, b, ctx, "Milk", 125)
+
+	trip := models.Trip{
+		ListName: "Groceries",
+		Store:    "Corner shop",
+		Total:    money.New(250, money.DEFAULT_CURRENCY),
+		Items: []models.TripItem{
+			{ItemID: milk.ID, Name: "Milk", Quantity: 2, Unit: "pints", Price: milk.Price, Store: "Corner shop", Note: "semi-skimmed"},
+		},
+	}
+	if err := b.Trips.Create(ctx, listId, &trip); err != nil || trip.ID == 0 || trip.FinishedAt.IsZero() || trip.ItemCount != 1 {
+		t.Fatalf("Create() = %v, trip = %+v", err, trip)
+	}
+
+	got, err := b.Trips.Get(ctx, trip.ID)
+	if err != nil || got.ListName != "Groceries" || got.Store != "Corner shop" || got.Total != trip.Total || !got.FinishedAt.Equal(trip.FinishedAt) {
+		t.Fatalf("Get() = %+v, %v, want %+v", got, err, trip)
+	}
+	if len(got.Items) != 1 || got.Items[0] != trip.Items[0] || got.ItemCount != 1 {
+		t.Errorf("Get() items = %+v, want %+v", got.Items, trip.Items)
+	}
+	all, err := b.Trips.GetAll(ctx)
+	if err != nil || len(all) != 1 || all[0].ID != trip.ID || all[0].ItemCount != 1 || all[0].Total != trip.Total {
+		t.Errorf("GetAll() = %+v, %v", all, err)
+	}
+
+	if _, err := b.Trips.Get(other, trip.ID); !errors.Is(err, models.ErrTripNotFound) {
+		t.Errorf("Get() from another household = %v, want %v", err, models.ErrTripNotFound)
+	}
+	if got, _ := b.Trips.GetAll(other); len(got) != 0 {
+		t.Errorf("GetAll() for another household = %+v, want none", got)
+	}
+
+	if err := b.Items.Delete(ctx, milk.ID); err != nil {
+		t.Fatalf("could not delete Milk: %v", err)
+	}
+	if got, _ := b.Trips.Get(ctx, trip.ID); len(got.Items) != 1 || got.Items[0].ItemID != 0 || got.Items[0].Name != "Milk" {
+		t.Errorf("Get() after the item was deleted = %+v, want it kept without the item", got.Items)
+	}
+}
+
+func testTokens(t *testing.T, b Backend) {
+	ctx, _ := login(t, b)
+	other, _ := login(t, b)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	token := models.Token{Name: "Script", Scope: models.ScopeRead, Hash: "first", ExpiresAt: expiresAt}
+	if err := b.Tokens.Create(ctx, &token); err != nil || token.ID == 0 || token.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %v, token = %+v", err, token)
+	}
+	if token.UserID != ctx.Value(components.UserKey).(uuid.UUID) || token.HouseholdID != ctx.Value(components.HouseholdKey).(int64) {
+		t.Errorf("Create() token = %+v, want it for the current user and household", token)
+	}
+
+	got, err := b.Tokens.GetByHash(ctx, "first")
+	if err != nil || got.ID != token.ID || got.Scope != models.ScopeRead || !got.ExpiresAt.Equal(expiresAt) || !got.LastUsedAt.IsZero() {
+		t.Errorf("GetByHash() = %+v, %v, want %+v", got, err, token)
+	}
+	if _, err := b.Tokens.GetByHash(ctx, "missing"); !errors.Is(err, models.ErrTokenNotFound) {
+		t.Errorf("GetByHash() for a missing token = %v, want %v", err, models.ErrTokenNotFound)
+	}
+
+	usedAt := time.Now().UTC().Truncate(time.Second)
+	if err := b.Tokens.SetLastUsed(ctx, token.ID, usedAt); err != nil {
+		t.Fatalf("SetLastUsed() = %v", err)
+	}
+	if got, _ := b.Tokens.GetByHash(ctx, "first"); !got.LastUsedAt.Equal(usedAt) {
+		t.Errorf("LastUsedAt after SetLastUsed() = %v, want %v", got.LastUsedAt, usedAt)
+	}
+
+	second := models.Token{Name: "Forever", Scope: models.ScopeWrite, Hash: "second"}
+	if err := b.Tokens.Create(ctx, &second); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if got, _ := b.Tokens.GetByHash(ctx, "second"); !got.ExpiresAt.IsZero() {
+		t.Errorf("ExpiresAt of a token that never expires = %v, want zero", got.ExpiresAt)
+	}
+	if got, err := b.Tokens.GetAll(ctx); err != nil || len(got) != 2 || got[0].ID != second.ID || got[1].ID != token.ID {
+		t.Errorf("GetAll() = %+v, %v, want the newest first", got, err)
+	}
+	if got, _ := b.Tokens.GetAll(other); len(got) != 0 {
+		t.Errorf("GetAll() for another user = %+v, want none", got)
+	}
+
+	if err := b.Tokens.Delete(other, token.ID); !errors.Is(err, models.ErrTokenNotFound) {
+		t.Errorf("Delete() by another user = %v, want %v", err, models.ErrTokenNotFound)
+	}
+	if err := b.Tokens.Delete(ctx, token.ID); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := b.Tokens.GetByHash(ctx, "first"); !errors.Is(err, models.ErrTokenNotFound) {
+		t.Errorf("GetByHash() after Delete() = %v, want %v", err, models.ErrTokenNotFound)
+	}
+}
+
+func testTOTP(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := createUser(t, b)
+
+	if _, err := b.TOTP.Get(ctx, user.ID); !errors.Is(err, models.ErrTOTPNotFound) {
+		t.Errorf("Get() before Save() = %v, want %v", err, models.ErrTOTPNotFound)
+	}
+	if err := b.TOTP.Enable(ctx, user.ID); !errors.Is(err, models.ErrTOTPNotFound) {
+		t.Errorf("Enable() before Save() = %v, want %v", err, models.ErrTOTPNotFound)
+	}
+	if _, err := b.TOTP.Fail(ctx, user.ID); !errors.Is(err, models.ErrTOTPNotFound) {
+		t.Errorf("Fail() before Save() = %v, want %v", err, models.ErrTOTPNotFound)
+	}
+
+	if err := b.TOTP.Save(ctx, &models.TOTPSecret{UserID: user.ID, Secret: "secret"}); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+	if got, err := b.TOTP.Get(ctx, user.ID); err != nil || got.Secret != "secret" || got.Enabled() {
+		t.Errorf("Get() after Save() = %+v, %v, want it not enabled", got, err)
+	}
+	if err := b.TOTP.Enable(ctx, user.ID); err != nil {
+		t.Fatalf("Enable() = %v", err)
+	}
+	if got, _ := b.TOTP.Get(ctx, user.ID); !got.Enabled() {
+		t.Errorf("Get() after Enable() = %+v, want it enabled", got)
+	}
+	if n, err := b.TOTP.CountEnabled(ctx); err != nil || n != 1 {
+		t.Errorf("CountEnabled() = %d, %v, want 1", n, err)
+	}
+
+	for _, tt := range []struct {
+		step int64
+		want bool
+	}{{5, true}, {5, false}, {4, false}, {6, true}} {
+		if got, err := b.TOTP.UseStep(ctx, user.ID, tt.step); err != nil || got != tt.want {
+			t.Errorf("UseStep(%d) = %v, %v, want %v", tt.step, got, err, tt.want)
+		}
+	}
+
+	for want := 1; want <= 2; want++ {
+		if got, err := b.TOTP.Fail(ctx, user.ID); err != nil || got != want {
+			t.Errorf("Fail() = %d, %v, want %d", got, err, want)
+		}
+	}
+	if got, _ := b.TOTP.Get(ctx, user.ID); got.FailedAttempts != 2 || got.FailedAt.IsZero() {
+		t.Errorf("Get() after Fail() = %+v, want 2 failed attempts", got)
+	}
+	if err := b.TOTP.ResetAttempts(ctx, user.ID); err != nil {
+		t.Fatalf("ResetAttempts() = %v", err)
+	}
+	if got, _ := b.TOTP.Get(ctx, user.ID); got.FailedAttempts != 0 || !got.FailedAt.IsZero() {
+		t.Errorf("Get() after ResetAttempts() = %+v, want no failed attempts", got)
+	}
+
+	if err := b.TOTP.SetRecoveryCodes(ctx, user.ID, []string{"a", "b"}); err != nil {
+		t.Fatalf("SetRecoveryCodes() = %v", err)
+	}
+	if used, err := b.TOTP.UseRecoveryCode(ctx, user.ID, "a"); err != nil || !used {
+		t.Errorf("UseRecoveryCode() = %v, %v, want true", used, err)
+	}
+	if used, _ := b.TOTP.UseRecoveryCode(ctx, user.ID, "a"); used {
+		t.Errorf("UseRecoveryCode() again = true, want false")
+	}
+	if n, err := b.TOTP.CountRecoveryCodes(ctx, user.ID); err != nil || n != 1 {
+		t.Errorf("CountRecoveryCodes() = %d, %v, want 1", n, err)
+	}
+
+	if err := b.TOTP.Save(ctx, &models.TOTPSecret{UserID: user.ID, Secret: "new"}); err != nil {
+		t.Fatalf("Save() again = %v", err)
+	}
+	if got, _ := b.TOTP.Get(ctx, user.ID); got.Secret != "new" || got.Enabled() || got.LastStep != 0 {
+		t.Errorf("Get() after saving a new secret = %+v, want it replaced and not enabled", got)
+	}
+	if n, _ := b.TOTP.CountEnabled(ctx); n != 0 {
+		t.Errorf("CountEnabled() after saving a new secret = %d, want 0", n)
+	}
+
+	if err := b.TOTP.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := b.TOTP.Get(ctx, user.ID); !errors.Is(err, models.ErrTOTPNotFound) {
+		t.Errorf("Get() after Delete() = %v, want %v", err, models.ErrTOTPNotFound)
+	}
+	if n, _ := b.TOTP.CountRecoveryCodes(ctx, user.ID); n != 0 {
+		t.Errorf("CountRecoveryCodes() after Delete() = %d, want 0", n)
+	}
+}
+
+func testCredentials(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := createUser(t, b)
+
+	credential := models.Credential{UserID: user.ID, CredentialID: "abc", Name: "Laptop", Data: []byte(`{"count":0}`)}
+	if err := b.Credentials.Create(ctx, &credential); err != nil || credential.ID == 0 || credential.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %v, credential = %+v", err, credential)
+	}
+	duplicate := models.Credential{UserID: user.ID, CredentialID: "abc", Name: "Phone", Data: []byte(`{}`)}
+	if err := b.Credentials.Create(ctx, &duplicate); !errors.Is(err, models.ErrDuplicateCredential) {
+		t.Errorf("Create() with a taken credential ID = %v, want %v", err, models.ErrDuplicateCredential)
+	}
+
+	got, err := b.Credentials.GetByCredentialID(ctx, "abc")
+	if err != nil || got.ID != credential.ID || got.Name != "Laptop" || string(got.Data) != `{"count":0}` || !got.LastUsedAt.IsZero() {
+		t.Errorf("GetByCredentialID() = %+v, %v, want %+v", got, err, credential)
+	}
+	if _, err := b.Credentials.GetByCredentialID(ctx, "missing"); !errors.Is(err, models.ErrCredentialNotFound) {
+		t.Errorf("GetByCredentialID() for a missing passkey = %v, want %v", err, models.ErrCredentialNotFound)
+	}
+
+	credential.Data = []byte(`{"count":1}`)
+	if err := b.Credentials.Used(ctx, &credential); err != nil {
+		t.Fatalf("Used() = %v", err)
+	}
+	if got, _ := b.Credentials.GetByCredentialID(ctx, "abc"); string(got.Data) != `{"count":1}` || got.LastUsedAt.IsZero() {
+		t.Errorf("GetByCredentialID() after Used() = %+v, want the new data", got)
+	}
+	if got, err := b.Credentials.GetAll(ctx, user.ID); err != nil || len(got) != 1 || got[0].ID != credential.ID {
+		t.Errorf("GetAll() = %+v, %v, want the passkey", got, err)
+	}
+	if got, _ := b.Credentials.GetAll(ctx, uuid.New()); len(got) != 0 {
+		t.Errorf("GetAll() for another user = %+v, want none", got)
+	}
+
+	if err := b.Credentials.Delete(ctx, uuid.New(), credential.ID); !errors.Is(err, models.ErrCredentialNotFound) {
+		t.Errorf("Delete() by another user = %v, want %v", err, models.ErrCredentialNotFound)
+	}
+	if err := b.Credentials.Delete(ctx, user.ID, credential.ID); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := b.Credentials.GetByCredentialID(ctx, "abc"); !errors.Is(err, models.ErrCredentialNotFound) {
+		t.Errorf("GetByCredentialID() after Delete() = %v, want %v", err, models.ErrCredentialNotFound)
+	}
+}
+
+func testIdentities(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := createUser(t, b)
+
+	identity := models.Identity{Issuer: "https://id.example.com", Subject: "123", UserID: user.ID}
+	if err := b.Identities.Create(ctx, &identity); err != nil || identity.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %v, identity = %+v", err, identity)
+	}
+	if got, err := b.Identities.Get(ctx, "https://id.example.com", "123"); err != nil || got.UserID != user.ID {
+		t.Errorf("Get() = %+v, %v, want %+v", got, err, identity)
+	}
+	if _, err := b.Identities.Get(ctx, "https://other.example.com", "123"); !errors.Is(err, models.ErrIdentityNotFound) {
+		t.Errorf("Get() from another issuer = %v, want %v", err, models.ErrIdentityNotFound)
+	}
+}
+
+// testConcurrentTransactions checks a write made outside a transaction while
+// one is running is kept when the transaction is undone.
+func testConcurrentTransactions(t *testing.T, b Backend) {
+	ctx, _ := login(t, b)
+	errFailed := errors.New("failed")
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	txErr := make(chan error)
+	go func() {
+		txErr <- b.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			if err := b.Items.Create(ctx, &models.Item{Name: "Rolled back", Price: money.New(100, money.DEFAULT_CURRENCY)}); err != nil {
+				return err
+			}
+			close(started)
+			<-release
+			return errFailed
+		})
+	}()
+	<-started
+
+	outsideErr := make(chan error)
+	go func() {
+		outsideErr <- b.Items.Create(ctx, &models.Item{Name: "Outside", Price: money.New(100, money.DEFAULT_CURRENCY)})
+	}()
+	// The write may finish while the transaction is running or wait for it,
+	// but either way it has to survive the rollback.
+	var err error
+	select {
+	case err = <-outsideErr:
+		close(release)
+	case <-time.After(100 * time.Millisecond):
+		close(release)
+		err = <-outsideErr
+	}
+	if err != nil {
+		t.Fatalf("Create() outside the transaction = %v", err)
+	}
+	if err := <-txErr; !errors.Is(err, errFailed) {
+		t.Errorf("WithinTx() = %v, want %v", err, errFailed)
+	}
+	if _, items, _ := b.Items.GetAll(ctx, "", 1, 10, ""); fmt.Sprint(names(items)) != "[Outside]" {
+		t.Errorf("GetAll() after the transaction was undone = %v, want [Outside]", names(items))
+	}
+}
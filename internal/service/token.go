@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+)
+
+// TOKEN_PREFIX marks trolly tokens so they are easy to spot, e.g. by secret
+// scanners.
+const TOKEN_PREFIX = "trolly_"
+
+// LAST_USED_INTERVAL is how stale a token's last use can get before it is
+// updated, so tokens are not written to on every request.
+const LAST_USED_INTERVAL = time.Minute
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+type TokenService struct {
+	repository TokenRepository
+}
+
+func NewTokenService(r TokenRepository) *TokenService {
+	return &TokenService{
+		repository: r,
+	}
+}
+
+// Create makes a token for the current user in their current household. The
+// token itself is only returned here, as just its hash is stored. A zero
+// expiresAt never expires.
+func (s *TokenService) Create(ctx context.Context, name string, scope models.TokenScope, expiresAt time.Time) (models.Token, string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return models.Token{}, "", err
+	}
+	plaintext = TOKEN_PREFIX + plaintext
+
+	token := &models.Token{
+		Name:      strings.TrimSpace(name),
+		Scope:     scope,
+		Hash:      hashToken(plaintext),
+		ExpiresAt: expiresAt,
+	}
+	err = token.Validate()
+	if err != nil {
+		return models.Token{}, "", err
+	}
+	err = s.repository.Create(ctx, token)
+	if err != nil {
+		return models.Token{}, "", err
+	}
+	return *token, plaintext, nil
+}
+
+func (s *TokenService) GetAll(ctx context.Context) ([]models.Token, error) {
+	return s.repository.GetAll(ctx)
+}
+
+func (s *TokenService) Revoke(ctx context.Context, id int64) error {
+	return s.repository.Delete(ctx, id)
+}
+
+// Authenticate returns the token for plaintext if it exists and has not
+// expired, and records that it was used.
+func (s *TokenService) Authenticate(ctx context.Context, plaintext string) (models.Token, error) {
+	if !strings.HasPrefix(plaintext, TOKEN_PREFIX) {
+		return models.Token{}, ErrInvalidToken
+	}
+	token, err := s.repository.GetByHash(ctx, hashToken(plaintext))
+	if err == models.ErrTokenNotFound {
+		return models.Token{}, ErrInvalidToken
+	} else if err != nil {
+		return models.Token{}, err
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return models.Token{}, ErrInvalidToken
+	}
+	if now.Sub(token.LastUsedAt) > LAST_USED_INTERVAL {
+		err = s.repository.SetLastUsed(ctx, token.ID, now)
+		if err != nil {
+			return models.Token{}, err
+		}
+		token.LastUsedAt = now
+	}
+	return token, nil
+}
+
+// randomToken returns 32 random bytes encoded for use in URLs.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(plaintext string) string {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/hunterwilkins2/trolly/internal/events"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/validator"
+)
+
+var (
+	ErrNothingPurchased = errors.New("no items have been purchased")
+)
+
+type TripService struct {
+	repository TripRepository
+	basket     BasketRepository
+	lists      ListRepository
+	transactor Transactor
+	broker     *events.Broker
+}
+
+func NewTripService(r TripRepository, basket BasketRepository, lists ListRepository, transactor Transactor, broker *events.Broker) *TripService {
+	return &TripService{
+		repository: r,
+		basket:     basket,
+		lists:      lists,
+		transactor: transactor,
+		broker:     broker,
+	}
+}
+
+func (s *TripService) GetAll(ctx context.Context) ([]models.Trip, error) {
+	return s.repository.GetAll(ctx)
+}
+
+func (s *TripService) Get(ctx context.Context, id int64) (models.Trip, error) {
+	return s.repository.Get(ctx, id)
+}
+
+// Finish archives the purchased items on the list into a new trip and removes
+// them from the basket. Items that were not purchased stay on the list. The
+// trip's store defaults to the store of its items when they all share one.
+func (s *TripService) Finish(ctx context.Context, listId int64, store string) (models.Trip, error) {
+	trip := models.Trip{
+		Store: strings.TrimSpace(store),
+	}
+	v := validator.New()
+	models.ValidateStore(v, trip.Store)
+	if v.HasErrors() {
+		return models.Trip{}, v
+	}
+
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		list, err := s.lists.Get(ctx, listId)
+		if err != nil {
+			return err
+		}
+		purchased, err := s.basket.GetPurchased(ctx, listId)
+		if err != nil {
+			return err
+		}
+
+		trip.ListName = list.Name
+		stores := map[string]bool{}
+		basketIds := make([]int64, 0, len(purchased))
+		for _, item := range purchased {
+			basketIds = append(basketIds, item.BasketID)
+			trip.Items = append(trip.Items, models.TripItem{
+				ItemID:   item.ID,
+				Name:     item.Name,
+				Quantity: item.Quantity,
+				Unit:     item.Unit,
+				Price:    item.Price,
+				Store:    item.Store,
+				Note:     item.Note,
+			})
+			line, err := item.Price.Mul(item.Quantity)
+			if err != nil {
+				return err
+			}
+			trip.Total, err = trip.Total.Add(line)
+			if err != nil {
+				return err
+			}
+			stores[item.Store] = true
+		}
+		if len(trip.Items) == 0 {
+			return ErrNothingPurchased
+		}
+		if trip.Store == "" && len(stores) == 1 {
+			for store := range stores {
+				trip.Store = store
+			}
+		}
+
+		err = s.repository.Create(ctx, listId, &trip)
+		if err != nil {
+			return err
+		}
+		// Only the items on the trip are removed, not any checked off since
+		err = s.basket.RemovePurchased(ctx, listId, basketIds)
+		if err != nil {
+			return err
+		}
+		models.AfterCommit(ctx, func() {
+			s.broker.Publish(events.Event{Type: events.TripFinished, ListID: listId})
+		})
+		return nil
+	})
+	if err != nil {
+		return models.Trip{}, err
+	}
+	return trip, nil
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/totp"
+)
+
+const (
+	// TOTP_ISSUER is what authenticator apps list the account under.
+	TOTP_ISSUER    = "Trolly"
+	RECOVERY_CODES = 10
+	// MAX_TWO_FACTOR_ATTEMPTS is how many invalid codes a user can enter
+	// before they are locked out for TWO_FACTOR_LOCKOUT. Each invalid code
+	// after that locks them out again, until they enter a valid one.
+	MAX_TWO_FACTOR_ATTEMPTS = 5
+	TWO_FACTOR_LOCKOUT      = 15 * time.Minute
+)
+
+var (
+	ErrInvalidCode      = errors.New("invalid code")
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTooManyAttempts  = errors.New("too many invalid codes")
+)
+
+// Enrolment is a new secret for a user to add to their authenticator app. QR
+// is an SVG of URL.
+type Enrolment struct {
+	Secret string
+	URL    string
+	QR     string
+}
+
+type TwoFactorService struct {
+	repository TOTPRepository
+	transactor Transactor
+	// key encrypts secrets at rest.
+	key []byte
+}
+
+func NewTwoFactorService(repository TOTPRepository, transactor Transactor, key []byte) *TwoFactorService {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("totp-secrets"))
+	return &TwoFactorService{
+		repository: repository,
+		transactor: transactor,
+		key:        mac.Sum(nil),
+	}
+}
+
+// Enabled reports whether the user has to enter a code to log in.
+func (s *TwoFactorService) Enabled(ctx context.Context, userId uuid.UUID) (bool, error) {
+	secret, err := s.repository.Get(ctx, userId)
+	if err == models.ErrTOTPNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return secret.Enabled(), nil
+}
+
+// Enrol creates a new secret for the user, replacing any they have not
+// finished setting up. It is not used until Enable is called with a code from
+// it.
+func (s *TwoFactorService) Enrol(ctx context.Context, user *models.User) (Enrolment, error) {
+	enabled, err := s.Enabled(ctx, user.ID)
+	if err != nil {
+		return Enrolment{}, err
+	}
+	if enabled {
+		return Enrolment{}, ErrTwoFactorEnabled
+	}
+
+	plaintext, err := totp.NewSecret()
+	if err != nil {
+		return Enrolment{}, err
+	}
+	encrypted, err := s.encrypt(plaintext)
+	if err != nil {
+		return Enrolment{}, err
+	}
+	err = s.repository.Save(ctx, &models.TOTPSecret{UserID: user.ID, Secret: encrypted})
+	if err != nil {
+		return Enrolment{}, err
+	}
+	return enrolment(user, plaintext)
+}
+
+// Pending returns the enrolment the user has started but not enabled yet.
+func (s *TwoFactorService) Pending(ctx context.Context, user *models.User) (Enrolment, error) {
+	secret, err := s.repository.Get(ctx, user.ID)
+	if err != nil {
+		return Enrolment{}, err
+	}
+	if secret.Enabled() {
+		return Enrolment{}, ErrTwoFactorEnabled
+	}
+	plaintext, err := s.decrypt(secret.Secret)
+	if err != nil {
+		return Enrolment{}, err
+	}
+	return enrolment(user, plaintext)
+}
+
+func enrolment(user *models.User, secret string) (Enrolment, error) {
+	url := totp.URL(TOTP_ISSUER, user.Email, secret)
+	qr, err := totp.QR(url)
+	if err != nil {
+		return Enrolment{}, err
+	}
+	return Enrolment{Secret: secret, URL: url, QR: qr}, nil
+}
+
+// Enable turns on two-factor authentication once the user has entered a code
+// from their enrolment, and returns their recovery codes.
+func (s *TwoFactorService) Enable(ctx context.Context, userId uuid.UUID, code string) ([]string, error) {
+	var codes []string
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		secret, err := s.repository.Get(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if secret.Enabled() {
+			return ErrTwoFactorEnabled
+		}
+		err = s.checkCode(ctx, secret, code)
+		if err != nil {
+			return err
+		}
+		err = s.repository.Enable(ctx, userId)
+		if err != nil {
+			return err
+		}
+		codes, err = s.setRecoveryCodes(ctx, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a code from the user's authenticator app, or one of their
+// recovery codes, which can then not be used again. Invalid codes are counted
+// against the user, whichever session they come from, and it returns
+// ErrTooManyAttempts once they have entered MAX_TWO_FACTOR_ATTEMPTS of them.
+func (s *TwoFactorService) Verify(ctx context.Context, userId uuid.UUID, code string) error {
+	secret, err := s.repository.Get(ctx, userId)
+	if err == models.ErrTOTPNotFound {
+		return ErrInvalidCode
+	} else if err != nil {
+		return err
+	}
+	if !secret.Enabled() {
+		return ErrInvalidCode
+	}
+	if secret.FailedAttempts >= MAX_TWO_FACTOR_ATTEMPTS && time.Since(secret.FailedAt) < TWO_FACTOR_LOCKOUT {
+		return ErrTooManyAttempts
+	}
+
+	err = s.verify(ctx, secret, code)
+	if err == ErrInvalidCode {
+		attempts, err := s.repository.Fail(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if attempts >= MAX_TWO_FACTOR_ATTEMPTS {
+			return ErrTooManyAttempts
+		}
+		return ErrInvalidCode
+	} else if err != nil {
+		return err
+	}
+	if secret.FailedAttempts > 0 {
+		return s.repository.ResetAttempts(ctx, userId)
+	}
+	return nil
+}
+
+// verify checks the code against the user's secret or recovery codes.
+func (s *TwoFactorService) verify(ctx context.Context, secret models.TOTPSecret, code string) error {
+	if len(strings.ReplaceAll(code, " ", "")) == totp.DIGITS {
+		return s.checkCode(ctx, secret, code)
+	}
+	ok, err := s.repository.UseRecoveryCode(ctx, secret.UserID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// checkCode validates the authenticator app code, and uses up its step.
+func (s *TwoFactorService) checkCode(ctx context.Context, secret models.TOTPSecret, code string) error {
+	plaintext, err := s.decrypt(secret.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(plaintext, code, time.Now())
+	if !ok {
+		return ErrInvalidCode
+	}
+	ok, err = s.repository.UseStep(ctx, secret.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// Disable turns off two-factor authentication for the user.
+func (s *TwoFactorService) Disable(ctx context.Context, userId uuid.UUID) error {
+	return s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return s.repository.Delete(ctx, userId)
+	})
+}
+
+// RecoveryCodesLeft is how many recovery codes the user has not used.
+func (s *TwoFactorService) RecoveryCodesLeft(ctx context.Context, userId uuid.UUID) (int, error) {
+	return s.repository.CountRecoveryCodes(ctx, userId)
+}
+
+// NewRecoveryCodes replaces the user's recovery codes.
+func (s *TwoFactorService) NewRecoveryCodes(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	enabled, err := s.Enabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, models.ErrTOTPNotFound
+	}
+	var codes []string
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		codes, err = s.setRecoveryCodes(ctx, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// setRecoveryCodes generates the user's recovery codes, formatted like
+// abcde-fghij. Only their hashes are stored.
+func (s *TwoFactorService) setRecoveryCodes(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	codes := make([]string, RECOVERY_CODES)
+	hashes := make([]string, RECOVERY_CODES)
+	for n := range codes {
+		b := make([]byte, 8)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes[n] = code[:5] + "-" + code[5:]
+		hashes[n] = hashToken(code)
+	}
+	err := s.repository.SetRecoveryCodes(ctx, userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// encrypt seals the secret with AES-GCM, prefixed with its nonce.
+func (s *TwoFactorService) encrypt(plaintext string) (string, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *TwoFactorService) decrypt(ciphertext string) (string, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("could not decrypt two-factor secret")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("could not decrypt two-factor secret, has the secret key changed?")
+	}
+	return string(plaintext), nil
+}
+
+func (s *TwoFactorService) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
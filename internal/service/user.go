@@ -2,25 +2,50 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// PASSWORD_RESET_TTL is how long a password reset link can be used for.
+const PASSWORD_RESET_TTL = time.Hour
+
+// PASSWORD_RESET_INTERVAL is how long a user has to wait to be sent another
+// password reset link.
+const PASSWORD_RESET_INTERVAL = time.Minute
+
+// EMAIL_VERIFICATION_TTL is how long an email verification link can be used for.
+const EMAIL_VERIFICATION_TTL = 24 * time.Hour
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrResetTooSoon       = errors.New("a password reset was sent too recently")
 )
 
 type UserService struct {
-	repository *models.UserRepository
+	repository UserRepository
+	resets     PasswordResetRepository
+	transactor Transactor
+	// key signs email verification links.
+	key []byte
 }
 
-func NewUserService(repository *models.UserRepository) *UserService {
+func NewUserService(repository UserRepository, resets PasswordResetRepository, transactor Transactor, key []byte) *UserService {
 	return &UserService{
 		repository: repository,
+		resets:     resets,
+		transactor: transactor,
+		key:        key,
 	}
 }
 
@@ -71,3 +96,142 @@ func (s *UserService) GetUser(ctx context.Context, id uuid.UUID) (*models.User,
 	}
 	return user, err
 }
+
+// ForgotPassword creates a password reset for the user with the email. The
+// token for it is only returned here, as just its hash is stored. It returns
+// ErrResetTooSoon if the user was sent one within PASSWORD_RESET_INTERVAL.
+// Expired resets are cleared out along the way.
+func (s *UserService) ForgotPassword(ctx context.Context, email string) (*models.User, string, error) {
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		err := s.resets.DeleteExpired(ctx, now)
+		if err != nil {
+			return err
+		}
+		latest, err := s.resets.Latest(ctx, user.ID)
+		if err == nil && now.Sub(latest.CreatedAt) < PASSWORD_RESET_INTERVAL {
+			return ErrResetTooSoon
+		} else if err != nil && err != models.ErrPasswordResetNotFound {
+			return err
+		}
+		return s.resets.Create(ctx, &models.PasswordReset{
+			UserID:    user.ID,
+			Hash:      hashToken(plaintext),
+			ExpiresAt: now.Add(PASSWORD_RESET_TTL),
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return user, plaintext, nil
+}
+
+// CheckPasswordReset returns the user a password reset token is for, or
+// ErrInvalidToken if it has been used or has expired.
+func (s *UserService) CheckPasswordReset(ctx context.Context, token string) (*models.User, error) {
+	reset, err := s.resets.GetByHash(ctx, hashToken(token))
+	if err == models.ErrPasswordResetNotFound {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if reset.Expired(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	return s.repository.GetById(ctx, reset.UserID)
+}
+
+// ResetPassword sets a new password for the user the token is for. It uses up
+// every reset the user has been sent, and logs them out everywhere. Opening
+// the emailed link also verifies their email.
+func (s *UserService) ResetPassword(ctx context.Context, token string, password string) (*models.User, error) {
+	v := validator.New()
+	models.ValidatePassword(v, password)
+	if v.HasErrors() {
+		return nil, v
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash password: %v", err)
+	}
+
+	var user *models.User
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.CheckPasswordReset(ctx, token)
+		if err != nil {
+			return err
+		}
+		user.HashedPassword = hashed
+		err = s.repository.UpdatePassword(ctx, user)
+		if err != nil {
+			return err
+		}
+		err = s.repository.Verify(ctx, user)
+		if err != nil {
+			return err
+		}
+		return s.resets.DeleteAll(ctx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// VerificationToken signs a token the user can verify their email with. It
+// stops working once it expires, or if their email changes.
+func (s *UserService) VerificationToken(user *models.User) string {
+	payload := fmt.Sprintf("%s.%d", user.ID, time.Now().Add(EMAIL_VERIFICATION_TTL).Unix())
+	return payload + "." + s.sign(payload, user.Email)
+}
+
+// VerifyEmail marks the email of the user the token was signed for as
+// verified. Using a token again once verified does nothing.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	n := strings.LastIndex(token, ".")
+	if n == -1 {
+		return nil, ErrInvalidToken
+	}
+	payload, signature := token[:n], token[n+1:]
+	id, expiresAt, _ := strings.Cut(payload, ".")
+	userId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.repository.GetById(ctx, userId)
+	if err == models.ErrUserNotFound {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload, user.Email))) {
+		return nil, ErrInvalidToken
+	}
+	err = s.repository.Verify(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// sign returns the signature of a verification token's payload, which covers
+// the email it verifies without putting it in the link.
+func (s *UserService) sign(payload string, email string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("verify-email\n" + payload + "\n" + strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
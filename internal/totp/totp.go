@@ -0,0 +1,115 @@
+// Package totp implements the time-based one-time passwords of RFC 6238 that
+// authenticator apps generate, with the defaults they all support: SHA-1, six
+// digits and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+const (
+	DIGITS = 6
+	PERIOD = 30
+	// SKEW is how many periods either side of now a code is accepted from,
+	// for clocks that are a little out.
+	SKEW = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random base32 secret, which is how authenticator apps
+// take it.
+func NewSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Step is the period the time falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / PERIOD
+}
+
+// Code returns the code for the secret in the step.
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", DIGITS, value%uint32(math.Pow10(DIGITS))), nil
+}
+
+// Validate returns the step the code is for if it is valid at now, or false
+// if it is not. Callers should only accept a step once, so that a code cannot
+// be replayed.
+func Validate(secret string, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != DIGITS {
+		return 0, false
+	}
+	current := Step(now)
+	for step := current - SKEW; step <= current+SKEW; step++ {
+		want, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(code), []byte(want)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URL is the otpauth URL authenticator apps scan to add the secret.
+func URL(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{
+		"secret": {secret},
+		"issuer": {issuer},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// QR draws the text as a QR code in an SVG, with the quiet zone scanners need
+// around it.
+func QR(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+	const margin = 4
+	size := code.Size + 2*margin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+margin, y+margin)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String(), nil
+}
@@ -0,0 +1,98 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors from RFC 6238, cut to six digits
+var vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+// rfcSecret is "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	for _, v := range vectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil || got != v.code {
+			t.Errorf("Code at %d = %q, %v, want %q", v.unix, got, err, v.code)
+		}
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with an invalid secret returned no error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	for _, tt := range []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current", 0, true},
+		{"previous", -1, true},
+		{"next", 1, true},
+		{"too old", -2, false},
+		{"too new", 2, false},
+	} {
+		code, _ := Code(rfcSecret, step+tt.offset)
+		got, ok := Validate(rfcSecret, code, now)
+		if ok != tt.ok || (ok && got != step+tt.offset) {
+			t.Errorf("Validate %s code = %d, %v, want %d, %v", tt.name, got, ok, step+tt.offset, tt.ok)
+		}
+	}
+	if _, ok := Validate(rfcSecret, "050 471", now); !ok {
+		t.Error("Validate rejected a code with a space")
+	}
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+
+	secret, err := NewSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("NewSecret() = %q, %v", secret, err)
+	}
+	code, _ := Code(secret, Step(time.Now()))
+	if _, ok := Validate(secret, code, time.Now()); !ok {
+		t.Error("Validate rejected the code for a new secret")
+	}
+}
+
+func TestURL(t *testing.T) {
+	u, err := url.Parse(URL("Trolly", "test@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Trolly:test@example.com" {
+		t.Errorf("URL = %s", u)
+	}
+	if u.Query().Get("secret") != rfcSecret || u.Query().Get("issuer") != "Trolly" {
+		t.Errorf("URL query = %v", u.Query())
+	}
+}
+
+func TestQR(t *testing.T) {
+	svg, err := QR(URL("Trolly", "test@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>") || !strings.Contains(svg, "h1v1h-1z") {
+		t.Errorf("QR = %q", svg)
+	}
+}
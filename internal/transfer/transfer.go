@@ -0,0 +1,240 @@
+// Package transfer reads and writes the pantry and basket as CSV or JSON, for
+// getting data out of Trolly and back in.
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv or json")
+	ErrNoName        = errors.New("there is no name column")
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+var Formats = []Format{CSV, JSON}
+
+// ParseFormat returns the format named by s, which may also be a file name
+// ending in the format's extension.
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(s)
+	if ext := filepath.Ext(s); ext != "" {
+		s = ext[1:]
+	}
+	if !slices.Contains(Formats, Format(s)) {
+		return "", ErrUnknownFormat
+	}
+	return Format(s), nil
+}
+
+func (f Format) ContentType() string {
+	if f == JSON {
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Item is a pantry item as it is exported. Prices are decimal strings like
+// "3.49" and LastPurchaseDate is nil for items that have never been bought.
+type Item struct {
+	Name             string     `json:"name"`
+	Price            string     `json:"price"`
+	Currency         string     `json:"currency"`
+	Category         string     `json:"category"`
+	TimesBought      int        `json:"times_bought"`
+	LastPurchaseDate *time.Time `json:"last_purchase_date"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+var itemColumns = []string{"name", "price", "currency", "category", "times_bought", "last_purchase_date", "created_at"}
+
+// BasketItem is an item in a list's basket as it is exported.
+type BasketItem struct {
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	Unit      string `json:"unit"`
+	Price     string `json:"price"`
+	Currency  string `json:"currency"`
+	Category  string `json:"category"`
+	Store     string `json:"store"`
+	Note      string `json:"note"`
+	Purchased bool   `json:"purchased"`
+}
+
+var basketColumns = []string{"name", "quantity", "unit", "price", "currency", "category", "store", "note", "purchased"}
+
+func WriteItems(w io.Writer, format Format, records []models.ItemRecord) error {
+	items := make([]Item, 0, len(records))
+	for _, record := range records {
+		item := Item{
+			Name:        record.Name,
+			Price:       record.Price.Decimal(),
+			Currency:    string(record.Price.Currency),
+			Category:    record.Category,
+			TimesBought: record.TimesBought,
+			CreatedAt:   record.CreatedAt.UTC(),
+		}
+		if !record.LastPurchaseDate.IsZero() {
+			lastPurchase := record.LastPurchaseDate.UTC()
+			item.LastPurchaseDate = &lastPurchase
+		}
+		items = append(items, item)
+	}
+	if format == JSON {
+		return writeJSON(w, items)
+	}
+
+	rows := [][]string{itemColumns}
+	for _, item := range items {
+		lastPurchase := ""
+		if item.LastPurchaseDate != nil {
+			lastPurchase = item.LastPurchaseDate.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			item.Name, item.Price, item.Currency, item.Category, strconv.Itoa(item.TimesBought), lastPurchase, item.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+func WriteBasket(w io.Writer, format Format, basket models.Basket) error {
+	items := make([]BasketItem, 0, len(basket.Items))
+	for _, item := range basket.Items {
+		items = append(items, BasketItem{
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			Unit:      item.Unit,
+			Price:     item.Price.Decimal(),
+			Currency:  string(item.Price.Currency),
+			Category:  item.Category,
+			Store:     item.Store,
+			Note:      item.Note,
+			Purchased: item.Purchased,
+		})
+	}
+	if format == JSON {
+		return writeJSON(w, items)
+	}
+
+	rows := [][]string{basketColumns}
+	for _, item := range items {
+		rows = append(rows, []string{
+			item.Name, strconv.Itoa(item.Quantity), item.Unit, item.Price, item.Currency, item.Category, item.Store, item.Note, strconv.FormatBool(item.Purchased),
+		})
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Row is an item read from an import. Line is the row's line in a CSV file,
+// or its position in a JSON array counting from 1. Err is set when the row's
+// price or currency cannot be read, and the rest of the rows are still read.
+type Row struct {
+	Line int
+	Item models.Item
+	Err  error
+}
+
+// ReadItems reads items written by WriteItems. Only name is required, and
+// times_bought, last_purchase_date, created_at and any unknown columns are
+// ignored as they come from the purchase history, which is not imported.
+// Prices must be in currency, which rows without a currency are taken to be in.
+func ReadItems(r io.Reader, format Format, currency money.Currency) ([]Row, error) {
+	if format == JSON {
+		var items []Item
+		if err := json.NewDecoder(r).Decode(&items); err != nil {
+			return nil, fmt.Errorf("not a JSON array of items: %w", err)
+		}
+		rows := make([]Row, 0, len(items))
+		for i, item := range items {
+			rows = append(rows, toRow(i+1, item.Name, item.Price, item.Currency, item.Category, currency))
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []Row{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, ErrNoName
+	}
+
+	rows := []Row{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		field := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, toRow(line, field("name"), field("price"), field("currency"), field("category"), currency))
+	}
+}
+
+func toRow(line int, name string, price string, currency string, category string, want money.Currency) Row {
+	row := Row{
+		Line: line,
+		Item: models.Item{Name: strings.TrimSpace(name), Category: strings.TrimSpace(category)},
+	}
+	c := money.Currency(strings.ToUpper(strings.TrimSpace(currency)))
+	if c == "" {
+		c = want
+	}
+	// Prices in other currencies could not be totalled with the rest
+	if c != want {
+		row.Err = fmt.Errorf("currency %q is not %s, which prices are kept in", currency, want)
+		return row
+	}
+
+	price = strings.TrimPrefix(strings.TrimSpace(price), c.Symbol())
+	if price == "" {
+		row.Item.Price = money.New(0, c)
+		return row
+	}
+	amount, err := money.Parse(price, c)
+	if err != nil {
+		row.Err = fmt.Errorf("price %q: %w", price, err)
+	}
+	row.Item.Price = amount
+	return row
+}
@@ -0,0 +1,121 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hunterwilkins2/trolly/internal/models"
+	"github.com/hunterwilkins2/trolly/internal/money"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{"csv": CSV, "JSON": JSON, "pantry.csv": CSV, "export.JSON": JSON}
+	for s, want := range tests {
+		if got, err := ParseFormat(s); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "xml", "pantry.txt"} {
+		if _, err := ParseFormat(s); err != ErrUnknownFormat {
+			t.Errorf("ParseFormat(%q) = %v, want %v", s, err, ErrUnknownFormat)
+		}
+	}
+}
+
+// TestItemsRoundTrip checks exports can be imported again.
+func TestItemsRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []models.ItemRecord{
+		{Item: models.Item{ID: 1, Name: `Milk, "whole"`, Price: money.New(349, money.USD), Category: "Dairy", TimesBought: 3}, LastPurchaseDate: created.Add(time.Hour), CreatedAt: created},
+		{Item: models.Item{ID: 2, Name: "Sushi", Price: money.New(1200, money.USD)}, CreatedAt: created},
+	}
+
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		if err := WriteItems(&buf, format, records); err != nil {
+			t.Fatalf("WriteItems(%s) = %v", format, err)
+		}
+		rows, err := ReadItems(&buf, format, money.USD)
+		if err != nil {
+			t.Fatalf("ReadItems(%s) = %v", format, err)
+		}
+		if len(rows) != len(records) {
+			t.Fatalf("ReadItems(%s) read %d rows, want %d", format, len(rows), len(records))
+		}
+		for i, row := range rows {
+			want := models.Item{Name: records[i].Name, Price: records[i].Price, Category: records[i].Category}
+			if row.Err != nil || row.Item != want {
+				t.Errorf("%s row %d = %+v, %v, want %+v", format, i, row.Item, row.Err, want)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	WriteItems(&buf, JSON, records)
+	var items []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if items[0]["last_purchase_date"] != "2024-03-01T13:00:00Z" || items[1]["last_purchase_date"] != nil || items[0]["times_bought"] != 3.0 {
+		t.Errorf("JSON export = %+v", items)
+	}
+}
+
+func TestReadItems(t *testing.T) {
+	input := "Category, Name\n" +
+		"Dairy,Milk\n" +
+		"Bakery\n"
+	rows, err := ReadItems(strings.NewReader(input), CSV, money.USD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Item.Name != "Milk" || rows[0].Item.Category != "Dairy" || rows[0].Line != 2 || rows[1].Item.Name != "" {
+		t.Errorf("ReadItems() = %+v", rows)
+	}
+
+	rows, err = ReadItems(strings.NewReader("name,price,currency\nA,$1.5,\nB,1.234,\nC,1,dollars\nD,1.00,EUR\nE,1.00,usd\n"), CSV, money.USD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Err != nil || rows[0].Item.Price != money.New(150, money.USD) {
+		t.Errorf("row with $1.5 = %+v", rows[0])
+	}
+	if rows[1].Err == nil || rows[2].Err == nil || rows[3].Err == nil {
+		t.Errorf("rows with a bad price and currencies = %+v", rows[1:4])
+	}
+	if rows[4].Err != nil || rows[4].Item.Price != money.New(100, money.USD) {
+		t.Errorf("row in usd = %+v", rows[4])
+	}
+
+	rows, err = ReadItems(strings.NewReader("name,price,currency\nA,€2,\nB,3,EUR\nC,1,USD\n"), CSV, money.EUR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Err != nil || rows[0].Item.Price != money.New(200, money.EUR) || rows[1].Err != nil || rows[2].Err == nil {
+		t.Errorf("rows read in euros = %+v", rows)
+	}
+
+	if _, err := ReadItems(strings.NewReader("price\n1.00\n"), CSV, money.USD); err != ErrNoName {
+		t.Errorf("ReadItems() without a name column = %v, want %v", err, ErrNoName)
+	}
+	if _, err := ReadItems(strings.NewReader(`{"name": "Milk"}`), JSON, money.USD); err == nil {
+		t.Error("ReadItems() of a JSON object succeeded")
+	}
+}
+
+func TestWriteBasket(t *testing.T) {
+	basket := models.Basket{Items: []models.BasketItem{
+		{BasketID: 1, Quantity: 2, Unit: "1gal", Store: "Costco", Purchased: true, Item: models.Item{Name: "Milk", Price: money.New(349, money.USD)}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteBasket(&buf, CSV, basket); err != nil {
+		t.Fatal(err)
+	}
+	want := "name,quantity,unit,price,currency,category,store,note,purchased\nMilk,2,1gal,3.49,USD,,Costco,,true\n"
+	if buf.String() != want {
+		t.Errorf("WriteBasket(csv) = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations so the binary can apply them
+// itself. Each dialect has its own directory.
+package migrations
+
+import "embed"
+
+//go:embed mysql/*.sql sqlite/*.sql postgres/*.sql
+var FS embed.FS
@@ -0,0 +1,3 @@
+ALTER TABLE basket DROP FOREIGN KEY basket_fk_list;
+ALTER TABLE basket DROP COLUMN list_id;
+DROP TABLE IF EXISTS lists;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS lists (
+  id int NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  user_id varchar(36) NOT NULL,
+  PRIMARY KEY (id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+INSERT INTO lists (name, user_id)
+SELECT 'Groceries', id FROM users;
+
+ALTER TABLE basket ADD list_id int AFTER user_id;
+
+UPDATE basket b
+INNER JOIN lists l
+ON l.user_id = b.user_id
+SET b.list_id = l.id;
+
+ALTER TABLE basket MODIFY list_id int NOT NULL;
+ALTER TABLE basket ADD CONSTRAINT basket_fk_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE;
@@ -0,0 +1,9 @@
+ALTER TABLE basket DROP FOREIGN KEY basket_fk_household;
+ALTER TABLE basket DROP COLUMN household_id;
+ALTER TABLE lists DROP FOREIGN KEY lists_fk_household;
+ALTER TABLE lists DROP COLUMN household_id;
+ALTER TABLE items DROP FOREIGN KEY items_fk_household;
+ALTER TABLE items DROP COLUMN household_id;
+DROP TABLE IF EXISTS household_invitations;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
\ No newline at end of file
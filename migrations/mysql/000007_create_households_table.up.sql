@@ -0,0 +1,53 @@
+CREATE TABLE IF NOT EXISTS households (
+  id int NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  join_code CHAR(8) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  created_by varchar(36) NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT households_uc_join_code UNIQUE (join_code)
+);
+
+CREATE TABLE IF NOT EXISTS household_members (
+  household_id int NOT NULL,
+  user_id varchar(36) NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'editor',
+  joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (household_id, user_id),
+  FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS household_invitations (
+  id int NOT NULL AUTO_INCREMENT,
+  household_id int NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'editor',
+  invited_by varchar(36) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT household_invitations_uc_email UNIQUE (household_id, email),
+  FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO households (name, join_code, created_by)
+SELECT CONCAT(name, '''s household'), UPPER(LEFT(REPLACE(UUID(), '-', ''), 8)), id FROM users;
+
+INSERT INTO household_members (household_id, user_id, role)
+SELECT id, created_by, 'owner' FROM households;
+
+ALTER TABLE items ADD household_id int AFTER user_id;
+UPDATE items i INNER JOIN households h ON h.created_by = i.user_id SET i.household_id = h.id;
+ALTER TABLE items MODIFY household_id int NOT NULL;
+ALTER TABLE items ADD CONSTRAINT items_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE;
+
+ALTER TABLE lists ADD household_id int AFTER user_id;
+UPDATE lists l INNER JOIN households h ON h.created_by = l.user_id SET l.household_id = h.id;
+ALTER TABLE lists MODIFY household_id int NOT NULL;
+ALTER TABLE lists ADD CONSTRAINT lists_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE;
+
+ALTER TABLE basket ADD household_id int AFTER user_id;
+UPDATE basket b INNER JOIN households h ON h.created_by = b.user_id SET b.household_id = h.id;
+ALTER TABLE basket MODIFY household_id int NOT NULL;
+ALTER TABLE basket ADD CONSTRAINT basket_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE;
\ No newline at end of file
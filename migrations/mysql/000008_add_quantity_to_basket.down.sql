@@ -0,0 +1,5 @@
+ALTER TABLE basket DROP FOREIGN KEY basket_fk_list;
+ALTER TABLE basket DROP INDEX basket_uc_list_item;
+ALTER TABLE basket ADD CONSTRAINT basket_fk_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE;
+ALTER TABLE basket DROP COLUMN unit;
+ALTER TABLE basket DROP COLUMN quantity;
\ No newline at end of file
@@ -0,0 +1,17 @@
+ALTER TABLE basket ADD quantity int NOT NULL DEFAULT 1 AFTER purchased;
+ALTER TABLE basket ADD unit VARCHAR(32) NOT NULL DEFAULT '' AFTER quantity;
+
+UPDATE basket b
+INNER JOIN (
+  SELECT MIN(id) AS id, COUNT(*) AS quantity
+  FROM basket
+  GROUP BY list_id, item_id
+) d
+ON d.id = b.id
+SET b.quantity = d.quantity;
+
+DELETE b FROM basket b
+INNER JOIN basket d
+ON d.list_id = b.list_id AND d.item_id = b.item_id AND d.id < b.id;
+
+ALTER TABLE basket ADD CONSTRAINT basket_uc_list_item UNIQUE (list_id, item_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE basket DROP COLUMN note;
+ALTER TABLE basket DROP COLUMN store;
+ALTER TABLE items DROP COLUMN category;
\ No newline at end of file
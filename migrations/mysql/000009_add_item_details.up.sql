@@ -0,0 +1,3 @@
+ALTER TABLE items ADD category VARCHAR(64) NOT NULL DEFAULT '' AFTER price;
+ALTER TABLE basket ADD store VARCHAR(64) NOT NULL DEFAULT '' AFTER unit;
+ALTER TABLE basket ADD note VARCHAR(255) NOT NULL DEFAULT '' AFTER store;
\ No newline at end of file
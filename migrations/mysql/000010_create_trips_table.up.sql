@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS trips (
+  id int NOT NULL AUTO_INCREMENT,
+  household_id int NOT NULL,
+  list_id int,
+  list_name VARCHAR(255) NOT NULL,
+  store VARCHAR(64) NOT NULL DEFAULT '',
+  total FLOAT NOT NULL DEFAULT 0,
+  finished_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  user_id varchar(36) NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT trips_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  CONSTRAINT trips_fk_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE SET NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS trip_items (
+  id int NOT NULL AUTO_INCREMENT,
+  trip_id int NOT NULL,
+  item_id int,
+  name VARCHAR(255) NOT NULL,
+  quantity int NOT NULL DEFAULT 1,
+  unit VARCHAR(32) NOT NULL DEFAULT '',
+  price FLOAT NOT NULL DEFAULT 0,
+  store VARCHAR(64) NOT NULL DEFAULT '',
+  note VARCHAR(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (id),
+  CONSTRAINT trip_items_fk_trip FOREIGN KEY (trip_id) REFERENCES trips(id) ON DELETE CASCADE,
+  CONSTRAINT trip_items_fk_item FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE SET NULL
+);
\ No newline at end of file
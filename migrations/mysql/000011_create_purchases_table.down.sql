@@ -0,0 +1,25 @@
+ALTER TABLE items ADD times_bought int NOT NULL DEFAULT 0 AFTER category;
+ALTER TABLE items ADD last_purchase_date DATE AFTER created_at;
+
+UPDATE items i
+INNER JOIN (
+  SELECT item_id, COUNT(*) AS times_bought, MAX(purchased_at) AS last_purchase_date
+  FROM purchases
+  GROUP BY item_id
+) p
+ON p.item_id = i.id
+SET i.times_bought = p.times_bought, i.last_purchase_date = p.last_purchase_date;
+
+DROP TABLE IF EXISTS purchases;
+
+CREATE TRIGGER update_item
+AFTER
+UPDATE
+  ON basket FOR EACH ROW 
+BEGIN 
+    IF (new.purchased = true) THEN
+        UPDATE items
+        SET times_bought = times_bought + 1, last_purchase_date = CURRENT_TIMESTAMP
+        WHERE id = new.item_id;
+    END IF;
+END;
\ No newline at end of file
@@ -0,0 +1,51 @@
+DROP TRIGGER IF EXISTS update_item;
+
+CREATE TABLE IF NOT EXISTS purchases (
+  id int NOT NULL AUTO_INCREMENT,
+  household_id int NOT NULL,
+  item_id int NOT NULL,
+  basket_id int,
+  price FLOAT NOT NULL DEFAULT 0,
+  quantity int NOT NULL DEFAULT 1,
+  purchased_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  user_id varchar(36) NOT NULL,
+  PRIMARY KEY (id),
+  INDEX purchases_idx_item (item_id, purchased_at),
+  CONSTRAINT purchases_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  CONSTRAINT purchases_fk_item FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+  CONSTRAINT purchases_fk_basket FOREIGN KEY (basket_id) REFERENCES basket(id) ON DELETE SET NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- One purchase for each time an item was bought, counted with a numbers table
+-- as a recursive query would stop at cte_max_recursion_depth. The last row
+-- takes the rest of any count past 10000 as its quantity.
+INSERT INTO purchases (household_id, item_id, price, quantity, purchased_at, user_id)
+SELECT i.household_id, i.id, i.price,
+  CASE WHEN numbers.n = LEAST(i.times_bought, 10000) THEN i.times_bought - numbers.n + 1 ELSE 1 END,
+  COALESCE(i.last_purchase_date, i.created_at), i.user_id
+FROM items i
+INNER JOIN (
+  SELECT ones.n + tens.n * 10 + hundreds.n * 100 + thousands.n * 1000 + 1 AS n
+  FROM (SELECT 0 AS n UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) ones
+  CROSS JOIN (SELECT 0 AS n UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) tens
+  CROSS JOIN (SELECT 0 AS n UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) hundreds
+  CROSS JOIN (SELECT 0 AS n UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) thousands
+) numbers
+ON numbers.n <= LEAST(i.times_bought, 10000)
+WHERE i.times_bought > 0;
+
+UPDATE purchases p
+INNER JOIN (
+  SELECT b.id AS basket_id, MAX(p.id) AS purchase_id
+  FROM basket b
+  INNER JOIN purchases p
+  ON p.item_id = b.item_id
+  WHERE b.purchased = true
+  GROUP BY b.id
+) latest
+ON latest.purchase_id = p.id
+SET p.basket_id = latest.basket_id;
+
+ALTER TABLE items DROP COLUMN times_bought;
+ALTER TABLE items DROP COLUMN last_purchase_date;
\ No newline at end of file
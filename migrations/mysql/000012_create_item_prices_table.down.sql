@@ -0,0 +1 @@
+DROP TABLE IF EXISTS item_prices;
\ No newline at end of file
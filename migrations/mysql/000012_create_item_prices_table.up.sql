@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS item_prices (
+  id int NOT NULL AUTO_INCREMENT,
+  item_id int NOT NULL,
+  purchase_id int,
+  price FLOAT NOT NULL,
+  source VARCHAR(16) NOT NULL,
+  recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX item_prices_idx_item (item_id, recorded_at),
+  CONSTRAINT item_prices_fk_item FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+  CONSTRAINT item_prices_fk_purchase FOREIGN KEY (purchase_id) REFERENCES purchases(id) ON DELETE CASCADE
+);
+
+INSERT INTO item_prices (item_id, price, source, recorded_at)
+SELECT id, price, 'created', created_at
+FROM items
+WHERE price != 0;
+
+INSERT INTO item_prices (item_id, purchase_id, price, source, recorded_at)
+SELECT item_id, id, price, 'purchased', purchased_at
+FROM purchases
+WHERE price != 0;
\ No newline at end of file
@@ -0,0 +1,29 @@
+ALTER TABLE trip_items ADD price_float FLOAT NOT NULL DEFAULT 0 AFTER price;
+UPDATE trip_items SET price_float = price / 100;
+ALTER TABLE trip_items DROP COLUMN currency;
+ALTER TABLE trip_items DROP COLUMN price;
+ALTER TABLE trip_items RENAME COLUMN price_float TO price;
+
+ALTER TABLE trips ADD total_float FLOAT NOT NULL DEFAULT 0 AFTER total;
+UPDATE trips SET total_float = total / 100;
+ALTER TABLE trips DROP COLUMN currency;
+ALTER TABLE trips DROP COLUMN total;
+ALTER TABLE trips RENAME COLUMN total_float TO total;
+
+ALTER TABLE item_prices ADD price_float FLOAT NOT NULL DEFAULT 0 AFTER price;
+UPDATE item_prices SET price_float = price / 100;
+ALTER TABLE item_prices DROP COLUMN currency;
+ALTER TABLE item_prices DROP COLUMN price;
+ALTER TABLE item_prices RENAME COLUMN price_float TO price;
+
+ALTER TABLE purchases ADD price_float FLOAT NOT NULL DEFAULT 0 AFTER price;
+UPDATE purchases SET price_float = price / 100;
+ALTER TABLE purchases DROP COLUMN currency;
+ALTER TABLE purchases DROP COLUMN price;
+ALTER TABLE purchases RENAME COLUMN price_float TO price;
+
+ALTER TABLE items ADD price_float FLOAT NOT NULL DEFAULT 0 AFTER price;
+UPDATE items SET price_float = price / 100;
+ALTER TABLE items DROP COLUMN currency;
+ALTER TABLE items DROP COLUMN price;
+ALTER TABLE items RENAME COLUMN price_float TO price;
\ No newline at end of file
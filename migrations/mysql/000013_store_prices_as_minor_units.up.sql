@@ -0,0 +1,29 @@
+ALTER TABLE items ADD price_minor BIGINT NOT NULL DEFAULT 0 AFTER price;
+ALTER TABLE items ADD currency CHAR(3) NOT NULL DEFAULT 'USD' AFTER price_minor;
+UPDATE items SET price_minor = ROUND(price * 100);
+ALTER TABLE items DROP COLUMN price;
+ALTER TABLE items RENAME COLUMN price_minor TO price;
+
+ALTER TABLE purchases ADD price_minor BIGINT NOT NULL DEFAULT 0 AFTER price;
+ALTER TABLE purchases ADD currency CHAR(3) NOT NULL DEFAULT 'USD' AFTER price_minor;
+UPDATE purchases SET price_minor = ROUND(price * 100);
+ALTER TABLE purchases DROP COLUMN price;
+ALTER TABLE purchases RENAME COLUMN price_minor TO price;
+
+ALTER TABLE item_prices ADD price_minor BIGINT NOT NULL DEFAULT 0 AFTER price;
+ALTER TABLE item_prices ADD currency CHAR(3) NOT NULL DEFAULT 'USD' AFTER price_minor;
+UPDATE item_prices SET price_minor = ROUND(price * 100);
+ALTER TABLE item_prices DROP COLUMN price;
+ALTER TABLE item_prices RENAME COLUMN price_minor TO price;
+
+ALTER TABLE trips ADD total_minor BIGINT NOT NULL DEFAULT 0 AFTER total;
+ALTER TABLE trips ADD currency CHAR(3) NOT NULL DEFAULT 'USD' AFTER total_minor;
+UPDATE trips SET total_minor = ROUND(total * 100);
+ALTER TABLE trips DROP COLUMN total;
+ALTER TABLE trips RENAME COLUMN total_minor TO total;
+
+ALTER TABLE trip_items ADD price_minor BIGINT NOT NULL DEFAULT 0 AFTER price;
+ALTER TABLE trip_items ADD currency CHAR(3) NOT NULL DEFAULT 'USD' AFTER price_minor;
+UPDATE trip_items SET price_minor = ROUND(price * 100);
+ALTER TABLE trip_items DROP COLUMN price;
+ALTER TABLE trip_items RENAME COLUMN price_minor TO price;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id int NOT NULL AUTO_INCREMENT,
+  user_id varchar(36) NOT NULL,
+  household_id int NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  scope VARCHAR(16) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NULL DEFAULT NULL,
+  last_used_at TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD session_version int NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS password_resets (
+  id int NOT NULL AUTO_INCREMENT,
+  user_id varchar(36) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT password_resets_uc_token_hash UNIQUE (token_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD verified_at TIMESTAMP NULL DEFAULT NULL;
+
+-- Accounts from before verification was required are trusted as they are
+UPDATE users SET verified_at = CURRENT_TIMESTAMP;
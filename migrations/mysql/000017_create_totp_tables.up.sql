@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS totp_secrets (
+  user_id varchar(36) NOT NULL,
+  secret varchar(255) NOT NULL,
+  enabled_at TIMESTAMP NULL DEFAULT NULL,
+  last_step bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id int NOT NULL AUTO_INCREMENT,
+  user_id varchar(36) NOT NULL,
+  code_hash CHAR(64) NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT recovery_codes_uc_user_code UNIQUE (user_id, code_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN passkey_required;
+DROP TABLE IF EXISTS credentials;
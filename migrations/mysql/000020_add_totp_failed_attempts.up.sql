@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets ADD failed_attempts int NOT NULL DEFAULT 0;
+ALTER TABLE totp_secrets ADD failed_at TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS item_prices;
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS trip_items;
+DROP TABLE IF EXISTS trips;
+DROP TABLE IF EXISTS basket;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS household_invitations;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS sessions;
\ No newline at end of file
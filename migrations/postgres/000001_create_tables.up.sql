@@ -0,0 +1,151 @@
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS sessions (
+  token TEXT PRIMARY KEY,
+  data BYTEA NOT NULL,
+  expiry TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
+
+CREATE TABLE IF NOT EXISTS users (
+  id VARCHAR(36) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  email CITEXT NOT NULL,
+  hashed_password CHAR(60) NOT NULL,
+  CONSTRAINT users_uc_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS households (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  join_code CHAR(8) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  created_by VARCHAR(36) NOT NULL,
+  CONSTRAINT households_uc_join_code UNIQUE (join_code)
+);
+
+CREATE TABLE IF NOT EXISTS household_members (
+  household_id INTEGER NOT NULL,
+  user_id VARCHAR(36) NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'editor',
+  joined_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (household_id, user_id),
+  FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS household_invitations (
+  id SERIAL PRIMARY KEY,
+  household_id INTEGER NOT NULL,
+  email CITEXT NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'editor',
+  invited_by VARCHAR(36) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT household_invitations_uc_email UNIQUE (household_id, email),
+  FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS lists (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(36) NOT NULL,
+  household_id INTEGER NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  CONSTRAINT lists_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS items (
+  id SERIAL PRIMARY KEY,
+  name CITEXT NOT NULL,
+  price BIGINT NOT NULL DEFAULT 0,
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  category VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(36) NOT NULL,
+  household_id INTEGER NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  CONSTRAINT items_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS basket (
+  id SERIAL PRIMARY KEY,
+  purchased BOOLEAN NOT NULL DEFAULT false,
+  quantity INTEGER NOT NULL DEFAULT 1,
+  unit VARCHAR(32) NOT NULL DEFAULT '',
+  store VARCHAR(64) NOT NULL DEFAULT '',
+  note VARCHAR(255) NOT NULL DEFAULT '',
+  user_id VARCHAR(36) NOT NULL,
+  household_id INTEGER NOT NULL,
+  list_id INTEGER NOT NULL,
+  item_id INTEGER NOT NULL,
+  CONSTRAINT basket_uc_list_item UNIQUE (list_id, item_id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  CONSTRAINT basket_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  CONSTRAINT basket_fk_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+  FOREIGN KEY (item_id) REFERENCES items(id)
+);
+
+CREATE TABLE IF NOT EXISTS trips (
+  id SERIAL PRIMARY KEY,
+  household_id INTEGER NOT NULL,
+  list_id INTEGER,
+  list_name VARCHAR(255) NOT NULL,
+  store VARCHAR(64) NOT NULL DEFAULT '',
+  total BIGINT NOT NULL DEFAULT 0,
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  finished_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(36) NOT NULL,
+  CONSTRAINT trips_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  CONSTRAINT trips_fk_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE SET NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS trip_items (
+  id SERIAL PRIMARY KEY,
+  trip_id INTEGER NOT NULL,
+  item_id INTEGER,
+  name VARCHAR(255) NOT NULL,
+  quantity INTEGER NOT NULL DEFAULT 1,
+  unit VARCHAR(32) NOT NULL DEFAULT '',
+  price BIGINT NOT NULL DEFAULT 0,
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  store VARCHAR(64) NOT NULL DEFAULT '',
+  note VARCHAR(255) NOT NULL DEFAULT '',
+  CONSTRAINT trip_items_fk_trip FOREIGN KEY (trip_id) REFERENCES trips(id) ON DELETE CASCADE,
+  CONSTRAINT trip_items_fk_item FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS purchases (
+  id SERIAL PRIMARY KEY,
+  household_id INTEGER NOT NULL,
+  item_id INTEGER NOT NULL,
+  basket_id INTEGER,
+  price BIGINT NOT NULL DEFAULT 0,
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  quantity INTEGER NOT NULL DEFAULT 1,
+  purchased_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(36) NOT NULL,
+  CONSTRAINT purchases_fk_household FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+  CONSTRAINT purchases_fk_item FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+  CONSTRAINT purchases_fk_basket FOREIGN KEY (basket_id) REFERENCES basket(id) ON DELETE SET NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS purchases_idx_item ON purchases (item_id, purchased_at);
+
+CREATE TABLE IF NOT EXISTS item_prices (
+  id SERIAL PRIMARY KEY,
+  item_id INTEGER NOT NULL,
+  purchase_id INTEGER,
+  price BIGINT NOT NULL,
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  source VARCHAR(16) NOT NULL,
+  recorded_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT item_prices_fk_item FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+  CONSTRAINT item_prices_fk_purchase FOREIGN KEY (purchase_id) REFERENCES purchases(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_prices_idx_item ON item_prices (item_id, recorded_at);
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD session_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS password_resets (
+  id SERIAL PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMPTZ NOT NULL,
+  CONSTRAINT password_resets_uc_token_hash UNIQUE (token_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
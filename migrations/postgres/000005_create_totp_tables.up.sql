@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS totp_secrets (
+  user_id VARCHAR(36) PRIMARY KEY,
+  secret VARCHAR(255) NOT NULL,
+  enabled_at TIMESTAMPTZ NULL,
+  last_step BIGINT NOT NULL DEFAULT 0,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id SERIAL PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  code_hash CHAR(64) NOT NULL,
+  CONSTRAINT recovery_codes_uc_user_code UNIQUE (user_id, code_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
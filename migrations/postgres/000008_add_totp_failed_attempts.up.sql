@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets ADD failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE totp_secrets ADD failed_at TIMESTAMPTZ NULL;
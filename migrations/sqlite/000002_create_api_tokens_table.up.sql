@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id VARCHAR(36) NOT NULL,
+  household_id INTEGER NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  scope VARCHAR(16) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP,
+  last_used_at TIMESTAMP,
+  CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS credentials (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id VARCHAR(36) NOT NULL,
+  credential_id VARCHAR(255) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  data TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_used_at TIMESTAMP,
+  CONSTRAINT credentials_uc_credential_id UNIQUE (credential_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE users ADD passkey_required BOOLEAN NOT NULL DEFAULT false;
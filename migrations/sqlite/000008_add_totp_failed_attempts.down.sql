@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets DROP COLUMN failed_at;
+ALTER TABLE totp_secrets DROP COLUMN failed_attempts;
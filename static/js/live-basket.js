@@ -0,0 +1,25 @@
+const listId = document.currentScript.dataset.list;
+
+function connectBasket(attempt) {
+    const protocol = location.protocol === "https:" ? "wss:" : "ws:";
+    const socket = new WebSocket(`${protocol}//${location.host}/lists/${listId}/events`);
+
+    socket.onopen = () => {
+        if (attempt > 0) {
+            htmx.trigger(document.body, "basket-changed");
+        }
+        attempt = 0;
+    };
+
+    socket.onmessage = () => {
+        htmx.trigger(document.body, "basket-changed");
+    };
+
+    socket.onclose = () => {
+        const delay = Math.min(30000, 1000 * 2 ** attempt);
+        console.debug(`Basket events closed. Reconnecting in ${delay}ms`);
+        setTimeout(() => connectBasket(attempt + 1), delay);
+    };
+}
+
+connectBasket(0);
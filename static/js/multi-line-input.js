@@ -0,0 +1,15 @@
+// Enter adds the items while shift+enter starts a new line, and the box grows
+// to fit pasted lists. Listeners are on the document so they survive htmx
+// swapping the form out.
+document.addEventListener("keydown", (e) => {
+    if (e.target.id === "item" && e.key === "Enter" && !e.shiftKey) {
+        e.preventDefault();
+        e.target.form.requestSubmit();
+    }
+});
+
+document.addEventListener("input", (e) => {
+    if (e.target.id === "item") {
+        e.target.rows = Math.min(e.target.value.split("\n").length, 8);
+    }
+});
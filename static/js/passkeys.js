@@ -0,0 +1,132 @@
+// Passkeys are created and used through navigator.credentials, which works
+// with ArrayBuffers where the server sends and expects base64url strings.
+// Pages swapped in by htmx load this again, so the listeners are only added
+// once and find their elements when clicked.
+
+function toBuffer(base64url) {
+    const base64 = base64url.replace(/-/g, "+").replace(/_/g, "/");
+    const binary = atob(base64.padEnd(base64.length + (4 - base64.length % 4) % 4, "="));
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+}
+
+function toBase64url(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function credentialJSON(credential) {
+    const response = {
+        clientDataJSON: toBase64url(credential.response.clientDataJSON),
+    };
+    if (credential.response.attestationObject) {
+        response.attestationObject = toBase64url(credential.response.attestationObject);
+        response.transports = credential.response.getTransports ? credential.response.getTransports() : [];
+    } else {
+        response.authenticatorData = toBase64url(credential.response.authenticatorData);
+        response.signature = toBase64url(credential.response.signature);
+        if (credential.response.userHandle) {
+            response.userHandle = toBase64url(credential.response.userHandle);
+        }
+    }
+    return JSON.stringify({
+        id: credential.id,
+        rawId: toBase64url(credential.rawId),
+        type: credential.type,
+        authenticatorAttachment: credential.authenticatorAttachment,
+        clientExtensionResults: credential.getClientExtensionResults(),
+        response: response,
+    });
+}
+
+function showPasskeyError(message) {
+    const error = document.getElementById("passkey-error");
+    if (error) {
+        error.textContent = message;
+    }
+}
+
+async function logInWithPasskey() {
+    showPasskeyError("");
+    const begin = await fetch("/login/passkey/begin", { method: "POST" });
+    const options = await begin.json();
+    if (!begin.ok) {
+        showPasskeyError(options.error);
+        return;
+    }
+    options.publicKey.challenge = toBuffer(options.publicKey.challenge);
+    for (const allowed of options.publicKey.allowCredentials || []) {
+        allowed.id = toBuffer(allowed.id);
+    }
+
+    let credential;
+    try {
+        credential = await navigator.credentials.get(options);
+    } catch (err) {
+        console.debug("Passkey login cancelled", err);
+        showPasskeyError("No passkey was used");
+        return;
+    }
+    const finish = await fetch("/login/passkey", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: credentialJSON(credential),
+    });
+    const result = await finish.json();
+    if (!finish.ok) {
+        showPasskeyError(result.error);
+        return;
+    }
+    window.location.assign(result.redirect);
+}
+
+async function registerPasskey(form) {
+    showPasskeyError("");
+    const begin = await fetch("/account/passkeys/begin", { method: "POST", body: new FormData(form) });
+    const options = await begin.json();
+    if (!begin.ok) {
+        showPasskeyError(options.error);
+        return;
+    }
+    options.publicKey.challenge = toBuffer(options.publicKey.challenge);
+    options.publicKey.user.id = toBuffer(options.publicKey.user.id);
+    for (const excluded of options.publicKey.excludeCredentials || []) {
+        excluded.id = toBuffer(excluded.id);
+    }
+
+    let credential;
+    try {
+        credential = await navigator.credentials.create(options);
+    } catch (err) {
+        console.debug("Passkey registration cancelled", err);
+        showPasskeyError(err.name === "InvalidStateError" ? "This device already has a passkey for your account" : "No passkey was added");
+        return;
+    }
+    const finish = await fetch("/account/passkeys", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: credentialJSON(credential),
+    });
+    const page = new DOMParser().parseFromString(await finish.text(), "text/html");
+    const account = page.getElementById("account");
+    document.getElementById("account").replaceWith(account);
+    htmx.process(account);
+}
+
+if (!window.passkeysLoaded) {
+    window.passkeysLoaded = true;
+
+    document.addEventListener("click", event => {
+        if (event.target.closest("[data-passkey-login]")) {
+            event.preventDefault();
+            logInWithPasskey();
+        }
+    });
+
+    document.addEventListener("submit", event => {
+        const form = event.target.closest("[data-passkey-register]");
+        if (form) {
+            event.preventDefault();
+            registerPasskey(form);
+        }
+    });
+}